@@ -0,0 +1,83 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// requireAdmin only lets requests carrying "Authorization: Bearer <token>" with
+// the configured admin token through. Admin routes are disabled when no token
+// is configured.
+func (h *handlers) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.cfg.adminToken == "" {
+			foundation.Respond(w, http.StatusForbidden, newErrResp("admin API disabled"))
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			foundation.Respond(w, http.StatusUnauthorized, newErrResp(http.StatusText(http.StatusUnauthorized)))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pauseHandler pauses or resumes measurement processing in the grid loop.
+func (h *handlers) pauseHandler(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		events := getStateEvents(ctx)
+		if events == nil {
+			foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+			return
+		}
+
+		resp := make(chan business.PauseStatus, 1)
+		status, ok := query(ctx, w, events, business.PauseUpdate{Paused: paused, Reply: resp}, resp)
+		if !ok {
+			return
+		}
+
+		foundation.Respond(w, http.StatusOK, struct {
+			Paused   bool `json:"paused"`
+			Buffered int  `json:"buffered"`
+			Drained  int  `json:"drained"`
+		}{
+			Paused:   status.Paused,
+			Buffered: status.Buffered,
+			Drained:  status.Drained,
+		})
+	}
+}
+
+// recomputeHandler rebuilds the islands of the current graph without
+// re-posting it, and returns them in the shape of POST /graph.
+func (h *handlers) recomputeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	resp := make(chan [][]string, 1)
+	islands, ok := query(ctx, w, events, business.RecomputeIslands{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	foundation.Respond(w, http.StatusOK, struct {
+		Islands [][]string `json:"islands"`
+	}{
+		Islands: islands,
+	})
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestAdminRoutesRequireToken(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		auth       string
+		wantStatus int
+	}{
+		{name: "disabled without configured token", auth: "Bearer secret", wantStatus: http.StatusForbidden},
+		{name: "missing token", opts: []Option{WithAdminToken("secret")}, wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", opts: []Option{WithAdminToken("secret")}, auth: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "valid token", opts: []Option{WithAdminToken("secret")}, auth: "Bearer secret", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			events := make(chan business.Event, 16)
+			go business.NewGrid().Loop(ctx, events)
+			t.Cleanup(func() { close(events) })
+
+			h := foundation.WrapMiddleware(All(tt.opts...), GridEventsMiddleware(events))
+			if got := adminRequest(t, h, "/admin/pause", tt.auth).Code; got != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPauseRejectsMeasurements(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(WithAdminToken("secret")), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{"nodes": []string{"A"}, "edges": [][]string{}}, nil)
+	adminRequest(t, h, "/admin/pause", "Bearer secret")
+
+	if status := postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 1}, nil); status != http.StatusServiceUnavailable {
+		t.Fatalf("status while paused = %d, want %d", status, http.StatusServiceUnavailable)
+	}
+
+	adminRequest(t, h, "/admin/resume", "Bearer secret")
+
+	if status := postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 1}, nil); status != http.StatusOK {
+		t.Fatalf("status after resume = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestPauseBuffersThenResumeDrains(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid(business.WithPauseBuffer(8)).Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(WithAdminToken("secret")), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{"nodes": []string{"A", "B"}, "edges": [][]string{{"A", "B"}}}, nil)
+	adminRequest(t, h, "/admin/pause", "Bearer secret")
+
+	var totals []business.IslandMeasurement
+	status := postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 4}, &totals)
+	if status != http.StatusAccepted {
+		t.Fatalf("status while paused = %d, want %d", status, http.StatusAccepted)
+	}
+	if totals[0].Total != 0 {
+		t.Fatalf("total while paused = %v, want 0", totals[0].Total)
+	}
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 6}, nil)
+
+	rr := adminRequest(t, h, "/admin/resume", "Bearer secret")
+	var resumed struct {
+		Paused  bool `json:"paused"`
+		Drained int  `json:"drained"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resumed); err != nil {
+		t.Fatalf("decode resume response: %v", err)
+	}
+	if resumed.Paused || resumed.Drained != 2 {
+		t.Fatalf("resume response = %+v, want unpaused with 2 drained", resumed)
+	}
+
+	// Probe with a node outside the graph to read the totals.
+	postJSON(t, h, "/measurements", map[string]any{"node": "", "value": 0}, &totals)
+	if !floatEqual(totals[0].Total, 10) {
+		t.Fatalf("total after resume = %v, want 10", totals[0].Total)
+	}
+}
+
+func TestAdminRecompute(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(WithAdminToken("secret")), GridEventsMiddleware(events))
+
+	var posted struct {
+		Islands [][]string `json:"islands"`
+	}
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, &posted)
+
+	if got := adminRequest(t, h, "/admin/recompute", "").Code; got != http.StatusUnauthorized {
+		t.Fatalf("status without token = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	rr := adminRequest(t, h, "/admin/recompute", "Bearer secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var got struct {
+		Islands [][]string `json:"islands"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !islandsEqual(got.Islands, posted.Islands) {
+		t.Fatalf("recomputed islands = %v, want %v", got.Islands, posted.Islands)
+	}
+}
+
+func adminRequest(t *testing.T, h http.Handler, path, auth string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.test"+path, bytes.NewReader(nil))
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGraphRejectedWhileMeasurementsQueued(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	grid := business.NewGrid(business.WithPauseBuffer(8), business.WithGraphUpdatePolicy(business.RejectGraphWhilePending))
+	go grid.Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(WithAdminToken("secret")), GridEventsMiddleware(events))
+
+	graph := map[string]any{"nodes": []string{"A", "B"}, "edges": [][]string{{"A", "B"}}}
+	postJSON(t, h, "/graph", graph, nil)
+	adminRequest(t, h, "/admin/pause", "Bearer secret")
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 4}, nil)
+
+	if status := postJSON(t, h, "/graph", graph, nil); status != http.StatusConflict {
+		t.Fatalf("graph status while queued = %d, want %d", status, http.StatusConflict)
+	}
+
+	adminRequest(t, h, "/admin/resume", "Bearer secret")
+	if status := postJSON(t, h, "/graph", graph, nil); status != http.StatusOK {
+		t.Fatalf("graph status after resume = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestGraphRejectedWhileMeasurementsBuffered(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		policy business.GraphUpdatePolicy
+		want   int
+	}{
+		{name: "accepted by default", policy: business.AcceptGraphUpdates, want: http.StatusOK},
+		{name: "rejected while queued", policy: business.RejectGraphWhilePending, want: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			backlog := &business.MeasurementBacklog{}
+			events := make(chan business.Event, 16)
+			grid := business.NewGrid(business.WithGraphUpdatePolicy(tt.policy), business.WithMeasurementBacklog(backlog))
+			h := foundation.WrapMiddleware(All(WithMeasurementBacklog(backlog)), GridEventsMiddleware(events))
+
+			// Both requests queue before the loop starts, the graph first.
+			graph := map[string]any{"nodes": []string{"A", "B"}, "edges": [][]string{{"A", "B"}}}
+			graphStatus := make(chan int, 1)
+			go func() { graphStatus <- postJSON(t, h, "/graph", graph, nil) }()
+			waitQueued(t, events, 1)
+			measured := make(chan int, 1)
+			go func() { measured <- postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 4}, nil) }()
+			waitQueued(t, events, 2)
+			if n := backlog.Len(); n != 1 {
+				t.Fatalf("backlog = %d, want the queued measurement", n)
+			}
+
+			go grid.Loop(ctx, events)
+			if status := <-graphStatus; status != tt.want {
+				t.Fatalf("graph status = %d, want %d", status, tt.want)
+			}
+			if status := <-measured; status != http.StatusOK {
+				t.Fatalf("measurement status = %d, want %d", status, http.StatusOK)
+			}
+		})
+	}
+}
+
+// waitQueued waits until events holds n events.
+func waitQueued(t *testing.T, events chan business.Event, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(events) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d events queued, want %d", len(events), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -1,31 +1,117 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
-	"time"
+	"net/http/pprof"
+	"strconv"
 	"zgrid/business"
 	"zgrid/foundation"
 )
 
-const backpressureTimeout = 20 * time.Millisecond
-
 // All registers all HTTP routes for the grid service.
-func All() *http.ServeMux {
+func All(opts ...Option) *http.ServeMux {
+	h := &handlers{cfg: newConfig(opts...)}
+
 	mux := http.NewServeMux()
+	rt := newRoutes(mux)
+
+	// Nil without API keys, leaving the routes it guards open.
+	requireKey := h.cfg.requireAPIKey()
+
+	// Only routes that decode a JSON body use jsonBodyRoute; the others accept
+	// any Content-Type, since they never read one.
+	rt.readRoute(livenessPath, h.healthzHandler)
+
+	rt.noBodyRoute("/readyz", http.MethodGet, h.readyzHandler)
+
+	rt.bodyRoute("/graph", http.MethodPost, []string{"application/json", csvContentType}, h.graphHandler, requireKey, negotiateVersion)
+	rt.jsonBodyRoute("PATCH /graph", http.MethodPatch, h.graphPatchHandler, requireKey)
+
+	rt.jsonBodyRoute("/graph/simulate-cut", http.MethodPost, h.simulateCutHandler, negotiateVersion)
+
+	rt.noBodyRoute("/graph/edges", http.MethodGet, h.graphEdgesHandler)
+
+	rt.noBodyRoute("/graph.dot", http.MethodGet, h.graphDotHandler)
+
+	rt.noBodyRoute("/graph/nodes/{node}", http.MethodDelete, h.nodeRemoveHandler, requireKey)
+
+	rt.jsonBodyRoute("/measurements", http.MethodPost, h.measurementsHandler, negotiateVersion)
+
+	// Method-qualified patterns take precedence over the plain one above.
+	rt.handle("DELETE /measurements", foundation.WrapMiddleware(http.HandlerFunc(h.clearMeasurementsHandler), requireKey))
+	rt.noBodyRoute("/measurements/clear", http.MethodPost, h.clearMeasurementsHandler, requireKey)
+	rt.readRoute("GET /measurements", h.totalsHandler)
+
+	rt.readRoute("/version", h.stateVersionHandler)
+
+	rt.noBodyRoute("/reset", http.MethodPost, h.resetHandler, requireKey)
+
+	rt.jsonBodyRoute("/snapshot", http.MethodPost, h.snapshotRestoreHandler, requireKey)
+	rt.handle("GET /snapshot", http.HandlerFunc(h.snapshotHandler))
+
+	rt.jsonBodyRoute("/nodes/exists", http.MethodPost, h.nodesExistHandler, negotiateVersion)
+
+	rt.noBodyRoute("/nodes/{node}", http.MethodGet, h.nodeDetailHandler)
+	rt.noBodyRoute("/nodes/{node}/history", http.MethodGet, h.nodeHistoryHandler)
+
+	rt.noBodyRoute("/events/measurements", http.MethodGet, h.measurementEventsHandler)
+
+	rt.noBodyRoute("/ws", http.MethodGet, h.wsHandler)
+
+	rt.jsonBodyRoute("/nodes/{node}/cas", http.MethodPost, h.nodeCASHandler)
+
+	rt.readRoute("/islands", h.islandsHandler)
+
+	rt.noBodyRoute("/islands/by-node/{node}", http.MethodGet, h.islandByNodeHandler)
+
+	rt.noBodyRoute("/islands/metrics", http.MethodGet, h.islandMetricsHandler)
+
+	rt.noBodyRoute("/hotspot", http.MethodGet, h.hotspotHandler)
 
-	mux.Handle("/graph", foundation.WrapMiddleware(http.HandlerFunc(graphHandler),
-		foundation.RequireMethod(http.MethodPost),
-		foundation.RequireJSONContentType,
-	))
-	mux.Handle("/measurements", foundation.WrapMiddleware(http.HandlerFunc(measurementsHandler),
-		foundation.RequireMethod(http.MethodPost),
-		foundation.RequireJSONContentType,
-	))
+	rt.noBodyRoute("/islands/coverage", http.MethodGet, h.islandCoverageHandler)
+
+	rt.noBodyRoute("/islands/peaks", http.MethodGet, h.islandPeaksHandler)
+
+	rt.noBodyRoute("/islands/namespaces", http.MethodGet, h.islandNamespacesHandler)
+
+	rt.noBodyRoute("/admin/pause", http.MethodPost, h.pauseHandler(true), h.requireAdmin)
+
+	rt.noBodyRoute("/admin/resume", http.MethodPost, h.pauseHandler(false), h.requireAdmin)
+
+	rt.noBodyRoute("/admin/recompute", http.MethodPost, h.recomputeHandler, h.requireAdmin)
+
+	rt.noBodyRoute("/stats/density", http.MethodGet, h.densityHandler)
+
+	if h.cfg.latency != nil {
+		rt.noBodyRoute("/stats/latency", http.MethodGet, h.latencyHandler)
+	}
+
+	if h.cfg.pprof {
+		// The profiling handlers serve GET requests without a JSON body, so they
+		// skip the method and content-type middlewares.
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	if h.cfg.metrics != nil {
+		rt.noBodyRoute(metricsPath, http.MethodGet, h.cfg.metrics.handler().ServeHTTP)
+
+		// Every request goes through the instrumented routes above, which then
+		// know the pattern it matched.
+		instrumented := http.NewServeMux()
+		instrumented.Handle("/", h.cfg.metrics.instrument(mux))
+		return instrumented
+	}
 
 	return mux
 }
 
-func graphHandler(w http.ResponseWriter, r *http.Request) {
+func (h *handlers) graphHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	events := getStateEvents(ctx)
@@ -38,12 +124,45 @@ func graphHandler(w http.ResponseWriter, r *http.Request) {
 	// Validate Request
 
 	type graphPayload struct {
-		Nodes []string `json:"nodes"`
-		Edges []Edge   `json:"edges"`
+		Nodes      []string                    `json:"nodes"`
+		Edges      []Edge                      `json:"edges"`
+		Roles      map[string]string           `json:"roles"`
+		Transforms map[string]transformPayload `json:"transforms"`
+		Aliases    map[string]string           `json:"aliases"`
+		Root       string                      `json:"root"`
+		Directed   bool                        `json:"directed"`
+		Strict     bool                        `json:"strict"`
 	}
-	payload, err := foundation.Decode[graphPayload](w, r)
+	strict, err := parseStrict(r)
 	if err != nil {
-		foundation.Respond(w, http.StatusBadRequest, newErrResp("invalid graph payload"))
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+		return
+	}
+
+	var payload graphPayload
+	if isCSV(r) {
+		nodes, edges, err := decodeGraphCSV(w, r)
+		if err != nil {
+			h.respondDecodeError(w, r, err, "invalid graph CSV")
+			return
+		}
+		payload.Nodes, payload.Edges = nodes, edges
+	} else if payload, err = foundation.Decode[graphPayload](w, r); err != nil {
+		h.respondDecodeError(w, r, err, "invalid graph payload")
+		return
+	}
+
+	// Decoding cannot tell null from a missing field: both leave a nil slice,
+	// while an explicit [] decodes to an empty one. Edges are left nil, i.e.
+	// none, as a graph of isolated nodes legitimately omits them.
+	if h.cfg.nullArrays == RejectNullArrays && payload.Nodes == nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp("nodes is required"))
+		return
+	}
+
+	roles, err := parseRoles(payload.Roles)
+	if err != nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
 		return
 	}
 
@@ -51,13 +170,78 @@ func graphHandler(w http.ResponseWriter, r *http.Request) {
 	// Process Request
 
 	edges := make([][]string, len(payload.Edges))
+	var weights map[[2]string]float64
 	for i, edge := range payload.Edges {
-		// Edge is a JSON array of exactly 2 node IDs; convert to []string without copying.
-		edges[i] = []string(edge)
+		// Edge holds exactly 2 node IDs; use them without copying.
+		edges[i] = edge.Nodes
+		if edge.Weight != nil {
+			if weights == nil {
+				weights = map[[2]string]float64{}
+			}
+			key := [2]string{edge.Nodes[0], edge.Nodes[1]}
+			if !payload.Directed && key[1] < key[0] {
+				// Both ways round are the same undirected edge.
+				key[0], key[1] = key[1], key[0]
+			}
+			weights[key] = *edge.Weight
+		}
+	}
+	graph, diag := business.BuildGraph(payload.Nodes, edges, payload.Directed)
+	if (strict || payload.Strict) && len(diag.Unknown) > 0 {
+		foundation.Respond(w, http.StatusBadRequest, struct {
+			errorResponse
+			Edges [][]string `json:"edges"`
+		}{
+			errorResponse: foundation.NewErrorResponse(w, "edges reference unknown nodes"),
+			Edges:         diag.Unknown,
+		})
+		return
+	}
+	if transforms, aliases := unknownGraphNodes(graph.Nodes, payload.Transforms, payload.Aliases); len(transforms) > 0 || len(aliases) > 0 {
+		foundation.Respond(w, http.StatusBadRequest, struct {
+			errorResponse
+			Transforms []string `json:"transforms,omitempty"`
+			Aliases    []string `json:"aliases,omitempty"`
+		}{
+			errorResponse: foundation.NewErrorResponse(w, "transforms or aliases reference unknown nodes"),
+			Transforms:    transforms,
+			Aliases:       aliases,
+		})
+		return
+	}
+	transforms, err := parseTransforms(payload.Transforms)
+	if err != nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+		return
 	}
-	graph := business.NewGraph(payload.Nodes, edges)
+	graph.Roles = roles
+	graph.Transforms = transforms
+	graph.Aliases = payload.Aliases
+	graph.Weights = weights
 
-	resp := make(chan [][]string, 1)
+	root := payload.Root
+	if root == "" {
+		root = h.cfg.root
+	}
+	if root != "" {
+		unreachable, ok := graph.Unreachable(root)
+		if !ok {
+			foundation.Respond(w, http.StatusBadRequest, newErrResp(fmt.Sprintf("root %q is not a graph node", root)))
+			return
+		}
+		if len(unreachable) > 0 {
+			foundation.Respond(w, http.StatusBadRequest, struct {
+				errorResponse
+				Unreachable []string `json:"unreachable"`
+			}{
+				errorResponse: foundation.NewErrorResponse(w, fmt.Sprintf("nodes unreachable from root %q", root)),
+				Unreachable:   unreachable,
+			})
+			return
+		}
+	}
+
+	resp := make(chan business.GraphResult, 1)
 	updateEvent := business.GraphUpdate{
 		Graph: graph,
 		Reply: resp,
@@ -71,23 +255,50 @@ func graphHandler(w http.ResponseWriter, r *http.Request) {
 		// Wait for the recomputation result; measurements queued during this time
 		// will be processed once the graph update completes.
 		select {
-		case islands := <-resp:
-			foundation.Respond(w, http.StatusOK, struct {
-				Islands [][]string `json:"islands"`
-			}{
-				Islands: islands,
-			})
+		case res := <-resp:
+			if res.Err == nil {
+				w.Header().Set("X-State-Version", strconv.FormatUint(res.Version, 10))
+			}
+			switch {
+			case errors.Is(res.Err, business.ErrMeasurementsPending):
+				foundation.Respond(w, http.StatusConflict, newErrResp(res.Err.Error()))
+			case res.Err != nil:
+				foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+			case res.Degraded:
+				// The new graph is applied once its islands are computed in the
+				// background; until then the previous islands stay in effect.
+				foundation.Respond(w, http.StatusAccepted, struct {
+					Islands  [][]string     `json:"islands"`
+					Degraded bool           `json:"degraded"`
+					Warnings *graphWarnings `json:"warnings,omitempty"`
+				}{
+					Islands:  res.Islands,
+					Degraded: true,
+					Warnings: newGraphWarnings(diag),
+				})
+			default:
+				foundation.Respond(w, http.StatusOK, struct {
+					Islands  [][]string     `json:"islands"`
+					Warnings *graphWarnings `json:"warnings,omitempty"`
+				}{
+					Islands:  res.Islands,
+					Warnings: newGraphWarnings(diag),
+				})
+			}
 		case <-ctx.Done():
 			foundation.Respond(w, http.StatusRequestTimeout, newErrResp(http.StatusText(http.StatusRequestTimeout)))
 			return
 		}
+	case <-h.cfg.busy():
+		h.cfg.respondBusy(w)
+		return
 	case <-ctx.Done():
 		foundation.Respond(w, http.StatusRequestTimeout, newErrResp(http.StatusText(http.StatusRequestTimeout)))
 		return
 	}
 }
 
-func measurementsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *handlers) measurementsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	events := getStateEvents(ctx)
@@ -99,50 +310,248 @@ func measurementsHandler(w http.ResponseWriter, r *http.Request) {
 	// ----------------------------------------------------------------------------
 	// Validate Request
 
-	type measurementsPayload struct {
-		Node  string  `json:"node"`
-		Value float64 `json:"value"`
+	format, err := parseTotalsFormat(r)
+	if err != nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+		return
+	}
+
+	echo, err := parseEcho(r)
+	if err != nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+		return
 	}
-	measurement, err := foundation.Decode[measurementsPayload](w, r)
+
+	envelope, err := parseEnvelope(r)
 	if err != nil {
-		foundation.Respond(w, http.StatusBadRequest, newErrResp("invalid measurement payload"))
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+		return
+	}
+	if echo && envelope {
+		// The echoed body already tells whether the totals changed.
+		foundation.Respond(w, http.StatusBadRequest, newErrResp("echo and envelope cannot be combined"))
 		return
 	}
 
+	measurements, batch, err := decodeMeasurements(w, r)
+	if err != nil {
+		h.respondDecodeError(w, r, err, "invalid measurement payload")
+		return
+	}
+	if batch {
+		if echo {
+			foundation.Respond(w, http.StatusBadRequest, newErrResp("echo is not supported for a batch of measurements"))
+			return
+		}
+		h.sendMeasurementBatch(ctx, w, events, measurements, format, envelope)
+		return
+	}
+	measurement := measurements[0]
+
 	// ----------------------------------------------------------------------------
 	// Process Request
 
-	resp := make(chan []business.IslandMeasurement, 1)
+	resp := make(chan business.MeasurementResult, 1)
 	// If a node not present in the graph is sent anyway to avoid coupling and locking
 	updateEvent := business.MeasurementUpdate{
-		NodeMeasurement: business.NodeMeasurement{
-			Node:  measurement.Node,
-			Value: measurement.Value,
-		},
-		Reply: resp,
+		NodeMeasurement: measurement,
+		Reply:           resp,
 	}
 
 	// ----------------------------------------------------------------------------
 	// Send Response
 
+	h.cfg.backlog.Add(1)
 	select {
 	case events <- updateEvent:
 		select {
-		case totals := <-resp:
-			foundation.Respond(w, http.StatusOK, totals)
+		case res := <-resp:
+			var body any = present(format, res.Totals)
+			switch {
+			case echo:
+				body = echoedTotals{
+					Accepted: acceptedMeasurement{Node: measurement.Node, Value: measurement.Value, Applied: res.Applied, Changed: res.Changed},
+					Totals:   present(format, res.Totals),
+				}
+			case envelope:
+				body = envelopedTotals{Changed: res.Changed, Totals: present(format, res.Totals)}
+			}
+
+			switch {
+			case errors.Is(res.Err, business.ErrEventPanicked):
+				foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+			case res.Err != nil:
+				foundation.Respond(w, http.StatusServiceUnavailable, newErrResp(res.Err.Error()))
+			case res.Queued:
+				// Held while paused; totals do not include it yet.
+				foundation.Respond(w, http.StatusAccepted, body)
+			default:
+				// Lets clients skip downstream work for updates that left
+				// every total as it was.
+				w.Header().Set("X-Totals-Changed", strconv.FormatBool(res.Changed))
+				w.Header().Set("X-State-Version", strconv.FormatUint(res.Version, 10))
+				foundation.Respond(w, http.StatusOK, body)
+			}
 		case <-ctx.Done():
 			foundation.Respond(w, http.StatusRequestTimeout, newErrResp(http.StatusText(http.StatusRequestTimeout)))
 			return
 		}
-	// NOTE: In a real system, you might want to implement backpressure or rate-limiting
-	// to avoid overwhelming the event processing loop.
-	// Here we just show how it could be done, returning a 429 Too Many Requests status,
-	// we could also send a Retry-After header.
-	case <-time.After(backpressureTimeout):
-		foundation.Respond(w, http.StatusTooManyRequests, newErrResp("server busy, try again"))
+	// Backpressure: rather than queueing without bound behind a busy loop, the
+	// client is told to retry, with a Retry-After header.
+	case <-h.cfg.busy():
+		h.cfg.backlog.Add(-1)
+		h.cfg.respondBusy(w)
 		return
 	case <-ctx.Done():
+		h.cfg.backlog.Add(-1)
 		foundation.Respond(w, http.StatusRequestTimeout, newErrResp(http.StatusText(http.StatusRequestTimeout)))
 		return
 	}
 }
+
+// clearMeasurementsHandler drops all measurements but keeps the topology, to
+// start a fresh measurement window without re-posting the graph.
+func (h *handlers) clearMeasurementsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	format, err := parseTotalsFormat(r)
+	if err != nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan []business.IslandMeasurement, 1)
+	totals, ok := query(ctx, w, events, business.ClearMeasurements{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	foundation.Respond(w, http.StatusOK, present(format, totals))
+}
+
+// resetHandler drops the graph and every measurement, so tests and demos can
+// start over without restarting the server.
+func (h *handlers) resetHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan struct{}, 1)
+	if _, ok := query(ctx, w, events, business.ResetEvent{Reply: resp}, resp); !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// totalsHandler returns the current totals, or with ?version=V the totals right
+// after state version V while it is retained. The version is reported in the
+// X-State-Version header.
+func (h *handlers) totalsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	format, err := parseTotalsFormat(r)
+	if err != nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+		return
+	}
+
+	evt := business.TotalsAtQuery{Latest: true}
+	if raw := r.URL.Query().Get("version"); raw != "" {
+		version, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			foundation.Respond(w, http.StatusBadRequest, newErrResp(fmt.Sprintf("invalid version=%q: want a non-negative integer", raw)))
+			return
+		}
+		evt = business.TotalsAtQuery{Version: version}
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.VersionedTotals, 1)
+	evt.Reply = resp
+	res, ok := queryOrBusy(ctx, w, h.cfg, events, evt, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	switch {
+	case errors.Is(res.Err, business.ErrVersionEvicted):
+		foundation.Respond(w, http.StatusGone, newErrResp(res.Err.Error()))
+	case errors.Is(res.Err, business.ErrVersionUnknown):
+		foundation.Respond(w, http.StatusNotFound, newErrResp(res.Err.Error()))
+	default:
+		w.Header().Set("X-State-Version", strconv.FormatUint(res.Version, 10))
+		foundation.Respond(w, http.StatusOK, present(format, res.Totals))
+	}
+}
+
+// stateVersionHandler returns the current state version, which every applied
+// change to the graph or the measurements advances, so clients can tell whether
+// they missed updates without fetching the totals.
+func (h *handlers) stateVersionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan uint64, 1)
+	version, ok := query(ctx, w, events, business.VersionQuery{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	w.Header().Set("X-State-Version", strconv.FormatUint(version, 10))
+	foundation.Respond(w, http.StatusOK, struct {
+		Version uint64 `json:"version"`
+	}{
+		Version: version,
+	})
+}
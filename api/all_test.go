@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -246,6 +249,124 @@ func TestGraphEndpointInvalidPayloadReturnsJSONError(t *testing.T) {
 	}
 }
 
+func TestErrorResponsesCarryRequestID(t *testing.T) {
+	t.Parallel()
+
+	h := foundation.WrapMiddleware(All(), foundation.WithRequestID, GridEventsMiddleware(make(chan business.Event)))
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", strings.NewReader(`{"nodes":["A"],"edges":[["A"]]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Id", "client-7")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if want := `{"error":"invalid graph payload","request_id":"client-7"}`; strings.TrimSpace(rr.Body.String()) != want {
+		t.Errorf("body = %s, want %s", rr.Body.String(), want)
+	}
+}
+
+func TestDecodeErrorMessages(t *testing.T) {
+	t.Parallel()
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(make(chan business.Event)))
+
+	tests := []struct {
+		name  string
+		path  string
+		body  string
+		want  string
+		field string
+	}{
+		{name: "unknown graph field", path: "/graph", body: `{"nodes":["A"],"edgess":[]}`, want: `invalid graph payload: unknown field "edgess"`, field: "edgess"},
+		{name: "unknown edge field", path: "/graph", body: `{"nodes":["A","B"],"edges":[{"from":"A","to":"B","wieght":2}]}`, want: `invalid graph payload: unknown field "wieght"`, field: "wieght"},
+		{name: "graph field of the wrong type", path: "/graph", body: `{"nodes":"A","edges":[]}`, want: `invalid graph payload: field "nodes" must be an array, not a string`, field: "nodes"},
+		{name: "graph syntax error", path: "/graph", body: `{"nodes":[A]}`, want: "invalid graph payload: invalid JSON at byte 11: invalid character 'A' looking for beginning of value"},
+		{name: "unknown measurement field", path: "/measurements", body: `{"node":"A","valeu":1}`, want: `invalid measurement payload: unknown field "valeu"`, field: "valeu"},
+		{name: "measurement field of the wrong type", path: "/measurements", body: `{"node":"A","value":"1"}`, want: `invalid measurement payload: field "value" must be a number, not a string`, field: "value"},
+		{name: "empty measurement body", path: "/measurements", body: ``, want: "request body is required"},
+		{name: "whitespace graph body", path: "/graph", body: " \n", want: "request body is required"},
+		{name: "batch field of the wrong type", path: "/measurements", body: `[{"node":1,"value":1}]`, want: `invalid measurement payload: field "0.node" must be a string, not a number`, field: "0.node"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.test"+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			var got struct {
+				Error string `json:"error"`
+				Field string `json:"field"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode %s: %v", rr.Body, err)
+			}
+			if rr.Code != http.StatusBadRequest || got.Error != tt.want || got.Field != tt.field {
+				t.Errorf("response = %d %+v, want 400 with error %q and field %q", rr.Code, got, tt.want, tt.field)
+			}
+		})
+	}
+}
+
+func TestOversizedBodyReturns413(t *testing.T) {
+	t.Parallel()
+
+	// Valid JSON of exactly size bytes, so only its size can reject it.
+	graph := func(size int) string {
+		return `{"nodes":["` + strings.Repeat("A", size-25) + `"],"edges":[]}`
+	}
+	measurement := func(size int) string {
+		return `{"node":"` + strings.Repeat("A", size-21) + `","value":1}`
+	}
+
+	tests := []struct {
+		name       string
+		limit      int64 // 0 keeps the default
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "graph just over the default limit", path: "/graph", body: graph(foundation.DefaultMaxBodySize + 1), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "graph at a raised limit", limit: 2 << 20, path: "/graph", body: graph(foundation.DefaultMaxBodySize + 1), wantStatus: http.StatusOK},
+		{name: "graph just over a lowered limit", limit: 64, path: "/graph", body: graph(65), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "graph at a lowered limit", limit: 64, path: "/graph", body: graph(64), wantStatus: http.StatusOK},
+		{name: "measurement just over the limit", limit: 64, path: "/measurements", body: measurement(65), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "measurement batch over the limit", limit: 64, path: "/measurements", body: "[" + measurement(64) + "]", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "malformed within the limit", limit: 64, path: "/graph", body: `{"nodes":`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			events := make(chan business.Event, 8)
+			go business.NewGrid().Loop(ctx, events)
+			var h http.Handler = foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+			if tt.limit > 0 {
+				h = foundation.MaxBodySize(tt.limit)(h)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.test"+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d (%s), want %d", rr.Code, rr.Body.String(), tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusRequestEntityTooLarge && !strings.Contains(rr.Body.String(), "request body exceeds the limit") {
+				t.Errorf("body = %s, want the size limit named", rr.Body.String())
+			}
+		})
+	}
+}
+
 func TestBackpressureReturns429WhenNoConsumer(t *testing.T) {
 	t.Parallel()
 
@@ -333,6 +454,24 @@ func postJSON(t *testing.T, h http.Handler, path string, payload any, out any) i
 	return rr.Code
 }
 
+func getJSON(t *testing.T, h http.Handler, path string, out any) int {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "http://example.test"+path, nil)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if out == nil {
+		return rr.Code
+	}
+
+	if err := json.NewDecoder(rr.Body).Decode(out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return rr.Code
+}
+
 func doRequest(t *testing.T, h http.Handler, method, path, contentType string, body any) int {
 	t.Helper()
 
@@ -398,3 +537,621 @@ func floatEqual(a, b float64) bool {
 	const eps = 1e-9
 	return math.Abs(a-b) <= eps
 }
+
+func TestGraphRoles(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	grid := business.NewGrid()
+	go grid.Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	status := postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{{"A", "B"}},
+		"roles": map[string]string{"A": "source", "B": "consumer"},
+	}, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("invalid role status = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{{"A", "B"}},
+		"roles": map[string]string{"B": "sink"},
+	}, nil)
+
+	var totals []business.IslandMeasurement
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 10}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 4}, &totals)
+	if len(totals) != 1 || !floatEqual(totals[0].Total, 6) {
+		t.Fatalf("totals = %v, want a single island netting to 6", totals)
+	}
+}
+
+func TestMeasurementsAtVersion(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid(business.WithHistoryDepth(2)).Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{"nodes": []string{"A"}, "edges": [][]string{}}, nil)
+
+	post := func(value float64) string {
+		req := httptest.NewRequest(http.MethodPost, "http://example.test/measurements", strings.NewReader(fmt.Sprintf(`{"node":"A","value":%v}`, value)))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Header().Get("X-State-Version")
+	}
+	first, second, third := post(1), post(2), post(3)
+
+	var totals []business.IslandMeasurement
+	if status := getJSON(t, h, "/measurements?version="+second, &totals); status != http.StatusOK {
+		t.Fatalf("recent version status = %d, want %d", status, http.StatusOK)
+	}
+	if len(totals) != 1 || !floatEqual(totals[0].Total, 2) {
+		t.Fatalf("totals at version %s = %v, want 2", second, totals)
+	}
+
+	if status := getJSON(t, h, "/measurements", &totals); status != http.StatusOK || !floatEqual(totals[0].Total, 3) {
+		t.Fatalf("current totals = %v (status %d), want 3", totals, status)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "current version", path: "/measurements?version=" + third, want: http.StatusOK},
+		{name: "evicted version", path: "/measurements?version=" + first, want: http.StatusGone},
+		{name: "future version", path: "/measurements?version=999", want: http.StatusNotFound},
+		{name: "invalid version", path: "/measurements?version=-1", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if status := getJSON(t, h, tt.path, nil); status != tt.want {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, tt.want)
+		}
+	}
+}
+
+func TestGraphTransforms(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+		"transforms": map[string]any{
+			"A": map[string]float64{"scale": 2, "offset": 1},
+			"B": map[string]float64{"offset": -3},
+		},
+	}, nil)
+
+	var totals []business.IslandMeasurement
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 10}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 4}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "C", "value": 5}, &totals)
+
+	// A: 10*2+1, B: 4*1-3, C: untransformed.
+	if len(totals) != 2 || !floatEqual(totals[0].Total, 22) || !floatEqual(totals[1].Total, 5) {
+		t.Fatalf("totals = %v, want 22 and 5", totals)
+	}
+}
+
+func TestParseTransformsRejectsNonFinite(t *testing.T) {
+	t.Parallel()
+
+	nan, inf := math.NaN(), math.Inf(1)
+	for _, raw := range []map[string]transformPayload{
+		{"A": {Scale: &nan}},
+		{"A": {Scale: &inf}},
+		{"A": {Offset: math.Inf(-1)}},
+	} {
+		if _, err := parseTransforms(raw); err == nil {
+			t.Errorf("parseTransforms(%v) succeeded, want an error", raw)
+		}
+	}
+
+	scale := 2.0
+	got, err := parseTransforms(map[string]transformPayload{"A": {Scale: &scale, Offset: 1}, "B": {}})
+	if err != nil {
+		t.Fatalf("parseTransforms: %v", err)
+	}
+	if want := map[string]business.Transform{"A": {Scale: 2, Offset: 1}, "B": {Scale: 1}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("transforms = %v, want %v", got, want)
+	}
+}
+
+func TestClearMeasurementsEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+
+	// Both routes clear the measurements.
+	for _, route := range []struct{ method, path string }{
+		{http.MethodDelete, "/measurements"},
+		{http.MethodPost, "/measurements/clear"},
+	} {
+		postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 2}, nil)
+		postJSON(t, h, "/measurements", map[string]any{"node": "C", "value": 3}, nil)
+
+		req := httptest.NewRequest(route.method, "http://example.test"+route.path, nil)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s %s status = %d, want %d", route.method, route.path, rr.Code, http.StatusOK)
+		}
+
+		var got []business.IslandMeasurement
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		wantIslands := [][]string{{"A", "B"}, {"C"}}
+		if len(got) != len(wantIslands) {
+			t.Fatalf("%s: totals = %v, want islands %v", route.path, got, wantIslands)
+		}
+		for i, m := range got {
+			if !islandsEqual([][]string{m.Island}, wantIslands[i:i+1]) || m.Total != 0 {
+				t.Fatalf("%s: totals = %v, want islands %v with zero totals", route.path, got, wantIslands)
+			}
+		}
+	}
+
+	// The topology is still there: a new measurement lands on its island.
+	var totals []business.IslandMeasurement
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 1}, &totals)
+	if len(totals) != 2 || !floatEqual(totals[0].Total, 1) || !floatEqual(totals[1].Total, 0) {
+		t.Fatalf("totals after clear = %v, want [1 0]", totals)
+	}
+}
+
+func TestResetEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 2}, nil)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "http://example.test/reset", nil))
+	if rr.Code != http.StatusNoContent || rr.Body.Len() != 0 {
+		t.Fatalf("POST /reset = %d %q, want %d without a body", rr.Code, rr.Body, http.StatusNoContent)
+	}
+
+	var totals []business.IslandMeasurement
+	if status := getJSON(t, h, "/measurements", &totals); status != http.StatusOK || len(totals) != 0 {
+		t.Fatalf("GET /measurements after reset = %d %v, want no islands", status, totals)
+	}
+	if status := getJSON(t, h, "/nodes/A", nil); status != http.StatusNotFound {
+		t.Fatalf("GET /nodes/A after reset status = %d, want %d", status, http.StatusNotFound)
+	}
+
+	// The old value does not come back with the graph.
+	postJSON(t, h, "/graph", map[string]any{"nodes": []string{"A", "B"}, "edges": [][]string{{"A", "B"}}}, nil)
+	if getJSON(t, h, "/measurements", &totals); len(totals) != 1 || totals[0].Total != 0 {
+		t.Fatalf("totals after reposting the graph = %v, want a single zero total", totals)
+	}
+
+	if status := doRequest(t, h, http.MethodGet, "/reset", "", nil); status != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /reset status = %d, want %d", status, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestGraphAliases(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes":   []string{"A", "B", "C"},
+		"edges":   [][]string{{"A", "B"}},
+		"aliases": map[string]string{"legacyA": "A"},
+	}, nil)
+
+	var totals []business.IslandMeasurement
+	if status := postJSON(t, h, "/measurements", map[string]any{"node": "legacyA", "value": 7}, &totals); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if len(totals) != 2 || !floatEqual(totals[0].Total, 7) || !floatEqual(totals[1].Total, 0) {
+		t.Fatalf("totals = %v, want 7 on the island of A", totals)
+	}
+}
+
+func TestGraphRejectsTransformsAndAliasesOfUnknownNodes(t *testing.T) {
+	t.Parallel()
+
+	events := make(chan business.Event, 1)
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	var got struct {
+		Error      string   `json:"error"`
+		Transforms []string `json:"transforms"`
+		Aliases    []string `json:"aliases"`
+	}
+	status := postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{{"A", "B"}},
+		"transforms": map[string]any{
+			"A": map[string]float64{"scale": 2},
+			"Z": map[string]float64{"scale": 2},
+			"Y": map[string]float64{"offset": 1},
+		},
+		"aliases": map[string]string{"legacyA": "A", "legacyX": "X"},
+	}, &got)
+	if status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", status, http.StatusBadRequest)
+	}
+	if got.Error != "transforms or aliases reference unknown nodes" || !reflect.DeepEqual(got.Transforms, []string{"Y", "Z"}) || !reflect.DeepEqual(got.Aliases, []string{"legacyX"}) {
+		t.Fatalf("body = %+v, want transforms [Y Z] and aliases [legacyX]", got)
+	}
+	if len(events) != 0 {
+		t.Fatal("rejected graph was sent to the grid")
+	}
+}
+
+func TestGraphDirected(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	tests := []struct {
+		name    string
+		payload map[string]any
+		want    [][]string
+	}{
+		{
+			name: "directed cycle and a downstream node",
+			payload: map[string]any{
+				"nodes":    []string{"A", "B", "C", "D"},
+				"edges":    [][]string{{"A", "B"}, {"B", "C"}, {"C", "A"}, {"C", "D"}},
+				"directed": true,
+			},
+			want: [][]string{{"A", "B", "C"}, {"D"}},
+		},
+		{
+			name: "undirected by default",
+			payload: map[string]any{
+				"nodes": []string{"A", "B", "C", "D"},
+				"edges": [][]string{{"A", "B"}, {"B", "C"}, {"C", "D"}},
+			},
+			want: [][]string{{"A", "B", "C", "D"}},
+		},
+	}
+
+	for _, tt := range tests {
+		var got struct {
+			Islands [][]string `json:"islands"`
+		}
+		if status := postJSON(t, h, "/graph", tt.payload, &got); status != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, http.StatusOK)
+		}
+		if !islandsEqual(got.Islands, tt.want) {
+			t.Errorf("%s: islands = %v, want %v", tt.name, got.Islands, tt.want)
+		}
+	}
+}
+
+func TestGraphWarnings(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	tests := []struct {
+		name  string
+		edges [][]string
+		want  map[string]any
+	}{
+		{
+			name:  "clean graph has no warnings",
+			edges: [][]string{{"A", "B"}},
+		},
+		{
+			name:  "edges to unknown nodes are counted",
+			edges: [][]string{{"A", "B"}, {"A", "X"}, {"Y", "C"}},
+			want:  map[string]any{"ignored_edges": float64(2)},
+		},
+		{
+			name:  "self-loops and duplicates are counted",
+			edges: [][]string{{"A", "B"}, {"B", "A"}, {"A", "B"}, {"C", "C"}},
+			want:  map[string]any{"self_loops": float64(1), "duplicate_edges": float64(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		var got struct {
+			Islands  [][]string     `json:"islands"`
+			Warnings map[string]any `json:"warnings"`
+		}
+		payload := map[string]any{"nodes": []string{"A", "B", "C"}, "edges": tt.edges}
+		if status := postJSON(t, h, "/graph", payload, &got); status != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(got.Warnings, tt.want) {
+			t.Errorf("%s: warnings = %v, want %v", tt.name, got.Warnings, tt.want)
+		}
+		if !islandsEqual(got.Islands, [][]string{{"A", "B"}, {"C"}}) {
+			t.Errorf("%s: islands = %v, want [A B] [C]", tt.name, got.Islands)
+		}
+	}
+}
+
+func TestGraphStrictEdges(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+	postJSON(t, h, "/graph", map[string]any{"nodes": []string{"A", "B"}, "edges": [][]string{{"A", "B"}}}, nil)
+
+	typo := [][]string{{"A", "B"}, {"B", "Cc"}, {"Dd", "A"}}
+	tests := []struct {
+		name      string
+		path      string
+		payload   map[string]any
+		want      int
+		wantEdges [][]string
+	}{
+		{
+			name:      "query parameter",
+			path:      "/graph?strict=true",
+			payload:   map[string]any{"nodes": []string{"A", "B", "C"}, "edges": typo},
+			want:      http.StatusBadRequest,
+			wantEdges: [][]string{{"B", "Cc"}, {"Dd", "A"}},
+		},
+		{
+			name:      "payload flag",
+			path:      "/graph",
+			payload:   map[string]any{"nodes": []string{"A", "B", "C"}, "edges": typo, "strict": true},
+			want:      http.StatusBadRequest,
+			wantEdges: [][]string{{"B", "Cc"}, {"Dd", "A"}},
+		},
+		{
+			name:    "invalid query parameter",
+			path:    "/graph?strict=maybe",
+			payload: map[string]any{"nodes": []string{"A"}, "edges": [][]string{}},
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "strict graph without unknown nodes",
+			path:    "/graph?strict=true",
+			payload: map[string]any{"nodes": []string{"A", "B", "C"}, "edges": [][]string{{"A", "C"}}},
+			want:    http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		var got struct {
+			Error string     `json:"error"`
+			Edges [][]string `json:"edges"`
+		}
+		if status := postJSON(t, h, tt.path, tt.payload, &got); status != tt.want {
+			t.Fatalf("%s: status = %d, want %d", tt.name, status, tt.want)
+		}
+		if !reflect.DeepEqual(got.Edges, tt.wantEdges) {
+			t.Errorf("%s: rejected edges = %v, want %v", tt.name, got.Edges, tt.wantEdges)
+		}
+	}
+
+	// Rejected graphs leave the topology alone: only the last one applied.
+	var islands struct {
+		Islands [][]string `json:"islands"`
+	}
+	getJSON(t, h, "/islands", &islands)
+	if !islandsEqual(islands.Islands, [][]string{{"A", "C"}, {"B"}}) {
+		t.Fatalf("islands = %v, want [A C] [B]", islands.Islands)
+	}
+}
+
+func TestGraphWeightedEdges(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	invalid := []string{
+		`{"nodes":["A","B"],"edges":[["A","B",1,2]]}`,
+		`{"nodes":["A","B"],"edges":[["A","B","heavy"]]}`,
+		`{"nodes":["A","B"],"edges":[{"from":"A"}]}`,
+		`{"nodes":["A","B"],"edges":[["A"]]}`,
+	}
+	for _, body := range invalid {
+		req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("POST /graph %s: status = %d, want %d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	// The three edge forms mix; the last one has no weight and weighs 1.
+	body := `{"nodes":["A","B","C","D"],"edges":[["A","B",2.5],{"from":"C","to":"B","weight":4},["C","A"]]}`
+	req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("POST /graph: status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var totals []struct {
+		Island     []string
+		EdgeWeight *float64
+	}
+	if status := postJSON(t, h, "/measurements?weight=true", map[string]any{"node": "A", "value": 1}, &totals); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if len(totals) != 2 || totals[0].EdgeWeight == nil || !floatEqual(*totals[0].EdgeWeight, 7.5) || totals[1].EdgeWeight == nil || *totals[1].EdgeWeight != 0 {
+		t.Fatalf("totals = %+v, want edge weights 7.5 and 0", totals)
+	}
+
+	totals = nil
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 1}, &totals)
+	if totals[0].EdgeWeight != nil {
+		t.Errorf("edge weight sent without ?weight=true")
+	}
+}
+
+func TestEdgeUnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	weight := 2.5
+	tests := []struct {
+		name    string
+		in      string
+		want    Edge
+		wantErr string
+	}{
+		{name: "pair", in: `["A","B"]`, want: Edge{Nodes: []string{"A", "B"}}},
+		{name: "pair with whitespace", in: "[ \"A\" ,\n \"B\" ]", want: Edge{Nodes: []string{"A", "B"}}},
+		{name: "weighted", in: `["A","B",2.5]`, want: Edge{Nodes: []string{"A", "B"}, Weight: &weight}},
+		{name: "object", in: `{"from":"A","to":"B"}`, want: Edge{Nodes: []string{"A", "B"}}},
+		{name: "object with an unknown field", in: `{"from":"A","to":"B","wieght":2}`, wantErr: `json: unknown field "wieght"`},
+		{name: "names with commas", in: `["A,B","C, D"]`, want: Edge{Nodes: []string{"A,B", "C, D"}}},
+		{name: "names with brackets and quotes", in: `["[A]","\"B\""]`, want: Edge{Nodes: []string{"[A]", `"B"`}}},
+		{name: "one name with a comma", in: `["A,B"]`, wantErr: "each edge must connect exactly two nodes"},
+		{name: "too many nodes", in: `["A","B","C","D"]`, wantErr: "each edge must connect exactly two nodes"},
+		{name: "nested pair", in: `[["A","B"]]`, wantErr: "each edge must connect exactly two nodes"},
+		{name: "nested arrays", in: `[["A"],["B"]]`, wantErr: "edge nodes must be strings"},
+		{name: "nested node", in: `["A",["B"]]`, wantErr: "edge nodes must be strings"},
+		{name: "number node", in: `[1,"B"]`, wantErr: "edge nodes must be strings"},
+		{name: "string", in: `"A,B"`, wantErr: "each edge must be an array of two nodes or an object"},
+		{name: "non-numeric weight", in: `["A","B","heavy"]`, wantErr: "edge weight must be a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got Edge
+			err := json.Unmarshal([]byte(tt.in), &got)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Unmarshal(%s) error = %v, want %q", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Unmarshal(%s) = %+v, want %+v", tt.in, got, tt.want)
+			}
+
+			// The marshaler writes the pair back in a form that decodes alike.
+			data, err := json.Marshal(got)
+			if err != nil {
+				t.Fatalf("Marshal(%+v) error = %v", got, err)
+			}
+			var again Edge
+			if err := json.Unmarshal(data, &again); err != nil || !reflect.DeepEqual(again, got) {
+				t.Fatalf("round trip through %s = %+v, %v, want %+v", data, again, err, got)
+			}
+		})
+	}
+}
+
+func TestEdgeMarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	weight := 2.5
+	tests := []struct {
+		name    string
+		edge    Edge
+		want    string
+		wantErr bool
+	}{
+		{name: "unweighted", edge: Edge{Nodes: []string{"A", "B"}}, want: `["A","B"]`},
+		{name: "weighted", edge: Edge{Nodes: []string{"A", "B"}, Weight: &weight}, want: `["A","B",2.5]`},
+		{name: "one node", edge: Edge{Nodes: []string{"A"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := json.Marshal(tt.edge)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("json = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
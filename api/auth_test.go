@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestAPIKeysGuardTopologyRoutes(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 8)
+	go business.NewGrid().Loop(ctx, events)
+	keys := map[string]string{"secret": "ops"}
+	guarded := foundation.WrapMiddleware(All(WithAPIKeys(keys)), GridEventsMiddleware(events))
+	open := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	tests := []struct {
+		method, path, body string
+		guarded            bool
+	}{
+		{method: http.MethodPost, path: "/graph", body: `{"nodes":["A","B"],"edges":[["A","B"]]}`, guarded: true},
+		{method: http.MethodPatch, path: "/graph", body: `{"add":[["A","B"]]}`, guarded: true},
+		{method: http.MethodDelete, path: "/graph/nodes/A", guarded: true},
+		{method: http.MethodDelete, path: "/measurements", guarded: true},
+		{method: http.MethodPost, path: "/measurements/clear", guarded: true},
+		{method: http.MethodPost, path: "/measurements", body: `{"node":"A","value":1}`},
+		{method: http.MethodGet, path: "/measurements"},
+		{method: http.MethodGet, path: "/islands"},
+		{method: http.MethodPost, path: "/reset", guarded: true},
+		{method: http.MethodPost, path: "/snapshot", body: `{"version":1,"nodes":[],"edges":[],"measurements":[]}`, guarded: true},
+		{method: http.MethodGet, path: "/snapshot"},
+	}
+
+	do := func(h http.Handler, method, path, body, key string) int {
+		req := httptest.NewRequest(method, "http://example.test"+path, bytes.NewBufferString(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for _, tt := range tests {
+		name := tt.method + " " + tt.path
+		if got := do(guarded, tt.method, tt.path, tt.body, ""); (got == http.StatusUnauthorized) != tt.guarded {
+			t.Errorf("%s without a key: status = %d, want 401: %v", name, got, tt.guarded)
+		}
+		if got := do(guarded, tt.method, tt.path, tt.body, "wrong"); (got == http.StatusUnauthorized) != tt.guarded {
+			t.Errorf("%s with a wrong key: status = %d, want 401: %v", name, got, tt.guarded)
+		}
+		if got := do(guarded, tt.method, tt.path, tt.body, "secret"); got == http.StatusUnauthorized {
+			t.Errorf("%s with the key: status = %d, want it let through", name, got)
+		}
+		if got := do(open, tt.method, tt.path, tt.body, ""); got == http.StatusUnauthorized {
+			t.Errorf("%s without configured keys: status = %d, want it open", name, got)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// sendMeasurementBatch applies a batch of measurements as a single event and
+// responds with the totals after the whole batch, like a single measurement,
+// wrapped with whether they changed when envelope is set.
+func (h *handlers) sendMeasurementBatch(ctx context.Context, w http.ResponseWriter, events chan<- business.Event, measurements []business.NodeMeasurement, format totalsFormat, envelope bool) {
+	resp := make(chan business.BatchMeasurementResult, 1)
+	updateEvent := business.BatchMeasurementUpdate{
+		Measurements: measurements,
+		Reply:        resp,
+	}
+
+	h.cfg.backlog.Add(1)
+	select {
+	case events <- updateEvent:
+		select {
+		case res := <-resp:
+			var body any = present(format, res.Totals)
+			if envelope {
+				body = envelopedTotals{Changed: res.Changed, Totals: present(format, res.Totals)}
+			}
+
+			switch {
+			case errors.Is(res.Err, business.ErrEventPanicked):
+				foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+			case res.Err != nil:
+				foundation.Respond(w, http.StatusServiceUnavailable, newErrResp(res.Err.Error()))
+			case res.Queued:
+				foundation.Respond(w, http.StatusAccepted, body)
+			default:
+				w.Header().Set("X-Totals-Changed", strconv.FormatBool(res.Changed))
+				w.Header().Set("X-Measurements-Applied", strconv.Itoa(res.Applied))
+				w.Header().Set("X-State-Version", strconv.FormatUint(res.Version, 10))
+				foundation.Respond(w, http.StatusOK, body)
+			}
+		case <-ctx.Done():
+			foundation.Respond(w, http.StatusRequestTimeout, newErrResp(http.StatusText(http.StatusRequestTimeout)))
+		}
+	case <-h.cfg.busy():
+		h.cfg.backlog.Add(-1)
+		h.cfg.respondBusy(w)
+	case <-ctx.Done():
+		h.cfg.backlog.Add(-1)
+		foundation.Respond(w, http.StatusRequestTimeout, newErrResp(http.StatusText(http.StatusRequestTimeout)))
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestMeasurementsBatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		version    string
+		body       string
+		wantStatus int
+		wantBody   string
+		wantHeader string // X-Measurements-Applied
+	}{
+		{
+			name:       "array applied as one batch",
+			body:       `[{"node":"A","value":1},{"node":"B","value":2},{"node":"X","value":9}]`,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"Island":["A","B"],"Total":3},{"Island":["C"],"Total":0}]`,
+			wantHeader: "2",
+		},
+		{
+			name:       "leading whitespace before the array",
+			body:       " \n\t[{\"node\":\"C\",\"value\":4}]",
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"Island":["A","B"],"Total":0},{"Island":["C"],"Total":4}]`,
+			wantHeader: "1",
+		},
+		{
+			name:       "single object still accepted",
+			body:       `{"node":"C","value":4}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"Island":["A","B"],"Total":0},{"Island":["C"],"Total":4}]`,
+		},
+		{
+			name:       "empty array",
+			body:       `[]`,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"Island":["A","B"],"Total":0},{"Island":["C"],"Total":0}]`,
+			wantHeader: "0",
+		},
+		{
+			name:       "version 2 rules apply to every item",
+			version:    "2",
+			body:       `[{"node":"A","value":1,"mode":"add"},{"node":"A","value":1,"mode":"add"}]`,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"Island":["A","B"],"Total":2},{"Island":["C"],"Total":0}]`,
+			wantHeader: "2",
+		},
+		{
+			name:       "invalid item rejects the batch",
+			version:    "2",
+			body:       `[{"node":"A","value":1},{"node":"B","value":1,"mode":"double"}]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown field in an item",
+			body:       `[{"node":"A","value":1,"extra":true}]`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			events := make(chan business.Event, 8)
+			go business.NewGrid().Loop(ctx, events)
+			h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+			postJSON(t, h, "/graph", map[string]any{
+				"nodes": []string{"A", "B", "C"},
+				"edges": [][]string{{"A", "B"}},
+			}, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/measurements", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.version != "" {
+				req.Header.Set("X-API-Version", tt.version)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rr.Code, tt.wantStatus, rr.Body)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(rr.Body.String()) != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body, tt.wantBody)
+			}
+			if got := rr.Header().Get("X-Measurements-Applied"); got != tt.wantHeader {
+				t.Errorf("X-Measurements-Applied = %q, want %q", got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestMeasurementsBatchRejectsEcho(t *testing.T) {
+	t.Parallel()
+
+	events := make(chan business.Event, 1)
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	status := doRequest(t, h, http.MethodPost, "/measurements?echo=true", "application/json", []map[string]any{{"node": "A", "value": 1}})
+	if status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// DefaultMaxSubscribers is the default limit on concurrent streaming
+// subscribers.
+const DefaultMaxSubscribers = 1024
+
+// DefaultBackpressureTimeout is how long a request waits by default for the
+// grid loop to accept its event before it is answered 429.
+const DefaultBackpressureTimeout = 20 * time.Millisecond
+
+// NullArrayPolicy decides how a graph payload with a null or missing "nodes"
+// array is handled. A null or missing "edges" array is always empty, so a graph
+// of isolated nodes needs no edges key.
+type NullArrayPolicy int
+
+const (
+	// RejectNullArrays answers 400 ("nodes is required"). This is the default,
+	// since a null array usually hides a client bug.
+	RejectNullArrays NullArrayPolicy = iota
+	// NullArraysAsEmpty treats a null or missing array as an empty one.
+	NullArraysAsEmpty
+)
+
+// Option configures the router returned by All.
+type Option func(*config)
+
+// config holds the router settings shared by the handlers.
+type config struct {
+	nullArrays NullArrayPolicy
+	adminToken string
+	apiKeys    map[string]string // key to principal, required by topology changes when set
+	root       string            // every node must be reachable from it, empty disables the check
+
+	backpressure time.Duration // wait to enqueue an event before answering 429, 0 waits until the request ends
+
+	streamFlush    time.Duration // minimum time between streamed totals, 0 sends every change
+	maxSubscribers int64         // concurrent streams, beyond it new ones get 503
+
+	pprof bool // register the /debug/pprof/ handlers
+
+	latency *LatencyStats // served under /stats/latency, nil disables the route
+	metrics *Metrics      // served under /metrics, nil disables the route and instrumentation
+
+	backlog *business.MeasurementBacklog // raised for each measurement event sent, nil if untracked
+
+	websockets *WebSockets // open /ws connections, nil if untracked
+}
+
+func newConfig(opts ...Option) config {
+	cfg := config{
+		nullArrays:     RejectNullArrays,
+		backpressure:   DefaultBackpressureTimeout,
+		maxSubscribers: DefaultMaxSubscribers,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+	return cfg
+}
+
+// WithNullArrays sets the policy for null or missing graph arrays.
+func WithNullArrays(policy NullArrayPolicy) Option {
+	return func(c *config) {
+		c.nullArrays = policy
+	}
+}
+
+// WithAdminToken sets the bearer token required by the /admin routes. Without
+// a token the admin routes are disabled.
+func WithAdminToken(token string) Option {
+	return func(c *config) {
+		c.adminToken = token
+	}
+}
+
+// WithAPIKeys requires one of keys, mapped to the principal they authenticate,
+// on the routes that change the topology or drop state: POST and PATCH /graph,
+// DELETE /graph/nodes/{node} and DELETE /measurements. Measurements stay open.
+// Without keys those routes are open too.
+func WithAPIKeys(keys map[string]string) Option {
+	return func(c *config) {
+		c.apiKeys = keys
+	}
+}
+
+// requireAPIKey returns the middleware guarding the routes of WithAPIKeys, or
+// nil, which WrapMiddleware skips, when no keys are configured.
+func (c config) requireAPIKey() foundation.Middleware {
+	if len(c.apiKeys) == 0 {
+		return nil
+	}
+	return foundation.APIKey(c.apiKeys)
+}
+
+// WithRequiredRoot rejects graphs with nodes that are unreachable from root.
+// A graph payload can name its own root instead; with neither, any topology is
+// accepted.
+func WithRequiredRoot(root string) Option {
+	return func(c *config) {
+		c.root = root
+	}
+}
+
+// WithBackpressureTimeout sets how long a request waits for the grid loop to
+// accept its event while the event queue is full, before it is answered 429
+// Too Many Requests. Zero waits until the request context ends instead. It
+// defaults to DefaultBackpressureTimeout.
+func WithBackpressureTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.backpressure = max(d, 0)
+	}
+}
+
+// WithStreamFlushInterval coalesces the totals streamed to subscribers: they
+// receive the latest state at most once per interval instead of one event per
+// change. Topology changes are sent immediately. Zero (the default) sends
+// every change.
+func WithStreamFlushInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.streamFlush = max(d, 0)
+	}
+}
+
+// WithMaxSubscribers limits the number of concurrent streaming subscribers;
+// beyond it new subscriptions are answered 503 with a Retry-After header. It
+// defaults to DefaultMaxSubscribers, a value below 1 keeps the default.
+func WithMaxSubscribers(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxSubscribers = int64(n)
+		}
+	}
+}
+
+// WithPprof registers the net/http/pprof handlers under /debug/pprof/. They are
+// off by default, since profiles expose internals and profiling costs CPU.
+func WithPprof(enabled bool) Option {
+	return func(c *config) {
+		c.pprof = enabled
+	}
+}
+
+// WithLatencyStats serves the grid loop latency recorded by stats under
+// GET /stats/latency.
+func WithLatencyStats(stats *LatencyStats) Option {
+	return func(c *config) {
+		c.latency = stats
+	}
+}
+
+// WithMetrics counts the requests in metrics and serves them under GET /metrics
+// in the Prometheus text format.
+func WithMetrics(metrics *Metrics) Option {
+	return func(c *config) {
+		c.metrics = metrics
+	}
+}
+
+// WithMeasurementBacklog counts the measurement events sent to the grid loop in
+// backlog, which the grid shares through business.WithMeasurementBacklog, so
+// strict graph updates are rejected while measurements are queued.
+func WithMeasurementBacklog(backlog *business.MeasurementBacklog) Option {
+	return func(c *config) {
+		c.backlog = backlog
+	}
+}
+
+// busy returns a channel that fires once the backpressure timeout has elapsed,
+// or nil, which never fires, when requests wait until they end.
+func (c config) busy() <-chan time.Time {
+	if c.backpressure == 0 {
+		return nil
+	}
+	return time.After(c.backpressure)
+}
+
+// respondBusy answers 429 Too Many Requests for an event the grid loop did not
+// accept in time. Retry-After, in whole seconds, is the backpressure timeout
+// rounded up, and at least 1.
+func (c config) respondBusy(w http.ResponseWriter) {
+	retry := max(int64(math.Ceil(c.backpressure.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.FormatInt(retry, 10))
+	foundation.Respond(w, http.StatusTooManyRequests, newErrResp("server busy, try again"))
+}
+
+// handlers binds the HTTP handlers to the router configuration.
+type handlers struct {
+	cfg config
+
+	subscribers atomic.Int64 // open streams, bounded by cfg.maxSubscribers
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestGraphNullArraysPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		opts        []Option
+		body        string
+		wantStatus  int
+		wantError   string
+		wantIslands int
+	}{
+		{
+			name:       "default rejects null nodes",
+			body:       `{"nodes":null,"edges":[]}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "nodes is required",
+		},
+		{
+			name:        "default accepts null edges",
+			body:        `{"nodes":["A"],"edges":null}`,
+			wantStatus:  http.StatusOK,
+			wantIslands: 1,
+		},
+		{
+			name:        "default accepts missing edges",
+			body:        `{"nodes":["A","B"]}`,
+			wantStatus:  http.StatusOK,
+			wantIslands: 2,
+		},
+		{
+			name:       "default rejects both null",
+			body:       `{"nodes":null,"edges":null}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "nodes is required",
+		},
+		{
+			name:       "default rejects missing fields",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "nodes is required",
+		},
+		{
+			name:        "default accepts explicit empty arrays",
+			body:        `{"nodes":[],"edges":[]}`,
+			wantStatus:  http.StatusOK,
+			wantIslands: 0,
+		},
+		{
+			name:        "empty policy accepts null nodes",
+			opts:        []Option{WithNullArrays(NullArraysAsEmpty)},
+			body:        `{"nodes":null,"edges":[]}`,
+			wantStatus:  http.StatusOK,
+			wantIslands: 0,
+		},
+		{
+			name:        "empty policy accepts null edges",
+			opts:        []Option{WithNullArrays(NullArraysAsEmpty)},
+			body:        `{"nodes":["A","B"],"edges":null}`,
+			wantStatus:  http.StatusOK,
+			wantIslands: 2,
+		},
+		{
+			name:        "empty policy accepts both null",
+			opts:        []Option{WithNullArrays(NullArraysAsEmpty)},
+			body:        `{"nodes":null,"edges":null}`,
+			wantStatus:  http.StatusOK,
+			wantIslands: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			events := make(chan business.Event, 16)
+			grid := business.NewGrid()
+			go grid.Loop(ctx, events)
+			t.Cleanup(func() { close(events) })
+
+			h := foundation.WrapMiddleware(All(tt.opts...), GridEventsMiddleware(events))
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			var got struct {
+				Error   string     `json:"error"`
+				Islands [][]string `json:"islands"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got.Error != tt.wantError {
+				t.Fatalf("error = %q, want %q", got.Error, tt.wantError)
+			}
+			if len(got.Islands) != tt.wantIslands {
+				t.Fatalf("islands = %v, want %d islands", got.Islands, tt.wantIslands)
+			}
+		})
+	}
+}
+
+func TestGraphRequiredRoot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		opts            []Option
+		body            string
+		wantStatus      int
+		wantUnreachable []string
+	}{
+		{
+			name:       "no root accepts disconnected graph",
+			body:       `{"nodes":["A","B","C"],"edges":[["A","B"]]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "configured root reaches every node",
+			opts:       []Option{WithRequiredRoot("A")},
+			body:       `{"nodes":["A","B","C"],"edges":[["A","B"],["B","C"]]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "configured root with unreachable node",
+			opts:            []Option{WithRequiredRoot("A")},
+			body:            `{"nodes":["A","B","C","D"],"edges":[["A","B"],["C","D"]]}`,
+			wantStatus:      http.StatusBadRequest,
+			wantUnreachable: []string{"C", "D"},
+		},
+		{
+			name:            "payload root overrides configured root",
+			opts:            []Option{WithRequiredRoot("A")},
+			body:            `{"nodes":["A","B","C"],"edges":[["B","C"]],"root":"C"}`,
+			wantStatus:      http.StatusBadRequest,
+			wantUnreachable: []string{"A"},
+		},
+		{
+			name:       "unknown root",
+			body:       `{"nodes":["A"],"edges":[],"root":"Z"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			events := make(chan business.Event, 16)
+			go business.NewGrid().Loop(ctx, events)
+			t.Cleanup(func() { close(events) })
+
+			h := foundation.WrapMiddleware(All(tt.opts...), GridEventsMiddleware(events))
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			var got struct {
+				Unreachable []string `json:"unreachable"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if !slices.Equal(got.Unreachable, tt.wantUnreachable) {
+				t.Fatalf("unreachable = %v, want %v", got.Unreachable, tt.wantUnreachable)
+			}
+		})
+	}
+}
+
+func TestPprofRoutes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		wantStatus int
+	}{
+		{name: "absent by default", wantStatus: http.StatusNotFound},
+		{name: "present when enabled", opts: []Option{WithPprof(true)}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := All(tt.opts...)
+			for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap?debug=1", "/debug/pprof/cmdline"} {
+				if status := doRequest(t, h, http.MethodGet, path, "", nil); status != tt.wantStatus {
+					t.Fatalf("GET %s status = %d, want %d", path, status, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestBackpressureTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		method     string
+		path       string
+		body       any
+		wantStatus int
+	}{
+		{name: "graph gives up after the default", method: http.MethodPost, path: "/graph", body: map[string]any{"nodes": []string{"A"}, "edges": [][]string{}}, wantStatus: http.StatusTooManyRequests},
+		{name: "measurement gives up after the default", method: http.MethodPost, path: "/measurements", body: map[string]any{"node": "A", "value": 1}, wantStatus: http.StatusTooManyRequests},
+		{name: "totals give up after a custom timeout", opts: []Option{WithBackpressureTimeout(time.Millisecond)}, method: http.MethodGet, path: "/measurements", wantStatus: http.StatusTooManyRequests},
+		{name: "zero waits until the request ends", opts: []Option{WithBackpressureTimeout(0)}, method: http.MethodPost, path: "/measurements", body: map[string]any{"node": "A", "value": 1}, wantStatus: http.StatusRequestTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			events := make(chan business.Event) // unbuffered, no consumer => send blocks
+			h := foundation.WrapMiddleware(All(tt.opts...), GridEventsMiddleware(events))
+
+			// Longer than the default timeout, so only a disabled one runs into it.
+			ctx, cancel := context.WithTimeout(context.Background(), 10*DefaultBackpressureTimeout)
+			t.Cleanup(cancel)
+
+			var body bytes.Buffer
+			if tt.body != nil {
+				if err := json.NewEncoder(&body).Encode(tt.body); err != nil {
+					t.Fatalf("encode: %v", err)
+				}
+			}
+			req := httptest.NewRequestWithContext(ctx, tt.method, "http://example.test"+tt.path, &body)
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			// Sub-second timeouts round up to the 1s minimum.
+			if got, busy := rr.Header().Get("Retry-After"), rr.Code == http.StatusTooManyRequests; busy && got != "1" || !busy && got != "" {
+				t.Errorf("Retry-After = %q for status %d", got, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRespondBusyRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		timeout time.Duration
+		want    string
+	}{
+		{timeout: time.Millisecond, want: "1"},
+		{timeout: time.Second, want: "1"},
+		{timeout: 1500 * time.Millisecond, want: "2"},
+		{timeout: time.Minute, want: "60"},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		config{backpressure: tt.timeout}.respondBusy(rr)
+		if rr.Code != http.StatusTooManyRequests {
+			t.Errorf("%v: status = %d, want %d", tt.timeout, rr.Code, http.StatusTooManyRequests)
+		}
+		if got := rr.Header().Get("Retry-After"); got != tt.want {
+			t.Errorf("%v: Retry-After = %q, want %q", tt.timeout, got, tt.want)
+		}
+	}
+}
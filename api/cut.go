@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// simulateCutHandler reports whether removing an edge would split its island,
+// without modifying the grid.
+func (h *handlers) simulateCutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	type cutPayload struct {
+		Edge Edge `json:"edge"`
+	}
+
+	payload, err := foundation.Decode[cutPayload](w, r)
+	if err != nil || len(payload.Edge.Nodes) != 2 {
+		h.respondDecodeError(w, r, err, "invalid edge payload")
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.EdgeCut, 1)
+	cut, ok := query(ctx, w, events, business.EdgeCutQuery{
+		From:  payload.Edge.Nodes[0],
+		To:    payload.Edge.Nodes[1],
+		Reply: resp,
+	}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	if !cut.Found {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp("edge not found in current graph"))
+		return
+	}
+
+	foundation.Respond(w, http.StatusOK, struct {
+		Split   bool       `json:"split"`
+		Islands [][]string `json:"islands,omitempty"`
+	}{
+		Split:   cut.Split,
+		Islands: cut.Islands,
+	})
+}
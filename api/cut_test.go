@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestSimulateCutEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	grid := business.NewGrid()
+	go grid.Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	// A-B-C is a cycle, C-D is a bridge.
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C", "D"},
+		"edges": [][]string{{"A", "B"}, {"B", "C"}, {"C", "A"}, {"C", "D"}},
+	}, nil)
+
+	type cutResponse struct {
+		Split   bool       `json:"split"`
+		Islands [][]string `json:"islands"`
+	}
+
+	tests := []struct {
+		name        string
+		edge        []string
+		wantStatus  int
+		wantSplit   bool
+		wantIslands int
+	}{
+		{name: "bridge edge splits", edge: []string{"C", "D"}, wantStatus: http.StatusOK, wantSplit: true, wantIslands: 2},
+		{name: "redundant edge does not split", edge: []string{"A", "B"}, wantStatus: http.StatusOK},
+		{name: "unknown edge returns 400", edge: []string{"A", "D"}, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got cutResponse
+			status := postJSON(t, h, "/graph/simulate-cut", map[string]any{"edge": tt.edge}, &got)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if got.Split != tt.wantSplit || len(got.Islands) != tt.wantIslands {
+				t.Fatalf("response = %+v, want split=%v with %d islands", got, tt.wantSplit, tt.wantIslands)
+			}
+		})
+	}
+
+	// The what-if analysis must leave the topology untouched.
+	postJSON(t, h, "/graph/simulate-cut", map[string]any{"edge": []string{"C", "D"}}, nil)
+	var totals []business.IslandMeasurement
+	postJSON(t, h, "/measurements", map[string]any{"node": "D", "value": 1}, &totals)
+	if len(totals) != 1 {
+		t.Fatalf("islands after simulation = %d, want 1", len(totals))
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// islandDensity is the JSON form of business.IslandDensity.
+type islandDensity struct {
+	Island  []string `json:"island"`
+	Nodes   int      `json:"nodes"`
+	Edges   int      `json:"edges"`
+	Density float64  `json:"density"`
+}
+
+// graphDensity is the JSON form of business.GraphDensity.
+type graphDensity struct {
+	Nodes   int             `json:"nodes"`
+	Edges   int             `json:"edges"`
+	Density float64         `json:"density"`
+	Islands []islandDensity `json:"islands"`
+}
+
+// densityHandler returns the edge count and density of the current graph and
+// of each of its islands.
+func (h *handlers) densityHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.GraphDensity, 1)
+	d, ok := query(ctx, w, events, business.DensityQuery{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	out := graphDensity{
+		Nodes:   d.Nodes,
+		Edges:   d.Edges,
+		Density: d.Density,
+		Islands: make([]islandDensity, len(d.Islands)),
+	}
+	for i, island := range d.Islands {
+		out.Islands[i] = islandDensity{Island: island.Island, Nodes: island.Nodes, Edges: island.Edges, Density: island.Density}
+	}
+	foundation.Respond(w, http.StatusOK, out)
+}
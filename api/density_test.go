@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestDensityEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	// A path of four nodes and a lone one: 3 edges out of 5*4/2 = 10.
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C", "D", "E"},
+		"edges": [][]string{{"A", "B"}, {"B", "C"}, {"C", "D"}},
+	}, nil)
+
+	var got graphDensity
+	if status := getJSON(t, h, "/stats/density", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	want := graphDensity{
+		Nodes:   5,
+		Edges:   3,
+		Density: 0.3,
+		Islands: []islandDensity{
+			{Island: []string{"A", "B", "C", "D"}, Nodes: 4, Edges: 3, Density: 0.5},
+			{Island: []string{"E"}, Nodes: 1, Edges: 0, Density: 0},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("density = %+v, want %+v", got, want)
+	}
+}
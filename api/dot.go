@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// dotContentType is the media type of GraphViz DOT documents.
+const dotContentType = "text/vnd.graphviz"
+
+// graphDotHandler renders the current topology in GraphViz DOT format: each
+// island is a cluster, and measured nodes are labeled with their value.
+func (h *handlers) graphDotHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.Topology, 1)
+	topology, ok := query(ctx, w, events, business.TopologyQuery{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	w.Header().Set("Content-Type", dotContentType+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(renderDOT(topology))
+}
+
+// renderDOT returns t as a DOT graph, a digraph for directed topologies.
+func renderDOT(t business.Topology) []byte {
+	kind, edgeOp := "graph", "--"
+	if t.Directed {
+		kind, edgeOp = "digraph", "->"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s zgrid {\n", kind)
+	for i, island := range t.Islands {
+		fmt.Fprintf(&b, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(&b, "    label=%s;\n", dotQuote("island "+strconv.Itoa(i)))
+		for _, node := range island {
+			if v, ok := t.Measurements[node]; ok {
+				label := dotQuote(node + "\n" + strconv.FormatFloat(v, 'g', -1, 64))
+				fmt.Fprintf(&b, "    %s [label=%s];\n", dotQuote(node), label)
+				continue
+			}
+			fmt.Fprintf(&b, "    %s;\n", dotQuote(node))
+		}
+		b.WriteString("  }\n")
+	}
+	for _, e := range t.Edges {
+		fmt.Fprintf(&b, "  %s %s %s;\n", dotQuote(e[0]), edgeOp, dotQuote(e[1]))
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// dotEscaper escapes the characters that cannot appear as is in a quoted DOT
+// string. Newlines become the \n line break of labels.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+// dotQuote returns s as a quoted DOT identifier, so node names with spaces,
+// quotes or punctuation are kept intact.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestRenderDOT(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		topology business.Topology
+		want     string
+	}{
+		{
+			name: "empty",
+			want: "graph zgrid {\n}\n",
+		},
+		{
+			name: "islands and measurements",
+			topology: business.Topology{
+				Islands:      [][]string{{"A", "B"}, {"C"}},
+				Edges:        [][]string{{"A", "B"}},
+				Measurements: map[string]float64{"A": 2.5},
+			},
+			want: `graph zgrid {
+  subgraph cluster_0 {
+    label="island 0";
+    "A" [label="A\n2.5"];
+    "B";
+  }
+  subgraph cluster_1 {
+    label="island 1";
+    "C";
+  }
+  "A" -- "B";
+}
+`,
+		},
+		{
+			name: "directed",
+			topology: business.Topology{
+				Directed: true,
+				Islands:  [][]string{{"A", "B"}},
+				Edges:    [][]string{{"A", "B"}, {"B", "A"}},
+			},
+			want: `digraph zgrid {
+  subgraph cluster_0 {
+    label="island 0";
+    "A";
+    "B";
+  }
+  "A" -> "B";
+  "B" -> "A";
+}
+`,
+		},
+		{
+			name: "special characters are escaped",
+			topology: business.Topology{
+				Islands:      [][]string{{`say "hi"`, `a\b`, "two\nlines"}},
+				Measurements: map[string]float64{`say "hi"`: -1},
+			},
+			want: `graph zgrid {
+  subgraph cluster_0 {
+    label="island 0";
+    "say \"hi\"" [label="say \"hi\"\n-1"];
+    "a\\b";
+    "two\nlines";
+  }
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := string(renderDOT(tt.topology)); got != tt.want {
+				t.Fatalf("renderDOT() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphDotEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 4}, nil)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.test/graph.dot", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/vnd.graphviz") {
+		t.Errorf("Content-Type = %q, want text/vnd.graphviz", ct)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"graph zgrid {", `"B" [label="B\n4"];`, `"A" -- "B";`, "subgraph cluster_1 {"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body lacks %q:\n%s", want, body)
+		}
+	}
+
+	if status := doRequest(t, h, http.MethodPost, "/graph.dot", "application/json", nil); status != http.StatusMethodNotAllowed {
+		t.Fatalf("POST status = %d, want %d", status, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// graphEdgesHandler returns the edge list of the current graph: every
+// undirected edge once, as a sorted pair of node names, in sorted order.
+func (h *handlers) graphEdgesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan [][]string, 1)
+	edges, ok := query(ctx, w, events, business.EdgesQuery{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	foundation.Respond(w, http.StatusOK, edges)
+}
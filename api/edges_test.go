@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestGraphEdgesEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	var empty [][]string
+	if status := getJSON(t, h, "/graph/edges", &empty); status != http.StatusOK {
+		t.Fatalf("empty grid status = %d, want %d", status, http.StatusOK)
+	}
+	if empty == nil || len(empty) != 0 {
+		t.Fatalf("empty grid edges = %v, want []", empty)
+	}
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C", "D"},
+		"edges": [][]string{{"C", "B"}, {"A", "B"}, {"B", "A"}},
+	}, nil)
+
+	var got [][]string
+	if status := getJSON(t, h, "/graph/edges", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	want := [][]string{{"A", "B"}, {"B", "C"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("edges = %v, want %v", got, want)
+	}
+
+	if status := doRequest(t, h, http.MethodPost, "/graph/edges", "application/json", nil); status != http.StatusMethodNotAllowed {
+		t.Fatalf("POST status = %d, want %d", status, http.StatusMethodNotAllowed)
+	}
+}
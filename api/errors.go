@@ -1,9 +1,49 @@
 package api
 
-type errorResponse struct {
-	Error string `json:"error"`
-}
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"zgrid/foundation"
+)
+
+// errorResponse is the JSON body of every error: {"error": "...",
+// "request_id": "..."}. foundation.Respond fills in the request ID.
+type errorResponse = foundation.ErrorResponse
 
 func newErrResp(msg string) errorResponse {
 	return errorResponse{Error: msg}
 }
+
+// respondDecodeError answers a request whose payload could not be decoded: 413
+// when the body exceeded the size limit, which says nothing about its JSON,
+// otherwise 400 with msg. An empty body is reported as such, and when the JSON
+// itself is at fault, msg is followed by what broke and the offending field is
+// reported in "field".
+func (h *handlers) respondDecodeError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	h.cfg.metrics.decodeError(r)
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		foundation.Respond(w, http.StatusRequestEntityTooLarge, newErrResp(fmt.Sprintf("request body exceeds the limit of %d bytes", tooLarge.Limit)))
+		return
+	}
+
+	if errors.Is(err, foundation.ErrEmptyBody) {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp("request body is required"))
+		return
+	}
+
+	var decodeErr *foundation.DecodeError
+	if errors.As(err, &decodeErr) {
+		foundation.Respond(w, http.StatusBadRequest, struct {
+			errorResponse
+			Field string `json:"field,omitempty"`
+		}{
+			errorResponse: foundation.NewErrorResponse(w, msg+": "+decodeErr.Error()),
+			Field:         decodeErr.Field,
+		})
+		return
+	}
+	foundation.Respond(w, http.StatusBadRequest, newErrResp(msg))
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"zgrid/foundation"
+)
+
+// csvContentType is the media type of edge lists posted to /graph as CSV.
+const csvContentType = "text/csv"
+
+// isCSV reports whether the body of r is declared as CSV.
+func isCSV(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == csvContentType
+}
+
+// decodeGraphCSV reads a graph posted as CSV lines of "from,to", with an
+// optional "from,to" header. The nodes are the endpoints of the edges, in the
+// order they first appear. Lines that are not a pair of node names are
+// skipped, as malformed edges are in JSON graphs, and an empty body is an
+// empty graph.
+func decodeGraphCSV(w http.ResponseWriter, r *http.Request) ([]string, []Edge, error) {
+	records, err := foundation.DecodeCSV(w, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes := []string{}
+	edges := []Edge{}
+	seen := make(map[string]struct{})
+	for i, rec := range records {
+		if len(rec) != 2 {
+			continue
+		}
+		from, to := strings.TrimSpace(rec[0]), strings.TrimSpace(rec[1])
+		if from == "" || to == "" {
+			continue
+		}
+		if i == 0 && strings.EqualFold(from, "from") && strings.EqualFold(to, "to") {
+			continue
+		}
+		for _, n := range []string{from, to} {
+			if _, ok := seen[n]; !ok {
+				seen[n] = struct{}{}
+				nodes = append(nodes, n)
+			}
+		}
+		edges = append(edges, Edge{Nodes: []string{from, to}})
+	}
+	return nodes, edges, nil
+}
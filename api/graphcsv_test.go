@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestGraphCSVUpload(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        [][]string
+	}{
+		{
+			name:        "with header",
+			contentType: "text/csv",
+			body:        "from,to\nA,B\nC,D\nB,E\n",
+			want:        [][]string{{"A", "B", "E"}, {"C", "D"}},
+		},
+		{
+			name:        "without header, with charset and spaces",
+			contentType: "text/csv; charset=utf-8",
+			body:        "A, B\r\n\r\nC,D",
+			want:        [][]string{{"A", "B"}, {"C", "D"}},
+		},
+		{
+			name:        "quoted names",
+			contentType: "text/csv",
+			body:        "\"A,1\",B\n",
+			want:        [][]string{{"A,1", "B"}},
+		},
+		{
+			name:        "malformed lines are skipped",
+			contentType: "text/csv",
+			body:        "A,B\nC\nD,E,F\n,G\nH\"x,I\nJ,K\n",
+			want:        [][]string{{"A", "B"}, {"J", "K"}},
+		},
+		{
+			name:        "empty body",
+			contentType: "text/csv",
+			body:        "",
+			want:        [][]string{},
+		},
+		{
+			name:        "header only",
+			contentType: "text/csv",
+			body:        "From,To\n",
+			want:        [][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			events := make(chan business.Event, 16)
+			go business.NewGrid().Loop(ctx, events)
+			t.Cleanup(func() { close(events) })
+
+			h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+			}
+			var got struct {
+				Islands [][]string `json:"islands"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if !islandsEqual(got.Islands, tt.want) {
+				t.Fatalf("islands = %v, want %v", got.Islands, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphUploadContentTypes(t *testing.T) {
+	t.Parallel()
+
+	h := All()
+	req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", strings.NewReader("A,B\n"))
+	req.Header.Set("Content-Type", "text/plain")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusUnsupportedMediaType)
+	}
+	if want := "Content-Type must be application/json or text/csv"; !strings.Contains(rr.Body.String(), want) {
+		t.Fatalf("body = %s, want %q", rr.Body, want)
+	}
+}
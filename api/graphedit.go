@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// nodeRemoveHandler drops a node from the current graph, along with its edges
+// and stored measurement, and returns the resulting islands. Removing a node
+// that is not in the graph leaves them unchanged.
+func (h *handlers) nodeRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	node := r.PathValue("node")
+	if node == "" {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp("node is required"))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.GraphResult, 1)
+	res, ok := query(ctx, w, events, business.NodeRemove{Node: node, Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	respondGraphEdit(w, res)
+}
+
+// graphPatchHandler adds and removes edges of the current graph in place,
+// which is much cheaper than reposting a large graph for a small change, and
+// returns the resulting islands.
+func (h *handlers) graphPatchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	type patchPayload struct {
+		Add    []Edge `json:"add"`
+		Remove []Edge `json:"remove"`
+	}
+
+	payload, err := foundation.Decode[patchPayload](w, r)
+	if err != nil {
+		h.respondDecodeError(w, r, err, "invalid graph patch payload")
+		return
+	}
+
+	edit := business.EdgeEdit{
+		Add:    make([][]string, len(payload.Add)),
+		Remove: make([][]string, len(payload.Remove)),
+	}
+	for i, edge := range payload.Add {
+		// Edges added in place weigh 1; a weight would be silently lost.
+		if edge.Weight != nil {
+			foundation.Respond(w, http.StatusBadRequest, newErrResp("edge weights cannot be patched, post the graph instead"))
+			return
+		}
+		edit.Add[i] = edge.Nodes
+	}
+	for i, edge := range payload.Remove {
+		edit.Remove[i] = edge.Nodes
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.GraphResult, 1)
+	edit.Reply = resp
+	res, ok := query(ctx, w, events, edit, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	respondGraphEdit(w, res)
+}
+
+// respondGraphEdit sends the reply to an in-place edit of the graph: the
+// resulting islands, or 409 when the edit cannot be applied right now.
+func respondGraphEdit(w http.ResponseWriter, res business.GraphResult) {
+	switch {
+	case errors.Is(res.Err, business.ErrMeasurementsPending), errors.Is(res.Err, business.ErrRecomputePending):
+		foundation.Respond(w, http.StatusConflict, newErrResp(res.Err.Error()))
+	case res.Err != nil:
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+	default:
+		w.Header().Set("X-State-Version", strconv.FormatUint(res.Version, 10))
+		foundation.Respond(w, http.StatusOK, struct {
+			Islands [][]string `json:"islands"`
+		}{
+			Islands: res.Islands,
+		})
+	}
+}
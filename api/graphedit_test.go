@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestNodeRemoveEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 8)
+	go business.NewGrid().Loop(ctx, events)
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C", "D"},
+		"edges": [][]string{{"A", "B"}, {"B", "C"}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 5}, nil)
+
+	// Edited islands keep a deterministic but not canonical order.
+	steps := []struct {
+		method string
+		path   string
+		status int
+		want   [][]string
+	}{
+		{method: http.MethodDelete, path: "/graph/nodes/B", status: http.StatusOK, want: [][]string{{"C"}, {"D"}, {"A"}}},
+		{method: http.MethodDelete, path: "/graph/nodes/B", status: http.StatusOK, want: [][]string{{"C"}, {"D"}, {"A"}}},
+		{method: http.MethodDelete, path: "/graph/nodes/Z", status: http.StatusOK, want: [][]string{{"C"}, {"D"}, {"A"}}},
+		{method: http.MethodGet, path: "/graph/nodes/A", status: http.StatusMethodNotAllowed},
+	}
+	for _, step := range steps {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(step.method, "http://example.test"+step.path, nil))
+		if rr.Code != step.status {
+			t.Fatalf("%s %s: status = %d, want %d", step.method, step.path, rr.Code, step.status)
+		}
+		if step.want == nil {
+			continue
+		}
+
+		var body struct {
+			Islands [][]string `json:"islands"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if !islandsEqual(body.Islands, step.want) {
+			t.Errorf("%s %s: islands = %v, want %v", step.method, step.path, body.Islands, step.want)
+		}
+	}
+
+	// The measurement of B went away with it.
+	var detail nodeDetail
+	getJSON(t, h, "/nodes/B", &detail)
+	if detail.InGraph || detail.Value != nil {
+		t.Errorf("detail of B = %+v, want it outside the graph and unmeasured", detail)
+	}
+}
+
+func TestGraphPatchEndpoint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   [][]string // canonical partition
+	}{
+		{
+			name:   "add merges islands",
+			body:   `{"add": [["B", "C"]]}`,
+			status: http.StatusOK,
+			want:   [][]string{{"A", "B", "C", "D"}, {"E"}},
+		},
+		{
+			name:   "remove splits an island",
+			body:   `{"remove": [{"from": "C", "to": "D"}]}`,
+			status: http.StatusOK,
+			want:   [][]string{{"A", "B"}, {"C"}, {"D"}, {"E"}},
+		},
+		{
+			name:   "unknown nodes and missing edges are ignored",
+			body:   `{"add": [["A", "Z"]], "remove": [["A", "E"]]}`,
+			status: http.StatusOK,
+			want:   [][]string{{"A", "B"}, {"C", "D"}, {"E"}},
+		},
+		{
+			name:   "empty patch",
+			body:   `{}`,
+			status: http.StatusOK,
+			want:   [][]string{{"A", "B"}, {"C", "D"}, {"E"}},
+		},
+		{
+			name:   "weighted edge",
+			body:   `{"add": [["A", "E", 2]]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "malformed edge",
+			body:   `{"add": [["A"]]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown field",
+			body:   `{"nodes": ["A"]}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			events := make(chan business.Event, 8)
+			go business.NewGrid().Loop(ctx, events)
+			h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+			postJSON(t, h, "/graph", map[string]any{
+				"nodes": []string{"A", "B", "C", "D", "E"},
+				"edges": [][]string{{"A", "B"}, {"C", "D"}},
+			}, nil)
+
+			req := httptest.NewRequest(http.MethodPatch, "http://example.test/graph", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rr.Code, tt.status, rr.Body)
+			}
+			if tt.want == nil {
+				return
+			}
+			var body struct {
+				Islands [][]string `json:"islands"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			got := body.Islands
+			for _, island := range got {
+				slices.Sort(island)
+			}
+			slices.SortFunc(got, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+			if !islandsEqual(got, tt.want) {
+				t.Errorf("islands = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestHeadOnReadEndpoints(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+	postJSON(t, h, "/graph", map[string]any{"nodes": []string{"A", "B"}, "edges": [][]string{{"A", "B"}}}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 1}, nil)
+
+	for _, path := range []string{"/islands", "/measurements", "/healthz"} {
+		get := httptest.NewRecorder()
+		h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "http://example.test"+path, nil))
+		head := httptest.NewRecorder()
+		h.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "http://example.test"+path, nil))
+
+		if head.Code != get.Code || head.Code != http.StatusOK {
+			t.Errorf("HEAD %s status = %d, want %d as for GET", path, head.Code, get.Code)
+		}
+		if head.Body.Len() != 0 {
+			t.Errorf("HEAD %s body = %q, want none", path, head.Body)
+		}
+		for _, name := range []string{"Content-Type", "X-State-Version"} {
+			if got, want := head.Header().Get(name), get.Header().Get(name); got != want {
+				t.Errorf("HEAD %s %s = %q, want %q as for GET", path, name, got, want)
+			}
+		}
+		if head.Header().Get("Content-Type") == "" {
+			t.Errorf("HEAD %s has no Content-Type", path)
+		}
+	}
+}
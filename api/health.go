@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+const (
+	// livenessPath is served as soon as the server is up, even while the
+	// readiness gate holds everything else back.
+	livenessPath = "/healthz"
+
+	// readyTimeout bounds how long GET /readyz waits for the grid loop. It is
+	// below the default probe timeout of Kubernetes (1s), so a stalled loop is
+	// reported as not ready rather than as a failed probe.
+	readyTimeout = 500 * time.Millisecond
+)
+
+// healthStatus is the body of the health endpoints.
+type healthStatus struct {
+	Status string `json:"status"`
+}
+
+// healthzHandler is the liveness probe: the process is up and serving HTTP.
+func (h *handlers) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	foundation.Respond(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// readyzHandler is the readiness probe: it answers 200 only when the grid loop
+// takes and answers an event in time, and 503 when the loop has not started,
+// has stopped, or is too backed up to accept more work.
+func (h *handlers) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	events := getStateEvents(ctx)
+	if events == nil || !ping(ctx, events) {
+		w.Header().Set("Retry-After", notReadyRetryAfter)
+		foundation.Respond(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready"})
+		return
+	}
+	foundation.Respond(w, http.StatusOK, healthStatus{Status: "ready"})
+}
+
+// ping reports whether the grid loop answers a Ping before ctx ends. A closed
+// events channel means the loop is gone: it reports false instead of letting
+// the send panic.
+func ping(ctx context.Context, events chan<- business.Event) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	reply := make(chan struct{}, 1)
+	select {
+	case events <- business.Ping{Reply: reply}:
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case <-reply:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestHealthProbes(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	grid := business.NewGrid()
+	h := foundation.WrapMiddleware(All(), ReadinessGate(grid.Ready()), GridEventsMiddleware(events))
+
+	// Probes send no body; whatever Content-Type they declare is accepted.
+	probe := func(path string) int {
+		return doRequest(t, h, http.MethodGet, path, "text/plain", nil)
+	}
+	expect := func(step string, healthz, readyz int) {
+		t.Helper()
+		if got := probe("/healthz"); got != healthz {
+			t.Errorf("%s: /healthz status = %d, want %d", step, got, healthz)
+		}
+		if got := probe("/readyz"); got != readyz {
+			t.Errorf("%s: /readyz status = %d, want %d", step, got, readyz)
+		}
+	}
+
+	expect("before the loop starts", http.StatusOK, http.StatusServiceUnavailable)
+
+	loopCtx, stopLoop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		grid.Loop(loopCtx, events)
+	}()
+	<-grid.Ready()
+	expect("while the loop runs", http.StatusOK, http.StatusOK)
+
+	// Nobody takes the ping off the queue anymore.
+	stopLoop()
+	<-done
+	expect("after the loop stopped", http.StatusOK, http.StatusServiceUnavailable)
+}
+
+func TestReadyzClosedEventChannel(t *testing.T) {
+	t.Parallel()
+
+	events := make(chan business.Event)
+	close(events)
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.test/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
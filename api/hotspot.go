@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// hotspot is the JSON form of business.Hotspot.
+type hotspot struct {
+	Node   string   `json:"node"`
+	Value  float64  `json:"value"`
+	Island []string `json:"island"`
+	Total  float64  `json:"total"`
+}
+
+// hotspotHandler returns the node with the highest current measurement and its
+// island, or null when no node of the graph has been measured.
+func (h *handlers) hotspotHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan *business.Hotspot, 1)
+	hs, ok := query(ctx, w, events, business.HotspotQuery{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	var out *hotspot
+	if hs != nil {
+		out = &hotspot{Node: hs.Node, Value: hs.Value, Island: hs.Island, Total: hs.Total}
+	}
+	foundation.Respond(w, http.StatusOK, out)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestHotspotEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+
+	empty := &hotspot{}
+	if status := getJSON(t, h, "/hotspot", &empty); status != http.StatusOK {
+		t.Fatalf("status without measurements = %d, want %d", status, http.StatusOK)
+	}
+	if empty != nil {
+		t.Fatalf("hotspot without measurements = %+v, want null", empty)
+	}
+
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 2}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 7}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "C", "value": 7}, nil)
+
+	var got *hotspot
+	if status := getJSON(t, h, "/hotspot", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	want := &hotspot{Node: "B", Value: 7, Island: []string{"A", "B"}, Total: 9}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("hotspot = %+v, want %+v", got, want)
+	}
+}
+
+func TestHotspotEndpointWindow(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	now, advance := newTestClock()
+	events := make(chan business.Event, 16)
+	go business.NewGrid(business.WithAggregationWindow(time.Minute), business.WithClock(now)).Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 7}, nil)
+	advance(30 * time.Second)
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 2}, nil)
+
+	// B's measurement has left the window: it no longer counts anywhere.
+	advance(31 * time.Second)
+	var got *hotspot
+	if status := getJSON(t, h, "/hotspot", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	want := &hotspot{Node: "A", Value: 2, Island: []string{"A", "B"}, Total: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("hotspot = %+v, want %+v", got, want)
+	}
+}
+
+// newTestClock returns a clock for the grid loop, starting at a fixed time,
+// and a function advancing it from the test goroutine.
+func newTestClock() (now func() time.Time, advance func(time.Duration)) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	var elapsed atomic.Int64
+	now = func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+	advance = func(d time.Duration) { elapsed.Add(int64(d)) }
+	return now, advance
+}
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// islandsHandler returns the islands of the current graph, in the shape of the
+// POST /graph response, without changing anything. The response carries an
+// ETag of the islands, and a request whose If-None-Match matches it is answered
+// 304 Not Modified.
+func (h *handlers) islandsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.Partition, 1)
+	partition, ok := query(ctx, w, events, business.IslandsQuery{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	// The tag follows the islands alone, so pollers are not sent the same
+	// partition again after every measurement.
+	if foundation.NotModified(w, r, fmt.Sprintf(`"%016x"`, partition.Hash)) {
+		return
+	}
+
+	// Before the first graph there are no islands: send [], not null.
+	islands := partition.Islands
+	if islands == nil {
+		islands = [][]string{}
+	}
+	foundation.Respond(w, http.StatusOK, struct {
+		Islands [][]string `json:"islands"`
+	}{
+		Islands: islands,
+	})
+}
+
+// nodeIsland is the JSON form of business.NodeIsland.
+type nodeIsland struct {
+	Index  int      `json:"index"`
+	Island []string `json:"island"`
+	Total  float64  `json:"total"`
+}
+
+// islandByNodeHandler returns the island containing a node and its current
+// total, for clients that only care about one node's neighborhood. The index is
+// the island's position in the GET /islands output.
+func (h *handlers) islandByNodeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	node := r.PathValue("node")
+	if node == "" {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp("node is required"))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.NodeIsland, 1)
+	island, ok := query(ctx, w, events, business.IslandOfNodeQuery{Node: node, Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	if island.Index < 0 {
+		foundation.Respond(w, http.StatusNotFound, newErrResp("node not found"))
+		return
+	}
+	foundation.Respond(w, http.StatusOK, nodeIsland{Index: island.Index, Island: island.Island, Total: island.Total})
+}
+
+// islandMetrics is the JSON form of business.IslandMetrics.
+type islandMetrics struct {
+	Island      int  `json:"island"`
+	Nodes       int  `json:"nodes"`
+	Edges       int  `json:"edges"`
+	Diameter    int  `json:"diameter"`
+	Approximate bool `json:"approximate"`
+}
+
+// islandMetricsHandler returns structural statistics for every island, in the
+// same order as the islands returned by POST /graph.
+func (h *handlers) islandMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan []business.IslandMetrics, 1)
+	metrics, ok := query(ctx, w, events, business.IslandMetricsQuery{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	out := make([]islandMetrics, len(metrics))
+	for i, m := range metrics {
+		out[i] = islandMetrics{
+			Island:      i,
+			Nodes:       m.Nodes,
+			Edges:       m.Edges,
+			Diameter:    m.Diameter,
+			Approximate: m.Approximate,
+		}
+	}
+	foundation.Respond(w, http.StatusOK, out)
+}
+
+// islandCoverage is the JSON form of business.IslandCoverage.
+type islandCoverage struct {
+	Island    []string `json:"island"`
+	Reporting int      `json:"reporting"`
+	Nodes     int      `json:"nodes"`
+	Coverage  float64  `json:"coverage"`
+}
+
+// islandCoverageHandler returns, for every island, the fraction of its nodes
+// that currently have a measurement.
+func (h *handlers) islandCoverageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan []business.IslandCoverage, 1)
+	coverage, ok := query(ctx, w, events, business.IslandCoverageQuery{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	out := make([]islandCoverage, len(coverage))
+	for i, c := range coverage {
+		out[i] = islandCoverage{Island: c.Island, Reporting: c.Reporting, Nodes: c.Nodes, Coverage: c.Coverage}
+	}
+	foundation.Respond(w, http.StatusOK, out)
+}
+
+// islandPeak is the JSON form of business.IslandPeak.
+type islandPeak struct {
+	Island []string `json:"island"`
+	Total  float64  `json:"total"`
+	Peak   float64  `json:"peak"`
+}
+
+// islandPeaksHandler returns the current total of every island along with the
+// highest total it has reached since the last reset.
+func (h *handlers) islandPeaksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan []business.IslandPeak, 1)
+	peaks, ok := query(ctx, w, events, business.IslandPeaksQuery{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	out := make([]islandPeak, len(peaks))
+	for i, p := range peaks {
+		out[i] = islandPeak{Island: p.Island, Total: p.Total, Peak: p.Peak}
+	}
+	foundation.Respond(w, http.StatusOK, out)
+}
+
+// namespaceTotal is the JSON form of business.NamespaceTotal.
+type namespaceTotal struct {
+	Namespace string           `json:"namespace"`
+	Total     float64          `json:"total"`
+	Children  []namespaceTotal `json:"children,omitempty"`
+}
+
+// islandNamespaces is the JSON form of business.IslandNamespaces.
+type islandNamespaces struct {
+	Island     []string         `json:"island"`
+	Total      float64          `json:"total"`
+	Namespaces []namespaceTotal `json:"namespaces"`
+}
+
+func toNamespaceTotals(in []business.NamespaceTotal) []namespaceTotal {
+	if in == nil {
+		return nil
+	}
+	out := make([]namespaceTotal, len(in))
+	for i, n := range in {
+		out[i] = namespaceTotal{Namespace: n.Namespace, Total: n.Total, Children: toNamespaceTotals(n.Children)}
+	}
+	return out
+}
+
+// islandNamespacesHandler returns every island total broken down by the
+// namespace prefixes of its node names, e.g. "region1" then
+// "region1/substation" for ?depth=2.
+func (h *handlers) islandNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	depth := 1
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		d, err := strconv.Atoi(raw)
+		if err != nil || d < 1 {
+			foundation.Respond(w, http.StatusBadRequest, newErrResp(fmt.Sprintf("invalid depth=%q: want a positive integer", raw)))
+			return
+		}
+		depth = d
+	}
+
+	sep := business.DefaultNamespaceSeparator
+	if q := r.URL.Query(); q.Has("separator") {
+		if sep = q.Get("separator"); sep == "" {
+			foundation.Respond(w, http.StatusBadRequest, newErrResp("separator must not be empty"))
+			return
+		}
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan []business.IslandNamespaces, 1)
+	islands, ok := query(ctx, w, events, business.NamespaceQuery{Depth: depth, Separator: sep, Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	out := make([]islandNamespaces, len(islands))
+	for i, island := range islands {
+		out[i] = islandNamespaces{
+			Island:     island.Island,
+			Total:      island.Total,
+			Namespaces: toNamespaceTotals(island.Namespaces),
+		}
+	}
+	foundation.Respond(w, http.StatusOK, out)
+}
@@ -0,0 +1,393 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestIslandsEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	type islandsResponse struct {
+		Islands [][]string `json:"islands"`
+	}
+
+	var empty islandsResponse
+	if status := getJSON(t, h, "/islands", &empty); status != http.StatusOK {
+		t.Fatalf("empty grid status = %d, want %d", status, http.StatusOK)
+	}
+	if empty.Islands == nil || len(empty.Islands) != 0 {
+		t.Fatalf("empty grid islands = %v, want []", empty.Islands)
+	}
+
+	var posted islandsResponse
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C", "D"},
+		"edges": [][]string{{"A", "B"}, {"C", "D"}},
+	}, &posted)
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 1}, nil)
+
+	for range 2 {
+		var got islandsResponse
+		if status := getJSON(t, h, "/islands", &got); status != http.StatusOK {
+			t.Fatalf("status = %d, want %d", status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(got, posted) {
+			t.Fatalf("islands = %v, want the posted %v", got.Islands, posted.Islands)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "http://example.test/islands", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST status = %d, want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+	if got, want := rr.Header().Get("Allow"), "GET, HEAD"; got != want {
+		t.Errorf("POST Allow = %q, want %q", got, want)
+	}
+	if status := doRequest(t, h, http.MethodHead, "/islands", "", nil); status != http.StatusOK {
+		t.Errorf("HEAD status = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestIslandsETag(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "http://example.test/islands", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	graph := map[string]any{"nodes": []string{"A", "B", "C"}, "edges": [][]string{{"A", "B"}}}
+	postJSON(t, h, "/graph", graph, nil)
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || etag[0] != '"' {
+		t.Fatalf("GET = %d with ETag %q, want 200 with a strong ETag", first.Code, etag)
+	}
+
+	// Measurements and an identical graph leave the islands, and so the tag,
+	// unchanged.
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 1}, nil)
+	postJSON(t, h, "/graph", graph, nil)
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{name: "matching tag", ifNoneMatch: etag, want: http.StatusNotModified},
+		{name: "weak form of the tag", ifNoneMatch: "W/" + etag, want: http.StatusNotModified},
+		{name: "tag in a list", ifNoneMatch: `"other", ` + etag, want: http.StatusNotModified},
+		{name: "any tag", ifNoneMatch: "*", want: http.StatusNotModified},
+		{name: "other tag", ifNoneMatch: `"other"`, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := get(tt.ifNoneMatch)
+		if rr.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rr.Code, tt.want)
+		}
+		if got := rr.Header().Get("ETag"); got != etag {
+			t.Errorf("%s: ETag = %q, want %q", tt.name, got, etag)
+		}
+		if tt.want == http.StatusNotModified && rr.Body.Len() != 0 {
+			t.Errorf("%s: body = %q, want none", tt.name, rr.Body)
+		}
+	}
+
+	// An edge joining two islands changes them.
+	if status := doRequest(t, h, http.MethodPatch, "/graph", "application/json", map[string]any{"add": [][]string{{"B", "C"}}}); status != http.StatusOK {
+		t.Fatalf("PATCH status = %d", status)
+	}
+	rr := get(etag)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Fatalf("after the edit GET = %d with ETag %q, want 200 with a new tag", rr.Code, rr.Header().Get("ETag"))
+	}
+}
+
+func TestIslandByNodeEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C", "D"},
+		"edges": [][]string{{"A", "B"}, {"C", "D"}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "D", "value": 3}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "X", "value": 7}, nil)
+
+	tests := []struct {
+		node       string
+		wantStatus int
+		want       nodeIsland
+	}{
+		{node: "A", wantStatus: http.StatusOK, want: nodeIsland{Index: 0, Island: []string{"A", "B"}}},
+		{node: "C", wantStatus: http.StatusOK, want: nodeIsland{Index: 1, Island: []string{"C", "D"}, Total: 3}},
+		{node: "X", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		var got nodeIsland
+		status := getJSON(t, h, "/islands/by-node/"+tt.node, &got)
+		if status != tt.wantStatus {
+			t.Fatalf("%s: status = %d, want %d", tt.node, status, tt.wantStatus)
+		}
+		if status == http.StatusOK && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: island = %+v, want %+v", tt.node, got, tt.want)
+		}
+	}
+}
+
+func TestIslandMetricsEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	var empty []islandMetrics
+	if status := getJSON(t, h, "/islands/metrics", &empty); status != http.StatusOK {
+		t.Fatalf("empty grid status = %d, want %d", status, http.StatusOK)
+	}
+	if empty == nil || len(empty) != 0 {
+		t.Fatalf("empty grid metrics = %v, want []", empty)
+	}
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C", "D"},
+		"edges": [][]string{{"A", "B"}, {"B", "C"}},
+	}, nil)
+
+	var got []islandMetrics
+	if status := getJSON(t, h, "/islands/metrics", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	want := []islandMetrics{
+		{Island: 0, Nodes: 3, Edges: 2, Diameter: 2},
+		{Island: 1, Nodes: 1, Edges: 0, Diameter: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("metrics = %+v, want %+v", got, want)
+	}
+
+	if status := doRequest(t, h, http.MethodPost, "/islands/metrics", "application/json", nil); status != http.StatusMethodNotAllowed {
+		t.Fatalf("POST status = %d, want %d", status, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestIslandCoverageEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C", "D", "E"},
+		"edges": [][]string{{"A", "B"}, {"C", "D"}},
+	}, nil)
+	for _, node := range []string{"A", "B", "C"} {
+		postJSON(t, h, "/measurements", map[string]any{"node": node, "value": 1}, nil)
+	}
+
+	var got []islandCoverage
+	if status := getJSON(t, h, "/islands/coverage", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	want := []islandCoverage{
+		{Island: []string{"A", "B"}, Reporting: 2, Nodes: 2, Coverage: 1},
+		{Island: []string{"C", "D"}, Reporting: 1, Nodes: 2, Coverage: 0.5},
+		{Island: []string{"E"}, Reporting: 0, Nodes: 1, Coverage: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("coverage = %+v, want %+v", got, want)
+	}
+}
+
+func TestIslandPeaksEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+	for _, v := range []float64{2, 7, 3} {
+		postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": v}, nil)
+	}
+
+	var got []islandPeak
+	if status := getJSON(t, h, "/islands/peaks", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	want := []islandPeak{{Island: []string{"A", "B"}, Total: 3, Peak: 7}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("peaks = %+v, want %+v", got, want)
+	}
+}
+
+func TestIslandNamespacesEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"eu.de.A", "eu.fr.B", "us.C"},
+		"edges": [][]string{{"eu.de.A", "eu.fr.B"}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "eu.de.A", "value": 1}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "eu.fr.B", "value": 2}, nil)
+
+	var got []islandNamespaces
+	if status := getJSON(t, h, "/islands/namespaces?depth=2&separator=.", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	want := []islandNamespaces{
+		{Island: []string{"eu.de.A", "eu.fr.B"}, Total: 3, Namespaces: []namespaceTotal{
+			{Namespace: "eu", Total: 3, Children: []namespaceTotal{
+				{Namespace: "eu.de", Total: 1},
+				{Namespace: "eu.fr", Total: 2},
+			}},
+		}},
+		{Island: []string{"us.C"}, Total: 0, Namespaces: []namespaceTotal{
+			{Namespace: "us", Total: 0, Children: []namespaceTotal{
+				{Namespace: "us.C", Total: 0},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("namespaces = %+v, want %+v", got, want)
+	}
+
+	for _, path := range []string{"/islands/namespaces?depth=0", "/islands/namespaces?depth=x", "/islands/namespaces?separator="} {
+		if status := getJSON(t, h, path, nil); status != http.StatusBadRequest {
+			t.Fatalf("GET %s status = %d, want %d", path, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestIslandNamespacesEndpointWindow(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	now, advance := newTestClock()
+	events := make(chan business.Event, 16)
+	go business.NewGrid(business.WithAggregationWindow(time.Minute), business.WithClock(now)).Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"eu.de.A", "eu.fr.B"},
+		"edges": [][]string{{"eu.de.A", "eu.fr.B"}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "eu.de.A", "value": 1}, nil)
+	advance(30 * time.Second)
+	postJSON(t, h, "/measurements", map[string]any{"node": "eu.fr.B", "value": 2}, nil)
+
+	// eu.de.A's measurement has left the window.
+	advance(31 * time.Second)
+	var totals []business.IslandMeasurement
+	getJSON(t, h, "/measurements", &totals)
+	var got []islandNamespaces
+	if status := getJSON(t, h, "/islands/namespaces?depth=2&separator=.", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	want := []islandNamespaces{
+		{Island: []string{"eu.de.A", "eu.fr.B"}, Total: 2, Namespaces: []namespaceTotal{
+			{Namespace: "eu", Total: 2, Children: []namespaceTotal{
+				{Namespace: "eu.de", Total: 0},
+				{Namespace: "eu.fr", Total: 2},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("namespaces = %+v, want %+v", got, want)
+	}
+	if len(totals) != 1 || totals[0].Total != got[0].Total {
+		t.Fatalf("totals = %+v, want the namespaces total %v", totals, got[0].Total)
+	}
+}
+
+func TestQueryPanicReturns500(t *testing.T) {
+	t.Parallel()
+
+	// The grid closes the reply of a query whose processing panicked.
+	events := make(chan business.Event, 1)
+	go func() {
+		for evt := range events {
+			close(evt.(business.IslandsQuery).Reply)
+		}
+	}()
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+	if status := getJSON(t, h, "/islands", nil); status != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", status, http.StatusInternalServerError)
+	}
+}
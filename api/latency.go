@@ -0,0 +1,120 @@
+package api
+
+import (
+	"cmp"
+	"math"
+	"math/bits"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// latencyBuckets is the number of histogram buckets. Bucket i counts durations
+// below 2^i microseconds, so the last one reaches past half an hour.
+const latencyBuckets = 32
+
+// latencyHistogram is a streaming histogram with power-of-two bucket bounds:
+// constant memory, percentiles accurate to a factor of two.
+type latencyHistogram struct {
+	counts [latencyBuckets]uint64
+	total  uint64
+	max    time.Duration
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	us := uint64(max(d.Microseconds(), 0))
+	h.counts[min(bits.Len64(us), latencyBuckets-1)]++
+	h.total++
+	h.max = max(h.max, d)
+}
+
+// percentile returns the upper bound of the bucket holding the q-th quantile,
+// capped at the largest observed duration.
+func (h *latencyHistogram) percentile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	rank = min(max(rank, 1), h.total)
+
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return min(time.Duration(1<<i)*time.Microsecond, h.max)
+		}
+	}
+	return h.max
+}
+
+// LatencyStats records how long the grid loop spends on each event type. Pass
+// its Observe method to business.WithEventTimer and the stats to
+// WithLatencyStats to serve them.
+type LatencyStats struct {
+	mu     sync.Mutex
+	byType map[string]*latencyHistogram
+}
+
+// NewLatencyStats returns empty latency stats.
+func NewLatencyStats() *LatencyStats {
+	return &LatencyStats{byType: map[string]*latencyHistogram{}}
+}
+
+// Observe records that processing evt took d.
+func (s *LatencyStats) Observe(evt business.Event, d time.Duration) {
+	name := "unknown"
+	if t := reflect.TypeOf(evt); t != nil {
+		name = t.Name()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.byType[name]
+	if !ok {
+		h = &latencyHistogram{}
+		s.byType[name] = h
+	}
+	h.observe(d)
+}
+
+// eventLatency is the JSON form of the latency of one event type.
+type eventLatency struct {
+	Event string  `json:"event"`
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// snapshot returns the latency of every event type seen, sorted by name.
+func (s *LatencyStats) snapshot() []eventLatency {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+
+	out := make([]eventLatency, 0, len(s.byType))
+	for name, h := range s.byType {
+		out = append(out, eventLatency{
+			Event: name,
+			Count: h.total,
+			P50:   ms(h.percentile(0.50)),
+			P90:   ms(h.percentile(0.90)),
+			P99:   ms(h.percentile(0.99)),
+			Max:   ms(h.max),
+		})
+	}
+	slices.SortFunc(out, func(a, b eventLatency) int { return cmp.Compare(a.Event, b.Event) })
+	return out
+}
+
+// latencyHandler returns the grid loop processing latency per event type.
+func (h *handlers) latencyHandler(w http.ResponseWriter, r *http.Request) {
+	foundation.Respond(w, http.StatusOK, h.cfg.latency.snapshot())
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		q         float64
+		want      time.Duration
+	}{
+		{name: "empty", q: 0.5, want: 0},
+		{name: "capped at max", durations: []time.Duration{3 * time.Microsecond}, q: 0.5, want: 3 * time.Microsecond},
+		{
+			name:      "bucket upper bound",
+			durations: []time.Duration{3 * time.Microsecond, 5 * time.Microsecond, time.Millisecond},
+			q:         0.5,
+			want:      8 * time.Microsecond,
+		},
+		{
+			name:      "tail",
+			durations: []time.Duration{time.Microsecond, time.Microsecond, time.Microsecond, time.Second},
+			q:         0.99,
+			want:      time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var h latencyHistogram
+			for _, d := range tt.durations {
+				h.observe(d)
+			}
+			if got := h.percentile(tt.q); got != tt.want {
+				t.Fatalf("percentile(%v) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatencyStatsGraphSlowerThanMeasurements(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	stats := NewLatencyStats()
+	events := make(chan business.Event, 16)
+	go business.NewGrid(business.WithEventTimer(stats.Observe)).Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(WithLatencyStats(stats)), GridEventsMiddleware(events))
+
+	// Many small islands: a graph update visits every node, a measurement only
+	// its own island.
+	const pairs = 20000
+	nodes := make([]string, 0, 2*pairs)
+	edges := make([][]string, 0, pairs)
+	for i := range pairs {
+		a, b := fmt.Sprintf("A%d", i), fmt.Sprintf("B%d", i)
+		nodes = append(nodes, a, b)
+		edges = append(edges, []string{a, b})
+	}
+	for range 3 {
+		if status := postJSON(t, h, "/graph", map[string]any{"nodes": nodes, "edges": edges}, nil); status != http.StatusOK {
+			t.Fatalf("graph status = %d", status)
+		}
+	}
+	for i := range 50 {
+		postJSON(t, h, "/measurements", map[string]any{"node": nodes[i], "value": 1}, nil)
+	}
+
+	var got []eventLatency
+	if status := getJSON(t, h, "/stats/latency", &got); status != http.StatusOK {
+		t.Fatalf("stats status = %d, want %d", status, http.StatusOK)
+	}
+
+	byEvent := map[string]eventLatency{}
+	for _, l := range got {
+		byEvent[l.Event] = l
+	}
+	graph, measurement := byEvent["GraphUpdate"], byEvent["MeasurementUpdate"]
+	if graph.Count != 3 || measurement.Count != 50 {
+		t.Fatalf("counts = %d graph, %d measurement, want 3 and 50 (stats %+v)", graph.Count, measurement.Count, got)
+	}
+	if graph.P50 <= measurement.P50 {
+		t.Fatalf("graph p50 = %vms, measurement p50 = %vms: want graph updates slower", graph.P50, measurement.P50)
+	}
+}
+
+func TestLatencyRouteDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	if status := getJSON(t, All(), "/stats/latency", nil); status != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+	"zgrid/business"
+)
+
+// metricsPath is where the Prometheus metrics are served.
+const metricsPath = "/metrics"
+
+// unmatchedEndpoint labels requests that matched no route, so that arbitrary
+// paths cannot grow the label set.
+const unmatchedEndpoint = "unmatched"
+
+// Metrics holds the Prometheus collectors of the service. Pass its ObserveEvent
+// method to business.WithEventTimer and the metrics to WithMetrics to serve
+// them under GET /metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests           *prometheus.CounterVec
+	busyRejections     *prometheus.CounterVec
+	decodeErrors       *prometheus.CounterVec
+	graphUpdates       prometheus.Counter
+	measurementUpdates prometheus.Counter
+	eventDuration      *prometheus.HistogramVec
+}
+
+// NewMetrics returns metrics registered on a registry of their own, along with
+// the Go runtime and process collectors. islandCount reports the current
+// number of islands; it is called on every scrape and must be safe for
+// concurrent use.
+func NewMetrics(islandCount func() int) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "zgrid_http_requests_total",
+			Help: "HTTP requests by route pattern, method and status code.",
+		}, []string{"endpoint", "method", "status"}),
+		busyRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "zgrid_backpressure_rejections_total",
+			Help: "Requests answered 429 because the grid loop did not accept their event in time.",
+		}, []string{"endpoint"}),
+		decodeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "zgrid_decode_errors_total",
+			Help: "Request payloads that could not be decoded.",
+		}, []string{"endpoint"}),
+		graphUpdates: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "zgrid_graph_updates_total",
+			Help: "Graph updates processed by the grid loop, including edge edits, node removals, resets and restores.",
+		}),
+		measurementUpdates: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "zgrid_measurement_updates_total",
+			Help: "Measurements processed by the grid loop, each one of a batch counted.",
+		}),
+		eventDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "zgrid_event_duration_seconds",
+			Help:    "Time the grid loop spent processing an event, by event type.",
+			Buckets: prometheus.ExponentialBuckets(1e-6, 4, 12), // 1µs to ~4s
+		}, []string{"event"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.busyRejections,
+		m.decodeErrors,
+		m.graphUpdates,
+		m.measurementUpdates,
+		m.eventDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "zgrid_islands",
+			Help: "Current number of islands.",
+		}, func() float64 { return float64(islandCount()) }),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// ObserveEvent records that processing evt took d.
+func (m *Metrics) ObserveEvent(evt business.Event, d time.Duration) {
+	name := "unknown"
+	if t := reflect.TypeOf(evt); t != nil {
+		name = t.Name()
+	}
+	m.eventDuration.WithLabelValues(name).Observe(d.Seconds())
+
+	switch evt := evt.(type) {
+	case business.GraphUpdate, business.EdgeEdit, business.NodeRemove, business.ResetEvent, business.RestoreSnapshot:
+		m.graphUpdates.Inc()
+	case business.MeasurementUpdate:
+		m.measurementUpdates.Inc()
+	case business.BatchMeasurementUpdate:
+		m.measurementUpdates.Add(float64(len(evt.Measurements)))
+	}
+}
+
+// decodeError counts a payload of r that could not be decoded. It is a no-op
+// on nil metrics, so handlers need not check whether metrics are enabled.
+func (m *Metrics) decodeError(r *http.Request) {
+	if m == nil {
+		return
+	}
+	m.decodeErrors.WithLabelValues(endpointOf(r)).Inc()
+}
+
+// handler serves the metrics in the Prometheus text format.
+func (m *Metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// instrument counts the requests served by mux, labelled with the route
+// pattern they matched rather than their path.
+func (m *Metrics) instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		// The mux sets r.Pattern on the request it is given.
+		r.Pattern = ""
+		mux.ServeHTTP(rec, r)
+
+		endpoint := endpointOf(r)
+		m.requests.WithLabelValues(endpoint, r.Method, strconv.Itoa(rec.status)).Inc()
+		if rec.status == http.StatusTooManyRequests {
+			m.busyRejections.WithLabelValues(endpoint).Inc()
+		}
+	})
+}
+
+// endpointOf returns the route pattern r matched.
+func endpointOf(r *http.Request) string {
+	if r.Pattern == "" {
+		return unmatchedEndpoint
+	}
+	return r.Pattern
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController, so handlers
+// can still flush, set deadlines or hijack the connection through the recorder.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// scrape returns the body of GET /metrics.
+func scrape(t *testing.T, h http.Handler) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.test/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want the text exposition format", ct)
+	}
+	b, _ := io.ReadAll(rr.Body)
+	return string(b)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	var grid *business.Grid
+	metrics := NewMetrics(func() int { return grid.IslandCount() })
+	grid = business.NewGrid(business.WithEventTimer(metrics.ObserveEvent))
+	events := make(chan business.Event, 8)
+	go grid.Loop(ctx, events)
+	h := foundation.WrapMiddleware(All(WithMetrics(metrics)), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{"nodes": []string{"A", "B", "C"}, "edges": [][]string{{"A", "B"}}}, nil)
+	postJSON(t, h, "/measurements", []map[string]any{{"node": "A", "value": 1}, {"node": "C", "value": 2}}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 3}, nil)
+	doRequest(t, h, http.MethodPost, "/measurements", "application/json", "not a measurement")
+	getJSON(t, h, "/no/such/route", nil)
+	// The loop times an event once it is processed: this query guarantees the
+	// events above are counted.
+	getJSON(t, h, "/measurements", nil)
+
+	body := scrape(t, h)
+	for _, want := range []string{
+		"zgrid_graph_updates_total 1\n",
+		"zgrid_measurement_updates_total 3\n",
+		"zgrid_islands 2\n",
+		`zgrid_decode_errors_total{endpoint="/measurements"} 1` + "\n",
+		`zgrid_http_requests_total{endpoint="/graph",method="POST",status="200"} 1` + "\n",
+		`zgrid_http_requests_total{endpoint="/measurements",method="POST",status="200"} 2` + "\n",
+		`zgrid_http_requests_total{endpoint="/measurements",method="POST",status="400"} 1` + "\n",
+		`zgrid_http_requests_total{endpoint="unmatched",method="GET",status="404"} 1` + "\n",
+		`zgrid_event_duration_seconds_count{event="GraphUpdate"} 1` + "\n",
+		`zgrid_event_duration_seconds_count{event="BatchMeasurementUpdate"} 1` + "\n",
+		"go_goroutines ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q", strings.TrimSpace(want))
+		}
+	}
+}
+
+func TestMetricsCountBackpressureRejections(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewMetrics(func() int { return 0 })
+	events := make(chan business.Event) // unbuffered, no consumer => send blocks
+	h := foundation.WrapMiddleware(All(WithMetrics(metrics)), GridEventsMiddleware(events))
+
+	for range 2 {
+		if status := doRequest(t, h, http.MethodGet, "/measurements", "", nil); status != http.StatusTooManyRequests {
+			t.Fatalf("status = %d, want %d", status, http.StatusTooManyRequests)
+		}
+	}
+
+	if body, want := scrape(t, h), `zgrid_backpressure_rejections_total{endpoint="GET /measurements"} 2`; !strings.Contains(body, want) {
+		t.Errorf("metrics lack %q", want)
+	}
+}
+
+func TestMetricsRouteDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	h := All()
+	if status := getJSON(t, h, "/metrics", nil); status != http.StatusNotFound {
+		t.Fatalf("GET /metrics status = %d, want %d", status, http.StatusNotFound)
+	}
+}
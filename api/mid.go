@@ -4,14 +4,22 @@ import (
 	"context"
 	"net/http"
 	"zgrid/business"
+	"zgrid/foundation"
 )
 
+// notReadyRetryAfter is the Retry-After, in seconds, sent while the grid is not
+// ready.
+const notReadyRetryAfter = "1"
+
 // ContextKey differentiates values stored in request contexts.
 type ContextKey int
 
 const (
 	// GridEventsKey is the context key used to store the event channel.
 	GridEventsKey ContextKey = iota
+
+	// apiVersionKey stores the negotiated APIVersion of the request.
+	apiVersionKey
 )
 
 // GridEventsMiddleware injects the shared event channel into the request context.
@@ -25,6 +33,28 @@ func GridEventsMiddleware(evts chan<- business.Event) func(next http.Handler) ht
 	}
 }
 
+// ReadinessGate answers 503 with a Retry-After header until ready is closed,
+// so early requests do not race the startup of the grid loop. The liveness
+// probe passes: the server is up even while the loop starts.
+func ReadinessGate(ready <-chan struct{}) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == livenessPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+			select {
+			case <-ready:
+			default:
+				w.Header().Set("Retry-After", notReadyRetryAfter)
+				foundation.Respond(w, http.StatusServiceUnavailable, newErrResp("server is starting, try again"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func getStateEvents(ctx context.Context) chan<- business.Event {
 	events, ok := ctx.Value(GridEventsKey).(chan<- business.Event)
 	if !ok {
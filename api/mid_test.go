@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestReadinessGate(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	grid := business.NewGrid()
+	h := foundation.WrapMiddleware(All(), ReadinessGate(grid.Ready()), GridEventsMiddleware(events))
+
+	get := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.test/islands/metrics", nil))
+		return rr
+	}
+
+	// The loop has not started: nothing may reach the grid.
+	rr := get()
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status before ready = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if got := rr.Header().Get("Retry-After"); got != notReadyRetryAfter {
+		t.Fatalf("Retry-After = %q, want %q", got, notReadyRetryAfter)
+	}
+	if len(events) != 0 {
+		t.Fatalf("%d events enqueued before ready", len(events))
+	}
+
+	go grid.Loop(ctx, events)
+	<-grid.Ready()
+
+	if rr := get(); rr.Code != http.StatusOK {
+		t.Fatalf("status after ready = %d, want %d", rr.Code, http.StatusOK)
+	}
+}
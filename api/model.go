@@ -1,41 +1,182 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"slices"
+	"zgrid/business"
 )
 
-// Edge represents a connection between two nodes in the graph.
-type Edge []string
+// Edge represents a connection between two nodes in the graph. It is sent as
+// ["A", "B"], optionally with a weight (e.g. its capacity) as a third element,
+// ["A", "B", 2.5], or as an object, {"from": "A", "to": "B", "weight": 2.5}.
+// Edges without a weight weigh 1.
+type Edge struct {
+	Nodes  []string
+	Weight *float64 // nil when the edge has no weight
+}
+
+// edgeObject is the object form of an Edge.
+type edgeObject struct {
+	From   *string  `json:"from"`
+	To     *string  `json:"to"`
+	Weight *float64 `json:"weight"`
+}
 
-// MarshalJSON implements the json.Marshaler interface for Edge.
-// Returns an error if the edge does not connect exactly two nodes.
+// MarshalJSON implements the json.Marshaler interface for Edge, using the
+// array form. Returns an error if the edge does not connect exactly two nodes.
 func (e Edge) MarshalJSON() ([]byte, error) {
-	if len(e) != 2 {
+	if len(e.Nodes) != 2 {
 		return nil, fmt.Errorf("each edge must connect exactly two nodes")
 	}
 
-	data, err := json.Marshal([]string(e))
-	if err != nil {
-		return nil, err
+	elems := []any{e.Nodes[0], e.Nodes[1]}
+	if e.Weight != nil {
+		elems = append(elems, *e.Weight)
 	}
-
-	return data, nil
+	return json.Marshal(elems)
 }
 
-// UnmarshalJSON implements the json.Unmarshaler interface for Edge.
-// Returns an error if the edge does not connect exactly two nodes.
+// UnmarshalJSON implements the json.Unmarshaler interface for Edge, accepting
+// both the array and the object form. The array is decoded element by element,
+// so node names may contain commas or any other character. The object is
+// decoded as strictly as the payload around it, rejecting unknown fields.
+// Returns an error if the edge does not connect exactly two nodes given as
+// strings.
 func (e *Edge) UnmarshalJSON(data []byte) error {
-	if strings.Count(string(data), ",") != 1 {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var obj edgeObject
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&obj); err != nil {
+			return err
+		}
+		if obj.From == nil || obj.To == nil {
+			return fmt.Errorf("each edge must connect exactly two nodes")
+		}
+		*e = Edge{Nodes: []string{*obj.From, *obj.To}, Weight: obj.Weight}
+		return nil
+	}
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return fmt.Errorf("each edge must be an array of two nodes or an object")
+	}
+	if len(elems) != 2 && len(elems) != 3 {
 		return fmt.Errorf("each edge must connect exactly two nodes")
 	}
 
-	var nodes []string
-	if err := json.Unmarshal(data, &nodes); err != nil {
-		return err
+	nodes := make([]string, 2)
+	for i := range nodes {
+		// A nested array, as in [["A", "B"]], is not a node.
+		if err := json.Unmarshal(elems[i], &nodes[i]); err != nil {
+			return fmt.Errorf("edge nodes must be strings")
+		}
+	}
+	edge := Edge{Nodes: nodes}
+	if len(elems) == 3 {
+		var weight float64
+		if err := json.Unmarshal(elems[2], &weight); err != nil {
+			return fmt.Errorf("edge weight must be a number")
+		}
+		edge.Weight = &weight
 	}
 
-	*e = Edge(nodes)
+	*e = edge
 	return nil
 }
+
+// parseRoles converts the "roles" object of a graph payload (node -> "source" or
+// "sink") into business roles. Nodes without an entry are sources.
+func parseRoles(raw map[string]string) (map[string]business.NodeRole, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	roles := make(map[string]business.NodeRole, len(raw))
+	for node, role := range raw {
+		switch role {
+		case "source":
+			roles[node] = business.RoleSource
+		case "sink":
+			roles[node] = business.RoleSink
+		default:
+			return nil, fmt.Errorf("invalid role %q for node %q", role, node)
+		}
+	}
+	return roles, nil
+}
+
+// transformPayload is the per-node entry of the "transforms" object of a graph
+// payload. A missing scale means 1.
+type transformPayload struct {
+	Scale  *float64 `json:"scale"`
+	Offset float64  `json:"offset"`
+}
+
+// parseTransforms converts the "transforms" object of a graph payload (node ->
+// scale and offset) into business transforms, rejecting non-finite ones.
+func parseTransforms(raw map[string]transformPayload) (map[string]business.Transform, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	transforms := make(map[string]business.Transform, len(raw))
+	for node, tr := range raw {
+		t := business.Transform{Scale: 1, Offset: tr.Offset}
+		if tr.Scale != nil {
+			t.Scale = *tr.Scale
+		}
+		if err := t.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid transform for node %q: %w", node, err)
+		}
+		transforms[node] = t
+	}
+	return transforms, nil
+}
+
+// unknownGraphNodes returns, sorted, the nodes of transforms that are not
+// among nodes and the aliases whose targets are not, which the grid would
+// otherwise drop silently.
+func unknownGraphNodes(nodes []string, transforms map[string]transformPayload, aliases map[string]string) (unknownTransforms, unknownAliases []string) {
+	if len(transforms) == 0 && len(aliases) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		known[n] = true
+	}
+	for node := range transforms {
+		if !known[node] {
+			unknownTransforms = append(unknownTransforms, node)
+		}
+	}
+	for alias, target := range aliases {
+		if !known[target] {
+			unknownAliases = append(unknownAliases, alias)
+		}
+	}
+	slices.Sort(unknownTransforms)
+	slices.Sort(unknownAliases)
+	return unknownTransforms, unknownAliases
+}
+
+// graphWarnings is the "warnings" object of a graph response, counting the
+// posted edges that were dropped from the graph.
+type graphWarnings struct {
+	SelfLoops      int `json:"self_loops,omitempty"`
+	DuplicateEdges int `json:"duplicate_edges,omitempty"`
+	IgnoredEdges   int `json:"ignored_edges,omitempty"` // edges to nodes not in the graph
+}
+
+// newGraphWarnings returns the warnings for diag, or nil when nothing was
+// dropped.
+func newGraphWarnings(diag business.GraphDiagnostics) *graphWarnings {
+	w := graphWarnings{SelfLoops: diag.SelfLoops, DuplicateEdges: diag.Duplicates, IgnoredEdges: len(diag.Unknown)}
+	if w == (graphWarnings{}) {
+		return nil
+	}
+	return &w
+}
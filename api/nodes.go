@@ -0,0 +1,247 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// nodesExistHandler reports which of the given node IDs are part of the
+// current graph, so clients can avoid sending measurements that would be
+// dropped.
+func (h *handlers) nodesExistHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	type existsPayload struct {
+		Nodes []string `json:"nodes"`
+	}
+
+	payload, err := foundation.Decode[existsPayload](w, r)
+	if err != nil {
+		h.respondDecodeError(w, r, err, "invalid nodes payload")
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan map[string]bool, 1)
+	exists, ok := query(ctx, w, events, business.NodesExistQuery{Nodes: payload.Nodes, Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	foundation.Respond(w, http.StatusOK, exists)
+}
+
+// nodeDetail is the JSON form of business.NodeDetail. Island and value are
+// omitted when the node is outside the graph or has not been measured.
+type nodeDetail struct {
+	Node    string   `json:"node"`
+	InGraph bool     `json:"in_graph"`
+	Island  *int     `json:"island,omitempty"`
+	Value   *float64 `json:"value,omitempty"`
+	Source  string   `json:"source"`
+}
+
+// nodeDetailHandler returns the stored state of a single node, including the
+// source that reported its latest value.
+func (h *handlers) nodeDetailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	node := r.PathValue("node")
+	if node == "" {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp("node is required"))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.NodeDetail, 1)
+	detail, ok := query(ctx, w, events, business.NodeDetailQuery{Node: node, Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	if !detail.InGraph && !detail.Measured {
+		foundation.Respond(w, http.StatusNotFound, newErrResp("node not found"))
+		return
+	}
+
+	out := nodeDetail{
+		Node:    detail.Node,
+		InGraph: detail.InGraph,
+		Source:  detail.Source,
+	}
+	if detail.InGraph {
+		out.Island = &detail.Island
+	}
+	if detail.Measured {
+		out.Value = &detail.Value
+	}
+	foundation.Respond(w, http.StatusOK, out)
+}
+
+// nodeCASHandler sets the value of a node only if its current value is the
+// expected one, for writers coordinating through optimistic concurrency.
+func (h *handlers) nodeCASHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	format, err := parseTotalsFormat(r)
+	if err != nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+		return
+	}
+
+	// A null (or missing) expected value matches a node that was never measured.
+	type casPayload struct {
+		Expected *float64 `json:"expected"`
+		New      *float64 `json:"new"`
+	}
+
+	payload, err := foundation.Decode[casPayload](w, r)
+	if err != nil {
+		h.respondDecodeError(w, r, err, "invalid cas payload")
+		return
+	}
+	if payload.New == nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp("new is required"))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.CASResult, 1)
+	res, ok := query(ctx, w, events, business.CompareAndSet{
+		Node:     r.PathValue("node"),
+		Expected: payload.Expected,
+		New:      *payload.New,
+		Reply:    resp,
+	}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	switch {
+	case errors.Is(res.Err, business.ErrUnknownNode):
+		foundation.Respond(w, http.StatusNotFound, newErrResp(res.Err.Error()))
+	case res.Err != nil:
+		foundation.Respond(w, http.StatusServiceUnavailable, newErrResp(res.Err.Error()))
+	case !res.Swapped:
+		var current *float64
+		if res.Measured {
+			current = &res.Current
+		}
+		foundation.Respond(w, http.StatusConflict, struct {
+			errorResponse
+			Current *float64 `json:"current"`
+		}{
+			errorResponse: foundation.NewErrorResponse(w, "current value does not match expected"),
+			Current:       current,
+		})
+	default:
+		foundation.Respond(w, http.StatusOK, present(format, res.Totals))
+	}
+}
+
+// nodeHistory is the JSON form of business.NodeHistory.
+type nodeHistory struct {
+	Node    string    `json:"node"`
+	InGraph bool      `json:"in_graph"`
+	History []reading `json:"history"`
+}
+
+// reading is the JSON form of business.Reading.
+type reading struct {
+	Value float64   `json:"value"`
+	At    time.Time `json:"at"`
+	Taken time.Time `json:"taken,omitzero"` // the version 2 timestamp, if any
+}
+
+// nodeHistoryHandler returns the measurements retained for a single node,
+// oldest first.
+func (h *handlers) nodeHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	node := r.PathValue("node")
+	if node == "" {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp("node is required"))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.NodeHistory, 1)
+	history, ok := query(ctx, w, events, business.NodeHistoryQuery{Node: node, Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	if !history.InGraph && len(history.Readings) == 0 {
+		foundation.Respond(w, http.StatusNotFound, newErrResp("node not found"))
+		return
+	}
+
+	out := nodeHistory{
+		Node:    history.Node,
+		InGraph: history.InGraph,
+		History: make([]reading, len(history.Readings)),
+	}
+	for i, rd := range history.Readings {
+		out.History[i] = reading{Value: rd.Value, At: rd.At, Taken: rd.Taken}
+	}
+	foundation.Respond(w, http.StatusOK, out)
+}
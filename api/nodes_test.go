@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestNodesExistEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+
+	tests := []struct {
+		name  string
+		nodes []string
+		want  map[string]bool
+	}{
+		{name: "present and absent nodes", nodes: []string{"A", "Z", "B"}, want: map[string]bool{"A": true, "Z": false, "B": true}},
+		{name: "empty input", nodes: []string{}, want: map[string]bool{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]bool
+			status := postJSON(t, h, "/nodes/exists", map[string]any{"nodes": tt.nodes}, &got)
+			if status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("exists = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeDetailEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{},
+	}, nil)
+
+	var got nodeDetail
+	if status := getJSON(t, h, "/nodes/B", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if got.Value != nil || got.Island == nil || *got.Island != 1 || got.Source != "" {
+		t.Fatalf("unmeasured detail = %+v", got)
+	}
+
+	for _, source := range []string{"agent-1", "agent-2"} {
+		postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 2, "source": source}, nil)
+
+		got = nodeDetail{}
+		if status := getJSON(t, h, "/nodes/A", &got); status != http.StatusOK {
+			t.Fatalf("status = %d, want %d", status, http.StatusOK)
+		}
+		if got.Source != source || got.Value == nil || *got.Value != 2 || !got.InGraph {
+			t.Fatalf("detail = %+v, want source %q and value 2", got, source)
+		}
+	}
+
+	if status := getJSON(t, h, "/nodes/Z", nil); status != http.StatusNotFound {
+		t.Fatalf("unknown node status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestNodeHistoryEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	at := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	go business.NewGrid(business.WithMeasurementHistory(3), business.WithClock(func() time.Time { return at })).Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+
+	var got nodeHistory
+	if status := getJSON(t, h, "/nodes/B/history", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if want := (nodeHistory{Node: "B", InGraph: true, History: []reading{}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unmeasured history = %+v, want %+v", got, want)
+	}
+
+	for _, v := range []float64{1, 2, 3, 4} {
+		postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": v}, nil)
+	}
+	got = nodeHistory{}
+	if status := getJSON(t, h, "/nodes/A/history", &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if want := []reading{{Value: 2, At: at}, {Value: 3, At: at}, {Value: 4, At: at}}; !reflect.DeepEqual(got.History, want) {
+		t.Fatalf("history = %+v, want %+v", got.History, want)
+	}
+
+	if status := doRequest(t, h, http.MethodDelete, "/graph/nodes/A", "", nil); status != http.StatusOK {
+		t.Fatalf("node delete status = %d, want %d", status, http.StatusOK)
+	}
+	for _, path := range []string{"/nodes/A/history", "/nodes/Z/history"} {
+		if status := getJSON(t, h, path, nil); status != http.StatusNotFound {
+			t.Fatalf("GET %s status = %d, want %d", path, status, http.StatusNotFound)
+		}
+	}
+}
+
+func TestNodeCASEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 5.3}, nil)
+
+	var totals []business.IslandMeasurement
+	status := postJSON(t, h, "/nodes/A/cas", map[string]any{"expected": 5.3, "new": 6.0}, &totals)
+	if status != http.StatusOK {
+		t.Fatalf("matching cas status = %d, want %d", status, http.StatusOK)
+	}
+	if len(totals) != 1 || !floatEqual(totals[0].Total, 6) {
+		t.Fatalf("totals = %v, want 6", totals)
+	}
+
+	var conflict struct {
+		Error   string   `json:"error"`
+		Current *float64 `json:"current"`
+	}
+	status = postJSON(t, h, "/nodes/A/cas", map[string]any{"expected": 5.3, "new": 7.0}, &conflict)
+	if status != http.StatusConflict {
+		t.Fatalf("mismatching cas status = %d, want %d", status, http.StatusConflict)
+	}
+	if conflict.Current == nil || *conflict.Current != 6 {
+		t.Fatalf("conflict = %+v, want current 6", conflict)
+	}
+
+	conflict.Current = nil
+	status = postJSON(t, h, "/nodes/B/cas", map[string]any{"expected": 0, "new": 1}, &conflict)
+	if status != http.StatusConflict || conflict.Current != nil {
+		t.Fatalf("cas on unset node = %d %+v, want 409 with null current", status, conflict)
+	}
+
+	if status := postJSON(t, h, "/nodes/B/cas", map[string]any{"expected": nil, "new": 1}, nil); status != http.StatusOK {
+		t.Fatalf("cas against unset = %d, want %d", status, http.StatusOK)
+	}
+	if status := postJSON(t, h, "/nodes/Z/cas", map[string]any{"new": 1}, nil); status != http.StatusNotFound {
+		t.Fatalf("cas on unknown node = %d, want %d", status, http.StatusNotFound)
+	}
+	if status := postJSON(t, h, "/nodes/A/cas", map[string]any{"expected": 6}, nil); status != http.StatusBadRequest {
+		t.Fatalf("cas without new = %d, want %d", status, http.StatusBadRequest)
+	}
+}
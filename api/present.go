@@ -0,0 +1,205 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"zgrid/business"
+)
+
+// totalsScale selects the unit of island totals in responses.
+type totalsScale int
+
+const (
+	totalsAbsolute totalsScale = iota // raw totals (default)
+	totalsPercent                     // share of the grand total, in percent
+)
+
+// totalsFormat selects how island totals are presented in responses.
+type totalsFormat struct {
+	scale   totalsScale
+	count   bool // include the number of nodes and of reporting nodes per island
+	stats   bool // include the min, max and mean measurement per island
+	weight  bool // include the summed weight of the edges of each island
+	updated bool // include when each island last received a measurement
+}
+
+// islandTotal is the JSON form of business.IslandMeasurement. The counts, the
+// stats, the edge weight and the last update are only sent when asked for,
+// keeping the default body unchanged.
+type islandTotal struct {
+	Island    []string
+	Total     float64
+	Count     *int     `json:",omitempty"`
+	NodeCount *int     `json:",omitempty"`
+	Min       *float64 `json:",omitempty"`
+	Max       *float64 `json:",omitempty"`
+	Average   *float64 `json:",omitempty"`
+
+	EdgeWeight *float64 `json:",omitempty"`
+
+	// LastUpdated is the zero time, 0001-01-01T00:00:00Z, while the island has
+	// no measurement.
+	LastUpdated *time.Time `json:",omitempty"`
+
+	Overflow bool `json:",omitempty"` // Total or a node value is clamped, it exceeded the float64 range
+}
+
+// parseTotalsFormat reads the "as", "count", "stats", "weight" and "updated"
+// query parameters.
+func parseTotalsFormat(r *http.Request) (totalsFormat, error) {
+	var format totalsFormat
+
+	switch as := r.URL.Query().Get("as"); as {
+	case "", "absolute":
+		format.scale = totalsAbsolute
+	case "percent":
+		format.scale = totalsPercent
+	default:
+		return format, fmt.Errorf("invalid as=%q: want absolute or percent", as)
+	}
+
+	if raw := r.URL.Query().Get("count"); raw != "" {
+		count, err := strconv.ParseBool(raw)
+		if err != nil {
+			return format, fmt.Errorf("invalid count=%q: want true or false", raw)
+		}
+		format.count = count
+	}
+
+	if raw := r.URL.Query().Get("stats"); raw != "" {
+		stats, err := strconv.ParseBool(raw)
+		if err != nil {
+			return format, fmt.Errorf("invalid stats=%q: want true or false", raw)
+		}
+		format.stats = stats
+	}
+
+	if raw := r.URL.Query().Get("weight"); raw != "" {
+		weight, err := strconv.ParseBool(raw)
+		if err != nil {
+			return format, fmt.Errorf("invalid weight=%q: want true or false", raw)
+		}
+		format.weight = weight
+	}
+
+	if raw := r.URL.Query().Get("updated"); raw != "" {
+		updated, err := strconv.ParseBool(raw)
+		if err != nil {
+			return format, fmt.Errorf("invalid updated=%q: want true or false", raw)
+		}
+		format.updated = updated
+	}
+
+	return format, nil
+}
+
+// present applies format to totals. The input slice is never modified.
+func present(format totalsFormat, totals []business.IslandMeasurement) []islandTotal {
+	if format.scale == totalsPercent {
+		totals = asPercent(totals)
+	}
+
+	out := make([]islandTotal, len(totals))
+	for i, t := range totals {
+		out[i] = islandTotal{Island: t.Island, Total: t.Total, Overflow: t.Overflow}
+		if format.count {
+			out[i].Count, out[i].NodeCount = &totals[i].MeasuredCount, &totals[i].NodeCount
+		}
+		if format.stats {
+			out[i].Min, out[i].Max, out[i].Average = &totals[i].Min, &totals[i].Max, &totals[i].Average
+		}
+		if format.weight {
+			out[i].EdgeWeight = &totals[i].EdgeWeight
+		}
+		if format.updated {
+			out[i].LastUpdated = &totals[i].LastUpdated
+		}
+	}
+	return out
+}
+
+// asPercent returns a copy of totals where each Total is its percentage of the
+// grand total. When the grand total is 0 every percentage is 0.
+func asPercent(totals []business.IslandMeasurement) []business.IslandMeasurement {
+	var grand float64
+	for _, t := range totals {
+		grand += t.Total
+	}
+
+	out := make([]business.IslandMeasurement, len(totals))
+	for i, t := range totals {
+		out[i] = t
+		if grand == 0 {
+			out[i].Total = 0
+			continue
+		}
+		out[i].Total = t.Total / grand * 100
+	}
+	return out
+}
+
+// parseEcho reads the "echo" query parameter, which wraps the totals of a
+// measurement response together with the accepted measurement.
+func parseEcho(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get("echo")
+	if raw == "" {
+		return false, nil
+	}
+	echo, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid echo=%q: want true or false", raw)
+	}
+	return echo, nil
+}
+
+// parseEnvelope reads the "envelope" query parameter, which wraps the totals of
+// a measurement response in an object telling whether they changed.
+func parseEnvelope(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get("envelope")
+	if raw == "" {
+		return false, nil
+	}
+	envelope, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid envelope=%q: want true or false", raw)
+	}
+	return envelope, nil
+}
+
+// parseStrict reads the "strict" query parameter, which makes a graph update
+// reject edges to unknown nodes instead of ignoring them.
+func parseStrict(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get("strict")
+	if raw == "" {
+		return false, nil
+	}
+	strict, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid strict=%q: want true or false", raw)
+	}
+	return strict, nil
+}
+
+// acceptedMeasurement echoes a measurement and whether the grid stored it.
+type acceptedMeasurement struct {
+	Node    string  `json:"node"`
+	Value   float64 `json:"value"`
+	Applied bool    `json:"applied"`
+	Changed bool    `json:"changed"`
+}
+
+// echoedTotals is the measurement response body requested with ?echo=true.
+type echoedTotals struct {
+	Accepted acceptedMeasurement `json:"accepted"`
+	Totals   []islandTotal       `json:"totals"`
+}
+
+// envelopedTotals is the measurement response body requested with
+// ?envelope=true. Changed carries what the X-Totals-Changed header does, for
+// clients that cannot read response headers.
+type envelopedTotals struct {
+	Changed bool          `json:"changed"`
+	Totals  []islandTotal `json:"totals"`
+}
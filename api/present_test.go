@@ -0,0 +1,359 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestAsPercent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		totals []float64
+		want   []float64
+	}{
+		{name: "normal case", totals: []float64{30, 10, 60}, want: []float64{30, 10, 60}},
+		{name: "uneven split", totals: []float64{1, 3}, want: []float64{25, 75}},
+		{name: "all zero", totals: []float64{0, 0, 0}, want: []float64{0, 0, 0}},
+		{name: "single island", totals: []float64{42}, want: []float64{100}},
+		{name: "empty grid", totals: nil, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := make([]business.IslandMeasurement, len(tt.totals))
+			for i, total := range tt.totals {
+				in[i] = business.IslandMeasurement{Island: []string{"n"}, Total: total}
+			}
+
+			got := asPercent(in)
+			if len(got) != len(tt.want) {
+				t.Fatalf("asPercent() = %v, want totals %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if !floatEqual(got[i].Total, tt.want[i]) {
+					t.Fatalf("asPercent() = %v, want totals %v", got, tt.want)
+				}
+				// The input must be left untouched.
+				if in[i].Total != tt.totals[i] {
+					t.Fatalf("input modified: %v", in)
+				}
+			}
+		})
+	}
+}
+
+func TestPresentOverflowFlag(t *testing.T) {
+	t.Parallel()
+
+	out := present(totalsFormat{}, []business.IslandMeasurement{
+		{Island: []string{"A"}, Total: math.MaxFloat64, Overflow: true},
+		{Island: []string{"B"}, Total: 1},
+	})
+
+	b, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `[{"Island":["A"],"Total":1.7976931348623157e+308,"Overflow":true},{"Island":["B"],"Total":1}]`
+	if string(b) != want {
+		t.Fatalf("body = %s, want %s", b, want)
+	}
+}
+
+func TestMeasurementsAsPercent(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 1}, nil)
+
+	var totals []business.IslandMeasurement
+	status := postJSON(t, h, "/measurements?as=percent", map[string]any{"node": "B", "value": 3}, &totals)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if !floatEqual(totals[0].Total, 25) || !floatEqual(totals[1].Total, 75) {
+		t.Fatalf("totals = %v, want 25%% and 75%%", totals)
+	}
+
+	if status := postJSON(t, h, "/measurements?as=ratio", map[string]any{"node": "B", "value": 3}, nil); status != http.StatusBadRequest {
+		t.Fatalf("invalid format status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestMeasurementsEcho(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A"},
+		"edges": [][]string{},
+	}, nil)
+
+	tests := []struct {
+		name string
+		node string
+		want acceptedMeasurement
+	}{
+		{name: "applied", node: "A", want: acceptedMeasurement{Node: "A", Value: 5.3, Applied: true, Changed: true}},
+		{name: "same value does not change totals", node: "A", want: acceptedMeasurement{Node: "A", Value: 5.3, Applied: true}},
+		{name: "unknown node is dropped", node: "Z", want: acceptedMeasurement{Node: "Z", Value: 5.3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got echoedTotals
+			status := postJSON(t, h, "/measurements?echo=true", map[string]any{"node": tt.node, "value": 5.3}, &got)
+			if status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+			if got.Accepted != tt.want {
+				t.Fatalf("accepted = %+v, want %+v", got.Accepted, tt.want)
+			}
+			if len(got.Totals) != 1 || !floatEqual(got.Totals[0].Total, 5.3) {
+				t.Fatalf("totals = %v, want one island with total 5.3", got.Totals)
+			}
+		})
+	}
+
+	if status := postJSON(t, h, "/measurements?echo=maybe", map[string]any{"node": "A", "value": 1}, nil); status != http.StatusBadRequest {
+		t.Fatalf("invalid echo status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestMeasurementsChangedHeader(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A"},
+		"edges": [][]string{},
+	}, nil)
+
+	// Steps run in order: the second post repeats the stored value.
+	steps := []struct {
+		body string
+		want string
+	}{
+		{body: `{"node":"A","value":1}`, want: "true"},
+		{body: `{"node":"A","value":1}`, want: "false"},
+		{body: `{"node":"Z","value":1}`, want: "false"},
+	}
+
+	for _, st := range steps {
+		req := httptest.NewRequest(http.MethodPost, "http://example.test/measurements", strings.NewReader(st.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", st.body, rr.Code, http.StatusOK)
+		}
+		if got := rr.Header().Get("X-Totals-Changed"); got != st.want {
+			t.Fatalf("%s: X-Totals-Changed = %q, want %q", st.body, got, st.want)
+		}
+	}
+}
+
+func TestMeasurementsEnvelope(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{},
+	}, nil)
+
+	// Steps run in order; the body carries what X-Totals-Changed does.
+	steps := []struct {
+		name        string
+		body        any
+		wantChanged bool
+		wantTotal   float64 // of the island of A
+	}{
+		{name: "new value", body: map[string]any{"node": "A", "value": 1}, wantChanged: true, wantTotal: 1},
+		{name: "same value", body: map[string]any{"node": "A", "value": 1}, wantTotal: 1},
+		{name: "unknown node", body: map[string]any{"node": "Z", "value": 1}, wantTotal: 1},
+		{name: "batch that cancels out", body: []map[string]any{{"node": "A", "value": 2}, {"node": "A", "value": 1}}, wantTotal: 1},
+		{name: "batch", body: []map[string]any{{"node": "A", "value": 3}, {"node": "B", "value": 1}}, wantChanged: true, wantTotal: 3},
+	}
+
+	for _, st := range steps {
+		var got envelopedTotals
+		if status := postJSON(t, h, "/measurements?envelope=true", st.body, &got); status != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", st.name, status, http.StatusOK)
+		}
+		if got.Changed != st.wantChanged || len(got.Totals) != 2 || got.Totals[0].Total != st.wantTotal {
+			t.Fatalf("%s: body = %+v, want changed %v and a total of %v for A", st.name, got, st.wantChanged, st.wantTotal)
+		}
+	}
+
+	for _, path := range []string{"/measurements?envelope=maybe", "/measurements?envelope=true&echo=true"} {
+		if status := postJSON(t, h, path, map[string]any{"node": "A", "value": 1}, nil); status != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want %d", path, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestMeasurementsWithCount(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 1}, nil)
+
+	var totals []map[string]any
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 3}, &totals)
+	if _, ok := totals[0]["Count"]; ok {
+		t.Fatalf("default totals = %v, want no count", totals)
+	}
+
+	totals = nil
+	status := postJSON(t, h, "/measurements?count=true", map[string]any{"node": "B", "value": 3}, &totals)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if totals[0]["Total"] != 4.0 || totals[0]["Count"] != 2.0 || totals[1]["Count"] != 0.0 {
+		t.Fatalf("totals = %v, want total 4 from 2 nodes and an island with count 0", totals)
+	}
+	if totals[0]["NodeCount"] != 2.0 || totals[1]["NodeCount"] != 1.0 {
+		t.Fatalf("totals = %v, want node counts 2 and 1", totals)
+	}
+
+	if status := postJSON(t, h, "/measurements?count=yes", map[string]any{"node": "B", "value": 3}, nil); status != http.StatusBadRequest {
+		t.Fatalf("invalid count status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestMeasurementsWithStats(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 1}, nil)
+
+	var totals []map[string]any
+	postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 3}, &totals)
+	if _, ok := totals[0]["Min"]; ok {
+		t.Fatalf("default totals = %v, want no stats", totals)
+	}
+
+	totals = nil
+	if status := postJSON(t, h, "/measurements?stats=true&as=percent", map[string]any{"node": "B", "value": 3}, &totals); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if totals[0]["Min"] != 1.0 || totals[0]["Max"] != 3.0 || totals[0]["Average"] != 2.0 {
+		t.Fatalf("totals = %v, want min 1, max 3, average 2", totals)
+	}
+	if totals[1]["Min"] != 0.0 || totals[1]["Max"] != 0.0 || totals[1]["Average"] != 0.0 {
+		t.Fatalf("totals = %v, want zero stats for the unmeasured island", totals)
+	}
+
+	if status := postJSON(t, h, "/measurements?stats=maybe", map[string]any{"node": "B", "value": 3}, nil); status != http.StatusBadRequest {
+		t.Fatalf("invalid stats status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestMeasurementsWithUpdated(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	at := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	events := make(chan business.Event, 16)
+	go business.NewGrid(business.WithClock(func() time.Time { return at })).Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+
+	var totals []map[string]any
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 1}, &totals)
+	if _, ok := totals[0]["LastUpdated"]; ok {
+		t.Fatalf("default totals = %v, want no last update", totals)
+	}
+
+	totals = nil
+	if status := getJSON(t, h, "/measurements?updated=true", &totals); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if totals[0]["LastUpdated"] != "2024-03-01T12:00:00Z" || totals[1]["LastUpdated"] != "0001-01-01T00:00:00Z" {
+		t.Fatalf("totals = %v, want the measurement time and the zero time for the unmeasured island", totals)
+	}
+
+	if status := getJSON(t, h, "/measurements?updated=maybe", nil); status != http.StatusBadRequest {
+		t.Fatalf("invalid updated status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
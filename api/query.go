@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// query sends a read event to the grid loop and waits for its reply. When the
+// request context ends first it responds with 408 and reports false, and when
+// processing the event panicked, leaving no reply, with 500; the caller must
+// then return without writing a response.
+func query[T any](ctx context.Context, w http.ResponseWriter, events chan<- business.Event, evt business.Event, reply <-chan T) (T, bool) {
+	var zero T
+
+	select {
+	case events <- evt:
+		select {
+		case res, ok := <-reply:
+			return res, replied(w, ok)
+		case <-ctx.Done():
+			foundation.Respond(w, http.StatusRequestTimeout, newErrResp(http.StatusText(http.StatusRequestTimeout)))
+			return zero, false
+		}
+	case <-ctx.Done():
+		foundation.Respond(w, http.StatusRequestTimeout, newErrResp(http.StatusText(http.StatusRequestTimeout)))
+		return zero, false
+	}
+}
+
+// queryOrBusy is query for reads polled by clients: when the loop does not
+// accept the event within the backpressure timeout of cfg it responds 429, the
+// same as POST /measurements, rather than queueing the poll behind the writes.
+func queryOrBusy[T any](ctx context.Context, w http.ResponseWriter, cfg config, events chan<- business.Event, evt business.Event, reply <-chan T) (T, bool) {
+	var zero T
+
+	select {
+	case events <- evt:
+	case <-cfg.busy():
+		cfg.respondBusy(w)
+		return zero, false
+	case <-ctx.Done():
+		foundation.Respond(w, http.StatusRequestTimeout, newErrResp(http.StatusText(http.StatusRequestTimeout)))
+		return zero, false
+	}
+
+	select {
+	case res, ok := <-reply:
+		return res, replied(w, ok)
+	case <-ctx.Done():
+		foundation.Respond(w, http.StatusRequestTimeout, newErrResp(http.StatusText(http.StatusRequestTimeout)))
+		return zero, false
+	}
+}
+
+// replied responds 500 unless ok: the grid closes the reply channel of an
+// event whose processing panicked when the reply cannot carry the error.
+func replied(w http.ResponseWriter, ok bool) bool {
+	if !ok {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+	}
+	return ok
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"zgrid/foundation"
+)
+
+// methodHasBody reports whether requests of method carry a body, and so may be
+// required to declare its content type.
+func methodHasBody(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
+	}
+	return false
+}
+
+// routes registers the routes of All on mux. It records the methods each path
+// is served with, so that a 405 lists in Allow the methods of every route of
+// the path, not only of the route that answered it.
+type routes struct {
+	mux     *http.ServeMux
+	allowed foundation.AllowedMethods
+}
+
+func newRoutes(mux *http.ServeMux) routes {
+	return routes{mux: mux, allowed: foundation.AllowedMethods{}}
+}
+
+// handle registers h for pattern as is. A method-qualified pattern records its
+// method; ServeMux serves HEAD requests with a GET pattern too.
+func (rt routes) handle(pattern string, h http.Handler) {
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		rt.allowed.Add(path, method)
+		if method == http.MethodGet {
+			rt.allowed.Add(path, http.MethodHead)
+		}
+	}
+	rt.mux.Handle(pattern, h)
+}
+
+// requireMethods checks the method of requests to pattern against methods.
+func (rt routes) requireMethods(pattern string, methods ...string) foundation.Middleware {
+	path := pattern
+	if _, p, ok := strings.Cut(pattern, " "); ok {
+		path = p
+	}
+	return rt.allowed.RequireMethods(path, methods...)
+}
+
+// jsonBodyRoute registers h for a route that decodes a JSON request body: the
+// method is checked, then the body must be declared as application/json, then
+// mws run. It panics if method does not carry a body, as that is a
+// registration mistake.
+func (rt routes) jsonBodyRoute(pattern, method string, h http.HandlerFunc, mws ...foundation.Middleware) {
+	rt.bodyRoute(pattern, method, []string{"application/json"}, h, mws...)
+}
+
+// bodyRoute is jsonBodyRoute for a route whose body may be declared as any of
+// mediaTypes, which h tells apart.
+func (rt routes) bodyRoute(pattern, method string, mediaTypes []string, h http.HandlerFunc, mws ...foundation.Middleware) {
+	if !methodHasBody(method) {
+		panic(fmt.Sprintf("api: %s requests carry no body to require a content type for", method))
+	}
+	rt.handle(pattern, foundation.WrapMiddleware(h, append([]foundation.Middleware{
+		rt.requireMethods(pattern, method),
+		foundation.RequireContentType(mediaTypes...),
+	}, mws...)...))
+}
+
+// noBodyRoute registers h for a route that reads no request body: only the
+// method is checked, whatever Content-Type the client sends, then mws run.
+func (rt routes) noBodyRoute(pattern, method string, h http.HandlerFunc, mws ...foundation.Middleware) {
+	rt.handle(pattern, foundation.WrapMiddleware(h, append([]foundation.Middleware{
+		rt.requireMethods(pattern, method),
+	}, mws...)...))
+}
+
+// readRoute registers h for a read-only route like noBodyRoute, accepting
+// HEAD as well as GET. HEAD is answered with the headers and status of GET and
+// no body.
+func (rt routes) readRoute(pattern string, h http.HandlerFunc, mws ...foundation.Middleware) {
+	rt.handle(pattern, foundation.WrapMiddleware(h, append([]foundation.Middleware{
+		rt.requireMethods(pattern, http.MethodGet, http.MethodHead),
+		foundation.DiscardHeadBody,
+	}, mws...)...))
+}
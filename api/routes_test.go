@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestRouteContentTypeRequirement(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+	postJSON(t, h, "/graph", map[string]any{"nodes": []string{"A"}, "edges": [][]string{}}, nil)
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{method: http.MethodGet, path: "/graph/edges", want: http.StatusOK},
+		{method: http.MethodGet, path: "/islands/metrics", want: http.StatusOK},
+		{method: http.MethodGet, path: "/islands/coverage", want: http.StatusOK},
+		{method: http.MethodGet, path: "/nodes/A", want: http.StatusOK},
+		{method: http.MethodGet, path: "/measurements", want: http.StatusOK},
+		{method: http.MethodHead, path: "/islands", want: http.StatusOK},
+		{method: http.MethodDelete, path: "/measurements", want: http.StatusOK},
+		{method: http.MethodPost, path: "/graph", want: http.StatusUnsupportedMediaType},
+		{method: http.MethodPost, path: "/measurements", want: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		if status := doRequest(t, h, tt.method, tt.path, "text/plain", nil); status != tt.want {
+			t.Errorf("%s %s with text/plain: status = %d, want %d", tt.method, tt.path, status, tt.want)
+		}
+	}
+}
+
+func TestJSONBodyRouteRejectsBodylessMethods(t *testing.T) {
+	t.Parallel()
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete, http.MethodHead} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("jsonBodyRoute(%s) did not panic", method)
+				}
+			}()
+			newRoutes(http.NewServeMux()).jsonBodyRoute("/", method, func(http.ResponseWriter, *http.Request) {})
+		}()
+	}
+}
+
+func TestAllowListsEveryRouteOfThePath(t *testing.T) {
+	t.Parallel()
+
+	h := All()
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: http.MethodPut, path: "/graph", want: "PATCH, POST"},
+		{method: http.MethodPut, path: "/measurements", want: "DELETE, GET, HEAD, POST"},
+		{method: http.MethodDelete, path: "/snapshot", want: "GET, HEAD, POST"},
+		{method: http.MethodPost, path: "/islands", want: "GET, HEAD"},
+		{method: http.MethodGet, path: "/graph/nodes/A", want: "DELETE"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "http://example.test"+tt.path, nil)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, rr.Code, http.StatusMethodNotAllowed)
+		}
+		if got := rr.Header().Get("Allow"); got != tt.want {
+			t.Errorf("%s %s: Allow = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
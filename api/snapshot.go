@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// snapshotHandler downloads the graph and the stored measurements as a
+// versioned JSON snapshot, which snapshotRestoreHandler loads back.
+func (h *handlers) snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.SnapshotResult, 1)
+	res, ok := query(ctx, w, events, business.SnapshotQuery{Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	if res.Err != nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="zgrid-snapshot.json"`)
+	foundation.Respond(w, http.StatusOK, json.RawMessage(res.Data))
+}
+
+// snapshotRestoreHandler replaces the whole grid state with an uploaded
+// snapshot and returns the restored islands, as POST /graph does.
+func (h *handlers) snapshotRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	// The snapshot is parsed by the grid; only its size and JSON syntax are
+	// checked here.
+	data, err := foundation.Decode[json.RawMessage](w, r)
+	if err != nil {
+		h.respondDecodeError(w, r, err, "invalid snapshot payload")
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	resp := make(chan business.GraphResult, 1)
+	res, ok := query(ctx, w, events, business.RestoreSnapshot{Data: data, Reply: resp}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	if errors.Is(res.Err, business.ErrInvalidSnapshot) || errors.Is(res.Err, business.ErrSnapshotVersion) {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(res.Err.Error()))
+		return
+	}
+	respondGraphEdit(w, res)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestSnapshotEndpoints(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": []any{[]any{"A", "B", 2.5}},
+	}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 2, "source": "agent-1"}, nil)
+	postJSON(t, h, "/measurements", map[string]any{"node": "C", "value": 3}, nil)
+
+	var want []business.IslandMeasurement
+	getJSON(t, h, "/measurements?weight=true", &want)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.test/snapshot", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /snapshot status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+		t.Errorf("Content-Disposition = %q, want an attachment", cd)
+	}
+	snapshot := rr.Body.Bytes()
+	var fields map[string]any
+	if err := json.Unmarshal(snapshot, &fields); err != nil || fields["version"] != float64(business.SnapshotVersion) {
+		t.Fatalf("snapshot = %s (%v), want JSON with version %d", snapshot, err, business.SnapshotVersion)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "http://example.test/reset", nil))
+
+	if status := doRequest(t, h, http.MethodPost, "/snapshot", "application/json", json.RawMessage(snapshot)); status != http.StatusOK {
+		t.Fatalf("POST /snapshot status = %d, want %d", status, http.StatusOK)
+	}
+	var got []business.IslandMeasurement
+	getJSON(t, h, "/measurements?weight=true", &got)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("totals after restore = %+v, want %+v", got, want)
+	}
+	var detail nodeDetail
+	if getJSON(t, h, "/nodes/A", &detail); detail.Source != "agent-1" {
+		t.Fatalf("detail of A after restore = %+v, want source agent-1", detail)
+	}
+
+	for _, body := range []string{`{"nodes":["A"]}`, `{"version":99,"nodes":["A"],"edges":[]}`, `"snapshot"`} {
+		if status := doRequest(t, h, http.MethodPost, "/snapshot", "application/json", json.RawMessage(body)); status != http.StatusBadRequest {
+			t.Fatalf("POST /snapshot %s status = %d, want %d", body, status, http.StatusBadRequest)
+		}
+	}
+	// Rejected snapshots leave the state alone.
+	getJSON(t, h, "/measurements?weight=true", &got)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("totals after rejected restores = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// subscribersRetryAfter is the Retry-After, in seconds, sent when the
+// subscriber limit is reached.
+const subscribersRetryAfter = "5"
+
+// parseNodeFilter reads the watched nodes from ?nodes=, given either as a
+// comma-separated list or as repeated parameters. No nodes means no filter.
+func parseNodeFilter(r *http.Request) []string {
+	var nodes []string
+	for _, v := range r.URL.Query()["nodes"] {
+		for n := range strings.SplitSeq(v, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	return nodes
+}
+
+// measurementEventsHandler streams island totals as Server-Sent Events. The
+// first event carries the current totals; a new one is sent whenever a watched
+// island changes. With ?nodes= only the islands containing those nodes are
+// sent, following the nodes across topology changes. Every event's ID is the
+// state version of its totals, and a client reconnecting with the current
+// version as its Last-Event-ID is not sent the first event again.
+func (h *handlers) measurementEventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	format, err := parseTotalsFormat(r)
+	if err != nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+		return
+	}
+
+	// A slot is taken before subscribing and given back when the stream ends.
+	if h.subscribers.Add(1) > h.cfg.maxSubscribers {
+		h.subscribers.Add(-1)
+		w.Header().Set("Retry-After", subscribersRetryAfter)
+		foundation.Respond(w, http.StatusServiceUnavailable, newErrResp("too many subscribers, try again later"))
+		return
+	}
+	defer h.subscribers.Add(-1)
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	// One slot is enough: the grid replaces a pending update with the latest one.
+	updates := make(chan business.TotalsUpdate, 1)
+	resp := make(chan business.VersionedTotals, 1)
+	initial, ok := query(ctx, w, events, business.Subscribe{
+		Nodes:   parseNodeFilter(r),
+		Updates: updates,
+		Done:    ctx.Done(),
+		Reply:   resp,
+	}, resp)
+	if !ok {
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Send Response
+
+	// The stream outlives any server write timeout. Flushing needs a writer that
+	// supports it (possibly behind Unwrap); without one the stream ends after the
+	// first event.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(version uint64, totals []business.IslandMeasurement) bool {
+		if err := writeEvent(w, version, present(format, totals)); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	if r.Header.Get("Last-Event-ID") == strconv.FormatUint(initial.Version, 10) {
+		// Nothing changed since the client's last event.
+		if rc.Flush() != nil {
+			return
+		}
+	} else if !send(initial.Version, initial.Totals) {
+		return
+	}
+
+	// With a flush interval, updates arriving too soon after the last event are
+	// held and only the latest one is sent when the interval has elapsed.
+	var (
+		lastSent = time.Now()
+		held     *business.TotalsUpdate
+		flush    *time.Timer
+		flushC   <-chan time.Time
+	)
+	defer func() {
+		if flush != nil {
+			flush.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				// The grid ended the subscription (shutdown): deliver the last
+				// state, then tell the client to reconnect.
+				if held != nil && !send(held.Version, held.Totals) {
+					return
+				}
+				_ = writeShutdown(w)
+				_ = rc.Flush()
+				return
+			}
+			wait := h.cfg.streamFlush - time.Since(lastSent)
+			if u.Topology || wait <= 0 {
+				if flush != nil {
+					flush.Stop()
+					flush, flushC, held = nil, nil, nil
+				}
+				if !send(u.Version, u.Totals) {
+					return
+				}
+				lastSent = time.Now()
+				continue
+			}
+			held = &u
+			if flush == nil {
+				flush = time.NewTimer(wait)
+				flushC = flush.C
+			}
+		case <-flushC:
+			flush, flushC = nil, nil
+			if !send(held.Version, held.Totals) {
+				return
+			}
+			held = nil
+			lastSent = time.Now()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes a Server-Sent Event with the given ID and v as its JSON
+// data line.
+func writeEvent(w http.ResponseWriter, id uint64, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, b)
+	return err
+}
+
+// writeShutdown writes the terminal event of a stream ended by the server, so
+// clients can reconnect (possibly elsewhere) instead of seeing a bare close.
+func writeShutdown(w http.ResponseWriter) error {
+	_, err := fmt.Fprint(w, "event: shutdown\ndata: {}\n\n")
+	return err
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestMeasurementEventsFilteredByNodes(t *testing.T) {
+	t.Parallel()
+
+	srv := newStreamServer(t)
+
+	srv.post("/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	})
+
+	next := srv.subscribe("/events/measurements?nodes=B")
+
+	if got := next(); len(got) != 1 || !islandsEqual([][]string{got[0].Island}, [][]string{{"A", "B"}}) {
+		t.Fatalf("initial event = %v, want only island [A B]", got)
+	}
+
+	// C is on an unwatched island: the next event must come from A.
+	srv.post("/measurements", map[string]any{"node": "C", "value": 9})
+	srv.post("/measurements", map[string]any{"node": "A", "value": 4})
+
+	got := next()
+	if len(got) != 1 || !floatEqual(got[0].Total, 4) {
+		t.Fatalf("event = %v, want island [A B] with total 4", got)
+	}
+}
+
+func TestMeasurementEventsResumeFromVersion(t *testing.T) {
+	t.Parallel()
+
+	srv := newStreamServer(t)
+
+	srv.post("/graph", map[string]any{"nodes": []string{"A", "B"}, "edges": [][]string{}})
+	srv.post("/measurements", map[string]any{"node": "A", "value": 1})
+
+	first := srv.stream("/events/measurements", nil)()
+	if first.id != "2" {
+		t.Fatalf("initial event ID = %q, want the state version 2", first.id)
+	}
+
+	// Reconnecting at the current version skips the snapshot: the first event
+	// received is the next change.
+	next := srv.stream("/events/measurements", http.Header{"Last-Event-Id": {first.id}})
+	srv.post("/measurements", map[string]any{"node": "B", "value": 2})
+	if got := next(); got.id != "3" || len(got.totals) != 2 || !floatEqual(got.totals[1].Total, 2) {
+		t.Fatalf("event after resuming = %+v, want version 3 with B at 2", got)
+	}
+
+	// A client that missed updates gets the snapshot.
+	if got := srv.stream("/events/measurements", http.Header{"Last-Event-Id": {"2"}})(); got.id != "3" {
+		t.Fatalf("event after resuming from an old version = %+v, want the snapshot at version 3", got)
+	}
+}
+
+func TestMeasurementEventsCoalescedByFlushInterval(t *testing.T) {
+	t.Parallel()
+
+	srv := newStreamServer(t, WithStreamFlushInterval(300*time.Millisecond))
+
+	srv.post("/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{},
+	})
+
+	next := srv.subscribe("/events/measurements")
+	next()
+
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		srv.post("/measurements", map[string]any{"node": "A", "value": i})
+	}
+
+	got := next()
+	if len(got) != 2 || !floatEqual(got[0].Total, 5) {
+		t.Fatalf("coalesced event = %v, want the latest total 5 for A", got)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("coalesced event after %v, want it held for the flush interval", elapsed)
+	}
+
+	// A topology change is sent right away; had the burst produced more than
+	// one event, an intermediate total would show up here instead.
+	start = time.Now()
+	srv.post("/graph", map[string]any{
+		"nodes": []string{"A", "B"},
+		"edges": [][]string{{"A", "B"}},
+	})
+
+	got = next()
+	if len(got) != 1 || !floatEqual(got[0].Total, 5) {
+		t.Fatalf("event after topology change = %v, want one island with total 5", got)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("topology event after %v, want it sent immediately", elapsed)
+	}
+}
+
+func TestMeasurementEventsEndWithShutdownFrame(t *testing.T) {
+	t.Parallel()
+
+	srv := newStreamServer(t)
+	srv.post("/graph", map[string]any{"nodes": []string{"A"}, "edges": [][]string{}})
+
+	ctx, stop := context.WithTimeout(srv.ctx, 5*time.Second)
+	t.Cleanup(stop)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.url+"/events/measurements", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer res.Body.Close()
+
+	scanner := bufio.NewScanner(res.Body)
+	if !scanner.Scan() || scanner.Text() != "id: 1" {
+		t.Fatalf("first line = %q, want the ID of the initial totals", scanner.Text())
+	}
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "data: ") {
+		t.Fatalf("second line = %q, want the initial totals", scanner.Text())
+	}
+
+	reply := make(chan int, 1)
+	srv.events <- business.CloseSubscribers{Reply: reply}
+	<-reply
+
+	var lines []string
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 2 || lines[0] != "event: shutdown" || lines[1] != "data: {}" {
+		t.Fatalf("lines after close = %q, want the shutdown event then the end of the stream", lines)
+	}
+}
+
+func TestMeasurementEventsSubscriberLimit(t *testing.T) {
+	t.Parallel()
+
+	const limit = 2
+	srv := newStreamServer(t, WithMaxSubscribers(limit))
+	srv.post("/graph", map[string]any{"nodes": []string{"A"}, "edges": [][]string{}})
+
+	// Reading the first event guarantees each stream holds its slot.
+	for range limit {
+		srv.subscribe("/events/measurements")()
+	}
+
+	for range 3 {
+		res, err := http.Get(srv.url + "/events/measurements")
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("status over the limit = %d, want %d", res.StatusCode, http.StatusServiceUnavailable)
+		}
+		if res.Header.Get("Retry-After") == "" {
+			t.Fatal("missing Retry-After header")
+		}
+	}
+}
+
+// streamServer runs the router over a real listener, since streaming responses
+// need a flushing writer.
+type streamServer struct {
+	t      *testing.T
+	ctx    context.Context
+	url    string
+	events chan<- business.Event
+}
+
+func newStreamServer(t *testing.T, opts ...Option) streamServer {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+
+	srv := httptest.NewServer(foundation.WrapMiddleware(All(opts...), GridEventsMiddleware(events)))
+	t.Cleanup(srv.Close)
+
+	return streamServer{t: t, ctx: ctx, url: srv.URL, events: events}
+}
+
+func (s streamServer) post(path string, payload any) {
+	s.t.Helper()
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		s.t.Fatalf("marshal: %v", err)
+	}
+	res, err := http.Post(s.url+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		s.t.Fatalf("POST %s: %v", path, err)
+	}
+	res.Body.Close()
+}
+
+// subscribe opens an event stream and returns a function reading its next event.
+func (s streamServer) subscribe(path string) func() []business.IslandMeasurement {
+	s.t.Helper()
+
+	next := s.stream(path, nil)
+	return func() []business.IslandMeasurement {
+		s.t.Helper()
+		return next().totals
+	}
+}
+
+// streamEvent is an event read from a stream.
+type streamEvent struct {
+	id     string
+	totals []business.IslandMeasurement
+}
+
+// stream opens an event stream with the given request headers and returns a
+// function reading its next event along with its ID.
+func (s streamServer) stream(path string, header http.Header) func() streamEvent {
+	s.t.Helper()
+
+	ctx, stop := context.WithTimeout(s.ctx, 5*time.Second)
+	s.t.Cleanup(stop)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, s.url+path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatalf("GET %s: %v", path, err)
+	}
+	s.t.Cleanup(func() { res.Body.Close() })
+
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		s.t.Fatalf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	return func() streamEvent {
+		s.t.Helper()
+		var evt streamEvent
+		for scanner.Scan() {
+			if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+				evt.id = id
+				continue
+			}
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			if err := json.Unmarshal([]byte(data), &evt.totals); err != nil {
+				s.t.Fatalf("decode event %q: %v", data, err)
+			}
+			return evt
+		}
+		s.t.Fatalf("stream ended: %v", scanner.Err())
+		return evt
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestTotalsEndpointMatchesMeasurementsResponse(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 8)
+	go business.NewGrid().Loop(ctx, events)
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+
+	for _, params := range []string{"", "?count=true", "?as=percent", "?stats=true&weight=true"} {
+		t.Run(params, func(t *testing.T) {
+			post := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/measurements"+params, strings.NewReader(`{"node":"C","value":2}`))
+			req.Header.Set("Content-Type", "application/json")
+			h.ServeHTTP(post, req)
+
+			get := httptest.NewRecorder()
+			h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "http://example.test/measurements"+params, nil))
+
+			if post.Code != http.StatusOK || get.Code != http.StatusOK {
+				t.Fatalf("status POST %d, GET %d, want %d", post.Code, get.Code, http.StatusOK)
+			}
+			if !bytes.Equal(get.Body.Bytes(), post.Body.Bytes()) {
+				t.Errorf("GET body = %s, want the POST body %s", get.Body, post.Body)
+			}
+		})
+	}
+}
+
+func TestTotalsEndpointReturns429WhenBusy(t *testing.T) {
+	t.Parallel()
+
+	events := make(chan business.Event) // unbuffered, no consumer => send blocks
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	if status := doRequest(t, h, http.MethodGet, "/measurements", "", nil); status != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
+
+func TestStateVersionEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 8)
+	go business.NewGrid().Loop(ctx, events)
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	version := func() (uint64, string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.test/version", nil))
+		var body struct {
+			Version uint64 `json:"version"`
+		}
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode %s: %v", rr.Body, err)
+		}
+		return body.Version, rr.Header().Get("X-State-Version")
+	}
+
+	if v, header := version(); v != 0 || header != "0" {
+		t.Fatalf("initial version = %d (header %q), want 0", v, header)
+	}
+
+	postJSON(t, h, "/graph", map[string]any{"nodes": []string{"A"}, "edges": [][]string{}}, nil)
+	post := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "http://example.test/measurements", strings.NewReader(`{"node":"A","value":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(post, req)
+
+	v, header := version()
+	if want := post.Header().Get("X-State-Version"); v != 2 || header != want {
+		t.Fatalf("version = %d (header %q), want 2 as reported by the measurement (%q)", v, header, want)
+	}
+
+	// Reading does not advance it.
+	if again, _ := version(); again != v {
+		t.Fatalf("version after a read = %d, want %d", again, v)
+	}
+}
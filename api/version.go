@@ -0,0 +1,202 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// APIVersion identifies a revision of the request payload schemas.
+type APIVersion int
+
+const (
+	// APIVersion1 is the original schema: measurements are {node, value}.
+	APIVersion1 APIVersion = 1
+	// APIVersion2 extends measurements with optional timestamp and mode.
+	APIVersion2 APIVersion = 2
+
+	// defaultAPIVersion is used when the client does not ask for a version.
+	defaultAPIVersion = APIVersion1
+)
+
+// versionHeaders are the request headers a client can use to select a version.
+var versionHeaders = []string{"Accept-Version", "X-API-Version"}
+
+// parseAPIVersion reads the requested schema version from the request headers.
+// Both "2" and "v2" are accepted; conflicting headers are rejected.
+func parseAPIVersion(r *http.Request) (APIVersion, error) {
+	version := APIVersion(0)
+	for _, h := range versionHeaders {
+		raw := strings.TrimSpace(r.Header.Get(h))
+		if raw == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(raw), "v"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s header %q", h, raw)
+		}
+		v := APIVersion(n)
+		if _, ok := measurementDecoders[v]; !ok {
+			return 0, fmt.Errorf("unsupported API version %q", raw)
+		}
+		if version != 0 && version != v {
+			return 0, fmt.Errorf("conflicting API version headers")
+		}
+		version = v
+	}
+
+	if version == 0 {
+		version = defaultAPIVersion
+	}
+	return version, nil
+}
+
+// negotiateVersion resolves the schema version of the request, rejecting unknown
+// versions with 400, and stores it in the request context. The selected version
+// is echoed in the X-API-Version response header.
+func negotiateVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, err := parseAPIVersion(r)
+		if err != nil {
+			foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+			return
+		}
+
+		w.Header().Set("X-API-Version", strconv.Itoa(int(version)))
+		ctx := context.WithValue(r.Context(), apiVersionKey, version)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getAPIVersion(ctx context.Context) APIVersion {
+	version, ok := ctx.Value(apiVersionKey).(APIVersion)
+	if !ok {
+		return defaultAPIVersion
+	}
+	return version
+}
+
+// measurementDecoders holds the decode and validation rules of the measurement
+// payload for every supported API version.
+var measurementDecoders = map[APIVersion]func(w http.ResponseWriter, r *http.Request) ([]business.NodeMeasurement, bool, error){
+	APIVersion1: decodeMeasurementsV1,
+	APIVersion2: decodeMeasurementsV2,
+}
+
+// decodeMeasurements decodes the measurement payload using the rules of the
+// negotiated API version. The body is either a single measurement object or an
+// array of them; batch reports the array form.
+func decodeMeasurements(w http.ResponseWriter, r *http.Request) (ms []business.NodeMeasurement, batch bool, err error) {
+	return measurementDecoders[getAPIVersion(r.Context())](w, r)
+}
+
+// decodeMeasurementBody decodes a measurement object of type P, or an array of
+// them when the body starts with '[', converting each with convert.
+func decodeMeasurementBody[P any](w http.ResponseWriter, r *http.Request, convert func(P) (business.NodeMeasurement, error)) ([]business.NodeMeasurement, bool, error) {
+	body := bufio.NewReader(r.Body)
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, r.Body}
+
+	if !startsWithArray(body) {
+		p, err := foundation.Decode[P](w, r)
+		if err != nil {
+			return nil, false, err
+		}
+		m, err := convert(p)
+		if err != nil {
+			return nil, false, err
+		}
+		return []business.NodeMeasurement{m}, false, nil
+	}
+
+	ps, err := foundation.Decode[[]P](w, r)
+	if err != nil {
+		return nil, true, err
+	}
+	ms := make([]business.NodeMeasurement, len(ps))
+	for i, p := range ps {
+		if ms[i], err = convert(p); err != nil {
+			return nil, true, fmt.Errorf("measurement %d: %w", i, err)
+		}
+	}
+	return ms, true, nil
+}
+
+// startsWithArray reports whether the first non-whitespace byte of body is
+// '[', without consuming it. Leading whitespace is skipped up to the size of the
+// buffer only, so an endless run of it still reaches the body size limit.
+func startsWithArray(body *bufio.Reader) bool {
+	for range body.Size() {
+		b, err := body.Peek(1)
+		if err != nil {
+			return false
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			body.Discard(1)
+		default:
+			return b[0] == '['
+		}
+	}
+	return false
+}
+
+func decodeMeasurementsV1(w http.ResponseWriter, r *http.Request) ([]business.NodeMeasurement, bool, error) {
+	type measurementsPayload struct {
+		Node   string  `json:"node"`
+		Value  float64 `json:"value"`
+		Source string  `json:"source"`
+	}
+
+	return decodeMeasurementBody(w, r, func(m measurementsPayload) (business.NodeMeasurement, error) {
+		return business.NodeMeasurement{Node: m.Node, Value: m.Value, Source: m.Source}, nil
+	})
+}
+
+func decodeMeasurementsV2(w http.ResponseWriter, r *http.Request) ([]business.NodeMeasurement, bool, error) {
+	type measurementsPayload struct {
+		Node      string     `json:"node"`
+		Value     float64    `json:"value"`
+		Timestamp *time.Time `json:"timestamp"`
+		Mode      string     `json:"mode"`
+		Source    string     `json:"source"`
+	}
+
+	return decodeMeasurementBody(w, r, func(m measurementsPayload) (business.NodeMeasurement, error) {
+		var mode business.MeasurementMode
+		switch m.Mode {
+		case "", "set":
+			mode = business.MeasurementSet
+		case "add":
+			mode = business.MeasurementAdd
+		default:
+			return business.NodeMeasurement{}, fmt.Errorf("unknown mode %q", m.Mode)
+		}
+
+		var taken time.Time
+		if m.Timestamp != nil {
+			if m.Timestamp.IsZero() {
+				return business.NodeMeasurement{}, fmt.Errorf("timestamp must not be zero")
+			}
+			taken = *m.Timestamp
+		}
+
+		return business.NodeMeasurement{
+			Node:   m.Node,
+			Value:  m.Value,
+			Mode:   mode,
+			Source: m.Source,
+			Taken:  taken,
+		}, nil
+	})
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestMeasurementsVersionNegotiation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		header      string
+		version     string
+		body        string
+		wantStatus  int
+		wantVersion string
+		wantTotal   float64
+	}{
+		{
+			name:        "no header defaults to v1",
+			body:        `{"node":"A","value":5}`,
+			wantStatus:  http.StatusOK,
+			wantVersion: "1",
+			wantTotal:   5 + 1,
+		},
+		{
+			name:        "v1 plain payload",
+			header:      "Accept-Version",
+			version:     "v1",
+			body:        `{"node":"A","value":5}`,
+			wantStatus:  http.StatusOK,
+			wantVersion: "1",
+			wantTotal:   5 + 1,
+		},
+		{
+			name:       "v1 rejects v2 fields",
+			header:     "Accept-Version",
+			version:    "1",
+			body:       `{"node":"A","value":5,"mode":"add"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "v2 plain payload",
+			header:      "X-API-Version",
+			version:     "2",
+			body:        `{"node":"A","value":5}`,
+			wantStatus:  http.StatusOK,
+			wantVersion: "2",
+			wantTotal:   5 + 1,
+		},
+		{
+			name:        "v2 rich payload in add mode",
+			header:      "X-API-Version",
+			version:     "v2",
+			body:        `{"node":"A","value":5,"timestamp":"2024-01-02T03:04:05Z","mode":"add"}`,
+			wantStatus:  http.StatusOK,
+			wantVersion: "2",
+			wantTotal:   2 + 5 + 1,
+		},
+		{
+			name:       "v2 rejects a metric label",
+			header:     "X-API-Version",
+			version:    "2",
+			body:       `{"node":"A","value":5,"metric":"power"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "v2 rejects a zero timestamp",
+			header:     "X-API-Version",
+			version:    "2",
+			body:       `{"node":"A","value":5,"timestamp":"0001-01-01T00:00:00Z"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "v2 rejects unknown mode",
+			header:     "X-API-Version",
+			version:    "2",
+			body:       `{"node":"A","value":5,"mode":"multiply"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown version returns 400",
+			header:     "Accept-Version",
+			version:    "v9",
+			body:       `{"node":"A","value":5}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "malformed version returns 400",
+			header:     "Accept-Version",
+			version:    "latest",
+			body:       `{"node":"A","value":5}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			events := make(chan business.Event, 16)
+			grid := business.NewGrid()
+			go grid.Loop(ctx, events)
+			t.Cleanup(func() { close(events) })
+
+			h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+			// A=2 and B=1 are in the same island.
+			postJSON(t, h, "/graph", map[string]any{
+				"nodes": []string{"A", "B"},
+				"edges": [][]string{{"A", "B"}},
+			}, nil)
+			postJSON(t, h, "/measurements", map[string]any{"node": "A", "value": 2}, nil)
+			postJSON(t, h, "/measurements", map[string]any{"node": "B", "value": 1}, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/measurements", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.version)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if got := rr.Header().Get("X-API-Version"); got != tt.wantVersion {
+				t.Fatalf("X-API-Version = %q, want %q", got, tt.wantVersion)
+			}
+
+			var totals []business.IslandMeasurement
+			if err := json.NewDecoder(rr.Body).Decode(&totals); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(totals) != 1 || !floatEqual(totals[0].Total, tt.wantTotal) {
+				t.Fatalf("totals = %v, want single island with total %v", totals, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestMeasurementsV2TimestampIsMetadata(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	received := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	go business.NewGrid(business.WithClock(func() time.Time { return received })).Loop(ctx, events)
+	t.Cleanup(func() { close(events) })
+
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+	postJSON(t, h, "/graph", map[string]any{"nodes": []string{"A"}, "edges": [][]string{}}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.test/measurements?updated=true", bytes.NewReader([]byte(`{"node":"A","value":5,"timestamp":"9999-01-02T03:04:05Z"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Version", "2")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%s)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var totals []struct {
+		LastUpdated string
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&totals); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(totals) != 1 || totals[0].LastUpdated != "2024-03-01T12:00:00Z" {
+		t.Fatalf("totals = %+v, want lastUpdated 2024-03-01T12:00:00Z, the time of receipt", totals)
+	}
+
+	var history nodeHistory
+	if status := getJSON(t, h, "/nodes/A/history", &history); status != http.StatusOK {
+		t.Fatalf("history status = %d, want %d", status, http.StatusOK)
+	}
+	taken := time.Date(9999, time.January, 2, 3, 4, 5, 0, time.UTC)
+	if want := []reading{{Value: 5, At: received, Taken: taken}}; !reflect.DeepEqual(history.History, want) {
+		t.Fatalf("history = %+v, want %+v", history.History, want)
+	}
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/coder/websocket"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// wsOutboundBuffer is how many frames may wait for a WebSocket client that
+// reads slower than it sends; past it the connection is closed rather than
+// letting the backlog grow.
+const wsOutboundBuffer = 16
+
+// wsHandler ingests measurements and returns totals over a single WebSocket
+// connection. Every inbound text frame is a measurement, {"node", "value"},
+// forwarded to the grid like POST /measurements; it is answered by a frame with
+// the totals after it, in the same shape (the format query parameters of the
+// connection request apply), or by {"error": ...} when it was rejected.
+func (h *handlers) wsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events := getStateEvents(ctx)
+	if events == nil {
+		foundation.Respond(w, http.StatusInternalServerError, newErrResp(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	// ----------------------------------------------------------------------------
+	// Validate Request
+
+	format, err := parseTotalsFormat(r)
+	if err != nil {
+		foundation.Respond(w, http.StatusBadRequest, newErrResp(err.Error()))
+		return
+	}
+
+	// Answered here so the error is JSON like everywhere else; Accept checks
+	// the rest of the handshake.
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		foundation.Respond(w, http.StatusUpgradeRequired, newErrResp("websocket upgrade required"))
+		return
+	}
+
+	// The connection outlives any server timeout.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	// Accept responds to a request that is not a valid upgrade by itself.
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+	if !h.cfg.websockets.add(conn) {
+		conn.Close(websocket.StatusGoingAway, "server shutting down")
+		return
+	}
+	// Deferred after CloseNow, so it runs first: once the handler is done
+	// sending events.
+	defer h.cfg.websockets.done(conn)
+
+	// ----------------------------------------------------------------------------
+	// Process Request
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Frames are written by their own goroutine, so a client that does not read
+	// fills its buffer instead of stalling the measurements it sends.
+	out := make(chan any, wsOutboundBuffer)
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case v := <-out:
+				b, err := json.Marshal(v)
+				if err != nil {
+					return
+				}
+				if err := conn.Write(ctx, websocket.MessageText, b); err != nil {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	send := func(v any) bool {
+		select {
+		case out <- v:
+			return true
+		default:
+			conn.Close(websocket.StatusPolicyViolation, "client too slow, frames dropped")
+			return false
+		}
+	}
+
+	for {
+		// A read error means the client went away or the connection was closed.
+		typ, data, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		if typ != websocket.MessageText {
+			if !send(newErrResp("want a text frame with a JSON measurement")) {
+				return
+			}
+			continue
+		}
+
+		measurement, err := decodeWSMeasurement(data)
+		if err != nil {
+			h.cfg.metrics.decodeError(r)
+			if !send(newErrResp("invalid measurement payload")) {
+				return
+			}
+			continue
+		}
+
+		reply, ok := h.measureWS(ctx, events, measurement, format)
+		if !ok || !send(reply) {
+			return
+		}
+	}
+}
+
+// decodeWSMeasurement decodes an inbound WebSocket frame with the rules of the
+// POST /measurements payload: one object, no unknown fields.
+func decodeWSMeasurement(data []byte) (business.NodeMeasurement, error) {
+	var m struct {
+		Node   string  `json:"node"`
+		Value  float64 `json:"value"`
+		Source string  `json:"source"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return business.NodeMeasurement{}, err
+	}
+	if dec.More() {
+		return business.NodeMeasurement{}, errors.New("frame must contain a single JSON value")
+	}
+	return business.NodeMeasurement{Node: m.Node, Value: m.Value, Source: m.Source}, nil
+}
+
+// measureWS applies a measurement received over a WebSocket and returns the
+// frame to answer with. It reports false when the connection ended meanwhile.
+func (h *handlers) measureWS(ctx context.Context, events chan<- business.Event, m business.NodeMeasurement, format totalsFormat) (any, bool) {
+	resp := make(chan business.MeasurementResult, 1)
+	h.cfg.backlog.Add(1)
+	select {
+	case events <- business.MeasurementUpdate{NodeMeasurement: m, Reply: resp}:
+	case <-h.cfg.busy():
+		h.cfg.backlog.Add(-1)
+		return newErrResp("server busy, try again"), true
+	case <-ctx.Done():
+		h.cfg.backlog.Add(-1)
+		return nil, false
+	}
+
+	select {
+	case res := <-resp:
+		switch {
+		case errors.Is(res.Err, business.ErrEventPanicked):
+			return newErrResp(http.StatusText(http.StatusInternalServerError)), true
+		case res.Err != nil:
+			return newErrResp(res.Err.Error()), true
+		}
+		return present(format, res.Totals), true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// WebSockets tracks the open WebSocket connections. http.Server.Shutdown
+// neither closes nor waits for hijacked connections, so a server that stops
+// the grid loop once Shutdown returns must Close them first: their handlers
+// would otherwise keep sending measurements to it.
+type WebSockets struct {
+	mu      sync.Mutex
+	conns   map[*websocket.Conn]struct{}
+	closing bool           // new connections are refused
+	active  sync.WaitGroup // handlers of tracked connections
+}
+
+// NewWebSockets returns an empty connection tracker. Pass it to
+// WithWebSockets.
+func NewWebSockets() *WebSockets {
+	return &WebSockets{conns: map[*websocket.Conn]struct{}{}}
+}
+
+// WithWebSockets tracks the connections of /ws in ws, so they can be closed on
+// shutdown.
+func WithWebSockets(ws *WebSockets) Option {
+	return func(c *config) {
+		c.websockets = ws
+	}
+}
+
+// add tracks conn until its handler calls done. It reports false once Close
+// was called; the handler must then close conn without sending any event. A
+// nil tracker accepts every connection.
+func (ws *WebSockets) add(conn *websocket.Conn) bool {
+	if ws == nil {
+		return true
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closing {
+		return false
+	}
+	ws.conns[conn] = struct{}{}
+	ws.active.Add(1)
+	return true
+}
+
+// done stops tracking conn, once its handler sends no more events.
+func (ws *WebSockets) done(conn *websocket.Conn) {
+	if ws == nil {
+		return
+	}
+	ws.mu.Lock()
+	delete(ws.conns, conn)
+	ws.mu.Unlock()
+	ws.active.Done()
+}
+
+// Close refuses new connections, closes the open ones with status 1001 (going
+// away) and waits for their handlers to return, or for ctx to end. It returns
+// how many connections were open, and ctx.Err() when their handlers did not all
+// return in time.
+func (ws *WebSockets) Close(ctx context.Context) (int, error) {
+	ws.mu.Lock()
+	ws.closing = true
+	conns := make([]*websocket.Conn, 0, len(ws.conns))
+	for conn := range ws.conns {
+		conns = append(conns, conn)
+	}
+	ws.mu.Unlock()
+
+	// Each close waits for the client to answer the closing handshake.
+	for _, conn := range conns {
+		go conn.Close(websocket.StatusGoingAway, "server shutting down")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ws.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return len(conns), nil
+	case <-ctx.Done():
+		return len(conns), ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"github.com/coder/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestWebSocketMeasurements(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 8)
+	go business.NewGrid().Loop(ctx, events)
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+	postJSON(t, h, "/graph", map[string]any{
+		"nodes": []string{"A", "B", "C"},
+		"edges": [][]string{{"A", "B"}},
+	}, nil)
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?count=true", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.CloseNow()
+
+	frames := []struct {
+		in   string
+		want string
+	}{
+		{in: `{"node":"A","value":2}`, want: `[{"Island":["A","B"],"Total":2,"Count":1,"NodeCount":2},{"Island":["C"],"Total":0,"Count":0,"NodeCount":1}]`},
+		{in: `{"node":"C","value":5}`, want: `[{"Island":["A","B"],"Total":2,"Count":1,"NodeCount":2},{"Island":["C"],"Total":5,"Count":1,"NodeCount":1}]`},
+		{in: `{"node":"A","value":2,"extra":1}`, want: `{"error":"invalid measurement payload"}`},
+		{in: `not json`, want: `{"error":"invalid measurement payload"}`},
+	}
+	for _, f := range frames {
+		if err := conn.Write(ctx, websocket.MessageText, []byte(f.in)); err != nil {
+			t.Fatalf("write %s: %v", f.in, err)
+		}
+		_, got, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("read after %s: %v", f.in, err)
+		}
+		if string(got) != f.want {
+			t.Errorf("after %s: frame = %s, want %s", f.in, got, f.want)
+		}
+	}
+
+	// Measurements sent over the socket are visible to plain HTTP clients.
+	var totals []struct{ Total float64 }
+	getJSON(t, h, "/measurements", &totals)
+	if len(totals) != 2 || totals[1].Total != 5 {
+		t.Errorf("GET /measurements = %+v, want C totalling 5", totals)
+	}
+
+	conn.Close(websocket.StatusNormalClosure, "")
+}
+
+func TestWebSocketRequiresUpgrade(t *testing.T) {
+	t.Parallel()
+
+	events := make(chan business.Event, 1)
+	h := foundation.WrapMiddleware(All(), GridEventsMiddleware(events))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.test/ws", nil))
+	if rr.Code != http.StatusUpgradeRequired {
+		t.Fatalf("plain GET status = %d, want %d", rr.Code, http.StatusUpgradeRequired)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want a JSON error", ct)
+	}
+}
@@ -0,0 +1,10 @@
+package business
+
+// resolveAlias returns the canonical name of node: the node an alias of the
+// current graph points to, or node itself.
+func (s *Grid) resolveAlias(node string) string {
+	if id, ok := s.graph.aliases[node]; ok {
+		return s.nodes.names[id]
+	}
+	return node
+}
@@ -0,0 +1,75 @@
+package business
+
+import "testing"
+
+func TestAliasedMeasurements(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		aliases     map[string]string
+		regraph     bool // a graph update without aliases follows the first one
+		node        string
+		wantApplied bool
+		want        []IslandMeasurement
+	}{
+		{
+			name:        "alias lands on its canonical node",
+			aliases:     map[string]string{"legacyA": "A"},
+			node:        "legacyA",
+			wantApplied: true,
+			want:        []IslandMeasurement{{Island: []string{"A", "B"}, Total: 5}, {Island: []string{"C"}}},
+		},
+		{
+			name:        "canonical name still works",
+			aliases:     map[string]string{"legacyA": "A"},
+			node:        "A",
+			wantApplied: true,
+			want:        []IslandMeasurement{{Island: []string{"A", "B"}, Total: 5}, {Island: []string{"C"}}},
+		},
+		{
+			name:        "node name shadows an alias",
+			aliases:     map[string]string{"C": "A"},
+			node:        "C",
+			wantApplied: true,
+			want:        []IslandMeasurement{{Island: []string{"A", "B"}}, {Island: []string{"C"}, Total: 5}},
+		},
+		{
+			name:    "alias to a node outside the graph is ignored",
+			aliases: map[string]string{"legacyZ": "Z"},
+			node:    "legacyZ",
+			want:    []IslandMeasurement{{Island: []string{"A", "B"}}, {Island: []string{"C"}}},
+		},
+		{
+			name:    "graph update replaces the aliases",
+			aliases: map[string]string{"legacyA": "A"},
+			regraph: true,
+			node:    "legacyA",
+			want:    []IslandMeasurement{{Island: []string{"A", "B"}}, {Island: []string{"C"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			graph := NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})
+			graph.Aliases = tt.aliases
+			grid.update(GraphUpdate{Graph: graph})
+			if tt.regraph {
+				grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+			}
+
+			reply := make(chan MeasurementResult, 1)
+			grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: tt.node, Value: 5}, Reply: reply})
+			res := <-reply
+			if res.Applied != tt.wantApplied {
+				t.Fatalf("applied = %v, want %v", res.Applied, tt.wantApplied)
+			}
+			if !totalsEqual(res.Totals, tt.want) {
+				t.Fatalf("totals = %v, want %v", res.Totals, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package business
+
+import "sync/atomic"
+
+// MeasurementBacklog counts the measurement events sent to the loop and not yet
+// taken from its queue, so RejectGraphWhilePending can see measurements that
+// are queued without the grid being paused. Senders call Add(1) before sending
+// a MeasurementUpdate or BatchMeasurementUpdate and Add(-1) if the send is
+// abandoned; the loop lowers it as it takes each one. A nil backlog counts
+// nothing.
+type MeasurementBacklog struct {
+	n atomic.Int64
+}
+
+// Add adjusts the count of queued measurement events by delta.
+func (b *MeasurementBacklog) Add(delta int) {
+	if b != nil {
+		b.n.Add(int64(delta))
+	}
+}
+
+// Len returns the number of queued measurement events.
+func (b *MeasurementBacklog) Len() int {
+	if b == nil {
+		return 0
+	}
+	return int(b.n.Load())
+}
+
+// WithMeasurementBacklog makes the loop lower b as it takes measurement
+// events from its queue. Share b with the senders of those events.
+func WithMeasurementBacklog(b *MeasurementBacklog) GridOption {
+	return func(s *Grid) {
+		s.backlog = b
+	}
+}
+
+// taken lowers the backlog when evt is a measurement event.
+func (b *MeasurementBacklog) taken(evt Event) {
+	switch evt.(type) {
+	case MeasurementUpdate, BatchMeasurementUpdate:
+		b.Add(-1)
+	}
+}
+
+// measurementsPending reports whether measurements are held in the pause
+// buffer or queued behind the event being processed.
+func (s *Grid) measurementsPending() bool {
+	return len(s.pending) > 0 || s.backlog.Len() > 0
+}
@@ -0,0 +1,58 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGraphUpdateWhileMeasurementsBuffered(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		policy      GraphUpdatePolicy
+		wantErr     error
+		wantIslands [][]string
+	}{
+		{name: "accepted by default", policy: AcceptGraphUpdates, wantIslands: [][]string{{"A"}, {"B"}}},
+		{name: "rejected while queued", policy: RejectGraphWhilePending, wantErr: ErrMeasurementsPending, wantIslands: [][]string{{"A", "B"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			backlog := &MeasurementBacklog{}
+			grid := NewGrid(WithGraphUpdatePolicy(tt.policy), WithMeasurementBacklog(backlog))
+			grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+
+			// The graph update is queued ahead of a measurement, without the
+			// grid being paused.
+			events := make(chan Event, 2)
+			graphReply := make(chan GraphResult, 1)
+			measureReply := make(chan MeasurementResult, 1)
+			events <- GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil), Reply: graphReply}
+			backlog.Add(1)
+			events <- MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 5}, Reply: measureReply}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			go grid.Loop(ctx, events)
+
+			if got := <-graphReply; !errors.Is(got.Err, tt.wantErr) {
+				t.Fatalf("graph update err = %v, want %v", got.Err, tt.wantErr)
+			}
+			res := <-measureReply
+			if !res.Applied {
+				t.Fatalf("measurement result = %+v, want it applied", res)
+			}
+			if got := res.Totals; len(got) != len(tt.wantIslands) || !islandsEqual([][]string{got[0].Island}, tt.wantIslands[:1]) {
+				t.Fatalf("totals = %+v, want islands %v", got, tt.wantIslands)
+			}
+			if n := backlog.Len(); n != 0 {
+				t.Fatalf("backlog = %d after the loop took the measurement, want 0", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package business
+
+import "slices"
+
+// measureBatch applies ms in order and returns the result along with the
+// islands it measured. While paused the whole batch is held, or rejected if it
+// does not fit the pause buffer, so a batch is never split across a resume.
+func (s *Grid) measureBatch(ms []NodeMeasurement) (BatchMeasurementResult, []int) {
+	var res BatchMeasurementResult
+	if s.paused {
+		switch {
+		case s.pauseBuffer == 0:
+			res.Err = ErrPaused
+		case len(s.pending)+len(ms) > s.pauseBuffer:
+			res.Err = ErrPauseBufferFull
+		default:
+			s.pending = append(s.pending, ms...)
+			res.Queued = true
+		}
+		return res, nil
+	}
+
+	// Totals of the touched islands before and after the batch: an island whose
+	// measurements cancel out within the batch did not change. Each measurement
+	// reports its island's total around it, so the first before and the last
+	// after of an island span the whole batch.
+	before, after := map[int]float64{}, map[int]float64{}
+	for _, m := range ms {
+		applied, island, from, to := s.measureIsland(m)
+		if !applied {
+			continue
+		}
+		res.Applied++
+		if _, ok := before[island]; !ok {
+			before[island] = from
+		}
+		after[island] = to
+	}
+
+	touched := make([]int, 0, len(before))
+	for island, total := range before {
+		touched = append(touched, island)
+		if after[island] != total {
+			res.Changed = true
+		}
+	}
+	slices.Sort(touched)
+	return res, touched
+}
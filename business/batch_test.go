@@ -0,0 +1,126 @@
+package business
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBatchMeasurementUpdate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		measurements []NodeMeasurement
+		want         []IslandMeasurement
+		applied      int
+		changed      bool
+	}{
+		{
+			name:    "empty batch",
+			want:    []IslandMeasurement{{Island: []string{"A", "B"}, Total: 1}, {Island: []string{"C"}}},
+			changed: false,
+		},
+		{
+			name: "applied in order",
+			measurements: []NodeMeasurement{
+				{Node: "A", Value: 3},
+				{Node: "C", Value: 4},
+				{Node: "A", Value: 2, Mode: MeasurementAdd},
+			},
+			want:    []IslandMeasurement{{Island: []string{"A", "B"}, Total: 5}, {Island: []string{"C"}, Total: 4}},
+			applied: 3,
+			changed: true,
+		},
+		{
+			name:         "nodes outside the graph are dropped",
+			measurements: []NodeMeasurement{{Node: "X", Value: 3}, {Node: "B", Value: 2}},
+			want:         []IslandMeasurement{{Island: []string{"A", "B"}, Total: 3}, {Island: []string{"C"}}},
+			applied:      1,
+			changed:      true,
+		},
+		{
+			name:         "changes that cancel out",
+			measurements: []NodeMeasurement{{Node: "A", Value: 7}, {Node: "A", Value: 1}},
+			want:         []IslandMeasurement{{Island: []string{"A", "B"}, Total: 1}, {Island: []string{"C"}}},
+			applied:      2,
+			changed:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+			grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+			version := grid.version
+
+			reply := make(chan BatchMeasurementResult, 1)
+			grid.update(BatchMeasurementUpdate{Measurements: tt.measurements, Reply: reply})
+			got := <-reply
+
+			if !totalsEqual(got.Totals, tt.want) {
+				t.Errorf("totals = %v, want %v", got.Totals, tt.want)
+			}
+			if got.Applied != tt.applied || got.Changed != tt.changed {
+				t.Errorf("applied %d, changed %v, want %d, %v", got.Applied, got.Changed, tt.applied, tt.changed)
+			}
+			// The whole batch is a single state change.
+			wantVersion := version
+			if tt.applied > 0 {
+				wantVersion++
+			}
+			if got.Version != wantVersion {
+				t.Errorf("version = %d, want %d", got.Version, wantVersion)
+			}
+			checkTotalsCache(t, grid, tt.name)
+		})
+	}
+}
+
+func TestBatchMeasurementUpdateWhilePaused(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithPauseBuffer(3))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil)})
+	grid.update(PauseUpdate{Paused: true})
+
+	reply := make(chan BatchMeasurementResult, 1)
+	grid.update(BatchMeasurementUpdate{Measurements: []NodeMeasurement{{Node: "A", Value: 1}, {Node: "B", Value: 2}}, Reply: reply})
+	if got := <-reply; !got.Queued || got.Err != nil {
+		t.Fatalf("first batch = %+v, want it queued", got)
+	}
+
+	// Two more do not fit: none of them is held.
+	grid.update(BatchMeasurementUpdate{Measurements: []NodeMeasurement{{Node: "A", Value: 5}, {Node: "B", Value: 5}}, Reply: reply})
+	if got := <-reply; got.Queued || !errors.Is(got.Err, ErrPauseBufferFull) {
+		t.Fatalf("second batch = %+v, want it rejected with ErrPauseBufferFull", got)
+	}
+
+	grid.update(PauseUpdate{Paused: false})
+	if got, want := grid.currentTotals(), []IslandMeasurement{{Island: []string{"A"}, Total: 1}, {Island: []string{"B"}, Total: 2}}; !totalsEqual(got, want) {
+		t.Errorf("totals after resume = %v, want %v", got, want)
+	}
+}
+
+func TestBatchMeasurementUpdatePublishesOnce(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, nil)})
+
+	all := make(chan TotalsUpdate, 4)
+	onlyC := make(chan TotalsUpdate, 4)
+	grid.update(Subscribe{Updates: all, Done: make(chan struct{})})
+	grid.update(Subscribe{Nodes: []string{"C"}, Updates: onlyC, Done: make(chan struct{})})
+
+	grid.update(BatchMeasurementUpdate{Measurements: []NodeMeasurement{{Node: "A", Value: 1}, {Node: "B", Value: 2}}})
+
+	if len(all) != 1 {
+		t.Errorf("subscriber to every island got %d updates, want 1", len(all))
+	}
+	if len(onlyC) != 0 {
+		t.Errorf("subscriber to C got %d updates, want none", len(onlyC))
+	}
+}
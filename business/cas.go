@@ -0,0 +1,38 @@
+package business
+
+import "errors"
+
+// ErrUnknownNode is returned for operations on a node that is not part of the
+// current graph.
+var ErrUnknownNode = errors.New("node is not in the current graph")
+
+// compareAndSet applies e if the stored value of its node matches e.Expected.
+// While paused it is rejected, since it cannot be queued without losing the
+// comparison.
+func (s *Grid) compareAndSet(e CompareAndSet) CASResult {
+	if s.paused {
+		return CASResult{Err: ErrPaused}
+	}
+	if !s.hasNode(e.Node) {
+		return CASResult{Err: ErrUnknownNode}
+	}
+
+	id, _ := s.nodes.id(e.Node)
+	var cur measurement
+	if id < len(s.measurements) {
+		cur = s.measurements[id]
+	}
+
+	res := CASResult{Measured: cur.ok, Current: cur.value}
+	// A nil Expected stands for "not measured yet".
+	matches := (e.Expected == nil && !cur.ok) || (e.Expected != nil && cur.ok && *e.Expected == cur.value)
+	if !matches {
+		return res
+	}
+
+	s.applyMeasurement(NodeMeasurement{Node: e.Node, Value: e.New})
+	s.commit()
+	res.Swapped = true
+	res.Totals = s.currentTotals()
+	return res
+}
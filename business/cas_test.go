@@ -0,0 +1,55 @@
+package business
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompareAndSet(t *testing.T) {
+	t.Parallel()
+
+	ptr := func(v float64) *float64 { return &v }
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil)})
+
+	steps := []struct {
+		name         string
+		node         string
+		expected     *float64
+		new          float64
+		wantSwapped  bool
+		wantMeasured bool
+		wantCurrent  float64
+		wantErr      error
+	}{
+		{name: "unset matches nil", node: "A", expected: nil, new: 5.3, wantSwapped: true},
+		{name: "nil no longer matches", node: "A", expected: nil, new: 1, wantMeasured: true, wantCurrent: 5.3},
+		{name: "matching value", node: "A", expected: ptr(5.3), new: 6, wantSwapped: true, wantMeasured: true, wantCurrent: 5.3},
+		{name: "stale value", node: "A", expected: ptr(5.3), new: 7, wantMeasured: true, wantCurrent: 6},
+		{name: "value against unset", node: "B", expected: ptr(0), new: 1},
+		{name: "unknown node", node: "Z", expected: nil, new: 1, wantErr: ErrUnknownNode},
+	}
+
+	for _, st := range steps {
+		reply := make(chan CASResult, 1)
+		grid.update(CompareAndSet{Node: st.node, Expected: st.expected, New: st.new, Reply: reply})
+		got := <-reply
+
+		if !errors.Is(got.Err, st.wantErr) || got.Swapped != st.wantSwapped || got.Measured != st.wantMeasured || got.Current != st.wantCurrent {
+			t.Fatalf("%s: result = %+v, want swapped=%v measured=%v current=%v err=%v",
+				st.name, got, st.wantSwapped, st.wantMeasured, st.wantCurrent, st.wantErr)
+		}
+	}
+
+	if got := aggregate(grid); got[0].Total != 6 || got[1].Total != 0 {
+		t.Fatalf("totals = %v, want A=6 and B unset", got)
+	}
+
+	grid.update(PauseUpdate{Paused: true})
+	reply := make(chan CASResult, 1)
+	grid.update(CompareAndSet{Node: "A", Expected: ptr(6), New: 8, Reply: reply})
+	if got := <-reply; !errors.Is(got.Err, ErrPaused) {
+		t.Fatalf("cas while paused err = %v, want %v", got.Err, ErrPaused)
+	}
+}
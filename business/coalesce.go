@@ -0,0 +1,124 @@
+package business
+
+import "time"
+
+// coalescedUpdate is the latest set-mode measurement of a node held during the
+// coalescing window, with every sender waiting for the node's result.
+type coalescedUpdate struct {
+	m       NodeMeasurement
+	replies []chan<- MeasurementResult
+}
+
+// coalesceFlush applies the held measurements. The loop processes it when the
+// coalescing window ends.
+type coalesceFlush struct{}
+
+// coalesce holds e for the coalescing window and reports whether it did. A
+// later set-mode measurement of the same node replaces it, so only the last
+// arriving value is applied. Add-mode measurements depend on the stored value
+// and are never held.
+func (s *Grid) coalesce(e MeasurementUpdate) bool {
+	if s.coalesceWindow == 0 || s.paused || e.Mode != MeasurementSet {
+		return false
+	}
+
+	if i, ok := s.coalesceIndex[e.Node]; ok {
+		s.coalesced[i].m = e.NodeMeasurement
+		s.coalesced[i].replies = append(s.coalesced[i].replies, e.Reply)
+		return true
+	}
+
+	if s.coalesceIndex == nil {
+		s.coalesceIndex = map[string]int{}
+	}
+	s.coalesceIndex[e.Node] = len(s.coalesced)
+	s.coalesced = append(s.coalesced, coalescedUpdate{m: e.NodeMeasurement, replies: []chan<- MeasurementResult{e.Reply}})
+	if s.coalesceTimer == nil {
+		s.coalesceTimer = time.NewTimer(s.coalesceWindow)
+	}
+	return true
+}
+
+// coalesceC returns the channel signaling the end of the coalescing window, or
+// nil (blocking forever in a select) when nothing is held.
+func (s *Grid) coalesceC() <-chan time.Time {
+	if s.coalesceTimer == nil {
+		return nil
+	}
+	return s.coalesceTimer.C
+}
+
+// flushCoalesced applies the held measurements in arrival order and answers
+// every sender with the totals after all of them. Senders of a replaced value
+// get the result of the value that replaced it. Should applying them panic,
+// every sender is answered with ErrEventPanicked before the panic goes on to
+// safeUpdate, which only knows about the event that triggered the flush.
+func (s *Grid) flushCoalesced() {
+	if s.coalesceTimer != nil {
+		s.coalesceTimer.Stop()
+		s.coalesceTimer = nil
+	}
+	if len(s.coalesced) == 0 {
+		return
+	}
+	held := s.coalesced
+	s.coalesced = nil
+	clear(s.coalesceIndex)
+
+	answered := false
+	defer func() {
+		if !answered {
+			replyHeldPanic(held)
+		}
+	}()
+
+	results := make([]MeasurementResult, len(held))
+	// Subscribers are notified once, for the only island touched or for all.
+	changed, applied := allIslands, 0
+	for i, c := range held {
+		results[i].Applied, results[i].Changed = s.measure(c.m)
+		if !results[i].Applied {
+			continue
+		}
+		if island := s.islandOfNode(c.m.Node); applied == 0 {
+			changed = island
+		} else if island != changed {
+			changed = allIslands
+		}
+		applied++
+	}
+
+	if applied > 0 {
+		s.commit()
+	}
+	totals := s.currentTotals()
+	for i, c := range held {
+		results[i].Totals = totals
+		results[i].Version = s.version
+		for _, reply := range c.replies {
+			if reply != nil {
+				reply <- results[i]
+			}
+		}
+	}
+	answered = true
+	if applied > 0 {
+		s.publish(changed, false)
+	}
+}
+
+// replyHeldPanic answers the senders of held with ErrEventPanicked. Like
+// replyPanic, the send never blocks.
+func replyHeldPanic(held []coalescedUpdate) {
+	for _, c := range held {
+		for _, reply := range c.replies {
+			if reply == nil {
+				continue
+			}
+			select {
+			case reply <- MeasurementResult{Err: ErrEventPanicked}:
+			default:
+			}
+		}
+	}
+}
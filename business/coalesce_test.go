@@ -0,0 +1,132 @@
+package business
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoalesceKeepsLastValuePerNode(t *testing.T) {
+	t.Parallel()
+
+	// The window never ends on its own: the detail query flushes it.
+	grid := NewGrid(WithMeasurementCoalescing(time.Hour))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+
+	updates := []NodeMeasurement{
+		{Node: "A", Value: 1},
+		{Node: "C", Value: 5},
+		{Node: "A", Value: 2},
+		{Node: "Z", Value: 9},
+	}
+	replies := make([]chan MeasurementResult, len(updates))
+	for i, m := range updates {
+		replies[i] = make(chan MeasurementResult, 1)
+		grid.update(MeasurementUpdate{NodeMeasurement: m, Reply: replies[i]})
+	}
+	for i, r := range replies {
+		if len(r) != 0 {
+			t.Fatalf("update %d answered before the window ended", i)
+		}
+	}
+
+	detail := make(chan NodeDetail, 1)
+	grid.update(NodeDetailQuery{Node: "A", Reply: detail})
+	if got := <-detail; got.Value != 2 {
+		t.Fatalf("A = %v after flush, want the last value 2", got.Value)
+	}
+
+	want := []IslandMeasurement{
+		{Island: []string{"A", "B"}, Total: 2, NodeCount: 2, MeasuredCount: 1},
+		{Island: []string{"C"}, Total: 5, NodeCount: 1, MeasuredCount: 1},
+	}
+	for i, r := range replies {
+		res := <-r
+		if !totalsEqual(res.Totals, want) {
+			t.Fatalf("update %d totals = %v, want %v", i, res.Totals, want)
+		}
+		if wantApplied := updates[i].Node != "Z"; res.Applied != wantApplied {
+			t.Fatalf("update %d applied = %v, want %v", i, res.Applied, wantApplied)
+		}
+	}
+}
+
+func TestCoalesceDoesNotHoldAddMode(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithMeasurementCoalescing(time.Hour))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A"}, nil)})
+
+	set := make(chan MeasurementResult, 1)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}, Reply: set})
+
+	// The add must see the held set, and is answered right away.
+	add := make(chan MeasurementResult, 1)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 3, Mode: MeasurementAdd}, Reply: add})
+
+	if got := (<-add).Totals[0].Total; got != 5 {
+		t.Fatalf("total after set 2 and add 3 = %v, want 5", got)
+	}
+	if got := (<-set).Totals[0].Total; got != 2 {
+		t.Fatalf("total answered to the set = %v, want 2", got)
+	}
+}
+
+func TestConcurrentSameNodeWrites(t *testing.T) {
+	t.Parallel()
+
+	for _, window := range []time.Duration{0, time.Millisecond} {
+		t.Run(window.String(), func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			events := make(chan Event, 64)
+			go NewGrid(WithMeasurementCoalescing(window)).Loop(ctx, events)
+
+			send := func(evt Event) {
+				select {
+				case events <- evt:
+				case <-ctx.Done():
+				}
+			}
+
+			graphDone := make(chan GraphResult, 1)
+			send(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}}), Reply: graphDone})
+			<-graphDone
+
+			fixed := make(chan MeasurementResult, 1)
+			send(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 1000}, Reply: fixed})
+			<-fixed
+
+			const writers = 200
+			var wg sync.WaitGroup
+			for i := range writers {
+				wg.Go(func() {
+					reply := make(chan MeasurementResult, 1)
+					send(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: float64(i)}, Reply: reply})
+					if res := <-reply; !res.Applied {
+						t.Errorf("write %d was not applied", i)
+					}
+				})
+			}
+			wg.Wait()
+
+			detail := make(chan NodeDetail, 1)
+			send(NodeDetailQuery{Node: "A", Reply: detail})
+			last := (<-detail).Value
+			if last < 0 || last >= writers || last != float64(int(last)) {
+				t.Fatalf("A = %v, want one of the written values", last)
+			}
+
+			totals := make(chan []IslandPeak, 1)
+			send(IslandPeaksQuery{Reply: totals})
+			got := <-totals
+			if len(got) != 1 || got[0].Total != 1000+last {
+				t.Fatalf("totals = %v, want %v", got, 1000+last)
+			}
+		})
+	}
+}
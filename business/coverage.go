@@ -0,0 +1,24 @@
+package business
+
+// IslandCoverage tells how many nodes of an island currently report a
+// measurement.
+type IslandCoverage struct {
+	Island    []string
+	Reporting int     // nodes with a stored measurement
+	Nodes     int     // nodes of the island
+	Coverage  float64 // Reporting / Nodes
+}
+
+// islandCoverage returns the measurement coverage of every island, in island
+// order. Islands without any measurement are included with coverage 0.
+func islandCoverage(s *Grid) []IslandCoverage {
+	totals := s.islandTotals()
+	res := make([]IslandCoverage, len(totals))
+	for i, t := range totals {
+		res[i] = IslandCoverage{Island: t.Island, Reporting: t.MeasuredCount, Nodes: t.NodeCount}
+		if t.NodeCount > 0 {
+			res[i].Coverage = float64(t.MeasuredCount) / float64(t.NodeCount)
+		}
+	}
+	return res
+}
@@ -0,0 +1,36 @@
+package business
+
+import "testing"
+
+func TestIslandCoverage(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C", "D", "E", "F"}, [][]string{{"A", "B"}, {"C", "D"}, {"D", "E"}})})
+	for _, node := range []string{"A", "B", "C", "Z"} {
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: node, Value: 1}})
+	}
+
+	reply := make(chan []IslandCoverage, 1)
+	grid.update(IslandCoverageQuery{Reply: reply})
+	got := <-reply
+
+	want := []struct {
+		island    []string
+		reporting int
+		coverage  float64
+	}{
+		{island: []string{"A", "B"}, reporting: 2, coverage: 1},
+		{island: []string{"C", "D", "E"}, reporting: 1, coverage: 1.0 / 3},
+		{island: []string{"F"}, reporting: 0, coverage: 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("coverage = %+v, want %d islands", got, len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if !islandsEqual([][]string{g.Island}, [][]string{w.island}) || g.Reporting != w.reporting || g.Nodes != len(w.island) || g.Coverage != w.coverage {
+			t.Fatalf("island %d = %+v, want %v with %d reporting (coverage %v)", i, g, w.island, w.reporting, w.coverage)
+		}
+	}
+}
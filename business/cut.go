@@ -0,0 +1,101 @@
+package business
+
+import "context"
+
+// EdgeCut is the outcome of simulating the removal of an edge.
+type EdgeCut struct {
+	Found   bool       // the edge exists in the current graph
+	Split   bool       // removing the edge disconnects its island
+	Islands [][]string // the resulting islands when Split, see simulateCut
+}
+
+// simulateCut reports whether removing every edge between a and b would split
+// their island, i.e. whether the link is a bridge. The topology is only read:
+// the search treats the link as absent instead of deleting it.
+// The two sides are reported From's side first.
+func simulateCut(g topology, nodes *nodeTable, nodeToIsland []int, islands [][]string, a, b int) EdgeCut {
+	if !g.has(a) || !g.has(b) || !hasEdge(g, a, b) && !(g.directed && hasEdge(g, b, a)) {
+		return EdgeCut{}
+	}
+	if g.directed {
+		return simulateDirectedCut(g, nodes, nodeToIsland, islands, a, b)
+	}
+
+	// Collect the nodes still reachable from a without crossing the link.
+	reached := map[int]bool{a: true}
+	stack := []int{a}
+	for len(stack) > 0 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, nei := range g.adj[v] {
+			if (v == a && nei == b) || (v == b && nei == a) {
+				continue
+			}
+			if !reached[nei] {
+				reached[nei] = true
+				stack = append(stack, nei)
+			}
+		}
+	}
+
+	// Another path exists: the edge is not a bridge.
+	if reached[b] {
+		return EdgeCut{Found: true}
+	}
+
+	// Partition the island preserving its node order.
+	var sideA, sideB []string
+	for _, name := range islands[nodeToIsland[a]] {
+		id, _ := nodes.id(name)
+		if reached[id] {
+			sideA = append(sideA, name)
+		} else {
+			sideB = append(sideB, name)
+		}
+	}
+
+	return EdgeCut{Found: true, Split: true, Islands: [][]string{sideA, sideB}}
+}
+
+// simulateDirectedCut is simulateCut for a directed graph: the edges between a
+// and b are removed in both directions, and the strongly connected components
+// of their island recomputed. The island may break into more than two, which
+// are reported in island order.
+func simulateDirectedCut(g topology, nodes *nodeTable, nodeToIsland []int, islands [][]string, a, b int) EdgeCut {
+	island := nodeToIsland[a]
+	if nodeToIsland[b] != island {
+		// The edge joins two islands: removing it cannot split either.
+		return EdgeCut{Found: true}
+	}
+
+	sub := topology{order: make([]int, len(islands[island])), adj: make([][]int, nodes.len()), directed: true}
+	for i, name := range islands[island] {
+		id, _ := nodes.id(name)
+		sub.order[i] = id
+		sub.adj[id] = []int{}
+	}
+	for _, v := range sub.order {
+		for _, nei := range g.adj[v] {
+			if sub.adj[nei] != nil && !(v == a && nei == b) && !(v == b && nei == a) {
+				sub.adj[v] = append(sub.adj[v], nei)
+			}
+		}
+	}
+
+	parts, _, _ := computeSCC(context.Background(), sub, nodes)
+	if len(parts) == 1 {
+		return EdgeCut{Found: true}
+	}
+	return EdgeCut{Found: true, Split: true, Islands: parts}
+}
+
+// hasEdge reports whether a and b are adjacent.
+func hasEdge(g topology, a, b int) bool {
+	for _, nei := range g.adj[a] {
+		if nei == b {
+			return true
+		}
+	}
+	return false
+}
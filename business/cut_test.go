@@ -0,0 +1,82 @@
+package business
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSimulateCut(t *testing.T) {
+	t.Parallel()
+
+	// A-B-C form a triangle (no bridges), C-D is a bridge.
+	graph := NewGraph(
+		[]string{"A", "B", "C", "D"},
+		[][]string{{"A", "B"}, {"B", "C"}, {"C", "A"}, {"C", "D"}},
+	)
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     EdgeCut
+	}{
+		{
+			name: "bridge edge splits the island",
+			from: "C",
+			to:   "D",
+			want: EdgeCut{Found: true, Split: true, Islands: [][]string{{"A", "B", "C"}, {"D"}}},
+		},
+		{
+			name: "bridge edge given in reverse order",
+			from: "D",
+			to:   "C",
+			want: EdgeCut{Found: true, Split: true, Islands: [][]string{{"D"}, {"A", "B", "C"}}},
+		},
+		{
+			name: "redundant edge does not split",
+			from: "A",
+			to:   "B",
+			want: EdgeCut{Found: true},
+		},
+		{
+			name: "missing edge is not found",
+			from: "A",
+			to:   "D",
+			want: EdgeCut{},
+		},
+		{
+			name: "unknown node is not found",
+			from: "A",
+			to:   "X",
+			want: EdgeCut{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: graph})
+
+			reply := make(chan EdgeCut, 1)
+			grid.update(EdgeCutQuery{From: tt.from, To: tt.to, Reply: reply})
+
+			got := <-reply
+			if got.Found != tt.want.Found || got.Split != tt.want.Split {
+				t.Fatalf("cut = %+v, want %+v", got, tt.want)
+			}
+			for i := range tt.want.Islands {
+				if !sameMembers(got.Islands[i], tt.want.Islands[i]) {
+					t.Fatalf("cut islands = %v, want %v", got.Islands, tt.want.Islands)
+				}
+			}
+
+			// The simulation must not touch the stored topology.
+			if len(grid.islands) != 1 || len(grid.islands[0]) != 4 {
+				t.Fatalf("grid islands mutated: %v", grid.islands)
+			}
+		})
+	}
+}
+
+func sameMembers(a, b []string) bool {
+	return reflect.DeepEqual(normalizeStrings(a), normalizeStrings(b))
+}
@@ -0,0 +1,49 @@
+package business
+
+// IslandDensity is the edge density of one island.
+type IslandDensity struct {
+	Island  []string
+	Nodes   int
+	Edges   int     // distinct undirected edges (BuildGraph drops self-loops)
+	Density float64 // Edges over the Nodes*(Nodes-1)/2 possible ones, 0 below two nodes
+}
+
+// GraphDensity is the edge density of the whole graph and of each island.
+type GraphDensity struct {
+	Nodes   int
+	Edges   int
+	Density float64
+	Islands []IslandDensity
+}
+
+// graphDensity computes the edge density of the current graph. The graph counts
+// are the sums of the island ones: edges never cross islands, except in a
+// directed graph, where such edges are not counted. Both directions of a
+// directed pair count as one edge.
+func graphDensity(s *Grid) GraphDensity {
+	res := GraphDensity{Islands: make([]IslandDensity, len(s.islands))}
+	for i, island := range s.islands {
+		ids := make([]int, len(island))
+		for j, name := range island {
+			ids[j], _ = s.nodes.id(name)
+		}
+
+		d := IslandDensity{Island: island, Nodes: len(ids), Edges: countEdges(s.graph, s.nodeToIsland, ids)}
+		d.Density = density(d.Nodes, d.Edges)
+		res.Islands[i] = d
+
+		res.Nodes += d.Nodes
+		res.Edges += d.Edges
+	}
+	res.Density = density(res.Nodes, res.Edges)
+	return res
+}
+
+// density returns edges over the possible edges between nodes nodes, or 0 when
+// there are fewer than two nodes and density is undefined.
+func density(nodes, edges int) float64 {
+	if nodes < 2 {
+		return 0
+	}
+	return float64(edges) / (float64(nodes) * float64(nodes-1) / 2)
+}
@@ -0,0 +1,65 @@
+package business
+
+import "testing"
+
+func TestGraphDensity(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		nodes       []string
+		edges       [][]string
+		wantEdges   int
+		wantDensity float64
+		wantIslands []IslandDensity
+	}{
+		{name: "empty graph", wantIslands: []IslandDensity{}},
+		{
+			name:        "single node",
+			nodes:       []string{"A"},
+			edges:       [][]string{{"A", "A"}},
+			wantIslands: []IslandDensity{{Island: []string{"A"}, Nodes: 1}},
+		},
+		{
+			// A triangle, a path of three, and a lone node: 5 edges out of
+			// 7*6/2 = 21 possible ones.
+			name:        "known graph",
+			nodes:       []string{"A", "B", "C", "D", "E", "F", "G"},
+			edges:       [][]string{{"A", "B"}, {"B", "C"}, {"C", "A"}, {"B", "A"}, {"D", "E"}, {"E", "F"}},
+			wantEdges:   5,
+			wantDensity: 5.0 / 21,
+			wantIslands: []IslandDensity{
+				{Island: []string{"A", "B", "C"}, Nodes: 3, Edges: 3, Density: 1},
+				{Island: []string{"D", "E", "F"}, Nodes: 3, Edges: 2, Density: 2.0 / 3},
+				{Island: []string{"G"}, Nodes: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: NewGraph(tt.nodes, tt.edges)})
+
+			reply := make(chan GraphDensity, 1)
+			grid.update(DensityQuery{Reply: reply})
+			got := <-reply
+
+			if got.Nodes != len(tt.nodes) || got.Edges != tt.wantEdges || got.Density != tt.wantDensity {
+				t.Fatalf("graph = %d nodes, %d edges, density %v; want %d, %d, %v",
+					got.Nodes, got.Edges, got.Density, len(tt.nodes), tt.wantEdges, tt.wantDensity)
+			}
+			if len(got.Islands) != len(tt.wantIslands) {
+				t.Fatalf("islands = %+v, want %+v", got.Islands, tt.wantIslands)
+			}
+			for i, want := range tt.wantIslands {
+				g := got.Islands[i]
+				if !islandsEqual([][]string{g.Island}, [][]string{want.Island}) || g.Nodes != want.Nodes || g.Edges != want.Edges || g.Density != want.Density {
+					t.Fatalf("island %d = %+v, want %+v", i, g, want)
+				}
+			}
+		})
+	}
+}
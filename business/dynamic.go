@@ -0,0 +1,346 @@
+package business
+
+import (
+	"errors"
+	"slices"
+)
+
+// ErrRecomputePending is returned for an edge edit while the islands of a newer
+// graph are still being computed in the background: the edit would apply to a
+// graph about to be replaced.
+var ErrRecomputePending = errors.New("edge edit rejected: a graph update is still being applied")
+
+// editEdges applies the removals of e, then its additions, to the current graph
+// and maintains the islands incrementally instead of recomputing them all:
+//
+//   - adding an edge between two islands merges them, relabeling only the
+//     smaller one;
+//   - removing an edge searches from both endpoints in lockstep; the searches
+//     meeting proves the island is still connected, while the side exhausted
+//     first, the smaller one, becomes a new island.
+//
+// Edited islands do not keep the order a full rebuild would give them: a merged
+// island takes the place of the larger one, the island emptied by a merge is
+// replaced by the last one, and split-off islands are appended. The order stays
+// deterministic, and a full rebuild (e.g. RecomputeIslands) restores the
+// canonical one. Edges with an endpoint outside the graph, self-loops,
+// additions of existing edges and removals of missing edges are ignored.
+//
+// Strongly connected components cannot be maintained this way: the edges of a
+// directed graph are edited in place and its islands rebuilt.
+func (s *Grid) editEdges(e EdgeEdit) GraphResult {
+	if s.recomputeCancel != nil {
+		return GraphResult{Islands: s.islands, Err: ErrRecomputePending}
+	}
+	if s.graph.directed {
+		s.editDirectedEdges(e)
+		return GraphResult{Islands: s.islands}
+	}
+
+	// Earlier replies share the island list: edit a copy of it. The islands
+	// themselves are never modified in place, only replaced.
+	s.islands = slices.Clone(s.islands)
+
+	for _, edge := range e.Remove {
+		if a, b, ok := s.edgeIDs(edge); ok {
+			s.unlink(a, b)
+		}
+	}
+	for _, edge := range e.Add {
+		if a, b, ok := s.newEdgeIDs(edge); ok {
+			s.link(a, b)
+		}
+	}
+
+	s.islandsChanged()
+	return GraphResult{Islands: s.islands}
+}
+
+// removeNode drops node from the graph along with its edges and stored
+// measurement, and reports whether it was in the graph. Its edges are unlinked
+// one by one as in editEdges, splitting its island where it was the only
+// bridge, which leaves the node an island of its own to remove.
+func (s *Grid) removeNode(node string) (GraphResult, bool) {
+	if s.recomputeCancel != nil {
+		return GraphResult{Islands: s.islands, Err: ErrRecomputePending}, false
+	}
+	id, ok := s.nodes.id(s.resolveAlias(node))
+	if !ok || !s.graph.has(id) {
+		return GraphResult{Islands: s.islands}, false
+	}
+
+	if s.graph.directed {
+		for _, other := range s.graph.order {
+			for {
+				if _, ok := s.graph.removeNeighbor(other, id); !ok {
+					break
+				}
+			}
+		}
+		s.dropNode(id)
+		s.rebuildIslands()
+		return GraphResult{Islands: s.islands}, true
+	}
+
+	s.islands = slices.Clone(s.islands)
+	for len(s.graph.adj[id]) > 0 {
+		s.unlink(id, s.graph.adj[id][0])
+	}
+	s.dropNode(id)
+	s.removeIsland(s.nodeToIsland[id])
+	s.nodeToIsland[id] = -1
+
+	s.islandsChanged()
+	return GraphResult{Islands: s.islands}, true
+}
+
+// dropNode removes the node with the given ID from the graph, along with the
+// edges it still lists, and forgets its measurement, transform and aliases.
+func (s *Grid) dropNode(id int) {
+	s.graph.order = slices.DeleteFunc(slices.Clone(s.graph.order), func(n int) bool { return n == id })
+	s.graph.adj[id] = nil
+	if s.graph.weights != nil {
+		s.graph.weights[id] = nil
+	}
+	delete(s.graph.transforms, id)
+	for alias, target := range s.graph.aliases {
+		if target == id {
+			delete(s.graph.aliases, alias)
+		}
+	}
+	if id < len(s.measurements) {
+		s.measurements[id] = measurement{}
+	}
+	if id < len(s.readings) {
+		s.readings[id] = readingRing{}
+	}
+}
+
+// editDirectedEdges applies the removals of e, then its additions, as one-way
+// edges and rebuilds the islands.
+func (s *Grid) editDirectedEdges(e EdgeEdit) {
+	for _, edge := range e.Remove {
+		if a, b, ok := s.edgeIDs(edge); ok {
+			s.graph.removeNeighbor(a, b)
+		}
+	}
+	for _, edge := range e.Add {
+		if a, b, ok := s.newEdgeIDs(edge); ok {
+			s.graph.addNeighbor(a, b)
+		}
+	}
+	s.rebuildIslands()
+}
+
+// edgeIDs returns the IDs of the endpoints of edge, provided both are nodes of
+// the current graph.
+func (s *Grid) edgeIDs(edge []string) (int, int, bool) {
+	if len(edge) != 2 {
+		return 0, 0, false
+	}
+	a, okA := s.nodes.id(edge[0])
+	b, okB := s.nodes.id(edge[1])
+	if !okA || !okB || !s.graph.has(a) || !s.graph.has(b) {
+		return 0, 0, false
+	}
+	return a, b, true
+}
+
+// newEdgeIDs is edgeIDs for an edge to add: like NewGraph, it leaves out
+// self-loops and edges the graph already has.
+func (s *Grid) newEdgeIDs(edge []string) (int, int, bool) {
+	a, b, ok := s.edgeIDs(edge)
+	if !ok || a == b || slices.Contains(s.graph.adj[a], b) {
+		return 0, 0, false
+	}
+	return a, b, true
+}
+
+// link adds an edge between a and b, merging their islands if they differ.
+// Like NewGraph, it records the edge once per endpoint.
+func (s *Grid) link(a, b int) {
+	s.graph.addNeighbor(a, b)
+	s.graph.addNeighbor(b, a)
+
+	keep, drop := s.nodeToIsland[a], s.nodeToIsland[b]
+	if keep == drop {
+		s.addEdgeWeight(keep, 1)
+		return
+	}
+	// Only the nodes of the smaller island are relabeled.
+	if len(s.islands[keep]) < len(s.islands[drop]) {
+		keep, drop = drop, keep
+	}
+
+	merged := make([]string, 0, len(s.islands[keep])+len(s.islands[drop]))
+	merged = append(append(merged, s.islands[keep]...), s.islands[drop]...)
+	slices.Sort(merged)
+	s.relabel(s.islands[drop], keep)
+	s.islands[keep] = merged
+	s.edgeWeights[keep] += s.edgeWeights[drop] + 1
+	// A merged island is a new island: its peak starts from its total.
+	s.peaks[keep] = s.refreshIsland(keep).Total
+	s.removeIsland(drop)
+}
+
+// unlink removes one edge between a and b, splitting their island if that was
+// the last path between them. Removing a missing edge does nothing.
+func (s *Grid) unlink(a, b int) {
+	weight, ok := s.graph.removeNeighbor(a, b)
+	if !ok {
+		return
+	}
+	s.graph.removeNeighbor(b, a)
+	island := s.nodeToIsland[a]
+	if a == b || slices.Contains(s.graph.adj[a], b) {
+		s.addEdgeWeight(island, -weight)
+		return
+	}
+
+	side := separatedSide(s.graph, a, b)
+	if side == nil {
+		s.addEdgeWeight(island, -weight)
+		return
+	}
+
+	split := len(s.islands)
+	names := make([]string, len(side))
+	for i, id := range side {
+		names[i] = s.nodes.names[id]
+		s.nodeToIsland[id] = split
+	}
+	slices.Sort(names)
+	rest := make([]string, 0, len(s.islands[island])-len(side))
+	for _, n := range s.islands[island] {
+		if id, _ := s.nodes.id(n); s.nodeToIsland[id] == island {
+			rest = append(rest, n)
+		}
+	}
+
+	s.islands[island] = rest
+	s.islands = append(s.islands, names)
+	// Only the split-off side is walked for its edge weight, as it was to
+	// find it; the rest keeps what is left.
+	sideWeight := membersEdgeWeight(s.graph, names, s.nodeToIsland, &s.nodes)
+	s.edgeWeights[island] -= weight + sideWeight
+	s.edgeWeights = append(s.edgeWeights, sideWeight)
+	// Both halves are new islands: their peaks start from their totals.
+	s.peaks = append(s.peaks, 0)
+	if s.totals != nil {
+		s.totals = append(s.totals, IslandMeasurement{})
+	}
+	s.peaks[island] = s.refreshIsland(island).Total
+	s.peaks[split] = s.refreshIsland(split).Total
+}
+
+// removeIsland drops island i, moving the last island into its place.
+func (s *Grid) removeIsland(i int) {
+	last := len(s.islands) - 1
+	if i != last {
+		s.islands[i], s.peaks[i] = s.islands[last], s.peaks[last]
+		s.edgeWeights[i] = s.edgeWeights[last]
+		s.relabel(s.islands[i], i)
+		if s.totals != nil {
+			s.totals[i] = s.totals[last]
+		}
+	}
+	s.islands[last] = nil
+	s.islands, s.peaks = s.islands[:last], s.peaks[:last]
+	s.edgeWeights = s.edgeWeights[:last]
+	if s.totals != nil {
+		s.totals = s.totals[:last]
+	}
+}
+
+// addEdgeWeight adjusts the edge weight of island for an edge added or removed
+// inside it, which would otherwise need the whole island re-summed.
+func (s *Grid) addEdgeWeight(island int, delta float64) {
+	s.edgeWeights[island] += delta
+	if s.totals != nil {
+		s.totals[island].EdgeWeight = s.edgeWeights[island]
+	}
+}
+
+// relabel maps every node of names to island.
+func (s *Grid) relabel(names []string, island int) {
+	for _, n := range names {
+		id, _ := s.nodes.id(n)
+		s.nodeToIsland[id] = island
+	}
+}
+
+// addNeighbor appends nei to the adjacency row of a. Edges added after the
+// graph was posted weigh 1.
+func (tp topology) addNeighbor(a, nei int) {
+	tp.adj[a] = append(tp.adj[a], nei)
+	if tp.weights != nil {
+		tp.weights[a] = append(tp.weights[a], 1)
+	}
+}
+
+// removeNeighbor deletes the first occurrence of nei from the adjacency row of
+// a, along with its weight, and returns that weight and whether there was one.
+// The order of the rest is kept, so full rebuilds stay deterministic.
+func (tp topology) removeNeighbor(a, nei int) (float64, bool) {
+	i := slices.Index(tp.adj[a], nei)
+	if i < 0 {
+		return 0, false
+	}
+	weight := tp.weight(a, i)
+	tp.adj[a] = slices.Delete(tp.adj[a], i, i+1)
+	if tp.weights != nil {
+		tp.weights[a] = slices.Delete(tp.weights[a], i, i+1)
+	}
+	return weight, true
+}
+
+// separatedSide runs a BFS from a and one from b in lockstep, one node each in
+// turn. If either reaches the other endpoint, a and b are connected and it
+// returns nil. Otherwise it returns the nodes reached by the search that ran out
+// first: a whole component, and the smaller one up to a step, so the cost is
+// bounded by the smaller side rather than the island.
+func separatedSide(g topology, a, b int) []int {
+	x, y := newSearch(a), newSearch(b)
+	for {
+		if !x.step(g) {
+			return x.queue
+		}
+		if x.seen[b] {
+			return nil
+		}
+		if !y.step(g) {
+			return y.queue
+		}
+		if y.seen[a] {
+			return nil
+		}
+	}
+}
+
+// search is an incremental BFS. It keeps its visited set in a map, so its cost
+// depends on the nodes it reaches only.
+type search struct {
+	queue []int
+	seen  map[int]bool
+	next  int // position in queue of the next node to expand
+}
+
+func newSearch(start int) *search {
+	return &search{queue: []int{start}, seen: map[int]bool{start: true}}
+}
+
+// step expands the next node of the search and reports whether there was one.
+func (s *search) step(g topology) bool {
+	if s.next == len(s.queue) {
+		return false
+	}
+	v := s.queue[s.next]
+	s.next++
+	for _, nei := range g.adj[v] {
+		if !s.seen[nei] {
+			s.seen[nei] = true
+			s.queue = append(s.queue, nei)
+		}
+	}
+	return true
+}
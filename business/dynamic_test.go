@@ -0,0 +1,364 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// partition returns islands in a canonical form: each island sorted, and the
+// islands sorted by their first node.
+func partition(islands [][]string) [][]string {
+	out := make([][]string, len(islands))
+	for i, island := range islands {
+		out[i] = slices.Sorted(slices.Values(island))
+	}
+	slices.SortFunc(out, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+	return out
+}
+
+// checkAgainstRebuild fails unless the incrementally maintained islands of grid
+// match a full DFS rebuild of its graph, and its island-keyed state agrees.
+func checkAgainstRebuild(t *testing.T, grid *Grid, step string) {
+	t.Helper()
+
+	want, _ := computeIslands(grid.graph, &grid.nodes)
+	if got := partition(grid.islands); !islandsEqual(got, partition(want)) {
+		t.Fatalf("%s: islands = %v, want %v", step, got, partition(want))
+	}
+	for i, island := range grid.islands {
+		for _, n := range island {
+			if id, _ := grid.nodes.id(n); grid.nodeToIsland[id] != i {
+				t.Fatalf("%s: node %s maps to island %d, listed in %d", step, n, grid.nodeToIsland[id], i)
+			}
+		}
+	}
+	if len(grid.peaks) != len(grid.islands) || grid.IslandCount() != len(grid.islands) {
+		t.Fatalf("%s: %d peaks, count %d for %d islands", step, len(grid.peaks), grid.IslandCount(), len(grid.islands))
+	}
+	if want := islandEdgeWeights(grid.graph, grid.islands, grid.nodeToIsland, &grid.nodes); !slices.Equal(grid.edgeWeights, want) {
+		t.Fatalf("%s: edge weights = %v, want %v", step, grid.edgeWeights, want)
+	}
+}
+
+func TestEdgeEdit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		edges [][]string
+		edit  EdgeEdit
+		want  [][]string // canonical partition after the edit
+	}{
+		{
+			name: "add merges islands",
+			edit: EdgeEdit{Add: [][]string{{"B", "C"}}},
+			want: [][]string{{"A", "B", "C", "D"}, {"E"}},
+		},
+		{
+			name: "add within an island",
+			edit: EdgeEdit{Add: [][]string{{"A", "B"}}},
+			want: [][]string{{"A", "B"}, {"C", "D"}, {"E"}},
+		},
+		{
+			name: "remove a bridge splits",
+			edit: EdgeEdit{Remove: [][]string{{"B", "A"}}},
+			want: [][]string{{"A"}, {"B"}, {"C", "D"}, {"E"}},
+		},
+		{
+			name:  "repeated edges are kept once",
+			edges: [][]string{{"A", "B"}, {"B", "A"}},
+			edit:  EdgeEdit{Remove: [][]string{{"A", "B"}}},
+			want:  [][]string{{"A"}, {"B"}, {"C", "D"}, {"E"}},
+		},
+		{
+			name:  "remove an edge of a cycle keeps the island",
+			edges: [][]string{{"B", "C"}, {"C", "A"}},
+			edit:  EdgeEdit{Remove: [][]string{{"A", "B"}}},
+			want:  [][]string{{"A", "B", "C", "D"}, {"E"}},
+		},
+		{
+			name: "removals apply before additions",
+			edit: EdgeEdit{Remove: [][]string{{"A", "B"}}, Add: [][]string{{"A", "E"}}},
+			want: [][]string{{"A", "E"}, {"B"}, {"C", "D"}},
+		},
+		{
+			name: "unknown nodes and missing edges are ignored",
+			edit: EdgeEdit{Add: [][]string{{"A", "Z"}, {"A"}}, Remove: [][]string{{"A", "E"}, {"Z", "A"}}},
+			want: [][]string{{"A", "B"}, {"C", "D"}, {"E"}},
+		},
+		{
+			name: "self-loops",
+			edit: EdgeEdit{Add: [][]string{{"E", "E"}}, Remove: [][]string{{"E", "E"}, {"A", "A"}}},
+			want: [][]string{{"A", "B"}, {"C", "D"}, {"E"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			edges := append([][]string{{"A", "B"}, {"C", "D"}}, tt.edges...)
+			grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C", "D", "E"}, edges)})
+
+			reply := make(chan GraphResult, 1)
+			tt.edit.Reply = reply
+			grid.update(tt.edit)
+			res := <-reply
+
+			if res.Err != nil {
+				t.Fatalf("err = %v", res.Err)
+			}
+			if got := partition(res.Islands); !islandsEqual(got, tt.want) {
+				t.Fatalf("islands = %v, want %v", got, tt.want)
+			}
+			checkAgainstRebuild(t, grid, "after edit")
+		})
+	}
+}
+
+func TestEdgeEditKeepsTotalsAndResetsPeaks(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+	for _, m := range []NodeMeasurement{{Node: "A", Value: 9}, {Node: "A", Value: 2}, {Node: "B", Value: 3}, {Node: "C", Value: 4}} {
+		grid.update(MeasurementUpdate{NodeMeasurement: m})
+	}
+
+	grid.update(EdgeEdit{Add: [][]string{{"B", "C"}}})
+	want := []IslandMeasurement{{Island: []string{"A", "B", "C"}, Total: 9}}
+	if got := aggregate(grid); !totalsEqual(got, want) {
+		t.Fatalf("totals after merge = %v, want %v", got, want)
+	}
+	if grid.peaks[0] != 9 {
+		t.Fatalf("peak after merge = %v, want the current total 9", grid.peaks[0])
+	}
+
+	grid.update(EdgeEdit{Remove: [][]string{{"A", "B"}}})
+	totals := map[string]float64{}
+	for i, island := range grid.islands {
+		totals[strings.Join(slices.Sorted(slices.Values(island)), ",")] = grid.islandTotal(i)
+		if grid.peaks[i] != grid.islandTotal(i) {
+			t.Fatalf("peak of %v = %v, want its total", island, grid.peaks[i])
+		}
+	}
+	if len(totals) != 2 || totals["A"] != 2 || totals["B,C"] != 7 {
+		t.Fatalf("totals after split = %v, want A 2 and B,C 7", totals)
+	}
+}
+
+func TestEdgeEditRejectedWhileRecomputing(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithRecomputeBudget(time.Millisecond))
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	grid.compute = func(ctx context.Context, g topology, nodes *nodeTable) ([][]string, []int, error) {
+		if len(g.order) > 1 {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+		return computeIslandsCtx(ctx, g, nodes)
+	}
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil)})
+
+	reply := make(chan GraphResult, 1)
+	grid.update(EdgeEdit{Add: [][]string{{"A", "B"}}, Reply: reply})
+	if got := <-reply; !errors.Is(got.Err, ErrRecomputePending) {
+		t.Fatalf("err = %v, want %v", got.Err, ErrRecomputePending)
+	}
+}
+
+func TestNodeRemove(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		directed bool
+		edges    [][]string
+		node     string
+		want     [][]string // canonical partition after the removal
+		removed  bool
+	}{
+		{
+			name:    "bridge splits its island",
+			edges:   [][]string{{"A", "B"}, {"B", "C"}},
+			node:    "B",
+			want:    [][]string{{"A"}, {"C"}, {"D"}},
+			removed: true,
+		},
+		{
+			name:    "node of a cycle keeps the island",
+			edges:   [][]string{{"A", "B"}, {"B", "C"}, {"C", "A"}},
+			node:    "A",
+			want:    [][]string{{"B", "C"}, {"D"}},
+			removed: true,
+		},
+		{
+			name:    "isolated node",
+			edges:   [][]string{{"A", "B"}},
+			node:    "D",
+			want:    [][]string{{"A", "B"}, {"C"}},
+			removed: true,
+		},
+		{
+			name:    "self-loops and parallel edges",
+			edges:   [][]string{{"A", "A"}, {"A", "B"}, {"A", "B"}, {"B", "C"}},
+			node:    "A",
+			want:    [][]string{{"B", "C"}, {"D"}},
+			removed: true,
+		},
+		{
+			name:  "node outside the graph",
+			edges: [][]string{{"A", "B"}},
+			node:  "Z",
+			want:  [][]string{{"A", "B"}, {"C"}, {"D"}},
+		},
+		{
+			name:     "directed cycle broken",
+			directed: true,
+			edges:    [][]string{{"A", "B"}, {"B", "C"}, {"C", "A"}, {"C", "D"}},
+			node:     "B",
+			want:     [][]string{{"A"}, {"C"}, {"D"}},
+			removed:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			nodes := []string{"A", "B", "C", "D"}
+			graph := NewGraph(nodes, tt.edges)
+			if tt.directed {
+				graph = NewDirectedGraph(nodes, tt.edges)
+			}
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: graph})
+			for i, n := range nodes {
+				grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: n, Value: float64(i + 1)}})
+			}
+			grid.islandTotals()
+			version := grid.version
+
+			reply := make(chan GraphResult, 1)
+			grid.update(NodeRemove{Node: tt.node, Reply: reply})
+			res := <-reply
+
+			if res.Err != nil {
+				t.Fatalf("err = %v", res.Err)
+			}
+			if got := partition(res.Islands); !islandsEqual(got, tt.want) {
+				t.Fatalf("islands = %v, want %v", got, tt.want)
+			}
+			if changed := res.Version != version; changed != tt.removed {
+				t.Errorf("version advanced: %v, want %v", changed, tt.removed)
+			}
+			if grid.hasNode(tt.node) {
+				t.Errorf("node %s still in the graph", tt.node)
+			}
+			if detail := grid.nodeDetail(tt.node); detail.Measured {
+				t.Errorf("node %s still has a measurement", tt.node)
+			}
+			if !tt.directed {
+				checkAgainstRebuild(t, grid, "after removal")
+			}
+			checkTotalsCache(t, grid, "after removal")
+		})
+	}
+}
+
+func TestEdgeEditRandomAgainstRebuild(t *testing.T) {
+	t.Parallel()
+
+	for seed := range uint64(20) {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			t.Parallel()
+
+			rng := rand.New(rand.NewPCG(seed, seed))
+			const nodeCount = 40
+			nodes := make([]string, nodeCount)
+			for i := range nodes {
+				nodes[i] = fmt.Sprintf("n%02d", i)
+			}
+			randomEdge := func() []string {
+				return []string{nodes[rng.IntN(nodeCount)], nodes[rng.IntN(nodeCount)]}
+			}
+
+			var edges [][]string
+			for range nodeCount {
+				edges = append(edges, randomEdge())
+			}
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: NewGraph(nodes, edges)})
+			checkAgainstRebuild(t, grid, "initial graph")
+
+			for step := range 200 {
+				var edit EdgeEdit
+				for range rng.IntN(3) {
+					// Mostly remove existing edges, so islands split as well as merge.
+					if len(edges) > 0 && rng.IntN(2) == 0 {
+						i := rng.IntN(len(edges))
+						edit.Remove = append(edit.Remove, edges[i])
+						edges = slices.Delete(edges, i, i+1)
+					} else {
+						edit.Remove = append(edit.Remove, randomEdge())
+					}
+				}
+				for range rng.IntN(3) {
+					e := randomEdge()
+					edit.Add = append(edit.Add, e)
+					edges = append(edges, e)
+				}
+				grid.update(edit)
+				checkAgainstRebuild(t, grid, fmt.Sprintf("step %d (%+v)", step, edit))
+			}
+		})
+	}
+}
+
+// BenchmarkEdgeEdit compares toggling one edge of a large graph through an
+// incremental EdgeEdit with posting the edited graph as a GraphUpdate.
+func BenchmarkEdgeEdit(b *testing.B) {
+	const nodeCount = 100_000
+
+	// Islands of ten nodes in a path; the toggled edge bridges two of them.
+	nodes := make([]string, nodeCount)
+	var edges [][]string
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("node-%d", i)
+		if i%10 != 0 {
+			edges = append(edges, []string{nodes[i-1], nodes[i]})
+		}
+	}
+	toggled := []string{nodes[9], nodes[10]}
+	withEdge := append(slices.Clone(edges), toggled)
+
+	b.Run("dynamic", func(b *testing.B) {
+		grid := NewGrid()
+		grid.update(GraphUpdate{Graph: NewGraph(nodes, edges)})
+		for b.Loop() {
+			grid.update(EdgeEdit{Add: [][]string{toggled}})
+			grid.update(EdgeEdit{Remove: [][]string{toggled}})
+		}
+	})
+
+	b.Run("recompute", func(b *testing.B) {
+		grid := NewGrid()
+		grid.update(GraphUpdate{Graph: NewGraph(nodes, edges)})
+		for b.Loop() {
+			grid.update(GraphUpdate{Graph: NewGraph(nodes, withEdge)})
+			grid.update(GraphUpdate{Graph: NewGraph(nodes, edges)})
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package business
+
+import (
+	"cmp"
+	"slices"
+)
+
+// edgeList returns every undirected edge of the current graph exactly once, as
+// a pair of node names in sorted order. The adjacency holds each edge once per
+// endpoint, and may repeat it; both are collapsed. The pairs are sorted too.
+// The edges of a directed graph keep their direction, from the first node to
+// the second.
+func edgeList(s *Grid) [][]string {
+	names := s.nodes.names
+	seen := make(map[[2]int]struct{})
+	edges := [][]string{}
+	for _, id := range s.graph.order {
+		for _, nei := range s.graph.adj[id] {
+			a, b := id, nei
+			if !s.graph.directed && names[b] < names[a] {
+				a, b = b, a
+			}
+			if _, ok := seen[[2]int{a, b}]; ok {
+				continue
+			}
+			seen[[2]int{a, b}] = struct{}{}
+			edges = append(edges, []string{names[a], names[b]})
+		}
+	}
+
+	slices.SortFunc(edges, func(x, y []string) int {
+		return cmp.Or(cmp.Compare(x[0], y[0]), cmp.Compare(x[1], y[1]))
+	})
+	return edges
+}
+
+// topologyView returns the islands, edges and measurements of the current graph.
+func (s *Grid) topologyView() Topology {
+	t := Topology{
+		Directed:     s.graph.directed,
+		Islands:      s.islands,
+		Edges:        edgeList(s),
+		Measurements: make(map[string]float64),
+	}
+	for _, id := range s.graph.order {
+		if id < len(s.measurements) && s.measurements[id].ok {
+			t.Measurements[s.nodes.names[id]] = s.measurements[id].value
+		}
+	}
+	return t
+}
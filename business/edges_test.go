@@ -0,0 +1,84 @@
+package business
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEdgeList(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		nodes []string
+		edges [][]string
+		want  [][]string
+	}{
+		{
+			name: "empty grid",
+			want: [][]string{},
+		},
+		{
+			name:  "no edges",
+			nodes: []string{"A", "B"},
+			want:  [][]string{},
+		},
+		{
+			name:  "pairs are canonical and sorted",
+			nodes: []string{"C", "B", "A", "D"},
+			edges: [][]string{{"C", "B"}, {"B", "A"}, {"D", "A"}},
+			want:  [][]string{{"A", "B"}, {"A", "D"}, {"B", "C"}},
+		},
+		{
+			name:  "mirrored and repeated edges collapse",
+			nodes: []string{"A", "B", "C"},
+			edges: [][]string{{"A", "B"}, {"B", "A"}, {"A", "B"}, {"B", "C"}},
+			want:  [][]string{{"A", "B"}, {"B", "C"}},
+		},
+		{
+			name:  "edges to unknown nodes are dropped",
+			nodes: []string{"A", "B"},
+			edges: [][]string{{"A", "B"}, {"A", "Z"}},
+			want:  [][]string{{"A", "B"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: NewGraph(tt.nodes, tt.edges)})
+
+			reply := make(chan [][]string, 1)
+			grid.update(EdgesQuery{Reply: reply})
+
+			if got := <-reply; !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("edges = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopologyQuery(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"B", "A"}})})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}})
+	// Retained for a node that then leaves the graph.
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "C", Value: 3}})
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"B", "A"}})})
+
+	reply := make(chan Topology, 1)
+	grid.update(TopologyQuery{Reply: reply})
+
+	want := Topology{
+		Islands:      [][]string{{"A", "B"}},
+		Edges:        [][]string{{"A", "B"}},
+		Measurements: map[string]float64{"A": 2},
+	}
+	if got := <-reply; !reflect.DeepEqual(got, want) {
+		t.Fatalf("topology = %+v, want %+v", got, want)
+	}
+}
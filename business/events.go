@@ -6,11 +6,260 @@ type Event any
 // GraphUpdate carries a new topology and an optional reply channel.
 type GraphUpdate struct {
 	Graph Graph
-	Reply chan<- [][]string
+	Reply chan<- GraphResult
+}
+
+// GraphResult is the reply to a GraphUpdate.
+type GraphResult struct {
+	Islands  [][]string // islands of the new topology
+	Degraded bool       // computing the islands exceeded the budget: Islands are the previous ones
+	Version  uint64     // state version after the update
+	Err      error      // the update was rejected and the topology is unchanged
+}
+
+// EdgeEdit adds and removes edges of the current graph, keeping its nodes. The
+// islands are maintained incrementally, which is much cheaper than a GraphUpdate
+// for small edits of a large graph. Removals apply first.
+type EdgeEdit struct {
+	Add    [][]string
+	Remove [][]string
+	Reply  chan<- GraphResult
+}
+
+// NodeRemove drops a node from the current graph, along with its edges and its
+// stored measurement. Like an EdgeEdit the islands are maintained
+// incrementally: removing a node that bridged two groups splits its island.
+// Removing a node that is not in the graph changes nothing.
+type NodeRemove struct {
+	Node  string
+	Reply chan<- GraphResult
 }
 
 // MeasurementUpdate carries a measurement and an optional reply channel.
 type MeasurementUpdate struct {
 	NodeMeasurement
+	Reply chan<- MeasurementResult
+}
+
+// MeasurementResult is the reply to a MeasurementUpdate.
+type MeasurementResult struct {
+	Totals  []IslandMeasurement // per-island totals after the update
+	Queued  bool                // held while paused, applied on resume
+	Applied bool                // stored; false when the node is not in the graph
+	Changed bool                // the total of the node's island changed
+	Version uint64              // state version after the update
+	Err     error               // the measurement was rejected
+}
+
+// BatchMeasurementUpdate applies several measurements in order as a single
+// event: subscribers, the state version and the reply all observe the grid
+// after the whole batch.
+type BatchMeasurementUpdate struct {
+	Measurements []NodeMeasurement
+	Reply        chan<- BatchMeasurementResult
+}
+
+// BatchMeasurementResult is the reply to a BatchMeasurementUpdate.
+type BatchMeasurementResult struct {
+	Totals  []IslandMeasurement // per-island totals after the whole batch
+	Queued  bool                // held while paused, applied on resume
+	Applied int                 // measurements stored; the others name nodes not in the graph
+	Changed bool                // the total of some island changed
+	Version uint64              // state version after the batch
+	Err     error               // the batch was rejected as a whole
+}
+
+// CompareAndSet stores New as the value of Node only if its current value is
+// Expected; a nil Expected matches a node that has not been measured yet.
+type CompareAndSet struct {
+	Node     string
+	Expected *float64
+	New      float64
+	Reply    chan<- CASResult
+}
+
+// CASResult is the reply to a CompareAndSet.
+type CASResult struct {
+	Swapped  bool                // New was stored
+	Totals   []IslandMeasurement // per-island totals after a swap
+	Measured bool                // the node had a value before the operation
+	Current  float64             // that value, reported on a mismatch
+	Err      error               // the operation could not be attempted
+}
+
+// ClearMeasurements drops every stored measurement while keeping the topology.
+// The reply carries the resulting (all zero) totals.
+type ClearMeasurements struct {
 	Reply chan<- []IslandMeasurement
 }
+
+// ResetEvent drops the graph and every measurement, leaving the grid as if
+// newly created. Events sent before it are applied first and events sent
+// after it see the empty grid. The reply is sent once the grid is reset.
+type ResetEvent struct {
+	Reply chan<- struct{}
+}
+
+// SnapshotQuery asks for the grid state serialized by Grid.Snapshot.
+type SnapshotQuery struct {
+	Reply chan<- SnapshotResult
+}
+
+// SnapshotResult carries a snapshot, or the error serializing it.
+type SnapshotResult struct {
+	Data []byte
+	Err  error
+}
+
+// RestoreSnapshot replaces the grid state with a snapshot, as Grid.Restore.
+// The reply carries the restored islands, or the error of an invalid snapshot,
+// which leaves the state unchanged.
+type RestoreSnapshot struct {
+	Data  []byte
+	Reply chan<- GraphResult
+}
+
+// TotalsAtQuery asks for the per-island totals right after a state version, or
+// for the current totals and version when Latest is set.
+type TotalsAtQuery struct {
+	Version uint64
+	Latest  bool
+	Reply   chan<- VersionedTotals
+}
+
+// RecomputeIslands rebuilds the islands of the current graph from scratch, as a
+// safety valve should they ever drift from the graph. The reply carries the
+// fresh islands.
+type RecomputeIslands struct {
+	Reply chan<- [][]string
+}
+
+// PauseUpdate pauses or resumes measurement processing.
+type PauseUpdate struct {
+	Paused bool
+	Reply  chan<- PauseStatus
+}
+
+// EdgeCutQuery asks what removing the edge between From and To would do to the
+// island containing it. The grid state is not modified.
+type EdgeCutQuery struct {
+	From  string
+	To    string
+	Reply chan<- EdgeCut
+}
+
+// NodesExistQuery asks which of Nodes are part of the current graph.
+type NodesExistQuery struct {
+	Nodes []string
+	Reply chan<- map[string]bool
+}
+
+// NodeDetailQuery asks for the stored state of a single node.
+type NodeDetailQuery struct {
+	Node  string
+	Reply chan<- NodeDetail
+}
+
+// NodeHistoryQuery asks for the measurements retained for a single node.
+type NodeHistoryQuery struct {
+	Node  string
+	Reply chan<- NodeHistory
+}
+
+// Subscribe registers a subscriber for island totals. The reply carries the
+// current totals of the watched islands; after every change to one of them the
+// new totals are pushed on Updates. Updates must be buffered: when the
+// subscriber falls behind, its pending update is replaced by the latest one.
+type Subscribe struct {
+	Nodes   []string          // watched nodes, empty watches every island
+	Updates chan TotalsUpdate // receives the watched totals after each change
+	Done    <-chan struct{}   // closed when the subscriber goes away
+	Reply   chan<- VersionedTotals
+}
+
+// CloseSubscribers ends every subscription, e.g. on shutdown: the Updates
+// channels of all subscribers are closed. The reply carries how many there were.
+type CloseSubscribers struct {
+	Reply chan<- int
+}
+
+// TotalsUpdate is pushed to subscribers after a change to a watched island.
+type TotalsUpdate struct {
+	Totals   []IslandMeasurement
+	Topology bool   // caused by a graph update, or replaced one that was
+	Version  uint64 // state version the totals are from
+}
+
+// TickEvent reaps the measurements whose TTL has passed. Loop sends it to
+// itself periodically when a TTL is set; see WithMeasurementTTL.
+type TickEvent struct{}
+
+// Ping asks the loop to reply as soon as it processes the event, proving it is
+// running and keeping up with its queue.
+type Ping struct {
+	Reply chan<- struct{}
+}
+
+// VersionQuery asks for the current state version, which every applied change
+// to the graph or the measurements advances.
+type VersionQuery struct {
+	Reply chan<- uint64
+}
+
+// IslandsQuery asks for the islands of the current graph, without changing
+// anything.
+type IslandsQuery struct {
+	Reply chan<- Partition
+}
+
+// IslandOfNodeQuery asks for the island containing Node and its current total.
+type IslandOfNodeQuery struct {
+	Node  string
+	Reply chan<- NodeIsland
+}
+
+// IslandPeaksQuery asks for the current total and peak of every island.
+type IslandPeaksQuery struct {
+	Reply chan<- []IslandPeak
+}
+
+// NamespaceQuery asks for every island total broken down by node name prefix,
+// Depth segments deep, using Separator (DefaultNamespaceSeparator when empty).
+type NamespaceQuery struct {
+	Depth     int
+	Separator string
+	Reply     chan<- []IslandNamespaces
+}
+
+// EdgesQuery asks for every edge of the current graph once, as sorted pairs of
+// node names.
+type EdgesQuery struct {
+	Reply chan<- [][]string
+}
+
+// TopologyQuery asks for the islands, edges and measurements of the current
+// graph at once, e.g. to render it.
+type TopologyQuery struct {
+	Reply chan<- Topology
+}
+
+// HotspotQuery asks for the graph node with the highest current measurement.
+// The reply is nil when no node of the graph has been measured.
+type HotspotQuery struct {
+	Reply chan<- *Hotspot
+}
+
+// IslandCoverageQuery asks for the measurement coverage of every island.
+type IslandCoverageQuery struct {
+	Reply chan<- []IslandCoverage
+}
+
+// DensityQuery asks for the edge density of the current graph and its islands.
+type DensityQuery struct {
+	Reply chan<- GraphDensity
+}
+
+// IslandMetricsQuery asks for the structural statistics of every island.
+type IslandMetricsQuery struct {
+	Reply chan<- []IslandMetrics
+}
@@ -0,0 +1,125 @@
+package business
+
+import "slices"
+
+// graphDeltaLimit is the most edges a re-posted graph may add or remove to be
+// applied incrementally. Each removal may search its island, so beyond it a
+// full recompute is cheaper.
+const graphDeltaLimit = 64
+
+// edgeDelta holds the edges, as pairs of node IDs listed once, that turn the
+// current graph into a re-posted one.
+type edgeDelta struct {
+	remove, add [][2]int
+}
+
+// graphDelta returns the edges to remove from the current graph and to add to
+// it to get g, or false when g differs in more than its edges: other nodes or
+// sinks, directed or weighted edges, or more than graphDeltaLimit edge changes.
+// Adjacency rows listing the same neighbors in the same order, as when a
+// client re-posts its edge list with a few changes, are compared as is.
+func (s *Grid) graphDelta(g topology) (edgeDelta, bool) {
+	cur := s.graph
+	if g.directed || cur.directed || g.weights != nil || cur.weights != nil || len(g.order) != len(cur.order) {
+		return edgeDelta{}, false
+	}
+
+	var d edgeDelta
+	counts := map[int]int{}
+	for _, id := range g.order {
+		if !cur.has(id) || cur.sign(id) != g.sign(id) {
+			return edgeDelta{}, false
+		}
+		old, row := cur.adj[id], g.adj[id]
+		if slices.Equal(old, row) {
+			continue
+		}
+
+		// Each undirected edge is listed by both endpoints: record it from the
+		// smaller one.
+		clear(counts)
+		for _, nei := range row {
+			counts[nei]++
+		}
+		for _, nei := range old {
+			if counts[nei] > 0 {
+				counts[nei]--
+			} else if id < nei {
+				d.remove = append(d.remove, [2]int{id, nei})
+			}
+		}
+		for _, nei := range row {
+			if counts[nei] > 0 {
+				counts[nei]--
+				if id < nei {
+					d.add = append(d.add, [2]int{id, nei})
+				}
+			}
+		}
+		if len(d.remove)+len(d.add) > graphDeltaLimit {
+			return edgeDelta{}, false
+		}
+	}
+	return d, true
+}
+
+// applyGraphDelta replaces the current graph with g, which differs from it by
+// the edges of d, maintaining the islands as editEdges does instead of
+// recomputing them. The islands are then put back in the order a full rebuild
+// gives them, so the result is the same either way.
+func (s *Grid) applyGraphDelta(g topology, d edgeDelta) {
+	// Earlier replies share the island list: edit a copy of it.
+	s.islands = slices.Clone(s.islands)
+	for _, e := range d.remove {
+		s.unlink(e[0], e[1])
+	}
+	for _, e := range d.add {
+		s.link(e[0], e[1])
+	}
+
+	// The edited adjacency now lists the edges of g; g also carries the node
+	// order, transforms and aliases of the new graph.
+	s.graph = g
+	s.growMeasurements()
+	s.reclaimNodes()
+	s.orderIslands()
+	s.islandsChanged()
+}
+
+// orderIslands reorders the islands by their first node in the graph order, in
+// which computeIslands discovers them, along with the state kept per island.
+func (s *Grid) orderIslands() {
+	rank := make([]int, len(s.islands))
+	for i := range rank {
+		rank[i] = -1
+	}
+	next, moved := 0, false
+	for _, id := range s.graph.order {
+		if i := s.nodeToIsland[id]; rank[i] < 0 {
+			rank[i] = next
+			moved = moved || i != next
+			next++
+		}
+	}
+	if !moved {
+		return
+	}
+
+	islands := make([][]string, len(s.islands))
+	peaks := make([]float64, len(s.peaks))
+	edgeWeights := make([]float64, len(s.edgeWeights))
+	var totals []IslandMeasurement
+	if s.totals != nil {
+		totals = make([]IslandMeasurement, len(s.totals))
+	}
+	for i, r := range rank {
+		islands[r], peaks[r], edgeWeights[r] = s.islands[i], s.peaks[i], s.edgeWeights[i]
+		if totals != nil {
+			totals[r] = s.totals[i]
+		}
+	}
+	for _, id := range s.graph.order {
+		s.nodeToIsland[id] = rank[s.nodeToIsland[id]]
+	}
+	s.islands, s.peaks, s.edgeWeights, s.totals = islands, peaks, edgeWeights, totals
+}
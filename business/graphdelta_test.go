@@ -0,0 +1,147 @@
+package business
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestGraphRepostAppliedIncrementally(t *testing.T) {
+	t.Parallel()
+
+	for seed := range uint64(20) {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			t.Parallel()
+
+			rng := rand.New(rand.NewPCG(seed, seed))
+			const nodeCount = 40
+			nodes := make([]string, nodeCount)
+			for i := range nodes {
+				nodes[i] = fmt.Sprintf("n%02d", i)
+			}
+			edges := map[[2]string]bool{}
+			for range nodeCount / 2 {
+				a, b := nodes[rng.IntN(nodeCount)], nodes[rng.IntN(nodeCount)]
+				edges[[2]string{min(a, b), max(a, b)}] = true
+			}
+			graph := func() Graph {
+				var list [][]string
+				for e := range edges {
+					list = append(list, []string{e[0], e[1]})
+				}
+				slices.SortFunc(list, func(x, y []string) int { return slices.Compare(x, y) })
+				return NewGraph(nodes, list)
+			}
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: graph()})
+			for step := range 100 {
+				// Flip a few edges, so islands merge and split.
+				for range 1 + rng.IntN(4) {
+					a, b := nodes[rng.IntN(nodeCount)], nodes[rng.IntN(nodeCount)]
+					e := [2]string{min(a, b), max(a, b)}
+					if edges[e] {
+						delete(edges, e)
+					} else {
+						edges[e] = true
+					}
+				}
+				g := graph()
+				if _, ok := grid.graphDelta(grid.nodes.internGraph(g)); !ok {
+					t.Fatalf("step %d: re-posted graph not applied incrementally", step)
+				}
+				grid.update(GraphUpdate{Graph: g})
+				grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: nodes[rng.IntN(nodeCount)], Value: float64(rng.IntN(10))}})
+
+				// The islands, in order, are those of a full rebuild.
+				want, wantNodeToIsland := computeIslands(grid.graph, &grid.nodes)
+				for _, island := range want {
+					slices.Sort(island)
+				}
+				if !reflect.DeepEqual(grid.islands, want) {
+					t.Fatalf("step %d: islands = %v, want %v", step, grid.islands, want)
+				}
+				for _, id := range grid.graph.order {
+					if grid.nodeToIsland[id] != wantNodeToIsland[id] {
+						t.Fatalf("step %d: node %s maps to island %d, want %d", step, grid.nodes.names[id], grid.nodeToIsland[id], wantNodeToIsland[id])
+					}
+				}
+				checkAgainstRebuild(t, grid, fmt.Sprintf("step %d", step))
+				checkTotalsCache(t, grid, fmt.Sprintf("step %d", step))
+			}
+		})
+	}
+}
+
+func TestGraphDeltaFallsBackToRecompute(t *testing.T) {
+	t.Parallel()
+
+	base := NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})
+	sinks := NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})
+	sinks.Roles = map[string]NodeRole{"C": RoleSink}
+	weighted := NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})
+	weighted.Weights = map[[2]string]float64{{"A", "B"}: 2}
+	var many [][]string
+	nodes := []string{"A", "B", "C"}
+	for i := range graphDeltaLimit + 1 {
+		n := fmt.Sprintf("x%d", i)
+		nodes = append(nodes, n)
+		many = append(many, []string{"A", n})
+	}
+
+	tests := []struct {
+		name  string
+		graph Graph
+		want  bool
+	}{
+		{name: "same graph", graph: base, want: true},
+		{name: "an edge added", graph: NewGraph([]string{"C", "B", "A"}, [][]string{{"A", "B"}, {"B", "C"}}), want: true},
+		{name: "another node", graph: NewGraph([]string{"A", "B", "D"}, [][]string{{"A", "B"}}), want: false},
+		{name: "other sinks", graph: sinks, want: false},
+		{name: "weighted edges", graph: weighted, want: false},
+		{name: "directed", graph: NewDirectedGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}}), want: false},
+		{name: "too many edge changes", graph: NewGraph(nodes, many), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: base})
+			if _, got := grid.graphDelta(grid.nodes.internGraph(tt.graph)); got != tt.want {
+				t.Fatalf("incremental = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkGraphRepost compares a full recompute of the islands of a 100k-node
+// graph re-posted with a few edges changed against the incremental path. Both
+// include interning the posted graph, as a POST /graph does.
+func BenchmarkGraphRepost(b *testing.B) {
+	nodes, edges := benchmarkGraph()
+	// Every other post removes a bridge of one island and joins two others.
+	edited := append(slices.Clone(edges[2:]), []string{nodes[0], nodes[1000]})
+	graphs := []Graph{NewGraph(nodes, edited), NewGraph(nodes, edges)}
+
+	b.Run("recompute", func(b *testing.B) {
+		grid := NewGrid()
+		grid.applyGraph(graphs[1])
+		i := 0
+		for b.Loop() {
+			grid.applyGraph(graphs[i%2])
+			i++
+		}
+	})
+	b.Run("incremental", func(b *testing.B) {
+		grid := NewGrid()
+		grid.applyGraph(graphs[1])
+		i := 0
+		for b.Loop() {
+			grid.updateTopology(grid.nodes.internGraph(graphs[i%2]))
+			i++
+		}
+	})
+}
@@ -1,6 +1,21 @@
 package business
 
-import "context"
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrEventPanicked is replied when processing an event panicked.
+var ErrEventPanicked = errors.New("grid: event processing failed")
 
 // Grid stores the current topology (graph/islands) and the latest measurement per node.
 //
@@ -10,25 +25,122 @@ import "context"
 // Measurements are retained across topology updates. Aggregation sums only nodes
 // present in the current graph (via nodeToIsland), so measurements for absent nodes
 // do not affect totals.
+//
+// Node names are interned once in nodes; the topology and per-node state (island
+// index and latest measurement) are stored in slices indexed by node ID rather than
+// in maps keyed by name, which keeps large grids compact.
 type Grid struct {
-	graph        Graph              // current grid graph
-	islands      [][]string         // list of islands (each island is a list of nodes)
-	nodeToIsland map[string]int     // node -> island index
-	measurements map[string]float64 // node -> latest measurement
+	graph        topology            // current grid graph
+	islands      [][]string          // list of islands (each island is a list of nodes)
+	nodes        nodeTable           // interned node names, see reclaimNodes for when IDs are reused
+	nodeToIsland []int               // node ID -> island index, -1 if not in the current graph
+	measurements []measurement       // node ID -> latest measurement
+	readings     []readingRing       // node ID -> retained measurements, when readingDepth > 1
+	readingDepth int                 // measurements retained per node
+	peaks        []float64           // island index -> highest total since the last reset
+	totals       []IslandMeasurement // island index -> aggregate entry, nil when stale
+	edgeWeights  []float64           // island index -> weight of its edges, kept with the islands
+	totalsExpiry time.Time           // when a counted measurement expires, zero if none will
+	decayed      bool                // totals changed by an expiry since the last commit
+	expiryTimer  *time.Timer         // fires at expiryAt, nil when not armed
+	expiryAt     time.Time           // the totalsExpiry expiryTimer was armed for
+	window       time.Duration       // age beyond which measurements stop counting, 0 keeps them
+	ttl          time.Duration       // lifetime of each measurement, 0 never expires
+
+	paused      bool              // measurements are held instead of applied
+	pauseBuffer int               // max measurements queued while paused, 0 rejects them
+	pending     []NodeMeasurement // measurements queued while paused
+
+	graphPolicy GraphUpdatePolicy   // whether graph updates wait for queued measurements
+	backlog     *MeasurementBacklog // measurement events queued for the loop, nil if untracked
+
+	transform Transform // applied to readings of nodes without their own transform
+
+	recomputeBudget time.Duration        // max time to compute islands in the loop, 0 is unbounded
+	compute         islandsFunc          // computes islands, replaceable in tests
+	graphVersion    int                  // incremented by every applied or deferred graph update
+	recomputed      chan recomputeResult // islands computed in the background
+	recomputeCancel context.CancelFunc   // cancels the pending background recompute
+	logger          *slog.Logger
+	wal             io.Writer        // write-ahead log of changes, nil when disabled
+	now             func() time.Time // clock stamping measurements
+
+	onPanic func(evt Event, v any, stack []byte) // called when an event panics
+	onEvent func(evt Event, d time.Duration)     // called with the processing time of each event
+
+	subscribers []*subscriber // receive totals after each change
+
+	coalesceWindow time.Duration     // how long set-mode measurements are held, 0 disables coalescing
+	coalesced      []coalescedUpdate // held measurements, one per node, in arrival order
+	coalesceIndex  map[string]int    // node -> index in coalesced
+	coalesceTimer  *time.Timer       // ends the current window, nil when nothing is held
+
+	islandCount atomic.Int64 // len(islands), readable outside the loop
+
+	partitionHash   uint64 // hash of islands, valid when partitionHashed
+	partitionHashed bool
+
+	version uint64  // state version, advanced by every mutation
+	history history // totals after the most recent versions
+
+	ready     chan struct{} // closed once the loop processes events
+	readyOnce sync.Once
+}
+
+// measurement is the latest value reported for a node.
+type measurement struct {
+	value   float64
+	ok      bool      // a value has been reported
+	source  string    // producer of the latest value, empty if unknown
+	at      time.Time // when the grid stored the value
+	taken   time.Time // when the producer took the value, zero if not reported
+	expires time.Time // when the value stops counting, zero if never
 }
 
 // NewGrid initializes an empty grid state.
-func NewGrid() *Grid {
-	return &Grid{
-		graph:        Graph{Nodes: []string{}, Edges: map[string][]string{}},
+func NewGrid(opts ...GridOption) *Grid {
+	s := &Grid{
+		graph:        topology{order: []int{}, adj: [][]int{}},
 		islands:      [][]string{},
-		nodeToIsland: map[string]int{},
-		measurements: map[string]float64{},
+		nodes:        newNodeTable(),
+		nodeToIsland: []int{},
+		measurements: []measurement{},
+		peaks:        []float64{},
+		compute:      computeIslandsCtx,
+		recomputed:   make(chan recomputeResult),
+		logger:       slog.New(slog.DiscardHandler),
+		ready:        make(chan struct{}),
+		transform:    IdentityTransform,
+		readingDepth: 1,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
 	}
+	s.record()
+	return s
 }
 
 // Loop processes graph and measurement events until the channel closes.
 func (s *Grid) Loop(ctx context.Context, evts <-chan Event) {
+	defer s.cancelRecompute()
+	// Subscribers get no more updates once the loop is gone.
+	defer s.closeSubscribers()
+	// Answer the senders of held measurements.
+	defer s.safeUpdate(coalesceFlush{})
+
+	// Expired measurements are reaped once per TTL.
+	var reap <-chan time.Time
+	if s.ttl > 0 {
+		ticker := time.NewTicker(s.ttl)
+		defer ticker.Stop()
+		reap = ticker.C
+	}
+
+	s.readyOnce.Do(func() { close(s.ready) })
+
 	// Process events serially to avoid concurrency issues.
 	for {
 		select {
@@ -38,8 +150,85 @@ func (s *Grid) Loop(ctx context.Context, evts <-chan Event) {
 			if !ok {
 				return
 			}
-			s.update(e)
+			s.backlog.taken(e)
+			s.safeUpdate(e)
+		case r := <-s.recomputed:
+			s.safeUpdate(r)
+		case <-s.coalesceC():
+			s.safeUpdate(coalesceFlush{})
+		case <-s.expiryC():
+			s.safeUpdate(expiryCheck{})
+		case <-reap:
+			s.safeUpdate(TickEvent{})
+		}
+	}
+}
+
+// Ready returns a channel closed once Loop has started processing events.
+// Until then, requests would only queue behind an idle loop.
+func (s *Grid) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// safeUpdate applies evt, recovering from a panic so that one bad event does
+// not stop the loop (handlers would keep enqueuing events nobody consumes).
+func (s *Grid) safeUpdate(evt Event) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		if s.onPanic != nil {
+			s.onPanic(evt, v, debug.Stack())
+		}
+		replyPanic(evt)
+	}()
+
+	s.update(evt)
+}
+
+// replyPanic tells the sender of evt that processing failed: with
+// ErrEventPanicked when its reply type can carry an error, otherwise by
+// closing the reply channel, so no sender is left waiting for a reply that
+// will never come. The send never blocks, since the reply may already have
+// been sent before the panic; a reply sent before the close is still received.
+func replyPanic(evt Event) {
+	switch e := evt.(type) {
+	case GraphUpdate:
+		if e.Reply != nil {
+			select {
+			case e.Reply <- GraphResult{Err: ErrEventPanicked}:
+			default:
+			}
+		}
+	case MeasurementUpdate:
+		if e.Reply != nil {
+			select {
+			case e.Reply <- MeasurementResult{Err: ErrEventPanicked}:
+			default:
+			}
 		}
+	case BatchMeasurementUpdate:
+		if e.Reply != nil {
+			select {
+			case e.Reply <- BatchMeasurementResult{Err: ErrEventPanicked}:
+			default:
+			}
+		}
+	default:
+		closeReply(evt)
+	}
+}
+
+// closeReply closes the Reply channel of evt, if it has a non-nil one. Every
+// reply channel is made for a single event, so no later event sends on it.
+func closeReply(evt Event) {
+	v := reflect.ValueOf(evt)
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	if reply := v.FieldByName("Reply"); reply.IsValid() && reply.Kind() == reflect.Chan && !reply.IsNil() {
+		reply.Close()
 	}
 }
 
@@ -49,91 +238,612 @@ func (s *Grid) update(evt Event) {
 	// If a measurement is updated, the totals per island are recomputed each
 	// time.
 	// Each event may have an optional reply channel to send back results.
+	if s.onEvent != nil {
+		start := time.Now()
+		defer func() { s.onEvent(evt, time.Since(start)) }()
+	}
+
+	// Aliases resolve against the topology current on arrival.
+	if e, ok := evt.(MeasurementUpdate); ok {
+		e.Node = s.resolveAlias(e.Node)
+		evt = e
+	}
+
+	// Measurements held for coalescing are applied before any other event, so
+	// every event observes them.
+	if e, ok := evt.(MeasurementUpdate); ok && s.coalesce(e) {
+		return
+	}
+	s.flushCoalesced()
+
 	switch e := evt.(type) {
 	case GraphUpdate:
-		s.graph = e.Graph
 		// Measurements for nodes not in the new graph are retained but ignored
 		// during aggregation. This allows the grid to be dynamic without losing
 		// data for nodes that may reappear later.
-		s.islands, s.nodeToIsland = computeIslands(s.graph)
+		if s.graphPolicy == RejectGraphWhilePending && s.measurementsPending() {
+			if e.Reply != nil {
+				e.Reply <- GraphResult{Err: ErrMeasurementsPending}
+			}
+			return
+		}
+
+		res := s.updateTopology(s.nodes.internGraph(e.Graph))
+		s.logGraph(e.Graph)
+		if !res.Degraded {
+			s.commit()
+		}
+		res.Version = s.version
+		if e.Reply != nil {
+			e.Reply <- res
+		}
+		if !res.Degraded {
+			s.publish(allIslands, true)
+		}
+	case EdgeEdit:
+		var res GraphResult
+		if s.graphPolicy == RejectGraphWhilePending && s.measurementsPending() {
+			res = GraphResult{Islands: s.islands, Err: ErrMeasurementsPending}
+		} else {
+			res = s.editEdges(e)
+		}
+		if res.Err == nil {
+			s.commit()
+			s.logEdgeEdit(e)
+		}
+		res.Version = s.version
+		if e.Reply != nil {
+			e.Reply <- res
+		}
+		if res.Err == nil {
+			s.publish(allIslands, true)
+		}
+	case NodeRemove:
+		var res GraphResult
+		var removed bool
+		// Logged by the name it has in the graph, as its aliases go with it.
+		node := s.resolveAlias(e.Node)
+		if s.graphPolicy == RejectGraphWhilePending && s.measurementsPending() {
+			res = GraphResult{Islands: s.islands, Err: ErrMeasurementsPending}
+		} else {
+			res, removed = s.removeNode(node)
+		}
+		if removed {
+			s.commit()
+			s.logNodeRemoval(node)
+		}
+		res.Version = s.version
+		if e.Reply != nil {
+			e.Reply <- res
+		}
+		if removed {
+			s.publish(allIslands, true)
+		}
+	case recomputeResult:
+		s.applyRecompute(e)
+	case coalesceFlush:
+		// Flushed above.
+	case expiryCheck:
+		s.checkExpiry()
+	case RecomputeIslands:
+		s.rebuildIslands()
+		s.commit()
 		if e.Reply != nil {
 			e.Reply <- s.islands
 		}
+		s.publish(allIslands, true)
 	case MeasurementUpdate:
-		// Update measurement only if the node exists in the current graph.
-		// This avoids storing measurements for nodes that are not part of the grid.
-		// Sending measurements for non-existent nodes is allowed.
-		if s.graph.HasNode(e.Node) {
-			s.measurements[e.Node] = e.Value
+		var res MeasurementResult
+		if s.paused {
+			// Held measurements are applied on resume; reply with the totals
+			// as they are now.
+			res.Err = s.hold(e.NodeMeasurement)
+			res.Queued = res.Err == nil
+		} else {
+			res.Applied, res.Changed = s.measure(e.NodeMeasurement)
 		}
+		if res.Applied {
+			s.commit()
+		}
+		res.Version = s.version
 
-		totals := aggregate(s)
+		if res.Err == nil && e.Reply != nil {
+			res.Totals = s.currentTotals()
+		}
+		if e.Reply != nil {
+			e.Reply <- res
+		}
+		if res.Applied {
+			s.publish(s.islandOfNode(e.Node), false)
+		}
+	case BatchMeasurementUpdate:
+		ms := make([]NodeMeasurement, len(e.Measurements))
+		for i, m := range e.Measurements {
+			m.Node = s.resolveAlias(m.Node)
+			ms[i] = m
+		}
+		res, touched := s.measureBatch(ms)
+		if res.Applied > 0 {
+			s.commit()
+		}
+		res.Version = s.version
+
+		if e.Reply != nil {
+			if res.Err == nil {
+				res.Totals = s.currentTotals()
+			}
+			e.Reply <- res
+		}
+		if len(touched) > 0 {
+			s.publishIslands(touched)
+		}
+	case CompareAndSet:
+		e.Node = s.resolveAlias(e.Node)
+		res := s.compareAndSet(e)
+		if e.Reply != nil {
+			e.Reply <- res
+		}
+		if res.Swapped {
+			s.publish(s.islandOfNode(e.Node), false)
+		}
+	case ClearMeasurements:
+		s.clearMeasurements()
+		s.commit()
+		s.logClear()
+		if e.Reply != nil {
+			e.Reply <- s.currentTotals()
+		}
+		s.publish(allIslands, false)
+	case ResetEvent:
+		s.reset()
+		s.commit()
+		s.logReset()
+		if e.Reply != nil {
+			e.Reply <- struct{}{}
+		}
+		s.publish(allIslands, true)
+	case SnapshotQuery:
+		data, err := s.Snapshot()
+		if e.Reply != nil {
+			e.Reply <- SnapshotResult{Data: data, Err: err}
+		}
+	case RestoreSnapshot:
+		res := GraphResult{Err: s.Restore(e.Data)}
+		if res.Err == nil {
+			s.logState()
+		}
+		res.Islands, res.Version = s.islands, s.version
+		if e.Reply != nil {
+			e.Reply <- res
+		}
+		if res.Err == nil {
+			s.publish(allIslands, true)
+		}
+	case NodesExistQuery:
+		exists := make(map[string]bool, len(e.Nodes))
+		for _, n := range e.Nodes {
+			exists[n] = s.hasNode(n)
+		}
+		if e.Reply != nil {
+			e.Reply <- exists
+		}
+	case NodeDetailQuery:
+		detail := s.nodeDetail(e.Node)
+		if e.Reply != nil {
+			e.Reply <- detail
+		}
+	case NodeHistoryQuery:
+		history := s.nodeHistory(e.Node)
+		if e.Reply != nil {
+			e.Reply <- history
+		}
+	case Subscribe:
+		totals := s.subscribe(e)
+		if e.Reply != nil {
+			e.Reply <- VersionedTotals{Version: s.version, Totals: totals}
+		}
+	case VersionQuery:
+		if e.Reply != nil {
+			e.Reply <- s.version
+		}
+	case TickEvent:
+		if s.reapExpired() > 0 {
+			s.commit()
+			s.publish(allIslands, false)
+		}
+	case Ping:
+		if e.Reply != nil {
+			e.Reply <- struct{}{}
+		}
+	case IslandsQuery:
+		// Islands are replaced, never modified in place, so the reply can
+		// share them.
+		if e.Reply != nil {
+			e.Reply <- s.partitionView()
+		}
+	case IslandOfNodeQuery:
+		res := NodeIsland{Index: s.islandOfNode(s.resolveAlias(e.Node))}
+		if res.Index >= 0 {
+			res.IslandMeasurement = s.islandTotals()[res.Index]
+		}
+		if e.Reply != nil {
+			e.Reply <- res
+		}
+	case IslandPeaksQuery:
+		peaks := islandPeaks(s)
+		if e.Reply != nil {
+			e.Reply <- peaks
+		}
+	case NamespaceQuery:
+		namespaces := islandNamespaces(s, e.Depth, e.Separator)
+		if e.Reply != nil {
+			e.Reply <- namespaces
+		}
+	case CloseSubscribers:
+		n := s.closeSubscribers()
+		if e.Reply != nil {
+			e.Reply <- n
+		}
+	case TotalsAtQuery:
+		version := e.Version
+		if e.Latest {
+			version = s.version
+		}
+		totals := s.totalsAt(version)
 		if e.Reply != nil {
 			e.Reply <- totals
 		}
+	case EdgesQuery:
+		edges := edgeList(s)
+		if e.Reply != nil {
+			e.Reply <- edges
+		}
+	case TopologyQuery:
+		view := s.topologyView()
+		if e.Reply != nil {
+			e.Reply <- view
+		}
+	case HotspotQuery:
+		hs := hotspot(s)
+		if e.Reply != nil {
+			e.Reply <- hs
+		}
+	case IslandCoverageQuery:
+		coverage := islandCoverage(s)
+		if e.Reply != nil {
+			e.Reply <- coverage
+		}
+	case DensityQuery:
+		density := graphDensity(s)
+		if e.Reply != nil {
+			e.Reply <- density
+		}
+	case IslandMetricsQuery:
+		metrics := islandMetrics(s)
+		if e.Reply != nil {
+			e.Reply <- metrics
+		}
+	case PauseUpdate:
+		status := s.setPaused(e.Paused)
+		if status.Drained > 0 {
+			s.commit()
+		}
+		if e.Reply != nil {
+			e.Reply <- status
+		}
+		if status.Drained > 0 {
+			s.publish(allIslands, false)
+		}
+	case EdgeCutQuery:
+		var cut EdgeCut
+		from, okFrom := s.nodes.id(e.From)
+		to, okTo := s.nodes.id(e.To)
+		if okFrom && okTo {
+			cut = simulateCut(s.graph, &s.nodes, s.nodeToIsland, s.islands, from, to)
+		}
+		if e.Reply != nil {
+			e.Reply <- cut
+		}
+	}
+}
+
+// clearMeasurements drops every stored measurement but keeps the topology.
+// Measurements queued while paused are kept and applied on resume. Clearing
+// starts a new window, so peaks are reset as well.
+func (s *Grid) clearMeasurements() {
+	clear(s.measurements)
+	clear(s.readings)
+	clear(s.peaks)
+	s.totals = nil
+}
+
+// applyTopology replaces the current graph and its islands.
+func (s *Grid) applyTopology(g topology, islands [][]string, nodeToIsland []int) {
+	oldIslands, oldNodeToIsland, oldPeaks := s.islands, s.nodeToIsland, s.peaks
+
+	// Members are sorted so the islands do not depend on the order nodes and
+	// edges were listed or explored in.
+	for _, island := range islands {
+		slices.Sort(island)
+	}
+	s.graph = g
+	s.islands, s.nodeToIsland = islands, nodeToIsland
+	s.edgeWeights = islandEdgeWeights(g, islands, nodeToIsland, &s.nodes)
+	s.totals = nil
+	s.growMeasurements()
+	s.reclaimNodes()
+	s.remapPeaks(oldIslands, oldNodeToIsland, oldPeaks)
+	s.islandsChanged()
+}
+
+// reclaimNodes releases the IDs of nodes that are neither in the graph nor
+// measured, so a grid whose node names churn does not grow its per-node state
+// forever. A measured node keeps its ID, and its value, until the measurements
+// are cleared. Nothing is released while a newer graph is computed in the
+// background, as its nodes may be among them.
+func (s *Grid) reclaimNodes() {
+	if s.recomputeCancel != nil {
+		return
+	}
+	for id := range s.nodes.len() {
+		if s.graph.has(id) || s.measurements[id].ok || !s.nodes.live(id) {
+			continue
+		}
+		s.nodes.release(id)
+		s.measurements[id] = measurement{}
+		if id < len(s.readings) {
+			s.readings[id] = readingRing{}
+		}
+	}
+}
+
+// IslandCount returns the number of islands in the current graph. Unlike the
+// rest of Grid it is safe to call from any goroutine.
+func (s *Grid) IslandCount() int {
+	return int(s.islandCount.Load())
+}
+
+// applyMeasurement stores m if its node exists in the current graph and its
+// value is finite, and reports whether it did.
+func (s *Grid) applyMeasurement(m NodeMeasurement) bool {
+	// Update measurement only if the node exists in the current graph.
+	// This avoids storing measurements for nodes that are not part of the grid.
+	// Sending measurements for non-existent nodes is allowed.
+	if !s.hasNode(m.Node) {
+		return false
+	}
+	// NaN and ±Inf cannot be stored: they would poison the totals and stats,
+	// and cannot be encoded in JSON responses or the write-ahead log.
+	if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+		s.logger.Warn("dropping non-finite measurement", "node", m.Node, "value", m.Value)
+		return false
+	}
+	id, _ := s.nodes.id(m.Node)
+
+	value, clamped := s.transformFor(id).apply(m.Value, m.Mode)
+	if clamped {
+		s.logger.Warn("transformed measurement overflowed, clamping", "node", m.Node, "value", m.Value)
+	}
+	if m.Mode == MeasurementAdd && id < len(s.measurements) && !s.measurements[id].expired(s.now()) {
+		value, _ = addClamped(value, s.measurements[id].value)
+	}
+	s.setMeasurementTaken(id, value, m.Taken)
+	s.measurements[id].source = m.Source
+	s.logMeasurement(id)
+	s.updatePeak(s.nodeToIsland[id])
+	return true
+}
+
+// measure applies m and reports whether it was stored and whether it changed
+// the total of the node's island.
+func (s *Grid) measure(m NodeMeasurement) (applied, changed bool) {
+	applied, _, before, after := s.measureIsland(m)
+	return applied, applied && after != before
+}
+
+// measureIsland applies m and returns, when it was stored, the island of its
+// node and that island's total before and after. Only the island's own entry
+// is read: the rest of the cached totals are left alone.
+func (s *Grid) measureIsland(m NodeMeasurement) (applied bool, island int, before, after float64) {
+	island = s.islandOfNode(m.Node)
+	if island >= 0 {
+		before = s.islandTotal(island)
+	}
+	if !s.applyMeasurement(m) {
+		return false, island, 0, 0
+	}
+	after = s.islandTotal(island)
+	if math.Abs(after) == math.MaxFloat64 && math.Abs(before) != math.MaxFloat64 {
+		s.logger.Warn("island total overflowed, clamping", "node", m.Node, "total", after)
+	}
+	return true, island, before, after
+}
+
+// nodeDetail returns the stored state of node.
+func (s *Grid) nodeDetail(node string) NodeDetail {
+	detail := NodeDetail{Node: node, Island: -1}
+	id, ok := s.nodes.id(node)
+	if !ok {
+		return detail
+	}
+	if s.graph.has(id) {
+		detail.InGraph = true
+		detail.Island = s.nodeToIsland[id]
+	}
+	if id < len(s.measurements) && s.measurements[id].ok {
+		m := s.measurements[id]
+		detail.Measured = true
+		detail.Value = m.value
+		detail.Source = m.source
+	}
+	return detail
+}
+
+// hasNode reports whether node is part of the current graph.
+func (s *Grid) hasNode(node string) bool {
+	id, ok := s.nodes.id(node)
+	return ok && s.graph.has(id)
+}
+
+// setMeasurement stores value as the latest measurement of the node with the given ID.
+func (s *Grid) setMeasurement(id int, value float64) {
+	s.setMeasurementTaken(id, value, time.Time{})
+}
+
+// setMeasurementTaken is setMeasurement for a value the producer reports it
+// took at taken. The value is still timed on receipt: the TTL and the
+// aggregation window run from now, whatever the producer's clock says.
+func (s *Grid) setMeasurementTaken(id int, value float64, taken time.Time) {
+	s.growMeasurements()
+	m := measurement{value: value, ok: true, at: s.now(), taken: taken}
+	if s.ttl > 0 {
+		m.expires = m.at.Add(s.ttl)
+	}
+	old := s.measurements[id]
+	s.measurements[id] = m
+	s.recordReading(id, Reading{Value: value, At: m.at, Taken: taken})
+	s.noteExpiry(m)
+	if id < len(s.nodeToIsland) && s.nodeToIsland[id] >= 0 {
+		s.adjustIsland(s.nodeToIsland[id], id, old, m)
+	}
+}
+
+// growMeasurements extends measurements so every interned node ID has a slot.
+func (s *Grid) growMeasurements() {
+	if n := s.nodes.len(); n > len(s.measurements) {
+		s.measurements = append(s.measurements, make([]measurement, n-len(s.measurements))...)
 	}
 }
 
 // computeIslands walks the graph and returns the connected components along with
-// a reverse index from node name to island position. Islands are discovered via
-// an iterative DFS to avoid recursion limits.
-func computeIslands(g Graph) ([][]string, map[string]int) {
-	visited := map[string]bool{}
+// a reverse index from node ID (as interned in nodes) to island position; IDs of
+// nodes outside the graph map to -1. Islands are discovered via an iterative DFS
+// to avoid recursion limits.
+func computeIslands(g topology, nodes *nodeTable) ([][]string, []int) {
+	islands, nodeToIsland, _ := computeIslandsCtx(context.Background(), g, nodes)
+	return islands, nodeToIsland
+}
+
+// computeIslandsCtx is computeIslands, giving up with ctx.Err() once ctx is done.
+func computeIslandsCtx(ctx context.Context, g topology, nodes *nodeTable) ([][]string, []int, error) {
+	nodeToIsland := make([]int, nodes.len())
+	for i := range nodeToIsland {
+		nodeToIsland[i] = -1
+	}
+
+	visited := make([]bool, nodes.len())
+	visits := 0
 	var islands [][]string
-	nodeToIsland := map[string]int{}
 
-	for _, n := range g.Nodes {
+	for _, n := range g.order {
 		if visited[n] {
 			continue
 		}
-		stack := []string{n}
+
+		stack := []int{n}
 		var island []string
 
 		for len(stack) > 0 {
 			v := stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
+
 			if visited[v] {
 				continue
 			}
 			visited[v] = true
-			island = append(island, v)
+			// Checking the context on every node would dominate small graphs.
+			if visits++; visits%cancelCheckInterval == 0 && ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			island = append(island, nodes.names[v])
+			// Map each node in the new island to its island index for O(1) lookups.
+			nodeToIsland[v] = len(islands)
+
 			// Push unvisited neighbors so they are explored in this component.
-			for _, nei := range g.Edges[v] {
+			for _, nei := range g.adj[v] {
 				if !visited[nei] {
 					stack = append(stack, nei)
 				}
 			}
 		}
 
-		idx := len(islands)
-		// Map each node in the new island to its island index for O(1) lookups.
-		for _, node := range island {
-			nodeToIsland[node] = idx
-		}
 		islands = append(islands, island)
 	}
-	return islands, nodeToIsland
+
+	return islands, nodeToIsland, nil
 }
 
 // aggregate sums the latest measurement for each node into its island and
-// returns one IslandMeasurement entry per island in the current graph.
+// returns one IslandMeasurement entry per island in the current graph, computed
+// from scratch. Sink nodes are subtracted, so a total is sum(sources) -
+// sum(sinks). The node and measured-node counts, and the minimum, maximum and
+// mean of the stored values, and the weight of the island edges, are gathered
+// along the way. Only nodes of the current graph count, so a retained
+// measurement of a removed node does not.
 func aggregate(s *Grid) []IslandMeasurement {
-	totals := make([]float64, len(s.islands))
+	res := make([]IslandMeasurement, len(s.islands))
+	for i := range s.islands {
+		res[i] = islandEntry(s, i)
+	}
+	return res
+}
 
-	for node, val := range s.measurements {
-		// Ignore stale measurements from nodes not present in the current graph.
-		if idx, ok := s.nodeToIsland[node]; ok {
-			totals[idx] += val
-		}
+// islandEdgeWeights sums the weights of the edges inside each island. It walks
+// the whole adjacency, so it runs only when the topology is replaced; edge
+// edits adjust the sums they change.
+func islandEdgeWeights(g topology, islands [][]string, nodeToIsland []int, nodes *nodeTable) []float64 {
+	weights := make([]float64, len(islands))
+	for i, island := range islands {
+		weights[i] = membersEdgeWeight(g, island, nodeToIsland, nodes)
 	}
+	return weights
+}
 
-	res := make([]IslandMeasurement, len(s.islands))
-	for i, island := range s.islands {
-		res[i] = IslandMeasurement{
-			Island: island,
-			Total:  totals[i],
+// membersEdgeWeight sums the weights of the edges between members of island,
+// which are all mapped to the same index by nodeToIsland.
+func membersEdgeWeight(g topology, island []string, nodeToIsland []int, nodes *nodeTable) float64 {
+	var weight float64
+	for _, n := range island {
+		id, _ := nodes.id(n)
+		for k, nei := range g.neighbors(id) {
+			// Edges of a directed graph may lead to another island.
+			if nodeToIsland[nei] == nodeToIsland[id] {
+				weight += g.weight(id, k)
+			}
 		}
 	}
+	if !g.directed {
+		// The adjacency holds an undirected edge once per endpoint.
+		weight /= 2
+	}
+	return weight
+}
 
-	return res
+// islandEntry aggregates the measurements of the members of island i, in
+// member order, so a refreshed entry matches a full aggregate exactly. The
+// edge weight is the one kept with the islands.
+func islandEntry(s *Grid, i int) IslandMeasurement {
+	r := IslandMeasurement{Island: s.islands[i], NodeCount: len(s.islands[i]), EdgeWeight: s.edgeWeights[i]}
+	now := s.now()
+	start := s.windowStart(now)
+	for _, n := range s.islands[i] {
+		id, _ := s.nodes.id(n)
+		if id >= len(s.measurements) || !s.measurements[id].counts(now, start) {
+			continue
+		}
+		m := s.measurements[id]
+		total, clamped := addClamped(r.Total, s.graph.sign(id)*m.value)
+		r.Total, r.Overflow = total, r.Overflow || clamped || m.clamped()
+		if r.MeasuredCount == 0 {
+			r.Min, r.Max = m.value, m.value
+		} else {
+			r.Min, r.Max = min(r.Min, m.value), max(r.Max, m.value)
+		}
+		r.MeasuredCount++
+		if m.at.After(r.LastUpdated) {
+			r.LastUpdated = m.at
+		}
+		r.Average = addToMean(r.Average, m.value, r.MeasuredCount)
+	}
+	return r
 }
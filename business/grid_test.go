@@ -1,8 +1,14 @@
 package business
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
 	"reflect"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestComputeIslands(t *testing.T) {
@@ -67,10 +73,17 @@ func TestComputeIslands(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotIslands, gotNodeToIsland := computeIslands(tt.graph)
+			nodes := newNodeTable()
+			gotIslands, nodeToIsland := computeIslands(nodes.internGraph(tt.graph), &nodes)
 			if !islandsEqual(gotIslands, tt.wantIslands) {
 				t.Fatalf("computeIslands() islands = %v, want %v", gotIslands, tt.wantIslands)
 			}
+			gotNodeToIsland := map[string]int{}
+			for id, idx := range nodeToIsland {
+				if idx >= 0 {
+					gotNodeToIsland[nodes.names[id]] = idx
+				}
+			}
 			if !reflect.DeepEqual(gotNodeToIsland, tt.wantNodeToIsland) {
 				t.Fatalf("computeIslands() nodeToIsland = %v, want %v", gotNodeToIsland, tt.wantNodeToIsland)
 			}
@@ -81,64 +94,48 @@ func TestComputeIslands(t *testing.T) {
 func TestAggregate(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
-		name string
-		grid Grid
-		want []IslandMeasurement
+		name         string
+		islands      [][]string
+		measurements map[string]float64
+		want         []IslandMeasurement
 	}{
 		{
-			name: "sums measurements per island",
-			grid: Grid{
-				islands: [][]string{{"a", "b"}, {"c"}},
-				nodeToIsland: map[string]int{
-					"a": 0,
-					"b": 0,
-					"c": 1,
-				},
-				measurements: map[string]float64{
-					"a": 1.5,
-					"b": 2.5,
-					"c": 10,
-				},
+			name:    "sums measurements per island",
+			islands: [][]string{{"a", "b"}, {"c"}},
+			measurements: map[string]float64{
+				"a": 1.5,
+				"b": 2.5,
+				"c": 10,
 			},
 			want: []IslandMeasurement{
-				{Island: []string{"a", "b"}, Total: 4},
-				{Island: []string{"c"}, Total: 10},
+				{Island: []string{"a", "b"}, Total: 4, NodeCount: 2, MeasuredCount: 2, Min: 1.5, Max: 2.5, Average: 2, LastUpdated: testTime},
+				{Island: []string{"c"}, Total: 10, NodeCount: 1, MeasuredCount: 1, Min: 10, Max: 10, Average: 10, LastUpdated: testTime},
 			},
 		},
 		{
-			name: "ignores unknown nodes",
-			grid: Grid{
-				islands: [][]string{{"a"}},
-				nodeToIsland: map[string]int{
-					"a": 0,
-				},
-				measurements: map[string]float64{
-					"a":     5,
-					"ghost": 9,
-				},
+			name:    "ignores unknown nodes",
+			islands: [][]string{{"a"}},
+			measurements: map[string]float64{
+				"a":     5,
+				"ghost": 9,
 			},
 			want: []IslandMeasurement{
-				{Island: []string{"a"}, Total: 5},
+				{Island: []string{"a"}, Total: 5, NodeCount: 1, MeasuredCount: 1, Min: 5, Max: 5, Average: 5, LastUpdated: testTime},
 			},
 		},
 		{
-			name: "no measurements yet",
-			grid: Grid{
-				islands: [][]string{{"solo"}},
-				nodeToIsland: map[string]int{
-					"solo": 0,
-				},
-				measurements: map[string]float64{},
-			},
+			name:         "no measurements yet",
+			islands:      [][]string{{"solo"}},
+			measurements: map[string]float64{},
 			want: []IslandMeasurement{
-				{Island: []string{"solo"}, Total: 0},
+				{Island: []string{"solo"}, Total: 0, NodeCount: 1},
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := aggregate(&tt.grid)
+			got := aggregate(newGridWithState(tt.islands, tt.measurements))
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Fatalf("aggregate() = %v, want %v", got, tt.want)
 			}
@@ -173,19 +170,19 @@ func TestGridUpdateHandlesEvents(t *testing.T) {
 				{
 					measurement: NodeMeasurement{Node: "a", Value: 1},
 					wantTotals: []IslandMeasurement{
-						{Island: []string{"a", "b"}, Total: 1},
+						{Island: []string{"a", "b"}, Total: 1, NodeCount: 2, MeasuredCount: 1, Min: 1, Max: 1, Average: 1, EdgeWeight: 1, LastUpdated: testTime},
 					},
 				},
 				{
 					measurement: NodeMeasurement{Node: "a", Value: 2},
 					wantTotals: []IslandMeasurement{
-						{Island: []string{"a", "b"}, Total: 2},
+						{Island: []string{"a", "b"}, Total: 2, NodeCount: 2, MeasuredCount: 1, Min: 2, Max: 2, Average: 2, EdgeWeight: 1, LastUpdated: testTime},
 					},
 				},
 				{
 					measurement: NodeMeasurement{Node: "b", Value: 3},
 					wantTotals: []IslandMeasurement{
-						{Island: []string{"a", "b"}, Total: 5},
+						{Island: []string{"a", "b"}, Total: 5, NodeCount: 2, MeasuredCount: 2, Min: 2, Max: 3, Average: 2.5, EdgeWeight: 1, LastUpdated: testTime},
 					},
 				},
 			},
@@ -205,22 +202,22 @@ func TestGridUpdateHandlesEvents(t *testing.T) {
 				{
 					measurement: NodeMeasurement{Node: "a", Value: 2.5},
 					wantTotals: []IslandMeasurement{
-						{Island: []string{"a", "b"}, Total: 2.5},
-						{Island: []string{"c"}, Total: 0},
+						{Island: []string{"a", "b"}, Total: 2.5, NodeCount: 2, MeasuredCount: 1, Min: 2.5, Max: 2.5, Average: 2.5, EdgeWeight: 1, LastUpdated: testTime},
+						{Island: []string{"c"}, Total: 0, NodeCount: 1},
 					},
 				},
 				{
 					measurement: NodeMeasurement{Node: "ghost", Value: 10},
 					wantTotals: []IslandMeasurement{
-						{Island: []string{"a", "b"}, Total: 2.5},
-						{Island: []string{"c"}, Total: 0},
+						{Island: []string{"a", "b"}, Total: 2.5, NodeCount: 2, MeasuredCount: 1, Min: 2.5, Max: 2.5, Average: 2.5, EdgeWeight: 1, LastUpdated: testTime},
+						{Island: []string{"c"}, Total: 0, NodeCount: 1},
 					},
 				},
 				{
 					measurement: NodeMeasurement{Node: "c", Value: 1.5},
 					wantTotals: []IslandMeasurement{
-						{Island: []string{"a", "b"}, Total: 2.5},
-						{Island: []string{"c"}, Total: 1.5},
+						{Island: []string{"a", "b"}, Total: 2.5, NodeCount: 2, MeasuredCount: 1, Min: 2.5, Max: 2.5, Average: 2.5, EdgeWeight: 1, LastUpdated: testTime},
+						{Island: []string{"c"}, Total: 1.5, NodeCount: 1, MeasuredCount: 1, Min: 1.5, Max: 1.5, Average: 1.5, LastUpdated: testTime},
 					},
 				},
 			},
@@ -229,18 +226,18 @@ func TestGridUpdateHandlesEvents(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			grid := NewGrid()
-			graphReply := make(chan [][]string, 1)
+			grid := NewGrid(WithClock(testClock))
+			graphReply := make(chan GraphResult, 1)
 			grid.update(GraphUpdate{Graph: tt.graph, Reply: graphReply})
-			gotIslands := <-graphReply
+			gotIslands := (<-graphReply).Islands
 			if !islandsEqual(gotIslands, tt.wantIslands) {
 				t.Fatalf("graph update islands = %v, want %v", gotIslands, tt.wantIslands)
 			}
 
 			for i, step := range tt.measurementSteps {
-				reply := make(chan []IslandMeasurement, 1)
+				reply := make(chan MeasurementResult, 1)
 				grid.update(MeasurementUpdate{NodeMeasurement: step.measurement, Reply: reply})
-				gotTotals := <-reply
+				gotTotals := (<-reply).Totals
 				if !reflect.DeepEqual(gotTotals, step.wantTotals) {
 					t.Fatalf("measurement step %d totals = %v, want %v", i, gotTotals, step.wantTotals)
 				}
@@ -249,6 +246,33 @@ func TestGridUpdateHandlesEvents(t *testing.T) {
 	}
 }
 
+// newGridWithState builds a grid whose current graph is made of islands and
+// whose stored measurements are measurements, including nodes outside the graph.
+func newGridWithState(islands [][]string, measurements map[string]float64) *Grid {
+	grid := NewGrid(WithClock(testClock))
+	grid.islands = islands
+	grid.edgeWeights = make([]float64, len(islands))
+	for idx, island := range islands {
+		for _, node := range island {
+			id, _ := grid.nodes.intern(node)
+			for id >= len(grid.nodeToIsland) {
+				grid.nodeToIsland = append(grid.nodeToIsland, -1)
+			}
+			grid.nodeToIsland[id] = idx
+		}
+	}
+	for node, value := range measurements {
+		id, _ := grid.nodes.intern(node)
+		grid.setMeasurement(id, value)
+	}
+	return grid
+}
+
+// testTime is the time grids using testClock stamp on measurements.
+var testTime = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func testClock() time.Time { return testTime }
+
 func islandsEqual(a, b [][]string) bool {
 	if len(a) != len(b) {
 		return false
@@ -260,3 +284,721 @@ func islandsEqual(a, b [][]string) bool {
 	}
 	return true
 }
+
+func TestNilGraphInputsDoNotPanic(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		graph Graph
+	}{
+		{name: "nil nodes", graph: NewGraph(nil, [][]string{{"A", "B"}})},
+		{name: "nil edges", graph: NewGraph([]string{"A", "B"}, nil)},
+		{name: "both nil", graph: NewGraph(nil, nil)},
+		{name: "zero graph", graph: Graph{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := newNodeTable()
+			islands, _ := computeIslands(nodes.internGraph(tt.graph), &nodes)
+			if len(islands) != len(tt.graph.Nodes) {
+				t.Fatalf("computeIslands() islands = %v, want %d singletons", islands, len(tt.graph.Nodes))
+			}
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: tt.graph})
+			reply := make(chan MeasurementResult, 1)
+			grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}, Reply: reply})
+			if got := (<-reply).Totals; len(got) != len(tt.graph.Nodes) {
+				t.Fatalf("totals = %v, want %d entries", got, len(tt.graph.Nodes))
+			}
+		})
+	}
+
+	// A zero Grid (nil slices and maps) must aggregate to an empty result.
+	if got := aggregate(&Grid{}); len(got) != 0 {
+		t.Fatalf("aggregate(zero grid) = %v, want empty", got)
+	}
+}
+
+func TestAggregateNetsSinks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		roles        map[string]NodeRole
+		measurements map[string]float64
+		want         []float64
+	}{
+		{
+			name:         "all sources by default",
+			measurements: map[string]float64{"a": 5, "b": 3, "c": 2},
+			want:         []float64{8, 2},
+		},
+		{
+			name:         "sink subtracted from its island",
+			roles:        map[string]NodeRole{"b": RoleSink},
+			measurements: map[string]float64{"a": 5, "b": 3, "c": 2},
+			want:         []float64{2, 2},
+		},
+		{
+			name:         "island of sinks nets negative",
+			roles:        map[string]NodeRole{"a": RoleSink, "b": RoleSink, "c": RoleSource},
+			measurements: map[string]float64{"a": 5, "b": 3, "c": 2},
+			want:         []float64{-8, 2},
+		},
+		{
+			name:         "roles for unknown nodes are ignored",
+			roles:        map[string]NodeRole{"ghost": RoleSink},
+			measurements: map[string]float64{"a": 1},
+			want:         []float64{1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph := NewGraph([]string{"a", "b", "c"}, [][]string{{"a", "b"}})
+			graph.Roles = tt.roles
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: graph})
+			for node, value := range tt.measurements {
+				grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: node, Value: value}})
+			}
+
+			got := aggregate(grid)
+			for i, want := range tt.want {
+				if got[i].Total != want {
+					t.Fatalf("aggregate() = %v, want totals %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoopRecoversFromPanickingEvent(t *testing.T) {
+	t.Parallel()
+
+	var panics []string
+	grid := NewGrid(WithPanicHandler(func(evt Event, v any, stack []byte) {
+		panics = append(panics, fmt.Sprintf("%T", evt))
+	}))
+
+	// Corrupt the state so the next measurement panics while aggregating.
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+	grid.islands, grid.totals = nil, nil
+
+	events := make(chan Event, 8)
+	done := make(chan struct{})
+	go func() {
+		grid.Loop(context.Background(), events)
+		close(done)
+	}()
+
+	reply := make(chan MeasurementResult, 1)
+	events <- MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}, Reply: reply}
+	if got := <-reply; !errors.Is(got.Err, ErrEventPanicked) {
+		t.Fatalf("reply err = %v, want %v", got.Err, ErrEventPanicked)
+	}
+
+	// The loop is still alive and processes subsequent events.
+	graphReply := make(chan GraphResult, 1)
+	events <- GraphUpdate{Graph: NewGraph([]string{"A"}, nil), Reply: graphReply}
+	<-graphReply
+	events <- MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}, Reply: reply}
+	if got := <-reply; got.Err != nil || got.Totals[0].Total != 2 {
+		t.Fatalf("reply after recovery = %+v, want total 2", got)
+	}
+
+	close(events)
+	<-done
+
+	if len(panics) != 1 || panics[0] != "business.MeasurementUpdate" {
+		t.Fatalf("panic handler calls = %v, want one for MeasurementUpdate", panics)
+	}
+}
+
+func TestPanickingFlushAnswersCoalescedSenders(t *testing.T) {
+	t.Parallel()
+
+	var panics []string
+	grid := NewGrid(
+		WithMeasurementCoalescing(time.Hour),
+		WithPanicHandler(func(evt Event, v any, stack []byte) {
+			panics = append(panics, fmt.Sprintf("%T", evt))
+		}),
+	)
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+
+	// Hold three measurements, one of them replaced, then corrupt the state so
+	// applying them panics.
+	replies := make([]chan MeasurementResult, 3)
+	for i, node := range []string{"A", "B", "A"} {
+		replies[i] = make(chan MeasurementResult, 1)
+		grid.safeUpdate(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: node, Value: float64(i)}, Reply: replies[i]})
+	}
+	grid.islands, grid.totals = nil, nil
+
+	// The next event flushes the held measurements.
+	version := make(chan uint64, 1)
+	grid.safeUpdate(VersionQuery{Reply: version})
+	for i, reply := range replies {
+		select {
+		case got := <-reply:
+			if !errors.Is(got.Err, ErrEventPanicked) {
+				t.Fatalf("reply %d err = %v, want %v", i, got.Err, ErrEventPanicked)
+			}
+		default:
+			t.Fatalf("held sender %d was not answered", i)
+		}
+	}
+	if _, ok := <-version; ok {
+		t.Fatal("reply of the flushing event left open after the panic")
+	}
+	if len(panics) != 1 || panics[0] != "business.VersionQuery" {
+		t.Fatalf("panic handler calls = %v, want one for VersionQuery", panics)
+	}
+	if len(grid.coalesced) != 0 {
+		t.Fatalf("coalesced = %v, want nothing left held", grid.coalesced)
+	}
+}
+
+func TestPanickingQueryClosesReply(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+	// Corrupt the state so aggregating the totals panics.
+	grid.totals, grid.edgeWeights = nil, nil
+
+	// A reply that cannot carry ErrEventPanicked is closed instead.
+	reply := make(chan []IslandPeak, 1)
+	grid.safeUpdate(IslandPeaksQuery{Reply: reply})
+	if peaks, ok := <-reply; ok {
+		t.Fatalf("reply = %v, want it closed", peaks)
+	}
+
+	// A reply sent before the panic is still received.
+	grid = NewGrid(WithEventTimer(func(Event, time.Duration) { panic("timer") }))
+	version := make(chan uint64, 1)
+	grid.safeUpdate(VersionQuery{Reply: version})
+	if _, ok := <-version; !ok {
+		t.Fatal("reply sent before the panic was lost")
+	}
+	if _, ok := <-version; ok {
+		t.Fatal("reply channel left open after the panic")
+	}
+}
+
+func TestIslandCount(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	if got := grid.IslandCount(); got != 0 {
+		t.Fatalf("IslandCount() = %d, want 0", got)
+	}
+
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"a", "b", "c"}, [][]string{{"a", "b"}})})
+	if got := grid.IslandCount(); got != 2 {
+		t.Fatalf("IslandCount() = %d, want 2", got)
+	}
+}
+
+func TestNodeDetailTracksSource(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+
+	detail := func(node string) NodeDetail {
+		reply := make(chan NodeDetail, 1)
+		grid.update(NodeDetailQuery{Node: node, Reply: reply})
+		return <-reply
+	}
+
+	if got, want := detail("A"), (NodeDetail{Node: "A", InGraph: true, Island: 0}); got != want {
+		t.Fatalf("unmeasured detail = %+v, want %+v", got, want)
+	}
+
+	steps := []struct {
+		m    NodeMeasurement
+		want NodeDetail
+	}{
+		{
+			m:    NodeMeasurement{Node: "A", Value: 1, Source: "agent-1"},
+			want: NodeDetail{Node: "A", InGraph: true, Island: 0, Measured: true, Value: 1, Source: "agent-1"},
+		},
+		{
+			m:    NodeMeasurement{Node: "A", Value: 2, Mode: MeasurementAdd, Source: "agent-2"},
+			want: NodeDetail{Node: "A", InGraph: true, Island: 0, Measured: true, Value: 3, Source: "agent-2"},
+		},
+		{
+			m:    NodeMeasurement{Node: "A", Value: 4},
+			want: NodeDetail{Node: "A", InGraph: true, Island: 0, Measured: true, Value: 4},
+		},
+	}
+	for _, step := range steps {
+		grid.update(MeasurementUpdate{NodeMeasurement: step.m})
+		if got := detail("A"); got != step.want {
+			t.Fatalf("after %+v: detail = %+v, want %+v", step.m, got, step.want)
+		}
+	}
+
+	if got, want := detail("Z"), (NodeDetail{Node: "Z", Island: -1}); got != want {
+		t.Fatalf("unknown node detail = %+v, want %+v", got, want)
+	}
+}
+
+func TestClearMeasurementsKeepsTopology(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithClock(testClock))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "C", Value: 3}})
+
+	reply := make(chan []IslandMeasurement, 1)
+	grid.update(ClearMeasurements{Reply: reply})
+
+	want := []IslandMeasurement{
+		{Island: []string{"A", "B"}, Total: 0, NodeCount: 2, EdgeWeight: 1},
+		{Island: []string{"C"}, Total: 0, NodeCount: 1},
+	}
+	if got := <-reply; !reflect.DeepEqual(got, want) {
+		t.Fatalf("totals after clear = %v, want %v", got, want)
+	}
+
+	// Add mode starts again from zero.
+	res := make(chan MeasurementResult, 1)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1, Mode: MeasurementAdd}, Reply: res})
+	want[0] = IslandMeasurement{Island: []string{"A", "B"}, Total: 1, NodeCount: 2, MeasuredCount: 1, Min: 1, Max: 1, Average: 1, EdgeWeight: 1, LastUpdated: testTime}
+	if got := (<-res).Totals; !reflect.DeepEqual(got, want) {
+		t.Fatalf("totals after clear and add = %v, want %v", got, want)
+	}
+}
+
+func TestMeasurementReportsChange(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+
+	// Steps run in order against the same grid.
+	steps := []struct {
+		name        string
+		m           NodeMeasurement
+		wantApplied bool
+		wantChanged bool
+	}{
+		{name: "first value", m: NodeMeasurement{Node: "A", Value: 2}, wantApplied: true, wantChanged: true},
+		{name: "same value in set mode", m: NodeMeasurement{Node: "A", Value: 2}, wantApplied: true},
+		{name: "zero in add mode", m: NodeMeasurement{Node: "A", Mode: MeasurementAdd}, wantApplied: true},
+		{name: "unknown node", m: NodeMeasurement{Node: "Z", Value: 5}},
+		{name: "other node of the island", m: NodeMeasurement{Node: "B", Value: 1}, wantApplied: true, wantChanged: true},
+	}
+
+	for _, st := range steps {
+		reply := make(chan MeasurementResult, 1)
+		grid.update(MeasurementUpdate{NodeMeasurement: st.m, Reply: reply})
+		res := <-reply
+		if res.Applied != st.wantApplied || res.Changed != st.wantChanged {
+			t.Fatalf("%s: applied=%v changed=%v, want applied=%v changed=%v",
+				st.name, res.Applied, res.Changed, st.wantApplied, st.wantChanged)
+		}
+	}
+}
+
+func TestAggregateCountsReportingNodes(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	counts := func() []int {
+		var out []int
+		for _, m := range aggregate(grid) {
+			out = append(out, m.MeasuredCount)
+		}
+		return out
+	}
+
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+	if got := counts(); !reflect.DeepEqual(got, []int{0, 0}) {
+		t.Fatalf("counts before measurements = %v, want [0 0]", got)
+	}
+
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 0}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}})
+	if got := counts(); !reflect.DeepEqual(got, []int{2, 0}) {
+		t.Fatalf("counts = %v, want [2 0] (zero values count, repeats do not)", got)
+	}
+
+	// B leaves the graph: its retained measurement no longer counts.
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "C"}, nil)})
+	if got := counts(); !reflect.DeepEqual(got, []int{1, 0}) {
+		t.Fatalf("counts after B left = %v, want [1 0]", got)
+	}
+	for _, m := range aggregate(grid) {
+		if m.NodeCount != 1 || m.MeasuredCount > m.NodeCount {
+			t.Fatalf("island %v after B left: %d measured of %d nodes, want 1 node", m.Island, m.MeasuredCount, m.NodeCount)
+		}
+	}
+
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+	if got := counts(); !reflect.DeepEqual(got, []int{2, 0}) {
+		t.Fatalf("counts after B returned = %v, want [2 0]", got)
+	}
+
+	grid.update(ClearMeasurements{})
+	if got := counts(); !reflect.DeepEqual(got, []int{0, 0}) {
+		t.Fatalf("counts after clear = %v, want [0 0]", got)
+	}
+}
+
+func TestAggregateStats(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	graph := NewGraph([]string{"A", "B", "C", "D", "E"}, [][]string{{"A", "B"}, {"B", "C"}})
+	graph.Roles = map[string]NodeRole{"C": RoleSink}
+	grid.update(GraphUpdate{Graph: graph})
+	for _, m := range []NodeMeasurement{{Node: "A", Value: 4}, {Node: "B", Value: -2}, {Node: "C", Value: 10}, {Node: "Z", Value: 99}} {
+		grid.update(MeasurementUpdate{NodeMeasurement: m})
+	}
+
+	type stats struct{ total, min, max, average float64 }
+	var got []stats
+	for _, m := range aggregate(grid) {
+		got = append(got, stats{m.Total, m.Min, m.Max, m.Average})
+	}
+
+	// The sink is netted in the total but its stored value feeds the stats;
+	// the unmeasured islands report zeros, not NaN.
+	want := []stats{{total: -8, min: -2, max: 10, average: 4}, {}, {}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestAggregateLastUpdated(t *testing.T) {
+	t.Parallel()
+
+	now := testTime
+	grid := NewGrid(WithClock(func() time.Time { return now }))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+
+	lastUpdated := func() []time.Time {
+		var out []time.Time
+		for _, m := range grid.currentTotals() {
+			out = append(out, m.LastUpdated)
+		}
+		return out
+	}
+
+	if got := lastUpdated(); !reflect.DeepEqual(got, []time.Time{{}, {}}) {
+		t.Fatalf("last updated before measurements = %v, want zero times", got)
+	}
+
+	steps := []struct {
+		node string
+		want []time.Time
+	}{
+		{node: "B", want: []time.Time{testTime, {}}},
+		{node: "A", want: []time.Time{testTime.Add(time.Minute), {}}},
+		{node: "C", want: []time.Time{testTime.Add(time.Minute), testTime.Add(2 * time.Minute)}},
+		{node: "Z", want: []time.Time{testTime.Add(time.Minute), testTime.Add(2 * time.Minute)}},
+	}
+	for i, step := range steps {
+		now = testTime.Add(time.Duration(i) * time.Minute)
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: step.node, Value: 1}})
+		if got := lastUpdated(); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("after measuring %s: last updated = %v, want %v", step.node, got, step.want)
+		}
+	}
+
+	// A clock running backwards does not move the island back in time.
+	now = testTime.Add(-time.Hour)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 2}})
+	if got := lastUpdated()[0]; !got.Equal(testTime.Add(time.Minute)) {
+		t.Fatalf("last updated = %v, want the most recent %v", got, testTime.Add(time.Minute))
+	}
+
+	// The time a producer reports taking the value is not the time it was stored.
+	now = testTime.Add(3 * time.Minute)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "C", Value: 3, Taken: testTime.Add(time.Hour)}})
+	if got := lastUpdated()[1]; !got.Equal(now) {
+		t.Fatalf("last updated = %v, want the time of receipt %v", got, now)
+	}
+
+	grid.update(ClearMeasurements{})
+	if got := lastUpdated(); !reflect.DeepEqual(got, []time.Time{{}, {}}) {
+		t.Fatalf("last updated after clear = %v, want zero times", got)
+	}
+}
+
+func TestAggregateEdgeWeight(t *testing.T) {
+	t.Parallel()
+
+	edgeWeights := func(grid *Grid) []float64 {
+		var got []float64
+		for _, m := range aggregate(grid) {
+			got = append(got, m.EdgeWeight)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name  string
+		graph Graph
+		want  []float64
+	}{
+		{
+			name:  "unweighted edges weigh 1",
+			graph: NewGraph([]string{"A", "B", "C", "D"}, [][]string{{"A", "B"}, {"B", "C"}}),
+			want:  []float64{2, 0},
+		},
+		{
+			name: "weights keyed either way round, self-loops dropped",
+			graph: func() Graph {
+				g := NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}, {"B", "C"}, {"C", "C"}})
+				g.Weights = map[[2]string]float64{{"B", "A"}: 2.5, {"C", "C"}: 4}
+				return g
+			}(),
+			want: []float64{3.5},
+		},
+		{
+			name: "directed edges between islands do not count",
+			graph: func() Graph {
+				g := NewDirectedGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}, {"B", "A"}, {"B", "C"}})
+				g.Weights = map[[2]string]float64{{"A", "B"}: 2, {"B", "A"}: 3, {"B", "C"}: 10}
+				return g
+			}(),
+			want: []float64{5, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: tt.graph})
+			if got := edgeWeights(grid); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("edge weights = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEdgeEditKeepsEdgeWeights(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	graph := NewGraph([]string{"A", "B", "C", "D"}, [][]string{{"A", "B"}, {"B", "C"}, {"A", "C"}})
+	graph.Weights = map[[2]string]float64{{"A", "B"}: 2, {"B", "C"}: 3, {"A", "C"}: 5}
+	grid.update(GraphUpdate{Graph: graph})
+	// Build the cache so the edits below maintain it.
+	reply := make(chan MeasurementResult, 1)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}, Reply: reply})
+	<-reply
+
+	steps := []struct {
+		edit EdgeEdit
+		want []float64
+	}{
+		{EdgeEdit{Remove: [][]string{{"C", "A"}}}, []float64{0, 5}},
+		{EdgeEdit{Add: [][]string{{"C", "D"}}}, []float64{6}},
+		{EdgeEdit{Remove: [][]string{{"B", "C"}}}, []float64{1, 2}},
+	}
+	for i, step := range steps {
+		grid.update(step.edit)
+		var got []float64
+		for _, m := range grid.islandTotals() {
+			got = append(got, m.EdgeWeight)
+		}
+		// Edited islands are not in rebuild order.
+		slices.Sort(got)
+		if !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("step %d: cached edge weights = %v, want %v", i, got, step.want)
+		}
+		checkTotalsCache(t, grid, fmt.Sprintf("step %d", i))
+	}
+}
+
+func TestIslandsQuery(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	reply := make(chan Partition, 1)
+	grid.update(IslandsQuery{Reply: reply})
+	empty := <-reply
+	if len(empty.Islands) != 0 {
+		t.Fatalf("islands before any graph = %v, want none", empty.Islands)
+	}
+
+	graph := NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "C"}})
+	grid.update(GraphUpdate{Graph: graph})
+	version := grid.version
+	grid.update(IslandsQuery{Reply: reply})
+	got := <-reply
+	if want := [][]string{{"A", "C"}, {"B"}}; !islandsEqual(got.Islands, want) {
+		t.Fatalf("islands = %v, want %v", got.Islands, want)
+	}
+	if grid.version != version {
+		t.Errorf("version = %d after the query, want it unchanged at %d", grid.version, version)
+	}
+	if got.Hash == empty.Hash {
+		t.Errorf("hash = %x for different islands, want it to change", got.Hash)
+	}
+
+	// The hash follows the islands alone.
+	steps := []struct {
+		name    string
+		evt     Event
+		changed bool
+	}{
+		{name: "measurement", evt: MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}}},
+		{name: "same graph", evt: GraphUpdate{Graph: graph}},
+		{name: "edge within an island", evt: EdgeEdit{Add: [][]string{{"C", "A"}}}},
+		{name: "edge joining islands", evt: EdgeEdit{Add: [][]string{{"A", "B"}}}, changed: true},
+	}
+	hash := got.Hash
+	for _, step := range steps {
+		grid.update(step.evt)
+		grid.update(IslandsQuery{Reply: reply})
+		got := <-reply
+		if changed := got.Hash != hash; changed != step.changed {
+			t.Errorf("%s: hash changed = %t, want %t", step.name, changed, step.changed)
+		}
+		hash = got.Hash
+	}
+}
+
+func TestHashIslands(t *testing.T) {
+	t.Parallel()
+
+	// Lists of islands that would encode alike if names were simply joined.
+	lists := [][][]string{
+		{},
+		{{}},
+		{{"A", "B"}},
+		{{"A"}, {"B"}},
+		{{"AB"}},
+		{{"B", "A"}},
+		{{"A", ""}},
+	}
+	seen := make(map[uint64][][]string)
+	for _, islands := range lists {
+		h := hashIslands(islands)
+		if other, ok := seen[h]; ok {
+			t.Errorf("hashIslands(%q) = hashIslands(%q)", islands, other)
+		}
+		seen[h] = islands
+	}
+}
+
+func TestIslandMembersSorted(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		graph Graph
+		edit  *EdgeEdit
+		want  [][]string
+	}{
+		{
+			name:  "undirected",
+			graph: NewGraph([]string{"D", "B", "C", "A", "E"}, [][]string{{"D", "C"}, {"C", "A"}, {"A", "B"}}),
+			want:  [][]string{{"A", "B", "C", "D"}, {"E"}},
+		},
+		{
+			name:  "directed",
+			graph: NewDirectedGraph([]string{"C", "B", "A"}, [][]string{{"C", "A"}, {"A", "B"}, {"B", "C"}}),
+			want:  [][]string{{"A", "B", "C"}},
+		},
+		{
+			name:  "merged by an edge edit",
+			graph: NewGraph([]string{"D", "C", "B", "A"}, [][]string{{"D", "B"}, {"C", "A"}}),
+			edit:  &EdgeEdit{Add: [][]string{{"D", "C"}}},
+			want:  [][]string{{"A", "B", "C", "D"}},
+		},
+		{
+			name:  "split by an edge edit",
+			graph: NewGraph([]string{"D", "C", "B", "A"}, [][]string{{"D", "B"}, {"B", "C"}, {"C", "A"}}),
+			edit:  &EdgeEdit{Remove: [][]string{{"B", "C"}}},
+			want:  [][]string{{"A", "C"}, {"B", "D"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: tt.graph})
+			if tt.edit != nil {
+				grid.update(*tt.edit)
+			}
+			if !reflect.DeepEqual(grid.islands, tt.want) {
+				t.Fatalf("islands = %v, want %v", grid.islands, tt.want)
+			}
+		})
+	}
+}
+
+func TestIslandOfNodeQuery(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	graph := NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "C"}})
+	graph.Aliases = map[string]string{"alpha": "A"}
+	grid.update(GraphUpdate{Graph: graph})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "C", Value: 2}})
+
+	reply := make(chan NodeIsland, 1)
+	for _, node := range []string{"C", "alpha"} {
+		grid.update(IslandOfNodeQuery{Node: node, Reply: reply})
+		if got := <-reply; got.Index != 0 || !islandsEqual([][]string{got.Island}, [][]string{{"A", "C"}}) || got.Total != 2 {
+			t.Errorf("island of %s = %+v, want island 0 [A C] totalling 2", node, got)
+		}
+	}
+
+	grid.update(IslandOfNodeQuery{Node: "Z", Reply: reply})
+	if got := <-reply; got.Index != -1 {
+		t.Errorf("island of a node outside the graph = %+v, want index -1", got)
+	}
+}
+
+// BenchmarkComputeIslands measures a full island computation on a 100k-node
+// graph of 1000-node random islands.
+func BenchmarkComputeIslands(b *testing.B) {
+	nodes, edges := benchmarkGraph()
+	var table nodeTable
+	g := table.internGraph(NewGraph(nodes, edges))
+	for b.Loop() {
+		computeIslands(g, &table)
+	}
+}
+
+// benchmarkGraph returns a graph of 100k nodes in islands of 1000, each a
+// random tree plus as many chords.
+func benchmarkGraph() (nodes []string, edges [][]string) {
+	const (
+		nodeCount  = 100_000
+		islandSize = 1000
+	)
+
+	rng := rand.New(rand.NewPCG(1, 1))
+	nodes = make([]string, nodeCount)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("node-%d", i)
+		if i%islandSize != 0 {
+			// Attach to a random earlier node of the same island, plus a chord.
+			base := i - i%islandSize
+			edges = append(edges,
+				[]string{nodes[base+rng.IntN(i-base)], nodes[i]},
+				[]string{nodes[base+rng.IntN(i-base)], nodes[i]})
+		}
+	}
+	return nodes, edges
+}
@@ -0,0 +1,54 @@
+package business
+
+import "errors"
+
+var (
+	// ErrVersionEvicted is returned for a state version older than the
+	// retained snapshots.
+	ErrVersionEvicted = errors.New("state version is no longer retained")
+
+	// ErrVersionUnknown is returned for a state version not reached yet.
+	ErrVersionUnknown = errors.New("state version does not exist yet")
+)
+
+// VersionedTotals are the per-island totals right after a state version.
+type VersionedTotals struct {
+	Version uint64
+	Totals  []IslandMeasurement
+	Err     error // the version is not available
+}
+
+// history is a bounded ring of the totals after the most recent state versions.
+type history struct {
+	ring []VersionedTotals // ring[i%len(ring)] holds the snapshot after version i
+}
+
+// commit records a mutation of the grid state: it advances the state version
+// and, when history is retained, snapshots the resulting totals.
+func (s *Grid) commit() {
+	s.version++
+	s.decayed = false
+	s.record()
+}
+
+// record snapshots the totals of the current version.
+func (s *Grid) record() {
+	if len(s.history.ring) == 0 {
+		return
+	}
+	s.history.ring[s.version%uint64(len(s.history.ring))] = VersionedTotals{Version: s.version, Totals: s.currentTotals()}
+}
+
+// totalsAt returns the totals right after version. The current version is
+// always available; older ones only while they are retained.
+func (s *Grid) totalsAt(version uint64) VersionedTotals {
+	switch {
+	case version == s.version:
+		return VersionedTotals{Version: version, Totals: s.currentTotals()}
+	case version > s.version:
+		return VersionedTotals{Version: version, Err: ErrVersionUnknown}
+	case len(s.history.ring) == 0 || s.version-version >= uint64(len(s.history.ring)):
+		return VersionedTotals{Version: version, Err: ErrVersionEvicted}
+	}
+	return s.history.ring[version%uint64(len(s.history.ring))]
+}
@@ -0,0 +1,110 @@
+package business
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTotalsAtVersion(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithHistoryDepth(3))
+
+	graph := make(chan GraphResult, 1)
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil), Reply: graph})
+	if v := (<-graph).Version; v != 1 {
+		t.Fatalf("version after graph = %d, want 1", v)
+	}
+
+	// Versions 2..5 set A to 10, 20, 30, 40.
+	for i := range 4 {
+		reply := make(chan MeasurementResult, 1)
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: float64(10 * (i + 1))}, Reply: reply})
+		if v := (<-reply).Version; v != uint64(i+2) {
+			t.Fatalf("version after measurement %d = %d, want %d", i, v, i+2)
+		}
+	}
+
+	// Not applied: the version stays.
+	reply := make(chan MeasurementResult, 1)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "Z", Value: 1}, Reply: reply})
+	if v := (<-reply).Version; v != 5 {
+		t.Fatalf("version after dropped measurement = %d, want 5", v)
+	}
+
+	tests := []struct {
+		name    string
+		query   TotalsAtQuery
+		want    float64 // total of A's island
+		wantErr error
+	}{
+		{name: "latest", query: TotalsAtQuery{Latest: true}, want: 40},
+		{name: "current", query: TotalsAtQuery{Version: 5}, want: 40},
+		{name: "recent", query: TotalsAtQuery{Version: 3}, want: 20},
+		{name: "evicted", query: TotalsAtQuery{Version: 2}, wantErr: ErrVersionEvicted},
+		{name: "before any mutation", query: TotalsAtQuery{Version: 0}, wantErr: ErrVersionEvicted},
+		{name: "future", query: TotalsAtQuery{Version: 6}, wantErr: ErrVersionUnknown},
+	}
+
+	for _, tt := range tests {
+		reply := make(chan VersionedTotals, 1)
+		tt.query.Reply = reply
+		grid.update(tt.query)
+		got := <-reply
+
+		if !errors.Is(got.Err, tt.wantErr) {
+			t.Fatalf("%s: err = %v, want %v", tt.name, got.Err, tt.wantErr)
+		}
+		if tt.wantErr == nil && (len(got.Totals) != 2 || got.Totals[0].Total != tt.want) {
+			t.Fatalf("%s: totals = %v, want A's island at %v", tt.name, got.Totals, tt.want)
+		}
+	}
+}
+
+func TestTotalsAtVersionWithoutHistory(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A"}, nil)})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+
+	reply := make(chan VersionedTotals, 1)
+	grid.update(TotalsAtQuery{Version: 1, Reply: reply})
+	if err := (<-reply).Err; !errors.Is(err, ErrVersionEvicted) {
+		t.Fatalf("previous version err = %v, want %v", err, ErrVersionEvicted)
+	}
+
+	grid.update(TotalsAtQuery{Version: 2, Reply: reply})
+	if got := <-reply; got.Err != nil || got.Totals[0].Total != 1 {
+		t.Fatalf("current version = %+v, want a total of 1", got)
+	}
+}
+
+func TestVersionQuery(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	steps := []struct {
+		name string
+		evt  Event
+		want uint64
+	}{
+		{name: "initial", want: 0},
+		{name: "graph", evt: GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil)}, want: 1},
+		{name: "measurement", evt: MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}}, want: 2},
+		{name: "dropped measurement", evt: MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "Z", Value: 1}}, want: 2},
+		{name: "query", evt: IslandsQuery{}, want: 2},
+		{name: "edge edit", evt: EdgeEdit{Add: [][]string{{"A", "B"}}}, want: 3},
+	}
+
+	for _, step := range steps {
+		if step.evt != nil {
+			grid.update(step.evt)
+		}
+		reply := make(chan uint64, 1)
+		grid.update(VersionQuery{Reply: reply})
+		if got := <-reply; got != step.want {
+			t.Fatalf("%s: version = %d, want %d", step.name, got, step.want)
+		}
+	}
+}
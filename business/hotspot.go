@@ -0,0 +1,39 @@
+package business
+
+// Hotspot is the node with the highest current measurement and the island it
+// belongs to.
+type Hotspot struct {
+	Node   string
+	Value  float64
+	Island []string
+	Total  float64 // total of Island
+}
+
+// hotspot returns the graph node with the highest measurement counting toward
+// the totals, or nil when no node of the graph has one. Ties go to the smallest node name, so the
+// answer does not depend on the order nodes were first seen.
+func hotspot(s *Grid) *Hotspot {
+	best := -1
+	now := s.now()
+	start := s.windowStart(now)
+	for id, m := range s.measurements {
+		if !m.counts(now, start) || id >= len(s.nodeToIsland) || s.nodeToIsland[id] < 0 {
+			continue
+		}
+		if best < 0 || m.value > s.measurements[best].value ||
+			(m.value == s.measurements[best].value && s.nodes.names[id] < s.nodes.names[best]) {
+			best = id
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+
+	island := s.nodeToIsland[best]
+	return &Hotspot{
+		Node:   s.nodes.names[best],
+		Value:  s.measurements[best].value,
+		Island: s.islands[island],
+		Total:  s.islandTotal(island),
+	}
+}
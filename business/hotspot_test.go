@@ -0,0 +1,61 @@
+package business
+
+import "testing"
+
+func TestHotspot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		updates []NodeMeasurement
+		want    *Hotspot
+	}{
+		{name: "no measurements"},
+		{
+			name:    "only nodes outside the graph",
+			updates: []NodeMeasurement{{Node: "Z", Value: 100}},
+		},
+		{
+			name:    "clear hotspot",
+			updates: []NodeMeasurement{{Node: "A", Value: 2}, {Node: "B", Value: 3}, {Node: "C", Value: 9}, {Node: "Z", Value: 100}},
+			want:    &Hotspot{Node: "C", Value: 9, Island: []string{"C", "D"}, Total: 9},
+		},
+		{
+			name:    "tie goes to the smallest name",
+			updates: []NodeMeasurement{{Node: "D", Value: 5}, {Node: "B", Value: 5}, {Node: "A", Value: 1}},
+			want:    &Hotspot{Node: "B", Value: 5, Island: []string{"A", "B"}, Total: 6},
+		},
+		{
+			name:    "negative values",
+			updates: []NodeMeasurement{{Node: "A", Value: -4}, {Node: "D", Value: -1}},
+			want:    &Hotspot{Node: "D", Value: -1, Island: []string{"C", "D"}, Total: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C", "D"}, [][]string{{"A", "B"}, {"C", "D"}})})
+			for _, m := range tt.updates {
+				grid.update(MeasurementUpdate{NodeMeasurement: m})
+			}
+
+			reply := make(chan *Hotspot, 1)
+			grid.update(HotspotQuery{Reply: reply})
+			got := <-reply
+
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("hotspot = %+v, want %+v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+			if got.Node != tt.want.Node || got.Value != tt.want.Value || got.Total != tt.want.Total ||
+				!islandsEqual([][]string{got.Island}, [][]string{tt.want.Island}) {
+				t.Fatalf("hotspot = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package business
+
+// exactDiameterLimit is the largest island whose diameter is computed exactly
+// (a BFS from every node, O(n*m)). Larger islands use a double-sweep BFS, which
+// yields a lower bound that is exact on trees and usually close on grids.
+const exactDiameterLimit = 512
+
+// IslandMetrics holds structural statistics of an island.
+type IslandMetrics struct {
+	Nodes       int  // number of nodes
+	Edges       int  // number of distinct undirected edges
+	Diameter    int  // longest shortest path, in hops
+	Approximate bool // Diameter is a double-sweep lower bound
+}
+
+// islandMetrics computes the structural statistics of every island.
+func islandMetrics(s *Grid) []IslandMetrics {
+	res := make([]IslandMetrics, len(s.islands))
+	dist := make([]int, s.nodes.len())
+	for i := range dist {
+		dist[i] = -1
+	}
+
+	for i, island := range s.islands {
+		ids := make([]int, len(island))
+		for j, name := range island {
+			ids[j], _ = s.nodes.id(name)
+		}
+
+		m := IslandMetrics{Nodes: len(ids), Edges: countEdges(s.graph, s.nodeToIsland, ids)}
+		if len(ids) <= exactDiameterLimit {
+			for _, id := range ids {
+				_, ecc := bfsFarthest(s.graph, s.nodeToIsland, id, dist)
+				m.Diameter = max(m.Diameter, ecc)
+			}
+		} else {
+			far, _ := bfsFarthest(s.graph, s.nodeToIsland, ids[0], dist)
+			_, m.Diameter = bfsFarthest(s.graph, s.nodeToIsland, far, dist)
+			m.Approximate = true
+		}
+		res[i] = m
+	}
+
+	return res
+}
+
+// countEdges counts the distinct undirected edges between the given nodes of
+// one island, ignoring mirrored and duplicated adjacency entries. Edges of a
+// directed graph leading to another island are left out.
+func countEdges(g topology, nodeToIsland []int, ids []int) int {
+	seen := map[[2]int]struct{}{}
+	for _, a := range ids {
+		for _, b := range g.adj[a] {
+			if nodeToIsland[b] != nodeToIsland[a] {
+				continue
+			}
+			seen[[2]int{min(a, b), max(a, b)}] = struct{}{}
+		}
+	}
+	return len(seen)
+}
+
+// bfsFarthest runs a BFS from start within its island and returns the farthest
+// node reached and its distance. dist is scratch space sized to the node table,
+// filled with -1; it is restored before returning.
+func bfsFarthest(g topology, nodeToIsland []int, start int, dist []int) (int, int) {
+	queue := []int{start}
+	dist[start] = 0
+	far := start
+
+	for i := 0; i < len(queue); i++ {
+		v := queue[i]
+		if dist[v] > dist[far] {
+			far = v
+		}
+		for _, nei := range g.adj[v] {
+			if dist[nei] < 0 && nodeToIsland[nei] == nodeToIsland[start] {
+				dist[nei] = dist[v] + 1
+				queue = append(queue, nei)
+			}
+		}
+	}
+
+	d := dist[far]
+	for _, v := range queue {
+		dist[v] = -1
+	}
+	return far, d
+}
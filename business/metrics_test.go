@@ -0,0 +1,91 @@
+package business
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIslandMetrics(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		nodes []string
+		edges [][]string
+		want  []IslandMetrics
+	}{
+		{
+			name: "empty grid",
+			want: []IslandMetrics{},
+		},
+		{
+			name:  "single node",
+			nodes: []string{"A"},
+			want:  []IslandMetrics{{Nodes: 1}},
+		},
+		{
+			name:  "path",
+			nodes: []string{"A", "B", "C", "D"},
+			edges: [][]string{{"A", "B"}, {"B", "C"}, {"C", "D"}},
+			want:  []IslandMetrics{{Nodes: 4, Edges: 3, Diameter: 3}},
+		},
+		{
+			name:  "cycle with duplicate edge",
+			nodes: []string{"A", "B", "C", "D", "E"},
+			edges: [][]string{{"A", "B"}, {"B", "C"}, {"C", "D"}, {"D", "E"}, {"E", "A"}, {"B", "A"}},
+			want:  []IslandMetrics{{Nodes: 5, Edges: 5, Diameter: 2}},
+		},
+		{
+			name:  "star and isolated node",
+			nodes: []string{"H", "A", "B", "C", "Z"},
+			edges: [][]string{{"H", "A"}, {"H", "B"}, {"H", "C"}},
+			want:  []IslandMetrics{{Nodes: 4, Edges: 3, Diameter: 2}, {Nodes: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: NewGraph(tt.nodes, tt.edges)})
+
+			reply := make(chan []IslandMetrics, 1)
+			grid.update(IslandMetricsQuery{Reply: reply})
+
+			got := <-reply
+			if len(got) != len(tt.want) {
+				t.Fatalf("metrics = %+v, want %+v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("metrics = %+v, want %+v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIslandMetricsApproximatesLargeIslands(t *testing.T) {
+	t.Parallel()
+
+	// A path is a tree, so the double-sweep estimate is exact.
+	const n = exactDiameterLimit + 1
+	nodes := make([]string, n)
+	var edges [][]string
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("n%d", i)
+		if i > 0 {
+			edges = append(edges, []string{nodes[i-1], nodes[i]})
+		}
+	}
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph(nodes, edges)})
+
+	got := islandMetrics(grid)
+	want := IslandMetrics{Nodes: n, Edges: n - 1, Diameter: n - 1, Approximate: true}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("metrics = %+v, want [%+v]", got, want)
+	}
+}
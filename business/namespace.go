@@ -0,0 +1,91 @@
+package business
+
+import "strings"
+
+// DefaultNamespaceSeparator separates the segments of hierarchical node names
+// such as "region1/substation/A".
+const DefaultNamespaceSeparator = "/"
+
+// NamespaceTotal is the total of the nodes of an island that share a namespace
+// prefix, broken down further by the next segment.
+type NamespaceTotal struct {
+	Namespace string // the shared prefix, e.g. "region1/substation"
+	Total     float64
+	Children  []NamespaceTotal // sub-totals one segment deeper, nil at the last level
+}
+
+// IslandNamespaces is an island total broken down by namespace.
+type IslandNamespaces struct {
+	Island     []string
+	Total      float64
+	Namespaces []NamespaceTotal
+}
+
+// namespaceNode accumulates a NamespaceTotal while keeping its children indexed.
+type namespaceNode struct {
+	total    NamespaceTotal
+	children []*namespaceNode
+	index    map[string]*namespaceNode
+}
+
+// child returns the child for namespace, creating it on first use so children
+// keep the order in which their first node appears in the island.
+func (n *namespaceNode) child(namespace string) *namespaceNode {
+	if c, ok := n.index[namespace]; ok {
+		return c
+	}
+	if n.index == nil {
+		n.index = map[string]*namespaceNode{}
+	}
+	c := &namespaceNode{total: NamespaceTotal{Namespace: namespace}}
+	n.index[namespace] = c
+	n.children = append(n.children, c)
+	return c
+}
+
+// build converts the accumulated children into NamespaceTotals.
+func (n *namespaceNode) build() []NamespaceTotal {
+	if len(n.children) == 0 {
+		return nil
+	}
+	out := make([]NamespaceTotal, len(n.children))
+	for i, c := range n.children {
+		out[i] = c.total
+		out[i].Children = c.build()
+	}
+	return out
+}
+
+// islandNamespaces breaks every island total down by node name prefix: level k
+// (1 <= k <= depth) groups nodes by their first k segments. A name with fewer
+// segments than a level stops there, so "A" is its own group at every level.
+// Sinks are netted as in aggregate.
+func islandNamespaces(s *Grid, depth int, sep string) []IslandNamespaces {
+	if sep == "" {
+		sep = DefaultNamespaceSeparator
+	}
+
+	now := s.now()
+	start := s.windowStart(now)
+	res := make([]IslandNamespaces, len(s.islands))
+	for i, island := range s.islands {
+		var root namespaceNode
+		var total float64
+		for _, name := range island {
+			var value float64
+			if id, _ := s.nodes.id(name); id < len(s.measurements) && s.measurements[id].counts(now, start) {
+				value = s.graph.sign(id) * s.measurements[id].value
+			}
+			total, _ = addClamped(total, value)
+
+			segments := strings.Split(name, sep)
+			n := &root
+			for k := 1; k <= min(depth, len(segments)); k++ {
+				n = n.child(strings.Join(segments[:k], sep))
+				n.total.Total, _ = addClamped(n.total.Total, value)
+			}
+		}
+		res[i] = IslandNamespaces{Island: island, Total: total, Namespaces: root.build()}
+	}
+	return res
+}
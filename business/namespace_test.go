@@ -0,0 +1,74 @@
+package business
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIslandNamespaces(t *testing.T) {
+	t.Parallel()
+
+	nodes := []string{"r1/s1/A", "r1/s1/B", "r1/s2/C", "r2/s1/D", "E"}
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph(nodes, [][]string{
+		{"r1/s1/A", "r1/s1/B"}, {"r1/s1/B", "r1/s2/C"}, {"r1/s2/C", "r2/s1/D"}, {"r2/s1/D", "E"},
+	})})
+	for i, n := range nodes {
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: n, Value: float64(i + 1)}})
+	}
+
+	tests := []struct {
+		name  string
+		depth int
+		sep   string
+		want  []NamespaceTotal
+	}{
+		{
+			name:  "depth 1",
+			depth: 1,
+			want: []NamespaceTotal{
+				{Namespace: "E", Total: 5},
+				{Namespace: "r1", Total: 6},
+				{Namespace: "r2", Total: 4},
+			},
+		},
+		{
+			name:  "depth 2 nests sub-totals",
+			depth: 2,
+			want: []NamespaceTotal{
+				{Namespace: "E", Total: 5},
+				{Namespace: "r1", Total: 6, Children: []NamespaceTotal{
+					{Namespace: "r1/s1", Total: 3},
+					{Namespace: "r1/s2", Total: 3},
+				}},
+				{Namespace: "r2", Total: 4, Children: []NamespaceTotal{
+					{Namespace: "r2/s1", Total: 4},
+				}},
+			},
+		},
+		{
+			name:  "other separator",
+			depth: 2,
+			sep:   ".",
+			want: []NamespaceTotal{
+				{Namespace: "E", Total: 5},
+				{Namespace: "r1/s1/A", Total: 1},
+				{Namespace: "r1/s1/B", Total: 2},
+				{Namespace: "r1/s2/C", Total: 3},
+				{Namespace: "r2/s1/D", Total: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := islandNamespaces(grid, tt.depth, tt.sep)
+			if len(got) != 1 || got[0].Total != 15 {
+				t.Fatalf("islands = %+v, want one island with total 15", got)
+			}
+			if !reflect.DeepEqual(got[0].Namespaces, tt.want) {
+				t.Fatalf("namespaces = %+v, want %+v", got[0].Namespaces, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package business
+
+import "slices"
+
+// nodeTable interns node names and assigns each one a dense ID, stable until
+// the name is released.
+//
+// Every name is stored once: the topology, the island lists, and the per-node
+// state slices of Grid all refer to the canonical string kept here, and per-node
+// state is indexed by ID instead of being keyed by name. Released IDs are reused
+// before the table grows, so it holds at most as many IDs as there were names
+// in use at once.
+type nodeTable struct {
+	ids   map[string]int // node name -> ID
+	names []string       // ID -> canonical node name, stale for a released ID
+	free  []int          // released IDs, reused by intern
+
+	// shared is set while a background recompute reads names: the slice is
+	// copied before a slot is overwritten, instead of writing under the reader.
+	shared bool
+}
+
+func newNodeTable() nodeTable {
+	return nodeTable{ids: map[string]int{}}
+}
+
+// intern returns the ID and canonical string for name, registering it on first use.
+func (t *nodeTable) intern(name string) (int, string) {
+	if id, ok := t.ids[name]; ok {
+		return id, t.names[id]
+	}
+	if t.ids == nil {
+		t.ids = map[string]int{}
+	}
+	if n := len(t.free); n > 0 {
+		id := t.free[n-1]
+		t.free = t.free[:n-1]
+		if t.shared {
+			t.names = slices.Clone(t.names)
+			t.shared = false
+		}
+		t.ids[name] = id
+		t.names[id] = name
+		return id, name
+	}
+	id := len(t.names)
+	t.ids[name] = id
+	t.names = append(t.names, name)
+	return id, name
+}
+
+// release forgets the name of id and lets intern hand the ID out again.
+func (t *nodeTable) release(id int) {
+	delete(t.ids, t.names[id])
+	t.free = append(t.free, id)
+}
+
+// live reports whether id is assigned to a name, i.e. has not been released.
+func (t *nodeTable) live(id int) bool {
+	got, ok := t.ids[t.names[id]]
+	return ok && got == id
+}
+
+// id returns the ID of name if it has been interned.
+func (t *nodeTable) id(name string) (int, bool) {
+	id, ok := t.ids[name]
+	return id, ok
+}
+
+// len returns the number of IDs handed out, released ones included.
+func (t *nodeTable) len() int {
+	return len(t.names)
+}
+
+// topology is the compact, ID-based form of a Graph kept by Grid.
+type topology struct {
+	order []int   // node IDs in the order of Graph.Nodes
+	adj   [][]int // node ID -> neighbor IDs, nil for nodes outside the graph
+	sinks []bool  // node ID -> node is a sink, nil when every node is a source
+
+	weights  [][]float64 // node ID -> weights of the edges in adj, nil when every edge weighs 1
+	directed bool        // adj lists only outgoing edges, islands are strongly connected
+
+	transforms map[int]Transform // node ID -> per-node transform, nil when there are none
+	aliases    map[string]int    // alternate name -> node ID, nil when there are none
+}
+
+// internGraph converts g into its ID-based topology, interning every node name.
+// Payload strings decoded for each request are not retained.
+func (t *nodeTable) internGraph(g Graph) topology {
+	if missing := len(g.Nodes) - t.len() - len(t.free); missing > 0 {
+		t.names = slices.Grow(t.names, missing)
+	}
+
+	order := make([]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		order[i], _ = t.intern(n)
+	}
+
+	// Nodes of the graph always get a non-nil adjacency, so adj doubles as the
+	// membership test.
+	adj := make([][]int, t.len())
+	for _, id := range order {
+		adj[id] = make([]int, 0, len(g.Edges[t.names[id]]))
+	}
+	var weights [][]float64
+	if len(g.Weights) > 0 {
+		weights = make([][]float64, len(adj))
+	}
+	for _, id := range order {
+		name := t.names[id]
+		for _, nei := range g.Edges[name] {
+			// Skip neighbors that are not nodes of this graph.
+			if neiID, ok := t.id(nei); ok && adj[neiID] != nil {
+				adj[id] = append(adj[id], neiID)
+				if weights != nil {
+					weights[id] = append(weights[id], g.weight(name, nei))
+				}
+			}
+		}
+	}
+
+	var sinks []bool
+	for n, role := range g.Roles {
+		id, ok := t.id(n)
+		if !ok || role != RoleSink || adj[id] == nil {
+			continue
+		}
+		if sinks == nil {
+			sinks = make([]bool, len(adj))
+		}
+		sinks[id] = true
+	}
+
+	var transforms map[int]Transform
+	for n, tr := range g.Transforms {
+		id, ok := t.id(n)
+		if !ok || adj[id] == nil {
+			continue
+		}
+		if transforms == nil {
+			transforms = make(map[int]Transform, len(g.Transforms))
+		}
+		transforms[id] = tr
+	}
+
+	var aliases map[string]int
+	for alias, target := range g.Aliases {
+		id, ok := t.id(target)
+		if !ok || adj[id] == nil {
+			continue
+		}
+		// A node name always refers to the node itself.
+		if aliasID, ok := t.id(alias); ok && adj[aliasID] != nil {
+			continue
+		}
+		if aliases == nil {
+			aliases = make(map[string]int, len(g.Aliases))
+		}
+		aliases[alias] = id
+	}
+
+	return topology{order: order, adj: adj, sinks: sinks, weights: weights, directed: g.Directed, transforms: transforms, aliases: aliases}
+}
+
+// has reports whether the node with the given ID is part of the topology.
+func (tp topology) has(id int) bool {
+	return id < len(tp.adj) && tp.adj[id] != nil
+}
+
+// neighbors returns the adjacency row of id, nil for nodes outside the graph.
+func (tp topology) neighbors(id int) []int {
+	if id >= len(tp.adj) {
+		return nil
+	}
+	return tp.adj[id]
+}
+
+// weight returns the weight of the k-th edge in the adjacency row of id.
+func (tp topology) weight(id, k int) float64 {
+	if tp.weights == nil {
+		return 1
+	}
+	return tp.weights[id][k]
+}
+
+// sign returns -1 for sink nodes and 1 for source nodes.
+func (tp topology) sign(id int) float64 {
+	if id < len(tp.sinks) && tp.sinks[id] {
+		return -1
+	}
+	return 1
+}
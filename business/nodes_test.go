@@ -0,0 +1,196 @@
+package business
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"testing"
+)
+
+func TestNodeTableIntern(t *testing.T) {
+	t.Parallel()
+
+	var nodes nodeTable
+
+	idA, a := nodes.intern("A")
+	idB, _ := nodes.intern("B")
+	// A distinct allocation with the same contents must resolve to the same entry.
+	idA2, a2 := nodes.intern(strings.Clone("A"))
+
+	if idA != 0 || idB != 1 {
+		t.Fatalf("ids = (%d, %d), want (0, 1)", idA, idB)
+	}
+	if idA2 != idA {
+		t.Fatalf("re-interned id = %d, want %d", idA2, idA)
+	}
+	if a2 != a || nodes.names[idA] != "A" {
+		t.Fatalf("canonical name = %q, want %q", a2, "A")
+	}
+	if nodes.len() != 2 {
+		t.Fatalf("len() = %d, want 2", nodes.len())
+	}
+	if _, ok := nodes.id("C"); ok {
+		t.Fatalf("id(C) found, want missing")
+	}
+
+	nodes.release(idA)
+	if _, ok := nodes.id("A"); ok || nodes.live(idA) {
+		t.Fatalf("released A still resolves")
+	}
+	if idC, _ := nodes.intern("C"); idC != idA || !nodes.live(idC) {
+		t.Fatalf("id(C) = %d, want the released id %d", idC, idA)
+	}
+	if nodes.len() != 2 {
+		t.Fatalf("len() after reuse = %d, want 2", nodes.len())
+	}
+}
+
+func TestGridStateRetainedAcrossInterning(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}})
+
+	// Re-post a topology where A moved; IDs must be stable across graph updates.
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"C", "A", "B"}, [][]string{{"C", "A"}})})
+
+	reply := make(chan MeasurementResult, 1)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 3}, Reply: reply})
+
+	got := (<-reply).Totals
+	want := []IslandMeasurement{
+		{Island: []string{"A", "C"}, Total: 2},
+		{Island: []string{"B"}, Total: 3},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("totals = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !islandsEqual([][]string{got[i].Island}, [][]string{want[i].Island}) || got[i].Total != want[i].Total {
+			t.Fatalf("totals = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestGridReclaimsNodeIDs(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"kept", "measured"}, nil)})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "measured", Value: 4}})
+
+	// Churn through node names: each graph replaces the previous one.
+	for i := range 100 {
+		grid.update(GraphUpdate{Graph: NewGraph([]string{"kept", fmt.Sprintf("churn-%d", i)}, nil)})
+	}
+
+	if got := grid.nodes.len(); got != 4 {
+		t.Fatalf("ids handed out = %d, want 4: kept, measured and two churned names", got)
+	}
+	if got := len(grid.measurements); got != 4 {
+		t.Fatalf("measurement slots = %d, want 4", got)
+	}
+	if _, ok := grid.nodes.id("churn-0"); ok {
+		t.Fatalf("id(churn-0) found, want released")
+	}
+	// A measured node outside the graph keeps its value for when it returns.
+	if d := grid.nodeDetail("measured"); !d.Measured || d.Value != 4 || d.InGraph {
+		t.Fatalf("detail of measured = %+v, want its value kept outside the graph", d)
+	}
+
+	grid.update(ClearMeasurements{})
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"kept"}, nil)})
+	if _, ok := grid.nodes.id("measured"); ok {
+		t.Fatalf("id(measured) found after clearing, want released")
+	}
+
+	reply := make(chan MeasurementResult, 1)
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"kept", "new"}, [][]string{{"kept", "new"}})})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "new", Value: 2}, Reply: reply})
+	if got := (<-reply).Totals; len(got) != 1 || got[0].Total != 2 {
+		t.Fatalf("totals = %v, want a single island of 2 on a reused id", got)
+	}
+	checkAgainstRebuild(t, grid, "after reusing ids")
+}
+
+// BenchmarkGridMemory compares the retained heap of the previous name-keyed
+// layout (map[string]int island index plus map[string]float64 measurements
+// keyed by the decoded payload strings) with the interned, ID-indexed Grid.
+func BenchmarkGridMemory(b *testing.B) {
+	const nodeCount = 200_000
+
+	names := make([]string, nodeCount)
+	edges := make([][]string, 0, nodeCount)
+	for i := range names {
+		names[i] = fmt.Sprintf("node-%d", i)
+		if i > 0 && i%10 != 0 {
+			edges = append(edges, []string{names[i-1], names[i]})
+		}
+	}
+
+	// Every measurement payload is decoded into a fresh string, as in the handler.
+	payloadNames := func() []string {
+		out := make([]string, nodeCount)
+		for i, n := range names {
+			out[i] = strings.Clone(n)
+		}
+		return out
+	}
+
+	b.Run("map", func(b *testing.B) {
+		for b.Loop() {
+			before := heapInUse()
+			pn := payloadNames()
+
+			graph := NewGraph(names, edges)
+			islands := make([][]string, 0, nodeCount/10)
+			nodeToIsland := map[string]int{}
+			measurements := map[string]float64{}
+			for i, n := range graph.Nodes {
+				if i%10 == 0 {
+					islands = append(islands, nil)
+				}
+				islands[i/10] = append(islands[i/10], n)
+				nodeToIsland[n] = i / 10
+			}
+			for i, n := range pn {
+				measurements[n] = float64(i)
+			}
+
+			b.ReportMetric(float64(heapInUse()-before)/nodeCount, "B/node")
+			runtime.KeepAlive(graph)
+			runtime.KeepAlive(islands)
+			runtime.KeepAlive(nodeToIsland)
+			runtime.KeepAlive(measurements)
+		}
+	})
+
+	b.Run("interned", func(b *testing.B) {
+		for b.Loop() {
+			before := heapInUse()
+			pn := payloadNames()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: NewGraph(names, edges)})
+			// Store directly: going through update would aggregate after every
+			// measurement, which is irrelevant to the retained footprint.
+			for i, n := range pn {
+				id, _ := grid.nodes.id(n)
+				grid.setMeasurement(id, float64(i))
+			}
+
+			b.ReportMetric(float64(heapInUse()-before)/nodeCount, "B/node")
+			runtime.KeepAlive(grid)
+		}
+	})
+}
+
+// heapInUse returns the live heap as marked by a fresh garbage collection.
+func heapInUse() uint64 {
+	runtime.GC()
+	sample := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
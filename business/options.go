@@ -0,0 +1,154 @@
+package business
+
+import (
+	"log/slog"
+	"time"
+)
+
+// GridOption configures a Grid created by NewGrid.
+type GridOption func(*Grid)
+
+// WithPauseBuffer sets how many measurements are queued while processing is
+// paused. With a limit of 0 (the default) measurements are rejected with
+// ErrPaused instead.
+func WithPauseBuffer(limit int) GridOption {
+	return func(s *Grid) {
+		s.pauseBuffer = max(limit, 0)
+	}
+}
+
+// GraphUpdatePolicy decides whether a graph update is applied while
+// measurements are queued, in the pause buffer or, with WithMeasurementBacklog,
+// in the event queue.
+type GraphUpdatePolicy int
+
+const (
+	// AcceptGraphUpdates always applies graph updates (default). Queued
+	// measurements are applied on resume against the topology current then.
+	AcceptGraphUpdates GraphUpdatePolicy = iota
+	// RejectGraphWhilePending rejects graph updates with ErrMeasurementsPending
+	// while the pause buffer holds measurements or, with WithMeasurementBacklog,
+	// measurement events are queued behind them, so every measurement is applied
+	// under the topology it was sent for.
+	RejectGraphWhilePending
+)
+
+// WithGraphUpdatePolicy sets how graph updates interact with queued
+// measurements.
+func WithGraphUpdatePolicy(policy GraphUpdatePolicy) GridOption {
+	return func(s *Grid) {
+		s.graphPolicy = policy
+	}
+}
+
+// WithRecomputeBudget bounds how long the loop spends computing the islands of
+// a new graph. When a graph exceeds it, the previous topology stays in effect,
+// the update is answered as degraded, and the islands are computed in the
+// background and applied once ready. Zero (the default) always computes fully.
+func WithRecomputeBudget(d time.Duration) GridOption {
+	return func(s *Grid) {
+		s.recomputeBudget = max(d, 0)
+	}
+}
+
+// WithMeasurementCoalescing holds set-mode measurements for up to window before
+// applying them. When several arrive for the same node within the window, only
+// the last one is applied and all of their senders get its result, which saves
+// loop work under bursts of writes to the same nodes. Any other event applies
+// the held measurements first, so ordering is preserved. Zero (the default)
+// applies every measurement on arrival.
+func WithMeasurementCoalescing(window time.Duration) GridOption {
+	return func(s *Grid) {
+		s.coalesceWindow = max(window, 0)
+	}
+}
+
+// WithTransform sets the transform applied to every reading before it is
+// stored, unless the graph gives the node its own. Totals reflect the
+// transformed values. The default is IdentityTransform.
+func WithTransform(t Transform) GridOption {
+	return func(s *Grid) {
+		s.transform = t
+	}
+}
+
+// WithHistoryDepth retains a snapshot of the totals after each of the last
+// depth state versions, so they can be queried with TotalsAtQuery. Every
+// mutation then aggregates the totals once more. Zero (the default) retains
+// only the current version.
+func WithHistoryDepth(depth int) GridOption {
+	return func(s *Grid) {
+		s.history.ring = make([]VersionedTotals, max(depth, 0))
+	}
+}
+
+// WithMeasurementHistory retains the last depth measurements stored for each
+// node, so they can be queried with NodeHistoryQuery. Older ones are evicted as
+// new ones arrive. Only the latest measurement counts toward the totals, and
+// the history of a node is dropped when it is removed or measurements are
+// cleared. The default of 1 retains the latest measurement only.
+func WithMeasurementHistory(depth int) GridOption {
+	return func(s *Grid) {
+		s.readingDepth = max(depth, 1)
+	}
+}
+
+// WithAggregationWindow counts a measurement toward the totals only for window
+// after it is stored: a node that stops reporting drops out of its island
+// total once its latest measurement is older. The stored value itself is kept
+// and still reported per node. Zero (the default) counts the latest
+// measurement of every node indefinitely.
+func WithAggregationWindow(window time.Duration) GridOption {
+	return func(s *Grid) {
+		s.window = max(window, 0)
+	}
+}
+
+// WithMeasurementTTL expires each measurement ttl after it is stored: from
+// then on it no longer counts toward the totals, and add-mode measurements
+// start again from 0. Loop reaps expired measurements once per ttl, dropping
+// them as if never reported, and logs how many it reaped. Zero (the default)
+// never expires measurements.
+func WithMeasurementTTL(ttl time.Duration) GridOption {
+	return func(s *Grid) {
+		s.ttl = max(ttl, 0)
+	}
+}
+
+// WithClock sets the clock stamping measurements as they are stored, which
+// tests replace to get deterministic times. The default is time.Now.
+func WithClock(now func() time.Time) GridOption {
+	return func(s *Grid) {
+		if now != nil {
+			s.now = now
+		}
+	}
+}
+
+// WithLogger sets the logger for grid warnings, such as a degraded recompute.
+// By default nothing is logged.
+func WithLogger(l *slog.Logger) GridOption {
+	return func(s *Grid) {
+		if l != nil {
+			s.logger = l
+		}
+	}
+}
+
+// WithEventTimer sets the callback receiving how long the loop spent processing
+// each event, to find which event types dominate loop time. It runs on the
+// loop goroutine, so it must be cheap.
+func WithEventTimer(fn func(evt Event, d time.Duration)) GridOption {
+	return func(s *Grid) {
+		s.onEvent = fn
+	}
+}
+
+// WithPanicHandler sets the callback invoked when processing an event panics.
+// The loop recovers and moves on to the next event either way; the callback is
+// the place to log v and the stack trace.
+func WithPanicHandler(fn func(evt Event, v any, stack []byte)) GridOption {
+	return func(s *Grid) {
+		s.onPanic = fn
+	}
+}
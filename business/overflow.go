@@ -0,0 +1,43 @@
+package business
+
+import "math"
+
+// addClamped returns total+value, clamped to ±math.MaxFloat64 when the sum is
+// not finite, and reports whether it was clamped. Clamping every step keeps a
+// running sum finite, so mixing huge sources and sinks cannot yield NaN either.
+func addClamped(total, value float64) (float64, bool) {
+	return clampFinite(total + value)
+}
+
+// clampFinite returns v clamped to ±math.MaxFloat64 when it is infinite, and
+// reports whether it was clamped.
+func clampFinite(v float64) (float64, bool) {
+	if math.IsInf(v, 0) {
+		return math.Copysign(math.MaxFloat64, v), true
+	}
+	return v, false
+}
+
+// clamped reports whether the value of m was clamped to ±math.MaxFloat64
+// when it was stored, by a transform or add-mode accumulation.
+func (m measurement) clamped() bool {
+	return math.Abs(m.value) == math.MaxFloat64
+}
+
+// addToMean returns the mean of n values from the mean of the first n-1 and the
+// n-th value v. Both are scaled by 1/n before they are combined, so the mean of
+// finite values stays finite even where their difference would overflow.
+func addToMean(mean, v float64, n int) float64 {
+	mean, _ = addClamped(mean, v/float64(n)-mean/float64(n))
+	return mean
+}
+
+// replaceInMean returns the mean of n values after one of them changed from old
+// to v, scaling both by 1/n like addToMean.
+func replaceInMean(mean, old, v float64, n int) float64 {
+	if n == 1 {
+		return v
+	}
+	mean, _ = addClamped(mean, v/float64(n)-old/float64(n))
+	return mean
+}
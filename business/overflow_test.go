@@ -0,0 +1,149 @@
+package business
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestAggregateClampsOverflow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		roles        map[string]NodeRole
+		updates      []NodeMeasurement
+		want         float64
+		wantOverflow bool
+	}{
+		{
+			name:    "large but finite",
+			updates: []NodeMeasurement{{Node: "A", Value: 1e307}, {Node: "B", Value: 1e307}},
+			want:    2e307,
+		},
+		{
+			name:         "positive overflow",
+			updates:      []NodeMeasurement{{Node: "A", Value: 1e308}, {Node: "B", Value: 1e308}, {Node: "C", Value: 1e308}},
+			want:         math.MaxFloat64,
+			wantOverflow: true,
+		},
+		{
+			name:         "negative overflow with sinks",
+			roles:        map[string]NodeRole{"A": RoleSink, "B": RoleSink},
+			updates:      []NodeMeasurement{{Node: "A", Value: 1e308}, {Node: "B", Value: 1e308}},
+			want:         -math.MaxFloat64,
+			wantOverflow: true,
+		},
+		{
+			name: "add mode accumulation stays finite",
+			updates: []NodeMeasurement{
+				{Node: "A", Value: 1e308},
+				{Node: "A", Value: 1e308, Mode: MeasurementAdd},
+				{Node: "A", Value: 1e308, Mode: MeasurementAdd},
+			},
+			want:         math.MaxFloat64,
+			wantOverflow: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			graph := NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}, {"B", "C"}})
+			graph.Roles = tt.roles
+			grid.update(GraphUpdate{Graph: graph})
+
+			var res MeasurementResult
+			for _, m := range tt.updates {
+				reply := make(chan MeasurementResult, 1)
+				grid.update(MeasurementUpdate{NodeMeasurement: m, Reply: reply})
+				res = <-reply
+			}
+
+			got := res.Totals[0]
+			if math.IsNaN(got.Total) || got.Total != tt.want || got.Overflow != tt.wantOverflow {
+				t.Fatalf("total = %v (overflow %v), want %v (overflow %v)", got.Total, got.Overflow, tt.want, tt.wantOverflow)
+			}
+		})
+	}
+}
+
+func TestMeasurementValueChecks(t *testing.T) {
+	t.Parallel()
+
+	for _, cached := range []bool{false, true} {
+		graph := NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})
+		graph.Transforms = map[string]Transform{"B": {Scale: 1e300}}
+		grid := NewGrid()
+		grid.update(GraphUpdate{Graph: graph})
+		if cached {
+			grid.currentTotals()
+		}
+
+		for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+			reply := make(chan MeasurementResult, 1)
+			grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: v}, Reply: reply})
+			if res := <-reply; res.Applied {
+				t.Fatalf("cached %v: measurement of %v applied, want it dropped", cached, v)
+			}
+		}
+		if d := grid.nodeDetail("A"); d.Measured {
+			t.Fatalf("cached %v: detail of A = %+v, want unmeasured", cached, d)
+		}
+
+		// B's transform takes a finite reading out of range.
+		reply := make(chan MeasurementResult, 1)
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: -1e10}, Reply: reply})
+		got := (<-reply).Totals[0]
+		if got.Total != -math.MaxFloat64 || got.Min != -math.MaxFloat64 || !got.Overflow {
+			t.Fatalf("cached %v: totals = %+v, want a clamped, flagged total", cached, got)
+		}
+
+		// Another value for B clears the flag.
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 1}, Reply: reply})
+		if got := (<-reply).Totals[0]; got.Overflow || got.Total != 1e300 {
+			t.Fatalf("cached %v: totals = %+v, want 1e300 without overflow", cached, got)
+		}
+	}
+}
+
+func TestAverageOfOppositeExtremesStaysFinite(t *testing.T) {
+	t.Parallel()
+
+	steps := []struct {
+		node string
+		want float64
+	}{
+		{node: "A", want: math.MaxFloat64},
+		{node: "B", want: 0},
+		// Replaces A's value: the incremental path scales before subtracting.
+		{node: "A", want: -math.MaxFloat64},
+	}
+	values := map[string][]float64{"A": {math.MaxFloat64, -math.MaxFloat64}, "B": {-math.MaxFloat64}}
+
+	for _, cached := range []bool{false, true} {
+		grid := NewGrid()
+		grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+		if cached {
+			grid.currentTotals()
+		}
+
+		seen := map[string]int{}
+		for _, step := range steps {
+			value := values[step.node][seen[step.node]]
+			seen[step.node]++
+			grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: step.node, Value: value}})
+
+			for _, totals := range [][]IslandMeasurement{grid.currentTotals(), aggregate(grid)} {
+				if got := totals[0].Average; got != step.want {
+					t.Fatalf("cached %v, after %s = %v: average = %v, want %v", cached, step.node, value, got, step.want)
+				}
+				if _, err := json.Marshal(totals); err != nil {
+					t.Fatalf("cached %v: marshal totals: %v", cached, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package business
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Partition is the islands of the current graph as reported by IslandsQuery.
+type Partition struct {
+	Islands [][]string
+	// Hash identifies Islands: it is the same for the same islands in the same
+	// order, whatever changes in between, and differs otherwise. Measurements
+	// do not change it.
+	Hash uint64
+}
+
+// islandsChanged records that the islands were replaced or edited.
+func (s *Grid) islandsChanged() {
+	s.islandCount.Store(int64(len(s.islands)))
+	s.partitionHashed = false
+}
+
+// partitionView returns the current islands and their hash, computing the hash
+// only once per change of the islands so repeated queries stay cheap.
+func (s *Grid) partitionView() Partition {
+	if !s.partitionHashed {
+		s.partitionHash = hashIslands(s.islands)
+		s.partitionHashed = true
+	}
+	return Partition{Islands: s.islands, Hash: s.partitionHash}
+}
+
+// hashIslands returns the FNV-1a hash of islands. Every island and name is
+// prefixed with its length, so no two lists of islands encode alike.
+func hashIslands(islands [][]string) uint64 {
+	h := fnv.New64a()
+	var buf [binary.MaxVarintLen64]byte
+	writeLen := func(n int) {
+		h.Write(buf[:binary.PutUvarint(buf[:], uint64(n))])
+	}
+	writeLen(len(islands))
+	for _, island := range islands {
+		writeLen(len(island))
+		for _, n := range island {
+			writeLen(len(n))
+			h.Write([]byte(n))
+		}
+	}
+	return h.Sum64()
+}
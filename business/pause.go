@@ -0,0 +1,52 @@
+package business
+
+import "errors"
+
+var (
+	// ErrPaused is returned for measurements received while processing is
+	// paused and no pause buffer is configured.
+	ErrPaused = errors.New("measurement processing is paused")
+
+	// ErrPauseBufferFull is returned for measurements received while paused once
+	// the pause buffer is full.
+	ErrPauseBufferFull = errors.New("measurement processing is paused and the buffer is full")
+
+	// ErrMeasurementsPending is returned for graph updates received while
+	// measurements are queued, under RejectGraphWhilePending.
+	ErrMeasurementsPending = errors.New("graph update rejected: measurements are queued")
+)
+
+// PauseStatus reports the state of measurement processing.
+type PauseStatus struct {
+	Paused   bool // measurements are not being applied
+	Buffered int  // measurements queued while paused
+	Drained  int  // measurements applied by the last resume
+}
+
+// hold queues m while paused, or returns the error to reply with.
+func (s *Grid) hold(m NodeMeasurement) error {
+	if s.pauseBuffer == 0 {
+		return ErrPaused
+	}
+	if len(s.pending) >= s.pauseBuffer {
+		return ErrPauseBufferFull
+	}
+	s.pending = append(s.pending, m)
+	return nil
+}
+
+// setPaused pauses or resumes measurement processing. Resuming applies the
+// queued measurements in arrival order against the current topology.
+func (s *Grid) setPaused(paused bool) PauseStatus {
+	drained := 0
+	if s.paused && !paused {
+		for _, m := range s.pending {
+			s.applyMeasurement(m)
+		}
+		drained = len(s.pending)
+		s.pending = nil
+	}
+	s.paused = paused
+
+	return PauseStatus{Paused: s.paused, Buffered: len(s.pending), Drained: drained}
+}
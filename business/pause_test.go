@@ -0,0 +1,161 @@
+package business
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGridPause(t *testing.T) {
+	t.Parallel()
+
+	graph := NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})
+
+	type step struct {
+		pause      *bool // toggles pause instead of sending a measurement
+		value      float64
+		wantErr    error
+		wantQueued bool
+		wantTotal  float64
+	}
+	pause, resume := true, false
+
+	tests := []struct {
+		name   string
+		buffer int
+		steps  []step
+	}{
+		{
+			name:   "rejects while paused without buffer",
+			buffer: 0,
+			steps: []step{
+				{value: 1, wantTotal: 1},
+				{pause: &pause},
+				{value: 5, wantErr: ErrPaused},
+				{pause: &resume},
+				{value: 2, wantTotal: 2},
+			},
+		},
+		{
+			name:   "buffers while paused and drains on resume",
+			buffer: 2,
+			steps: []step{
+				{value: 1, wantTotal: 1},
+				{pause: &pause},
+				{value: 5, wantQueued: true, wantTotal: 1},
+				{value: 7, wantQueued: true, wantTotal: 1},
+				{value: 9, wantErr: ErrPauseBufferFull},
+				{pause: &resume},
+				{value: 0, wantTotal: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grid := NewGrid(WithPauseBuffer(tt.buffer))
+			grid.update(GraphUpdate{Graph: graph})
+
+			for i, st := range tt.steps {
+				if st.pause != nil {
+					grid.update(PauseUpdate{Paused: *st.pause})
+					continue
+				}
+
+				reply := make(chan MeasurementResult, 1)
+				grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: st.value}, Reply: reply})
+				got := <-reply
+
+				if !errors.Is(got.Err, st.wantErr) {
+					t.Fatalf("step %d err = %v, want %v", i, got.Err, st.wantErr)
+				}
+				if got.Queued != st.wantQueued {
+					t.Fatalf("step %d queued = %v, want %v", i, got.Queued, st.wantQueued)
+				}
+				if st.wantErr == nil && got.Totals[0].Total != st.wantTotal {
+					t.Fatalf("step %d total = %v, want %v", i, got.Totals[0].Total, st.wantTotal)
+				}
+			}
+		})
+	}
+}
+
+func TestGridResumeAppliesBufferedInOrder(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithPauseBuffer(10))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil)})
+	grid.update(PauseUpdate{Paused: true})
+
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 3}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 2, Mode: MeasurementAdd}})
+
+	reply := make(chan PauseStatus, 1)
+	grid.update(PauseUpdate{Paused: false, Reply: reply})
+	if got := <-reply; got != (PauseStatus{Drained: 3}) {
+		t.Fatalf("resume status = %+v, want %+v", got, PauseStatus{Drained: 3})
+	}
+
+	totals := aggregate(grid)
+	if totals[0].Total != 3 || totals[1].Total != 2 {
+		t.Fatalf("totals after resume = %v, want [3 2]", totals)
+	}
+}
+
+func TestGraphUpdateWhileMeasurementsQueued(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		policy      GraphUpdatePolicy
+		wantErr     error
+		wantIslands [][]string
+		wantTotal   float64 // island of A after resume
+	}{
+		{
+			name:        "accepted by default",
+			policy:      AcceptGraphUpdates,
+			wantIslands: [][]string{{"A"}, {"B"}},
+			wantTotal:   5,
+		},
+		{
+			name:        "rejected while pending",
+			policy:      RejectGraphWhilePending,
+			wantErr:     ErrMeasurementsPending,
+			wantIslands: [][]string{{"A", "B"}},
+			wantTotal:   8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid(WithPauseBuffer(4), WithGraphUpdatePolicy(tt.policy))
+			grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+			grid.update(PauseUpdate{Paused: true})
+			grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 5}})
+			grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 3}})
+
+			reply := make(chan GraphResult, 1)
+			grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil), Reply: reply})
+			if got := <-reply; !errors.Is(got.Err, tt.wantErr) {
+				t.Fatalf("graph update err = %v, want %v", got.Err, tt.wantErr)
+			}
+			if !islandsEqual(grid.islands, tt.wantIslands) {
+				t.Fatalf("islands = %v, want %v", grid.islands, tt.wantIslands)
+			}
+
+			grid.update(PauseUpdate{Paused: false})
+			if got := aggregate(grid)[0].Total; got != tt.wantTotal {
+				t.Fatalf("total after resume = %v, want %v", got, tt.wantTotal)
+			}
+
+			// Once the queue is drained, graph updates are accepted again.
+			grid.update(GraphUpdate{Graph: NewGraph([]string{"A"}, nil), Reply: reply})
+			if got := <-reply; got.Err != nil {
+				t.Fatalf("graph update after resume err = %v, want nil", got.Err)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package business
+
+// IslandPeak is the current total of an island and the highest total it has
+// reached since the last reset.
+type IslandPeak struct {
+	Island []string
+	Total  float64
+	Peak   float64
+}
+
+// islandPeaks returns the current total and peak of every island.
+func islandPeaks(s *Grid) []IslandPeak {
+	totals := s.islandTotals()
+	res := make([]IslandPeak, len(totals))
+	for i, t := range totals {
+		res[i] = IslandPeak{Island: t.Island, Total: t.Total, Peak: s.peaks[i]}
+	}
+	return res
+}
+
+// updatePeak raises the peak of island to its current total.
+func (s *Grid) updatePeak(island int) {
+	if island < 0 || island >= len(s.peaks) {
+		return
+	}
+	s.peaks[island] = max(s.peaks[island], s.islandTotal(island))
+}
+
+// islandTotal returns the current total of island, netting sinks.
+func (s *Grid) islandTotal(island int) float64 {
+	return s.islandTotals()[island].Total
+}
+
+// remapPeaks recomputes the peaks after a topology update. An island whose
+// membership is unchanged keeps its peak; any other island is a new island and
+// starts from its current total. oldIslands and oldNodeToIsland describe the
+// topology before the update.
+func (s *Grid) remapPeaks(oldIslands [][]string, oldNodeToIsland []int, oldPeaks []float64) {
+	totals := s.islandTotals()
+	peaks := make([]float64, len(s.islands))
+	for i, island := range s.islands {
+		peaks[i] = totals[i].Total
+		if k := sameIsland(&s.nodes, island, oldIslands, oldNodeToIsland); k >= 0 && k < len(oldPeaks) {
+			peaks[i] = max(peaks[i], oldPeaks[k])
+		}
+	}
+	s.peaks = peaks
+}
+
+// sameIsland returns the index of the old island with exactly the members of
+// island, or -1 if there is none.
+func sameIsland(nodes *nodeTable, island []string, oldIslands [][]string, oldNodeToIsland []int) int {
+	k := -1
+	for _, n := range island {
+		id, _ := nodes.id(n)
+		if id >= len(oldNodeToIsland) || oldNodeToIsland[id] < 0 {
+			return -1
+		}
+		if k >= 0 && oldNodeToIsland[id] != k {
+			return -1
+		}
+		k = oldNodeToIsland[id]
+	}
+	// Every member was in island k; equal sizes mean k has no other members.
+	if k < 0 || k >= len(oldIslands) || len(oldIslands[k]) != len(island) {
+		return -1
+	}
+	return k
+}
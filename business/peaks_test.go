@@ -0,0 +1,58 @@
+package business
+
+import "testing"
+
+func TestIslandPeaks(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+
+	peaks := func() []IslandPeak {
+		reply := make(chan []IslandPeak, 1)
+		grid.update(IslandPeaksQuery{Reply: reply})
+		return <-reply
+	}
+	measure := func(node string, value float64) {
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: node, Value: value}})
+	}
+	check := func(step string, want []IslandPeak) {
+		t.Helper()
+		got := peaks()
+		if len(got) != len(want) {
+			t.Fatalf("%s: peaks = %+v, want %+v", step, got, want)
+		}
+		for i := range want {
+			if !islandsEqual([][]string{got[i].Island}, [][]string{want[i].Island}) || got[i].Total != want[i].Total || got[i].Peak != want[i].Peak {
+				t.Fatalf("%s: peaks = %+v, want %+v", step, got, want)
+			}
+		}
+	}
+
+	measure("A", 5)
+	measure("B", 3)
+	measure("A", 1)
+	measure("C", -2)
+	check("rise then fall", []IslandPeak{
+		{Island: []string{"A", "B"}, Total: 4, Peak: 8},
+		{Island: []string{"C"}, Total: -2, Peak: 0},
+	})
+
+	// Same islands in a different order: the peaks follow island identity.
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"C", "B", "A"}, [][]string{{"B", "A"}})})
+	check("unchanged islands reordered", []IslandPeak{
+		{Island: []string{"C"}, Total: -2, Peak: 0},
+		{Island: []string{"A", "B"}, Total: 4, Peak: 8},
+	})
+
+	// Merging creates a new island, which starts from its current total.
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}, {"B", "C"}})})
+	check("merged island", []IslandPeak{
+		{Island: []string{"A", "B", "C"}, Total: 2, Peak: 2},
+	})
+
+	grid.update(ClearMeasurements{})
+	check("after clear", []IslandPeak{
+		{Island: []string{"A", "B", "C"}, Total: 0, Peak: 0},
+	})
+}
@@ -0,0 +1,67 @@
+package business
+
+import "time"
+
+// Reading is a value stored for a node, as retained in its history.
+type Reading struct {
+	Value float64
+	At    time.Time // when the grid stored the value
+	Taken time.Time // when the producer took the value, zero if not reported
+}
+
+// readingRing is a bounded history of the values stored for a node: once full,
+// each new reading overwrites the oldest.
+type readingRing struct {
+	buf  []Reading
+	next int // slot overwritten by the next reading once buf is full
+}
+
+// push appends x, evicting the oldest reading when depth are already held.
+func (r *readingRing) push(x Reading, depth int) {
+	if len(r.buf) < depth {
+		r.buf = append(r.buf, x)
+		return
+	}
+	r.buf[r.next] = x
+	r.next = (r.next + 1) % len(r.buf)
+}
+
+// ordered returns a copy of the readings, oldest first.
+func (r *readingRing) ordered() []Reading {
+	out := make([]Reading, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+// recordReading appends rd to the history of the node with the given ID.
+// With a depth of 1 nothing is kept besides the latest measurement, which
+// already is the whole history.
+func (s *Grid) recordReading(id int, rd Reading) {
+	if s.readingDepth <= 1 {
+		return
+	}
+	if n := s.nodes.len(); n > len(s.readings) {
+		s.readings = append(s.readings, make([]readingRing, n-len(s.readings))...)
+	}
+	s.readings[id].push(rd, s.readingDepth)
+}
+
+// nodeHistory returns the retained readings of node, oldest first.
+func (s *Grid) nodeHistory(node string) NodeHistory {
+	h := NodeHistory{Node: node, Readings: []Reading{}}
+	id, ok := s.nodes.id(node)
+	if !ok {
+		return h
+	}
+	h.InGraph = s.graph.has(id)
+	switch {
+	case s.readingDepth > 1:
+		if id < len(s.readings) {
+			h.Readings = s.readings[id].ordered()
+		}
+	case id < len(s.measurements) && s.measurements[id].ok:
+		m := s.measurements[id]
+		h.Readings = []Reading{{Value: m.value, At: m.at, Taken: m.taken}}
+	}
+	return h
+}
@@ -0,0 +1,121 @@
+package business
+
+import (
+	"slices"
+	"testing"
+)
+
+// readingValues returns the values of the history of node.
+func readingValues(t *testing.T, grid *Grid, node string) (values []float64, inGraph bool) {
+	t.Helper()
+
+	reply := make(chan NodeHistory, 1)
+	grid.update(NodeHistoryQuery{Node: node, Reply: reply})
+	h := <-reply
+	for _, r := range h.Readings {
+		values = append(values, r.Value)
+	}
+	return values, h.InGraph
+}
+
+func TestMeasurementHistory(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		opts   []GridOption
+		values []float64
+		want   []float64
+	}{
+		{name: "default keeps the latest", values: []float64{1, 2, 3}, want: []float64{3}},
+		{name: "not measured", opts: []GridOption{WithMeasurementHistory(3)}},
+		{name: "partly filled", opts: []GridOption{WithMeasurementHistory(3)}, values: []float64{1, 2}, want: []float64{1, 2}},
+		{name: "exactly full", opts: []GridOption{WithMeasurementHistory(3)}, values: []float64{1, 2, 3}, want: []float64{1, 2, 3}},
+		{name: "oldest evicted", opts: []GridOption{WithMeasurementHistory(3)}, values: []float64{1, 2, 3, 4, 5}, want: []float64{3, 4, 5}},
+		{name: "depth below 1", opts: []GridOption{WithMeasurementHistory(0)}, values: []float64{1, 2}, want: []float64{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid(tt.opts...)
+			grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+			for _, v := range tt.values {
+				grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: v}})
+			}
+
+			got, inGraph := readingValues(t, grid, "A")
+			if !slices.Equal(got, tt.want) || !inGraph {
+				t.Fatalf("history = %v (in graph %v), want %v (in graph true)", got, inGraph, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeasurementHistoryStoresAppliedValues(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithMeasurementHistory(4))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A"}, nil)})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2, Mode: MeasurementAdd}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "Z", Value: 9}})
+
+	if got, _ := readingValues(t, grid, "A"); !slices.Equal(got, []float64{1, 3}) {
+		t.Fatalf("history = %v, want [1 3]", got)
+	}
+	if got, inGraph := readingValues(t, grid, "Z"); len(got) != 0 || inGraph {
+		t.Fatalf("history of an unknown node = %v (in graph %v), want none", got, inGraph)
+	}
+}
+
+func TestMeasurementHistoryDroppedWithNode(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithMeasurementHistory(3))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}})
+	grid.update(NodeRemove{Node: "A"})
+
+	if got, inGraph := readingValues(t, grid, "A"); len(got) != 0 || inGraph {
+		t.Fatalf("history after removal = %v (in graph %v), want none", got, inGraph)
+	}
+
+	// A node added back starts a new history.
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 5}})
+	if got, _ := readingValues(t, grid, "A"); !slices.Equal(got, []float64{5}) {
+		t.Fatalf("history after adding the node back = %v, want [5]", got)
+	}
+}
+
+func TestMeasurementHistoryNotAggregated(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithMeasurementHistory(3))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+	for _, v := range []float64{1, 2, 4} {
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: v}})
+	}
+	if totals := grid.currentTotals(); len(totals) != 1 || totals[0].Total != 4 {
+		t.Fatalf("totals = %+v, want the latest value 4 only", totals)
+	}
+
+	// A above is dropped from the graph: its history is kept but no longer
+	// counts toward any island.
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"B"}, nil)})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 10}})
+	if totals := grid.currentTotals(); len(totals) != 1 || totals[0].Total != 10 {
+		t.Fatalf("totals = %+v, want 10", totals)
+	}
+	if got, inGraph := readingValues(t, grid, "A"); !slices.Equal(got, []float64{1, 2, 4}) || inGraph {
+		t.Fatalf("history of the absent node = %v (in graph %v), want [1 2 4] outside the graph", got, inGraph)
+	}
+
+	grid.update(ClearMeasurements{})
+	if got, _ := readingValues(t, grid, "A"); len(got) != 0 {
+		t.Fatalf("history after clearing = %v, want none", got)
+	}
+}
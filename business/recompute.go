@@ -0,0 +1,114 @@
+package business
+
+import (
+	"context"
+	"time"
+)
+
+// cancelCheckInterval is how many nodes computeIslandsCtx visits between checks
+// of its context.
+const cancelCheckInterval = 1024
+
+// islandsFunc computes the islands of a topology; see computeIslandsCtx.
+type islandsFunc func(ctx context.Context, g topology, nodes *nodeTable) ([][]string, []int, error)
+
+// recomputeResult carries the islands of a topology that exceeded the recompute
+// budget, computed in the background. It is processed by the loop like an event.
+type recomputeResult struct {
+	version      int // graphVersion the topology was posted as
+	graph        topology
+	islands      [][]string
+	nodeToIsland []int
+}
+
+// updateTopology replaces the current graph. A graph differing from it in a few
+// edges only is applied incrementally; see graphDelta. Otherwise, with a
+// recompute budget, a graph whose islands take longer than the budget to
+// compute is not applied: the previous topology is kept, the reply is flagged
+// Degraded, and the islands are computed in the background and applied once
+// ready.
+func (s *Grid) updateTopology(g topology) GraphResult {
+	s.graphVersion++
+	s.cancelRecompute()
+
+	// A graph re-posted with a few edges changed is edited in place.
+	if d, ok := s.graphDelta(g); ok {
+		s.applyGraphDelta(g, d)
+		return GraphResult{Islands: s.islands}
+	}
+
+	ctx := context.Background()
+	if s.recomputeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.recomputeBudget)
+		defer cancel()
+	}
+
+	start := time.Now()
+	islands, nodeToIsland, err := s.islandsFuncFor(g)(ctx, g, &s.nodes)
+	if err != nil {
+		s.logger.Warn("island recompute exceeded budget, keeping previous islands",
+			"budget", s.recomputeBudget, "elapsed", time.Since(start), "nodes", len(g.order))
+		s.recomputeInBackground(g)
+		return GraphResult{Islands: s.islands, Degraded: true}
+	}
+
+	s.applyTopology(g, islands, nodeToIsland)
+	return GraphResult{Islands: s.islands}
+}
+
+// recomputeInBackground computes the islands of g off the loop and hands them
+// back through s.recomputed. It is cancelled by a newer graph update.
+func (s *Grid) recomputeInBackground(g topology) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.recomputeCancel = cancel
+
+	version := s.graphVersion
+	// Names are appended past the copied length, and a released slot is only
+	// overwritten in a copy of the slice while shared is set, so a copy of the
+	// slice header is a stable snapshot; the loop keeps interning meanwhile.
+	nodes := nodeTable{names: s.nodes.names[:s.nodes.len():s.nodes.len()]}
+	s.nodes.shared = true
+	compute, results := s.islandsFuncFor(g), s.recomputed
+
+	go func() {
+		islands, nodeToIsland, err := compute(ctx, g, &nodes)
+		if err != nil {
+			return
+		}
+		select {
+		case results <- recomputeResult{version: version, graph: g, islands: islands, nodeToIsland: nodeToIsland}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// rebuildIslands recomputes the islands of the current graph and re-derives the
+// state keyed by island (peaks and the island count) from them. It ignores the
+// recompute budget, and leaves a pending background recompute of a newer graph
+// in place.
+func (s *Grid) rebuildIslands() {
+	islands, nodeToIsland, _ := s.islandsFuncFor(s.graph)(context.Background(), s.graph, &s.nodes)
+	s.applyTopology(s.graph, islands, nodeToIsland)
+}
+
+// cancelRecompute stops a pending background recompute, if any.
+func (s *Grid) cancelRecompute() {
+	if s.recomputeCancel != nil {
+		s.recomputeCancel()
+		s.recomputeCancel = nil
+	}
+}
+
+// applyRecompute applies the islands computed in the background, unless a newer
+// graph update has superseded them.
+func (s *Grid) applyRecompute(r recomputeResult) {
+	if r.version != s.graphVersion {
+		return
+	}
+	s.recomputeCancel = nil
+	s.applyTopology(r.graph, r.islands, r.nodeToIsland)
+	s.commit()
+	s.logger.Info("island recompute completed in background", "islands", len(s.islands))
+	s.publish(allIslands, true)
+}
@@ -0,0 +1,136 @@
+package business
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecomputeBudgetDegradesThenConverges(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	grid := NewGrid(WithRecomputeBudget(10 * time.Millisecond))
+	// Graphs with a node named "slow" take longer than the budget.
+	grid.compute = func(ctx context.Context, g topology, nodes *nodeTable) ([][]string, []int, error) {
+		for _, id := range g.order {
+			if nodes.names[id] != "slow" {
+				continue
+			}
+			select {
+			case <-time.After(50 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+		return computeIslandsCtx(ctx, g, nodes)
+	}
+
+	events := make(chan Event, 8)
+	go grid.Loop(ctx, events)
+
+	reply := make(chan GraphResult, 1)
+	events <- GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}}), Reply: reply}
+	if got := <-reply; got.Degraded || !islandsEqual(got.Islands, [][]string{{"A", "B"}}) {
+		t.Fatalf("fast graph = %+v, want islands [[A B]] computed in budget", got)
+	}
+
+	events <- GraphUpdate{Graph: NewGraph([]string{"A", "B", "slow"}, [][]string{{"B", "slow"}}), Reply: reply}
+	got := <-reply
+	if !got.Degraded || !islandsEqual(got.Islands, [][]string{{"A", "B"}}) {
+		t.Fatalf("slow graph = %+v, want the previous islands flagged degraded", got)
+	}
+
+	// The previous topology stays in effect until the background compute lands.
+	want := [][]string{{"A"}, {"B", "slow"}}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		peaks := make(chan []IslandPeak, 1)
+		events <- IslandPeaksQuery{Reply: peaks}
+		var islands [][]string
+		for _, p := range <-peaks {
+			islands = append(islands, p.Island)
+		}
+		if islandsEqual(islands, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("islands = %v, want eventual convergence to %v", islands, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRecomputeSupersededByNewerGraph(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithRecomputeBudget(time.Millisecond))
+	release := make(chan struct{})
+	grid.compute = func(ctx context.Context, g topology, nodes *nodeTable) ([][]string, []int, error) {
+		if len(g.order) > 1 {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+		return computeIslandsCtx(ctx, g, nodes)
+	}
+
+	reply := make(chan GraphResult, 1)
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil), Reply: reply})
+	if got := <-reply; !got.Degraded {
+		t.Fatalf("slow graph = %+v, want degraded", got)
+	}
+	stale := grid.graphVersion
+
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"C"}, nil), Reply: reply})
+	if got := <-reply; got.Degraded || !islandsEqual(got.Islands, [][]string{{"C"}}) {
+		t.Fatalf("fast graph = %+v, want [[C]]", got)
+	}
+
+	// A late background result for the older graph must not be applied.
+	grid.applyRecompute(recomputeResult{version: stale, graph: grid.graph, islands: [][]string{{"A"}, {"B"}}})
+	if !islandsEqual(grid.islands, [][]string{{"C"}}) {
+		t.Fatalf("islands = %v after stale recompute, want [[C]]", grid.islands)
+	}
+	close(release)
+}
+
+func TestRecomputeIslandsMatchesCurrentState(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	graph := make(chan GraphResult, 1)
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C", "D"}, [][]string{{"A", "B"}, {"C", "D"}}), Reply: graph})
+	want := (<-graph).Islands
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 4}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "C", Value: 1}})
+	wantTotals := aggregate(grid)
+	wantPeaks := append([]float64(nil), grid.peaks...)
+
+	reply := make(chan [][]string, 1)
+	grid.update(RecomputeIslands{Reply: reply})
+
+	if got := <-reply; !islandsEqual(got, want) {
+		t.Fatalf("recomputed islands = %v, want %v", got, want)
+	}
+	if got := aggregate(grid); !totalsEqual(got, wantTotals) {
+		t.Fatalf("totals after recompute = %v, want %v", got, wantTotals)
+	}
+	for i, p := range wantPeaks {
+		if grid.peaks[i] != p {
+			t.Fatalf("peaks after recompute = %v, want %v", grid.peaks, wantPeaks)
+		}
+	}
+
+	// A desynced island index is repaired.
+	grid.nodeToIsland[0], grid.nodeToIsland[2] = grid.nodeToIsland[2], grid.nodeToIsland[0]
+	grid.update(RecomputeIslands{Reply: reply})
+	<-reply
+	if got := aggregate(grid); !totalsEqual(got, wantTotals) {
+		t.Fatalf("totals after repair = %v, want %v", got, wantTotals)
+	}
+}
@@ -0,0 +1,11 @@
+package business
+
+// reset returns the grid to the state of a new one: no graph, islands,
+// measurements or queued measurements. Interned node IDs are kept, as they are
+// stable for the grid lifetime, and the state version keeps advancing.
+func (s *Grid) reset() {
+	clear(s.measurements)
+	clear(s.readings)
+	s.pending = nil
+	s.applyGraph(Graph{})
+}
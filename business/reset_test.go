@@ -0,0 +1,49 @@
+package business
+
+import "testing"
+
+func TestResetEvent(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid(WithPauseBuffer(4), WithMeasurementHistory(2))
+	graph := NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})
+	graph.Aliases = map[string]string{"alpha": "A"}
+	grid.update(GraphUpdate{Graph: graph})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "C", Value: 3}})
+	grid.update(PauseUpdate{Paused: true})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 4}})
+
+	version := grid.version
+	reply := make(chan struct{}, 1)
+	grid.update(ResetEvent{Reply: reply})
+	<-reply
+
+	if len(grid.islands) != 0 || grid.IslandCount() != 0 || len(grid.currentTotals()) != 0 {
+		t.Fatalf("after reset: islands = %v, totals = %v, want none", grid.islands, grid.currentTotals())
+	}
+	if grid.version != version+1 {
+		t.Fatalf("version after reset = %d, want %d", grid.version, version+1)
+	}
+	if len(grid.pending) != 0 {
+		t.Fatalf("pending after reset = %v, want none", grid.pending)
+	}
+	checkAgainstRebuild(t, grid, "after reset")
+
+	// The same nodes posted again start without their old values, aliases or
+	// history, and the queued measurement is not applied on resume.
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+	grid.update(PauseUpdate{Paused: false})
+	for _, total := range grid.currentTotals() {
+		if total.Total != 0 || total.MeasuredCount != 0 {
+			t.Fatalf("totals after reposting the graph = %+v, want no measurements", grid.currentTotals())
+		}
+	}
+	if got, _ := readingValues(t, grid, "A"); len(got) != 0 {
+		t.Fatalf("history of A = %v, want none", got)
+	}
+	if got := grid.resolveAlias("alpha"); got != "alpha" {
+		t.Fatalf("alias resolves to %q after reset, want it gone", got)
+	}
+	checkAgainstRebuild(t, grid, "after reposting the graph")
+}
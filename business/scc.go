@@ -0,0 +1,114 @@
+package business
+
+import "context"
+
+// islandsFuncFor returns how the islands of g are computed: as strongly
+// connected components for a directed graph, with s.compute otherwise.
+func (s *Grid) islandsFuncFor(g topology) islandsFunc {
+	if g.directed {
+		return computeSCC
+	}
+	return s.compute
+}
+
+// computeSCC returns the strongly connected components of a directed topology:
+// sets of nodes that can all reach each other along the edge directions. It
+// runs Tarjan's algorithm with an explicit stack, so long paths cannot exhaust
+// the goroutine stack. Like computeIslands, islands are ordered by their first
+// node in graph order.
+func computeSCC(ctx context.Context, g topology, nodes *nodeTable) ([][]string, []int, error) {
+	n := nodes.len()
+	index := make([]int, n) // discovery index + 1, 0 while unvisited
+	low := make([]int, n)
+	onStack := make([]bool, n)
+	component := make([]int, n)
+	var stack []int
+
+	type frame struct {
+		v    int
+		next int // next neighbor of v to visit
+	}
+	var calls []frame
+	visited, components := 0, 0
+	visit := func(v int) {
+		visited++
+		index[v], low[v] = visited, visited
+		stack = append(stack, v)
+		onStack[v] = true
+		calls = append(calls, frame{v: v})
+	}
+
+	for _, root := range g.order {
+		if index[root] != 0 {
+			continue
+		}
+		visit(root)
+
+		for len(calls) > 0 {
+			f := &calls[len(calls)-1]
+			v := f.v
+			if f.next < len(g.adj[v]) {
+				w := g.adj[v][f.next]
+				f.next++
+				switch {
+				case index[w] == 0:
+					// Checking the context on every node would dominate small graphs.
+					if visited%cancelCheckInterval == 0 && ctx.Err() != nil {
+						return nil, nil, ctx.Err()
+					}
+					visit(w)
+				case onStack[w]:
+					low[v] = min(low[v], index[w])
+				}
+				continue
+			}
+
+			calls = calls[:len(calls)-1]
+			if len(calls) > 0 {
+				parent := calls[len(calls)-1].v
+				low[parent] = min(low[parent], low[v])
+			}
+			// v is the root of a component: everything above it on the stack
+			// belongs to it.
+			if low[v] == index[v] {
+				for {
+					w := stack[len(stack)-1]
+					stack = stack[:len(stack)-1]
+					onStack[w] = false
+					component[w] = components
+					if w == v {
+						break
+					}
+				}
+				components++
+			}
+		}
+	}
+
+	// Tarjan emits components in reverse topological order; renumber them by
+	// first node in graph order instead.
+	nodeToIsland := make([]int, n)
+	for i := range nodeToIsland {
+		nodeToIsland[i] = -1
+	}
+	componentIsland := make([]int, components)
+	for i := range componentIsland {
+		componentIsland[i] = -1
+	}
+	var islands [][]string
+	for _, id := range g.order {
+		if nodeToIsland[id] >= 0 {
+			continue // duplicate node
+		}
+		c := component[id]
+		if componentIsland[c] < 0 {
+			componentIsland[c] = len(islands)
+			islands = append(islands, nil)
+		}
+		island := componentIsland[c]
+		islands[island] = append(islands[island], nodes.names[id])
+		nodeToIsland[id] = island
+	}
+
+	return islands, nodeToIsland, nil
+}
@@ -0,0 +1,203 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestComputeSCC(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		nodes []string
+		edges [][]string
+		want  [][]string
+	}{
+		{name: "empty graph"},
+		{
+			name:  "chain is one island per node",
+			nodes: []string{"A", "B", "C"},
+			edges: [][]string{{"A", "B"}, {"B", "C"}},
+			want:  [][]string{{"A"}, {"B"}, {"C"}},
+		},
+		{
+			name:  "cycle with a downstream node",
+			nodes: []string{"A", "B", "C", "D"},
+			edges: [][]string{{"A", "B"}, {"B", "C"}, {"C", "A"}, {"C", "D"}},
+			want:  [][]string{{"A", "B", "C"}, {"D"}},
+		},
+		{
+			name:  "two cycles linked one way",
+			nodes: []string{"A", "B", "C", "D"},
+			edges: [][]string{{"A", "B"}, {"B", "A"}, {"B", "C"}, {"C", "D"}, {"D", "C"}},
+			want:  [][]string{{"A", "B"}, {"C", "D"}},
+		},
+		{
+			name:  "members in graph order",
+			nodes: []string{"D", "B", "A", "C"},
+			edges: [][]string{{"A", "B"}, {"B", "C"}, {"C", "D"}, {"D", "A"}},
+			want:  [][]string{{"D", "B", "A", "C"}},
+		},
+		{
+			name:  "self-loops, duplicates and edges outside the graph",
+			nodes: []string{"A", "A", "B"},
+			edges: [][]string{{"A", "A"}, {"B", "X"}},
+			want:  [][]string{{"A"}, {"B"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			nodes := newNodeTable()
+			g := nodes.internGraph(NewDirectedGraph(tt.nodes, tt.edges))
+			got, nodeToIsland, err := computeSCC(context.Background(), g, &nodes)
+			if err != nil {
+				t.Fatalf("computeSCC: %v", err)
+			}
+			if !islandsEqual(got, tt.want) {
+				t.Fatalf("islands = %v, want %v", got, tt.want)
+			}
+			for i, island := range got {
+				for _, n := range island {
+					if id, _ := nodes.id(n); nodeToIsland[id] != i {
+						t.Errorf("node %s maps to island %d, listed in %d", n, nodeToIsland[id], i)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestComputeSCCRandomAgainstReachability checks computeSCC against the
+// definition: two nodes share an island exactly when each reaches the other.
+func TestComputeSCCRandomAgainstReachability(t *testing.T) {
+	t.Parallel()
+
+	for seed := range uint64(20) {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			t.Parallel()
+
+			rng := rand.New(rand.NewPCG(seed, seed))
+			const nodeCount = 25
+			names := make([]string, nodeCount)
+			for i := range names {
+				names[i] = fmt.Sprintf("n%02d", i)
+			}
+			var edges [][]string
+			for range nodeCount + rng.IntN(nodeCount) {
+				edges = append(edges, []string{names[rng.IntN(nodeCount)], names[rng.IntN(nodeCount)]})
+			}
+
+			nodes := newNodeTable()
+			g := nodes.internGraph(NewDirectedGraph(names, edges))
+			_, nodeToIsland, _ := computeSCC(context.Background(), g, &nodes)
+
+			reach := make([][]bool, nodeCount)
+			for a := range reach {
+				reach[a] = make([]bool, nodeCount)
+				stack := []int{a}
+				reach[a][a] = true
+				for len(stack) > 0 {
+					v := stack[len(stack)-1]
+					stack = stack[:len(stack)-1]
+					for _, w := range g.adj[v] {
+						if !reach[a][w] {
+							reach[a][w] = true
+							stack = append(stack, w)
+						}
+					}
+				}
+			}
+			for a := range nodeCount {
+				for b := range nodeCount {
+					if same, want := nodeToIsland[a] == nodeToIsland[b], reach[a][b] && reach[b][a]; same != want {
+						t.Fatalf("%s and %s share an island: %v, want %v", names[a], names[b], same, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestComputeSCCDeepChainDoesNotOverflow(t *testing.T) {
+	t.Parallel()
+
+	// A single cycle through every node would need a deep recursion.
+	const nodeCount = 200_000
+	names := make([]string, nodeCount)
+	edges := make([][]string, nodeCount)
+	for i := range names {
+		names[i] = fmt.Sprintf("n%d", i)
+	}
+	for i := range names {
+		edges[i] = []string{names[i], names[(i+1)%nodeCount]}
+	}
+
+	nodes := newNodeTable()
+	g := nodes.internGraph(NewDirectedGraph(names, edges))
+	islands, _, _ := computeSCC(context.Background(), g, &nodes)
+	if len(islands) != 1 || len(islands[0]) != nodeCount {
+		t.Fatalf("got %d islands, want a single one of %d nodes", len(islands), nodeCount)
+	}
+}
+
+func TestDirectedGraphOnGrid(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	reply := make(chan GraphResult, 1)
+	graph := NewDirectedGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}, {"B", "A"}, {"B", "C"}})
+	grid.update(GraphUpdate{Graph: graph, Reply: reply})
+	if got, want := (<-reply).Islands, [][]string{{"A", "B"}, {"C"}}; !islandsEqual(got, want) {
+		t.Fatalf("islands = %v, want %v", got, want)
+	}
+
+	// Closing the cycle through C merges it. The edit is one-way: A->C is absent.
+	grid.update(EdgeEdit{Add: [][]string{{"C", "A"}}, Reply: reply})
+	if got, want := (<-reply).Islands, [][]string{{"A", "B", "C"}}; !islandsEqual(got, want) {
+		t.Fatalf("after adding C->A: islands = %v, want %v", got, want)
+	}
+	grid.update(EdgeEdit{Remove: [][]string{{"A", "C"}}, Reply: reply})
+	if got, want := (<-reply).Islands, [][]string{{"A", "B", "C"}}; !islandsEqual(got, want) {
+		t.Fatalf("after removing the missing A->C: islands = %v, want %v", got, want)
+	}
+
+	edges := make(chan [][]string, 1)
+	grid.update(EdgesQuery{Reply: edges})
+	if got, want := <-edges, [][]string{{"A", "B"}, {"B", "A"}, {"B", "C"}, {"C", "A"}}; !islandsEqual(got, want) {
+		t.Errorf("edges = %v, want %v", got, want)
+	}
+
+	// Without B->C nothing leads to C anymore, so it splits off.
+	cut := make(chan EdgeCut, 1)
+	grid.update(EdgeCutQuery{From: "C", To: "B", Reply: cut})
+	if got := <-cut; !got.Found || !got.Split || !islandsEqual(got.Islands, [][]string{{"A", "B"}, {"C"}}) {
+		t.Errorf("cut C-B = %+v, want a split into [A B] and [C]", got)
+	}
+	grid.update(EdgeCutQuery{From: "A", To: "B", Reply: cut})
+	if got := <-cut; !got.Found || !got.Split {
+		t.Errorf("cut A-B = %+v, want a split", got)
+	}
+}
+
+func TestDirectedIslandMetricsStayInIsland(t *testing.T) {
+	t.Parallel()
+
+	// B leads to C, but C cannot come back: C is its own island.
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewDirectedGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}, {"B", "A"}, {"B", "C"}})})
+
+	density := graphDensity(grid)
+	if density.Edges != 1 || density.Islands[0].Edges != 1 || density.Islands[1].Edges != 0 {
+		t.Errorf("density = %+v, want a single edge between A and B", density)
+	}
+	metrics := islandMetrics(grid)
+	if metrics[0].Edges != 1 || metrics[0].Diameter != 1 || metrics[1].Diameter != 0 {
+		t.Errorf("metrics = %+v, want the edge and diameter 1 of [A B] only", metrics)
+	}
+}
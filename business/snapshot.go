@@ -0,0 +1,204 @@
+package business
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SnapshotVersion is the version of the format written by Snapshot. Restore
+// reads snapshots of this version and every earlier one.
+const SnapshotVersion = 1
+
+var (
+	// ErrInvalidSnapshot is returned, wrapped, by Restore for data that is not
+	// a snapshot.
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+	// ErrSnapshotVersion is returned, wrapped, by Restore for a snapshot
+	// written by a newer format version.
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+)
+
+// snapshot is the JSON form of the grid state. Fields may be added in later
+// versions; existing ones keep their meaning.
+type snapshot struct {
+	Version      int                          `json:"version"`
+	Directed     bool                         `json:"directed,omitempty"`
+	Nodes        []string                     `json:"nodes"`
+	Edges        []snapshotEdge               `json:"edges"`
+	Sinks        []string                     `json:"sinks,omitempty"`
+	Transforms   map[string]snapshotTransform `json:"transforms,omitempty"`
+	Aliases      map[string]string            `json:"aliases,omitempty"`
+	Measurements []snapshotMeasurement        `json:"measurements"`
+}
+
+// snapshotEdge is an edge of the graph.
+type snapshotEdge struct {
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Weight *float64 `json:"weight,omitempty"` // omitted on graphs without weights
+}
+
+// snapshotTransform is the JSON form of a Transform.
+type snapshotTransform struct {
+	Scale  float64 `json:"scale"`
+	Offset float64 `json:"offset"`
+}
+
+// snapshotMeasurement is the stored measurement of a node, which need not be
+// in the graph: measurements of nodes dropped by a graph update are retained.
+type snapshotMeasurement struct {
+	Node   string    `json:"node"`
+	Value  float64   `json:"value"`
+	Source string    `json:"source,omitempty"`
+	At     time.Time `json:"at"`
+	Taken  time.Time `json:"taken,omitzero"`
+}
+
+// Snapshot serializes the graph and the stored measurements as versioned JSON,
+// which Restore reads back. Like the rest of Grid it must not be called while
+// Loop runs; send a SnapshotQuery then.
+func (s *Grid) Snapshot() ([]byte, error) {
+	names := s.nodes.names
+	snap := snapshot{
+		Version:      SnapshotVersion,
+		Directed:     s.graph.directed,
+		Nodes:        make([]string, len(s.graph.order)),
+		Edges:        []snapshotEdge{},
+		Measurements: []snapshotMeasurement{},
+	}
+
+	for i, id := range s.graph.order {
+		snap.Nodes[i] = names[id]
+		if s.graph.sign(id) < 0 {
+			snap.Sinks = append(snap.Sinks, names[id])
+		}
+		for k, nei := range s.graph.adj[id] {
+			// An undirected edge is held by both of its endpoints: it is
+			// listed once. BuildGraph drops self-loops.
+			if !s.graph.directed && names[nei] < names[id] {
+				continue
+			}
+			e := snapshotEdge{From: names[id], To: names[nei]}
+			if s.graph.weights != nil {
+				w := s.graph.weight(id, k)
+				e.Weight = &w
+			}
+			snap.Edges = append(snap.Edges, e)
+		}
+	}
+
+	for id, t := range s.graph.transforms {
+		if snap.Transforms == nil {
+			snap.Transforms = make(map[string]snapshotTransform, len(s.graph.transforms))
+		}
+		snap.Transforms[names[id]] = snapshotTransform{Scale: t.Scale, Offset: t.Offset}
+	}
+	for alias, id := range s.graph.aliases {
+		if snap.Aliases == nil {
+			snap.Aliases = make(map[string]string, len(s.graph.aliases))
+		}
+		snap.Aliases[alias] = names[id]
+	}
+
+	for id, m := range s.measurements {
+		if m.ok {
+			snap.Measurements = append(snap.Measurements, snapshotMeasurement{Node: names[id], Value: m.value, Source: m.source, At: m.at, Taken: m.taken})
+		}
+	}
+	// Node IDs are reused, so their order says nothing about the nodes.
+	slices.SortFunc(snap.Measurements, func(x, y snapshotMeasurement) int {
+		return cmp.Compare(x.Node, y.Node)
+	})
+
+	return json.Marshal(snap)
+}
+
+// Restore replaces the state of the grid with the one serialized by Snapshot
+// and recomputes the islands, ignoring the recompute budget. Invalid data
+// leaves the state unchanged. Like the rest of Grid it must not be called
+// while Loop runs; send a RestoreSnapshot then.
+func (s *Grid) Restore(data []byte) error {
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+	switch {
+	case snap.Version > SnapshotVersion:
+		return fmt.Errorf("%w: %d, want at most %d", ErrSnapshotVersion, snap.Version, SnapshotVersion)
+	case snap.Version < 1:
+		return fmt.Errorf("%w: missing version", ErrInvalidSnapshot)
+	}
+
+	s.reset()
+	s.applyGraph(snap.graph())
+	for _, m := range snap.Measurements {
+		s.restoreMeasurement(m)
+	}
+	s.remapPeaks(nil, nil, nil)
+	s.commit()
+	return nil
+}
+
+// applyGraph replaces the current graph with g, computing its islands in full
+// whatever the recompute budget.
+func (s *Grid) applyGraph(g Graph) {
+	s.graphVersion++
+	s.cancelRecompute()
+	topology := s.nodes.internGraph(g)
+	islands, nodeToIsland, _ := s.islandsFuncFor(topology)(context.Background(), topology, &s.nodes)
+	s.applyTopology(topology, islands, nodeToIsland)
+}
+
+// restoreMeasurement stores m as it was serialized, without applying a
+// transform or recording it anew.
+func (s *Grid) restoreMeasurement(m snapshotMeasurement) {
+	id, _ := s.nodes.intern(m.Node)
+	s.growMeasurements()
+	stored := measurement{value: m.Value, ok: true, source: m.Source, at: m.At, taken: m.Taken}
+	if s.ttl > 0 {
+		stored.expires = m.At.Add(s.ttl)
+	}
+	s.measurements[id] = stored
+	s.recordReading(id, Reading{Value: m.Value, At: m.At, Taken: m.Taken})
+	s.noteExpiry(stored)
+	s.totals = nil
+}
+
+// graph returns the graph described by snap.
+func (snap snapshot) graph() Graph {
+	edges := make([][]string, len(snap.Edges))
+	for i, e := range snap.Edges {
+		edges[i] = []string{e.From, e.To}
+	}
+	g := newGraph(snap.Nodes, edges, snap.Directed)
+
+	for _, e := range snap.Edges {
+		if e.Weight == nil {
+			continue
+		}
+		if g.Weights == nil {
+			g.Weights = make(map[[2]string]float64)
+		}
+		g.Weights[[2]string{e.From, e.To}] = *e.Weight
+	}
+	if len(snap.Sinks) > 0 {
+		g.Roles = make(map[string]NodeRole, len(snap.Sinks))
+		for _, n := range snap.Sinks {
+			g.Roles[n] = RoleSink
+		}
+	}
+	if len(snap.Transforms) > 0 {
+		g.Transforms = make(map[string]Transform, len(snap.Transforms))
+		for n, t := range snap.Transforms {
+			g.Transforms[n] = Transform{Scale: t.Scale, Offset: t.Offset}
+		}
+	}
+	g.Aliases = snap.Aliases
+	return g
+}
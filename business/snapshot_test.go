@@ -0,0 +1,151 @@
+package business
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	weighted := NewGraph([]string{"A", "B", "C", "D"}, [][]string{{"A", "B"}, {"B", "A"}, {"C", "C"}, {"B", "C"}})
+	weighted.Weights = map[[2]string]float64{{"B", "A"}: 2.5, {"C", "C"}: 4}
+
+	decorated := NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})
+	decorated.Roles = map[string]NodeRole{"B": RoleSink}
+	decorated.Transforms = map[string]Transform{"C": {Scale: 2, Offset: 1}}
+	decorated.Aliases = map[string]string{"legacy-a": "A"}
+
+	tests := []struct {
+		name  string
+		graph Graph
+	}{
+		{name: "empty", graph: NewGraph(nil, nil)},
+		{name: "parallel edges, self-loops and weights", graph: weighted},
+		{name: "sinks, transforms and aliases", graph: decorated},
+		{name: "directed", graph: NewDirectedGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}, {"B", "A"}, {"B", "C"}})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			src := NewGrid(WithClock(testClock))
+			src.update(GraphUpdate{Graph: tt.graph})
+			for i, n := range tt.graph.Nodes {
+				src.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: n, Value: float64(i + 1), Source: "agent"}})
+			}
+			// A measurement retained for a node that left the graph.
+			src.update(GraphUpdate{Graph: NewGraph([]string{"gone"}, nil)})
+			src.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "gone", Value: 7}})
+			src.update(GraphUpdate{Graph: tt.graph})
+
+			data, err := src.Snapshot()
+			if err != nil {
+				t.Fatalf("Snapshot() error: %v", err)
+			}
+
+			dst := NewGrid()
+			// State the restore must replace.
+			dst.update(GraphUpdate{Graph: NewGraph([]string{"X", "A"}, [][]string{{"X", "A"}})})
+			dst.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "X", Value: 100}})
+			if err := dst.Restore(data); err != nil {
+				t.Fatalf("Restore() error: %v", err)
+			}
+
+			if !reflect.DeepEqual(partition(dst.islands), partition(src.islands)) {
+				t.Fatalf("islands = %v, want %v", dst.islands, src.islands)
+			}
+			if got, want := dst.currentTotals(), src.currentTotals(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("totals = %+v, want %+v", got, want)
+			}
+			if got, want := edgeList(dst), edgeList(src); !reflect.DeepEqual(got, want) {
+				t.Fatalf("edges = %v, want %v", got, want)
+			}
+			for _, n := range append(tt.graph.Nodes, "gone", "X") {
+				if got, want := dst.nodeDetail(n), src.nodeDetail(n); got != want {
+					t.Fatalf("detail of %s = %+v, want %+v", n, got, want)
+				}
+			}
+			if !tt.graph.Directed {
+				checkAgainstRebuild(t, dst, "after restore")
+			}
+
+			again, err := dst.Snapshot()
+			if err != nil {
+				t.Fatalf("Snapshot() after restore error: %v", err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Fatalf("snapshot after restore = %s, want %s", again, data)
+			}
+		})
+	}
+}
+
+func TestRestoreRejectsInvalidSnapshots(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{name: "not JSON", data: "nope", want: ErrInvalidSnapshot},
+		{name: "wrong shape", data: `{"version":1,"nodes":"A"}`, want: ErrInvalidSnapshot},
+		{name: "no version", data: `{"nodes":["A"],"edges":[]}`, want: ErrInvalidSnapshot},
+		{name: "newer version", data: `{"version":99,"nodes":["A"],"edges":[]}`, want: ErrSnapshotVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+			grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+			version := grid.version
+
+			reply := make(chan GraphResult, 1)
+			grid.update(RestoreSnapshot{Data: []byte(tt.data), Reply: reply})
+			if err := (<-reply).Err; !errors.Is(err, tt.want) {
+				t.Fatalf("Restore() error = %v, want %v", err, tt.want)
+			}
+			if grid.version != version || len(grid.islands) != 1 || grid.currentTotals()[0].Total != 1 {
+				t.Fatalf("state changed by a rejected snapshot: version %d, totals %+v", grid.version, grid.currentTotals())
+			}
+		})
+	}
+}
+
+func TestSnapshotEvents(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 2}})
+
+	snap := make(chan SnapshotResult, 1)
+	grid.update(SnapshotQuery{Reply: snap})
+	res := <-snap
+	if res.Err != nil {
+		t.Fatalf("SnapshotQuery error: %v", res.Err)
+	}
+
+	grid.update(ResetEvent{})
+	version := grid.version
+
+	reply := make(chan GraphResult, 1)
+	grid.update(RestoreSnapshot{Data: res.Data, Reply: reply})
+	restored := <-reply
+	if restored.Err != nil || !islandsEqual(partition(restored.Islands), [][]string{{"A", "B"}, {"C"}}) {
+		t.Fatalf("RestoreSnapshot reply = %+v, want islands [A B] [C]", restored)
+	}
+	if restored.Version != version+1 {
+		t.Fatalf("version after restore = %d, want %d", restored.Version, version+1)
+	}
+	if got := grid.currentTotals(); got[0].Total != 2 {
+		t.Fatalf("totals after restore = %+v, want 2 on the first island", got)
+	}
+}
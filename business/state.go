@@ -1,54 +1,210 @@
 package business
 
+import "time"
+
+// MeasurementMode selects how a measurement combines with the stored value.
+type MeasurementMode int
+
+const (
+	// MeasurementSet replaces the stored value (default).
+	MeasurementSet MeasurementMode = iota
+	// MeasurementAdd adds the value to the stored one (0 when unmeasured).
+	MeasurementAdd
+)
+
 // NodeMeasurement represents a single measurement value reported by a node.
 type NodeMeasurement struct {
-	Node  string
-	Value float64
+	Node   string
+	Value  float64
+	Mode   MeasurementMode
+	Source string    // optional producer ID, kept for auditing
+	Taken  time.Time // when the producer took the value, zero if not reported; kept as metadata only
+}
+
+// NodeDetail is the stored state of a single node.
+type NodeDetail struct {
+	Node     string
+	InGraph  bool    // the node is part of the current graph
+	Island   int     // island index, -1 when not in the graph
+	Measured bool    // a value has been reported
+	Value    float64 // latest value, as stored (before the sink sign)
+	Source   string  // producer of the latest value
+}
+
+// NodeHistory is the measurements retained for a single node, oldest first.
+// See WithMeasurementHistory.
+type NodeHistory struct {
+	Node     string
+	InGraph  bool // the node is part of the current graph
+	Readings []Reading
+}
+
+// Topology is the current graph as reported by TopologyQuery.
+type Topology struct {
+	Directed     bool
+	Islands      [][]string         // as in IslandsQuery
+	Edges        [][]string         // as in EdgesQuery
+	Measurements map[string]float64 // latest value of every measured node of the graph, as stored
+}
+
+// NodeIsland is the island containing a node, as reported by IslandOfNodeQuery.
+type NodeIsland struct {
+	Index int // position of the island among the current islands, -1 when the node is not in the graph
+	IslandMeasurement
 }
 
 // IslandMeasurement aggregates the sum of measurements for a connected island.
 type IslandMeasurement struct {
 	Island []string
 	Total  float64
+
+	NodeCount     int // nodes of the island
+	MeasuredCount int // nodes of the island with a stored measurement
+
+	// Min, Max and Average describe the stored values of the measured nodes,
+	// before sinks are netted; all are 0 while MeasuredCount is 0.
+	Min     float64
+	Max     float64
+	Average float64
+
+	// EdgeWeight sums the weights of the edges between nodes of the island,
+	// each counted once; unweighted edges weigh 1.
+	EdgeWeight float64
+
+	// LastUpdated is when the most recent measurement among the island's
+	// nodes was stored, the zero time while none is.
+	LastUpdated time.Time
+
+	// Overflow reports that the sum exceeded the float64 range, Total is then
+	// clamped to ±math.MaxFloat64, or that the value of a node did and was
+	// clamped when it was stored.
+	Overflow bool
 }
 
+// NodeRole tells whether a node's measurements add to or subtract from its
+// island total.
+type NodeRole int
+
+const (
+	// RoleSource nodes add their measurement to the island total (default).
+	RoleSource NodeRole = iota
+	// RoleSink nodes subtract their measurement from the island total.
+	RoleSink
+)
+
 // Graph describes grid topology: a list of nodes and adjacency edges.
 type Graph struct {
 	Nodes []string
 	Edges map[string][]string
+	Roles map[string]NodeRole // optional, nodes not listed are sources
+
+	// Transforms optionally converts the readings of individual nodes,
+	// overriding the grid-wide transform for them.
+	Transforms map[string]Transform
+
+	// Aliases maps alternate names, e.g. legacy sensor IDs, to the node they
+	// report for. Aliases naming a node of the graph, or pointing outside it,
+	// are ignored.
+	Aliases map[string]string
+
+	// Weights optionally gives edges a weight, e.g. their capacity, keyed by
+	// their endpoints; edges not listed weigh 1. An undirected edge may be keyed
+	// either way round.
+	Weights map[[2]string]float64
+
+	// Directed makes Edges one-way: a node lists only the nodes its edges lead
+	// to, and islands are the strongly connected components of the graph
+	// rather than its connected components.
+	Directed bool
 }
 
 // NewGraph creates graph from nodes and list of edges.
 func NewGraph(nodes []string, edges [][]string) Graph {
+	return newGraph(nodes, edges, false)
+}
+
+// NewDirectedGraph creates a directed graph from nodes and a list of edges,
+// each leading from its first node to its second.
+func NewDirectedGraph(nodes []string, edges [][]string) Graph {
+	return newGraph(nodes, edges, true)
+}
+
+func newGraph(nodes []string, edges [][]string, directed bool) Graph {
+	g, _ := BuildGraph(nodes, edges, directed)
+	return g
+}
+
+// GraphDiagnostics counts the edges BuildGraph left out of a graph.
+type GraphDiagnostics struct {
+	SelfLoops  int        // edges from a node to itself
+	Duplicates int        // edges listed before, either way round in undirected graphs
+	Unknown    [][]string // edges with an endpoint that is not a node, as listed
+}
+
+// BuildGraph creates a graph from nodes and a list of edges, directed as in
+// NewDirectedGraph or not, and reports what it dropped. Edges that are not a
+// pair are ignored, as are edges to unknown nodes, self-loops are dropped as they do not
+// change connectivity, and an edge listed more than once is kept once, so the
+// adjacency lists hold no repeats.
+func BuildGraph(nodes []string, edges [][]string, directed bool) (Graph, GraphDiagnostics) {
 	nodeSet := make(map[string]struct{}, len(nodes))
 	for _, n := range nodes {
 		nodeSet[n] = struct{}{}
 	}
 
 	graph := Graph{
-		Nodes: nodes,
-		Edges: make(map[string][]string),
+		Nodes:    nodes,
+		Edges:    make(map[string][]string),
+		Directed: directed,
 	}
 	// Initialize empty adjacency for all nodes to ensure stable map lookups.
 	for _, n := range nodes {
 		graph.Edges[n] = []string{}
 	}
 	// Build adjacency list
+	var diag GraphDiagnostics
+	seen := make(map[[2]string]struct{}, len(edges))
 	for _, edge := range edges {
 		if len(edge) != 2 {
 			continue
 		}
 		a, b := edge[0], edge[1]
-		if _, ok := nodeSet[a]; !ok {
+		_, okA := nodeSet[a]
+		_, okB := nodeSet[b]
+		if !okA || !okB {
+			diag.Unknown = append(diag.Unknown, edge)
 			continue
 		}
-		if _, ok := nodeSet[b]; !ok {
+		if a == b {
+			diag.SelfLoops++
 			continue
 		}
+		key := [2]string{a, b}
+		if !directed && b < a {
+			key = [2]string{b, a}
+		}
+		if _, ok := seen[key]; ok {
+			diag.Duplicates++
+			continue
+		}
+		seen[key] = struct{}{}
 		graph.Edges[a] = append(graph.Edges[a], b)
-		graph.Edges[b] = append(graph.Edges[b], a)
+		if !directed {
+			graph.Edges[b] = append(graph.Edges[b], a)
+		}
 	}
-	return graph
+	return graph, diag
+}
+
+// weight returns the weight of the edge from a to b.
+func (g Graph) weight(a, b string) float64 {
+	if w, ok := g.Weights[[2]string{a, b}]; ok {
+		return w
+	}
+	if w, ok := g.Weights[[2]string{b, a}]; ok && !g.Directed {
+		return w
+	}
+	return 1
 }
 
 // HasNode reports whether the graph contains the given node.
@@ -59,3 +215,30 @@ func (g Graph) HasNode(node string) bool {
 	_, ok := g.Edges[node]
 	return ok
 }
+
+// Unreachable returns the nodes that cannot be reached from root, in the order
+// of g.Nodes. The second result is false when root is not a node of g.
+func (g Graph) Unreachable(root string) ([]string, bool) {
+	if !g.HasNode(root) {
+		return nil, false
+	}
+
+	seen := map[string]bool{root: true}
+	queue := []string{root}
+	for i := 0; i < len(queue); i++ {
+		for _, nei := range g.Edges[queue[i]] {
+			if !seen[nei] {
+				seen[nei] = true
+				queue = append(queue, nei)
+			}
+		}
+	}
+
+	unreachable := []string{}
+	for _, n := range g.Nodes {
+		if !seen[n] {
+			unreachable = append(unreachable, n)
+		}
+	}
+	return unreachable, true
+}
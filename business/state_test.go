@@ -89,6 +89,65 @@ func TestNewGraph(t *testing.T) {
 	}
 }
 
+func TestBuildGraphDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		edges     [][]string
+		directed  bool
+		wantEdges map[string][]string
+		wantDiag  GraphDiagnostics
+	}{
+		{
+			name:      "clean graph",
+			edges:     [][]string{{"A", "B"}, {"B", "C"}},
+			wantEdges: map[string][]string{"A": {"B"}, "B": {"A", "C"}, "C": {"B"}},
+		},
+		{
+			name:      "self-loops are dropped",
+			edges:     [][]string{{"A", "A"}, {"A", "B"}, {"C", "C"}},
+			wantEdges: map[string][]string{"A": {"B"}, "B": {"A"}, "C": {}},
+			wantDiag:  GraphDiagnostics{SelfLoops: 2},
+		},
+		{
+			name:      "duplicates either way round are kept once",
+			edges:     [][]string{{"A", "B"}, {"A", "B"}, {"B", "A"}, {"B", "C"}},
+			wantEdges: map[string][]string{"A": {"B"}, "B": {"A", "C"}, "C": {"B"}},
+			wantDiag:  GraphDiagnostics{Duplicates: 2},
+		},
+		{
+			name:      "directed edges differ by direction",
+			edges:     [][]string{{"A", "B"}, {"B", "A"}, {"A", "B"}},
+			directed:  true,
+			wantEdges: map[string][]string{"A": {"B"}, "B": {"A"}, "C": {}},
+			wantDiag:  GraphDiagnostics{Duplicates: 1},
+		},
+		{
+			name:      "edges to unknown nodes are listed",
+			edges:     [][]string{{"A", "X"}, {"X", "X"}, {"A"}},
+			wantEdges: map[string][]string{"A": {}, "B": {}, "C": {}},
+			wantDiag:  GraphDiagnostics{Unknown: [][]string{{"A", "X"}, {"X", "X"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			g, diag := BuildGraph([]string{"A", "B", "C"}, tt.edges, tt.directed)
+			if !reflect.DeepEqual(diag, tt.wantDiag) {
+				t.Errorf("diagnostics = %+v, want %+v", diag, tt.wantDiag)
+			}
+			for node, want := range tt.wantEdges {
+				if got := g.Edges[node]; !reflect.DeepEqual(got, want) {
+					t.Errorf("Edges[%q] = %v, want %v", node, got, want)
+				}
+			}
+		})
+	}
+}
+
 func normalizeStrings(in []string) []string {
 	if len(in) == 0 {
 		return nil
@@ -104,3 +163,46 @@ func normalizeStrings(in []string) []string {
 	}
 	return out[:n]
 }
+
+func TestGraphUnreachable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		graph  Graph
+		root   string
+		want   []string
+		wantOK bool
+	}{
+		{
+			name:   "everything reachable",
+			graph:  NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}, {"B", "C"}}),
+			root:   "C",
+			want:   []string{},
+			wantOK: true,
+		},
+		{
+			name:   "unreachable nodes in graph order",
+			graph:  NewGraph([]string{"D", "A", "B", "C"}, [][]string{{"A", "B"}}),
+			root:   "A",
+			want:   []string{"D", "C"},
+			wantOK: true,
+		},
+		{
+			name:  "root not in graph",
+			graph: NewGraph([]string{"A"}, nil),
+			root:  "Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := tt.graph.Unreachable(tt.root)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Unreachable(%q) = %v, %v, want %v, %v", tt.root, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
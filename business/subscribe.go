@@ -0,0 +1,161 @@
+package business
+
+import "slices"
+
+// allIslands marks a change that may affect every island, such as a topology update.
+const allIslands = -1
+
+// subscriber receives the totals of the islands it watches after each change.
+type subscriber struct {
+	nodes   []string // watched nodes, empty watches every island
+	updates chan TotalsUpdate
+	done    <-chan struct{}
+}
+
+// subscribe registers a subscriber and returns its current watched totals.
+// Subscribers that went away are dropped first, so the registry does not grow
+// with subscriptions made between two changes.
+func (s *Grid) subscribe(e Subscribe) []IslandMeasurement {
+	s.dropDone()
+
+	sub := &subscriber{nodes: e.Nodes, updates: e.Updates, done: e.Done}
+	// A subscriber without a buffered channel could never be pushed to without
+	// blocking the loop.
+	if cap(e.Updates) > 0 {
+		s.subscribers = append(s.subscribers, sub)
+	}
+	return sub.filter(s, s.currentTotals())
+}
+
+// publish pushes the current totals to every subscriber watching the changed
+// island (or to all of them for allIslands); topology marks changes caused by a
+// graph update. Subscribers whose Done channel is closed are dropped here, so
+// they need not unsubscribe explicitly.
+func (s *Grid) publish(changed int, topology bool) {
+	if len(s.subscribers) == 0 {
+		return
+	}
+
+	s.dropDone()
+
+	totals := s.currentTotals()
+	for _, sub := range s.subscribers {
+		if changed == allIslands || sub.watches(s, changed) {
+			sub.push(TotalsUpdate{Totals: sub.filter(s, totals), Topology: topology, Version: s.version})
+		}
+	}
+}
+
+// publishIslands is publish for a change to several islands: each subscriber
+// watching any of them is pushed to once.
+func (s *Grid) publishIslands(changed []int) {
+	if len(s.subscribers) == 0 {
+		return
+	}
+
+	s.dropDone()
+
+	totals := s.currentTotals()
+	for _, sub := range s.subscribers {
+		if slices.ContainsFunc(changed, func(island int) bool { return sub.watches(s, island) }) {
+			sub.push(TotalsUpdate{Totals: sub.filter(s, totals), Version: s.version})
+		}
+	}
+}
+
+// dropDone forgets the subscribers whose Done channel is closed.
+func (s *Grid) dropDone() {
+	live := s.subscribers[:0]
+	for _, sub := range s.subscribers {
+		select {
+		case <-sub.done:
+			continue
+		default:
+		}
+		live = append(live, sub)
+	}
+	clear(s.subscribers[len(live):])
+	s.subscribers = live
+}
+
+// islandOfNode returns the island index of node, or -1 when it is not part of
+// the current graph.
+func (s *Grid) islandOfNode(node string) int {
+	id, ok := s.nodes.id(node)
+	if !ok || id >= len(s.nodeToIsland) {
+		return -1
+	}
+	return s.nodeToIsland[id]
+}
+
+// closeSubscribers closes the update channel of every subscriber, telling it no
+// more updates will come, and forgets them. An update still pending in a
+// channel is received before the close. It returns how many were closed.
+func (s *Grid) closeSubscribers() int {
+	n := len(s.subscribers)
+	for _, sub := range s.subscribers {
+		close(sub.updates)
+	}
+	clear(s.subscribers)
+	s.subscribers = nil
+	return n
+}
+
+// watches reports whether island contains one of the watched nodes. Island
+// membership is resolved on every call, so a watched node that moves to another
+// island after a topology change is followed there.
+func (sub *subscriber) watches(s *Grid, island int) bool {
+	if len(sub.nodes) == 0 {
+		return true
+	}
+	for _, n := range sub.nodes {
+		if s.islandOfNode(n) == island {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the entries of totals for the watched islands, in island order.
+func (sub *subscriber) filter(s *Grid, totals []IslandMeasurement) []IslandMeasurement {
+	if len(sub.nodes) == 0 {
+		return totals
+	}
+
+	watched := make([]bool, len(totals))
+	for _, n := range sub.nodes {
+		if i := s.islandOfNode(n); i >= 0 && i < len(watched) {
+			watched[i] = true
+		}
+	}
+
+	res := []IslandMeasurement{}
+	for i, t := range totals {
+		if watched[i] {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// push delivers u without blocking the loop. When the subscriber is behind,
+// its pending update is replaced: only the latest state matters, but a replaced
+// topology change is still reported as one.
+func (sub *subscriber) push(u TotalsUpdate) {
+	select {
+	case sub.updates <- u:
+		return
+	default:
+	}
+
+	select {
+	case old := <-sub.updates:
+		u.Topology = u.Topology || old.Topology
+	default:
+	}
+
+	select {
+	case sub.updates <- u:
+	default:
+	}
+}
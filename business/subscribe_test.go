@@ -0,0 +1,203 @@
+package business
+
+import "testing"
+
+func TestSubscriberReceivesFilteredUpdates(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C", "D"}, [][]string{{"A", "B"}, {"C", "D"}})})
+
+	updates := make(chan TotalsUpdate, 1)
+	done := make(chan struct{})
+	reply := make(chan VersionedTotals, 1)
+	grid.update(Subscribe{Nodes: []string{"A"}, Updates: updates, Done: done, Reply: reply})
+
+	initial := <-reply
+	if want := []IslandMeasurement{{Island: []string{"A", "B"}}}; !totalsEqual(initial.Totals, want) {
+		t.Fatalf("initial totals = %v, want %v", initial.Totals, want)
+	}
+	if initial.Version != grid.version {
+		t.Fatalf("initial version = %d, want %d", initial.Version, grid.version)
+	}
+
+	expectNone := func(step string) {
+		t.Helper()
+		select {
+		case got := <-updates:
+			t.Fatalf("%s: unexpected update %v", step, got.Totals)
+		default:
+		}
+	}
+	expect := func(step string, want []IslandMeasurement, topology bool) {
+		t.Helper()
+		select {
+		case got := <-updates:
+			if !totalsEqual(got.Totals, want) || got.Topology != topology {
+				t.Fatalf("%s: update = %+v, want %v (topology %v)", step, got, want, topology)
+			}
+			if got.Version != grid.version {
+				t.Fatalf("%s: update version = %d, want %d", step, got.Version, grid.version)
+			}
+		default:
+			t.Fatalf("%s: no update, want %v", step, want)
+		}
+	}
+
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "C", Value: 5}})
+	expectNone("measurement on an unwatched island")
+
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 2}})
+	expect("measurement on the watched island", []IslandMeasurement{{Island: []string{"A", "B"}, Total: 2}}, false)
+
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "Z", Value: 1}})
+	expectNone("measurement on a node outside the graph")
+
+	// A moves to C's island; the subscription follows it.
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C", "D"}, [][]string{{"A", "C"}, {"B", "D"}})})
+	expect("topology change", []IslandMeasurement{{Island: []string{"A", "C"}, Total: 5}}, true)
+
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "D", Value: 1}})
+	expectNone("measurement on the island A left")
+
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "C", Value: 7}})
+	expect("measurement on the island A joined", []IslandMeasurement{{Island: []string{"A", "C"}, Total: 7}}, false)
+
+	close(done)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+	expectNone("after Done")
+	if len(grid.subscribers) != 0 {
+		t.Fatalf("subscribers = %d after Done, want 0", len(grid.subscribers))
+	}
+}
+
+func TestSubscriberKeepsLatestUpdate(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A"}, nil)})
+
+	updates := make(chan TotalsUpdate, 1)
+	grid.update(Subscribe{Updates: updates, Done: make(chan struct{})})
+
+	// The subscriber does not read; each push must replace the pending one
+	// instead of blocking the loop.
+	for i := 1; i <= 3; i++ {
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: float64(i)}})
+	}
+
+	if got, want := (<-updates).Totals, []IslandMeasurement{{Island: []string{"A"}, Total: 3}}; !totalsEqual(got, want) {
+		t.Fatalf("update = %v, want %v", got, want)
+	}
+}
+
+func totalsEqual(a, b []IslandMeasurement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Total != b[i].Total || !islandsEqual([][]string{a[i].Island}, [][]string{b[i].Island}) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSubscriberKeepsTopologyFlagWhenReplaced(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	updates := make(chan TotalsUpdate, 1)
+	grid.update(Subscribe{Updates: updates, Done: make(chan struct{})})
+
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A"}, nil)})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+
+	got := <-updates
+	if !got.Topology || !totalsEqual(got.Totals, []IslandMeasurement{{Island: []string{"A"}, Total: 1}}) {
+		t.Fatalf("update = %+v, want the latest totals flagged as a topology change", got)
+	}
+}
+
+func TestCloseSubscribersDeliversPendingUpdate(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A"}, nil)})
+
+	updates := make(chan TotalsUpdate, 1)
+	grid.update(Subscribe{Updates: updates, Done: make(chan struct{})})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 3}})
+
+	reply := make(chan int, 1)
+	grid.update(CloseSubscribers{Reply: reply})
+	if n := <-reply; n != 1 {
+		t.Fatalf("closed %d subscribers, want 1", n)
+	}
+
+	if u, ok := <-updates; !ok || u.Totals[0].Total != 3 {
+		t.Fatalf("pending update = %+v (open %v), want total 3 before the close", u, ok)
+	}
+	if _, ok := <-updates; ok {
+		t.Fatalf("updates channel still open after CloseSubscribers")
+	}
+
+	// Later changes must not send on the closed channel.
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 4}})
+}
+
+func TestSubscribeDropsSubscribersThatWentAway(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	for range 10 {
+		done := make(chan struct{})
+		grid.update(Subscribe{Updates: make(chan TotalsUpdate, 1), Done: done})
+		close(done)
+	}
+	if got := len(grid.subscribers); got != 1 {
+		t.Fatalf("registered subscribers = %d, want only the last one", got)
+	}
+}
+
+// TestStateChangesArePublished guards against events that change the totals
+// without telling subscribers.
+func TestStateChangesArePublished(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		evt      Event
+		topology bool
+	}{
+		{name: "graph update", evt: GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil)}, topology: true},
+		{name: "edge edit", evt: EdgeEdit{Add: [][]string{{"A", "C"}}}, topology: true},
+		{name: "node removal", evt: NodeRemove{Node: "C"}, topology: true},
+		{name: "recompute", evt: RecomputeIslands{}, topology: true},
+		{name: "measurement", evt: MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}}},
+		{name: "batch", evt: BatchMeasurementUpdate{Measurements: []NodeMeasurement{{Node: "A", Value: 1}, {Node: "C", Value: 2}}}},
+		{name: "compare-and-set", evt: CompareAndSet{Node: "A", New: 1}},
+		{name: "clear", evt: ClearMeasurements{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+			updates := make(chan TotalsUpdate, 1)
+			grid.update(Subscribe{Updates: updates, Done: make(chan struct{})})
+
+			grid.update(tt.evt)
+			select {
+			case got := <-updates:
+				if got.Topology != tt.topology {
+					t.Errorf("topology = %v, want %v", got.Topology, tt.topology)
+				}
+			default:
+				t.Fatal("no update published")
+			}
+		})
+	}
+}
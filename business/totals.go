@@ -0,0 +1,90 @@
+package business
+
+import "slices"
+
+// The per-island totals are cached in s.totals so that a measurement does not
+// re-aggregate the whole grid. A measurement adjusts the entry of its node's
+// island by the change from the node's previous value to the new one, in
+// constant time whatever the island size. The entry is re-summed from the island
+// members only when an adjustment cannot be exact: the old value was the
+// island's minimum or maximum, or the total is clamped. Adjusted totals may
+// drift from a full sum by float rounding; changes to island membership, clears
+// and expiry rebuild the cache from scratch, which resets it.
+
+// islandTotals returns the cached totals, rebuilding them if stale. The slice
+// is owned by the grid: it must not be handed out, see currentTotals.
+func (s *Grid) islandTotals() []IslandMeasurement {
+	s.expireTotals()
+	if s.totals == nil {
+		s.totals = aggregate(s)
+	}
+	return s.totals
+}
+
+// currentTotals returns the per-island totals of the current state, safe to
+// send out of the loop.
+func (s *Grid) currentTotals() []IslandMeasurement {
+	return slices.Clone(s.islandTotals())
+}
+
+// adjustIsland updates the cached entry of island i for the measurement of node
+// id replaced from old to m, which counts. It does nothing while the cache is
+// not built.
+func (s *Grid) adjustIsland(i, id int, old, m measurement) {
+	// Expired measurements leave the cache first, so old is counted in it
+	// exactly when it counts now.
+	s.expireTotals()
+	if s.totals == nil {
+		return
+	}
+	r := &s.totals[i]
+	now := s.now()
+	counted := old.counts(now, s.windowStart(now))
+
+	switch {
+	case counted && old.value == m.value:
+		// The total, counts and stats are unchanged: skipping the arithmetic
+		// keeps them bit for bit.
+	case r.Overflow || m.clamped() || counted && (old.value == r.Min || old.value == r.Max || old.at.After(m.at)):
+		// Neither a clamped sum nor the extremes can be taken back.
+		s.refreshIsland(i)
+		return
+	case counted:
+		total, clampedOld := addClamped(r.Total, -s.graph.sign(id)*old.value)
+		total, clampedNew := addClamped(total, s.graph.sign(id)*m.value)
+		if clampedOld || clampedNew {
+			s.refreshIsland(i)
+			return
+		}
+		r.Total = total
+		r.Min, r.Max = min(r.Min, m.value), max(r.Max, m.value)
+		r.Average = replaceInMean(r.Average, old.value, m.value, r.MeasuredCount)
+	default:
+		total, clamped := addClamped(r.Total, s.graph.sign(id)*m.value)
+		if clamped {
+			s.refreshIsland(i)
+			return
+		}
+		r.Total = total
+		if r.MeasuredCount == 0 {
+			r.Min, r.Max = m.value, m.value
+		} else {
+			r.Min, r.Max = min(r.Min, m.value), max(r.Max, m.value)
+		}
+		r.MeasuredCount++
+		r.Average = addToMean(r.Average, m.value, r.MeasuredCount)
+	}
+	if m.at.After(r.LastUpdated) {
+		r.LastUpdated = m.at
+	}
+}
+
+// refreshIsland recomputes the entry of island i, updating the cache if it is
+// built, and returns it.
+func (s *Grid) refreshIsland(i int) IslandMeasurement {
+	e := islandEntry(s, i)
+	if s.totals != nil {
+		s.totals[i] = e
+	}
+	return e
+}
@@ -0,0 +1,183 @@
+package business
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+)
+
+// checkTotalsCache fails if the cached totals differ from a full aggregate.
+func checkTotalsCache(t *testing.T, grid *Grid, step string) {
+	t.Helper()
+	if grid.totals == nil {
+		return
+	}
+	if want := aggregate(grid); !cachedTotalsEqual(grid.totals, want) {
+		t.Fatalf("%s: cached totals = %v, want %v", step, grid.totals, want)
+	}
+}
+
+// cachedTotalsEqual reports whether got and want are equal, up to the rounding that
+// adjusting a total and average by deltas leaves.
+func cachedTotalsEqual(got, want []IslandMeasurement) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if math.Abs(g.Total-w.Total) > 1e-9*max(1, math.Abs(w.Total)) || math.Abs(g.Average-w.Average) > 1e-9*max(1, math.Abs(w.Average)) {
+			return false
+		}
+		g.Total, g.Average = w.Total, w.Average
+		if !reflect.DeepEqual(g, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTotalsCacheRandomAgainstAggregate(t *testing.T) {
+	t.Parallel()
+
+	for seed := range uint64(20) {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			t.Parallel()
+
+			rng := rand.New(rand.NewPCG(seed, seed))
+			const nodeCount = 30
+			nodes := make([]string, nodeCount)
+			for i := range nodes {
+				nodes[i] = fmt.Sprintf("n%02d", i)
+			}
+			randomNode := func() string { return nodes[rng.IntN(nodeCount)] }
+			randomGraph := func() Graph {
+				// A random subset of the nodes, so measured nodes leave and rejoin.
+				var edges [][]string
+				roles := map[string]NodeRole{}
+				var graphNodes []string
+				for _, n := range nodes {
+					if rng.IntN(4) == 0 {
+						continue
+					}
+					graphNodes = append(graphNodes, n)
+					if rng.IntN(5) == 0 {
+						roles[n] = RoleSink
+					}
+				}
+				for range nodeCount / 2 {
+					edges = append(edges, []string{randomNode(), randomNode()})
+				}
+				g := NewGraph(graphNodes, edges)
+				g.Roles = roles
+				return g
+			}
+
+			grid := NewGrid()
+			grid.update(GraphUpdate{Graph: randomGraph()})
+			for step := range 300 {
+				var evt Event
+				switch r := rng.IntN(20); {
+				case r == 0:
+					evt = GraphUpdate{Graph: randomGraph()}
+				case r == 1:
+					evt = ClearMeasurements{}
+				case r == 2:
+					evt = NodeRemove{Node: randomNode()}
+				case r < 5:
+					evt = EdgeEdit{
+						Add:    [][]string{{randomNode(), randomNode()}},
+						Remove: [][]string{{randomNode(), randomNode()}},
+					}
+				default:
+					m := NodeMeasurement{Node: randomNode(), Value: float64(rng.IntN(200) - 100)}
+					if rng.IntN(3) == 0 {
+						m.Mode = MeasurementAdd
+					}
+					reply := make(chan MeasurementResult, 1)
+					grid.update(MeasurementUpdate{NodeMeasurement: m, Reply: reply})
+					if got, want := (<-reply).Totals, aggregate(grid); !cachedTotalsEqual(got, want) {
+						t.Fatalf("step %d: reply totals = %v, want %v", step, got, want)
+					}
+					checkTotalsCache(t, grid, fmt.Sprintf("step %d (%+v)", step, m))
+					continue
+				}
+				grid.update(evt)
+				checkTotalsCache(t, grid, fmt.Sprintf("step %d (%T)", step, evt))
+			}
+		})
+	}
+}
+
+func TestGraphUpdateRebuildsTotals(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+	for n, v := range map[string]float64{"A": 1, "B": 2, "C": 4} {
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: n, Value: v}})
+	}
+
+	// C joins the island of A and B, which used to total 3.
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}, {"B", "C"}})})
+	reply := make(chan MeasurementResult, 1)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 10}, Reply: reply})
+
+	got := (<-reply).Totals
+	if len(got) != 1 || got[0].Total != 16 || got[0].NodeCount != 3 || got[0].MeasuredCount != 3 {
+		t.Errorf("totals = %+v, want one island of 3 nodes totalling 16", got)
+	}
+}
+
+func TestTotalsRepliesDoNotShareCache(t *testing.T) {
+	t.Parallel()
+
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil)})
+	reply := make(chan MeasurementResult, 2)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}, Reply: reply})
+	first := (<-reply).Totals
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 5}, Reply: reply})
+	<-reply
+
+	if first[0].Total != 1 {
+		t.Errorf("earlier reply total = %v after a later update, want 1", first[0].Total)
+	}
+}
+
+// BenchmarkMeasurementUpdate measures a single measurement on a large grid,
+// where only the entry of the measured node's island is adjusted, whatever its
+// size.
+func BenchmarkMeasurementUpdate(b *testing.B) {
+	for _, size := range []int{10, 100_000} {
+		b.Run(fmt.Sprintf("islands of %d", size), func(b *testing.B) {
+			benchmarkMeasurementUpdate(b, size)
+		})
+	}
+}
+
+func benchmarkMeasurementUpdate(b *testing.B, islandSize int) {
+	const nodeCount = 100_000
+
+	// Islands of islandSize nodes in a path.
+	nodes := make([]string, nodeCount)
+	var edges [][]string
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("node-%d", i)
+		if i%islandSize != 0 {
+			edges = append(edges, []string{nodes[i-1], nodes[i]})
+		}
+	}
+	grid := NewGrid()
+	grid.update(GraphUpdate{Graph: NewGraph(nodes, edges)})
+	for i, n := range nodes {
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: n, Value: float64(i)}})
+	}
+
+	var i int
+	for b.Loop() {
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: nodes[i%nodeCount], Value: float64(i)}})
+		i++
+	}
+}
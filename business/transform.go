@@ -0,0 +1,48 @@
+package business
+
+import (
+	"errors"
+	"math"
+)
+
+// Transform converts a raw reading into the value stored for a node, e.g. to
+// turn sensor counts into physical units: Value*Scale + Offset.
+type Transform struct {
+	Scale  float64
+	Offset float64
+}
+
+// IdentityTransform stores readings unchanged.
+var IdentityTransform = Transform{Scale: 1}
+
+// Validate reports an error if the scale or the offset is NaN or infinite,
+// which would store a non-finite value for every reading.
+func (t Transform) Validate() error {
+	switch {
+	case math.IsNaN(t.Scale) || math.IsInf(t.Scale, 0):
+		return errors.New("scale must be finite")
+	case math.IsNaN(t.Offset) || math.IsInf(t.Offset, 0):
+		return errors.New("offset must be finite")
+	}
+	return nil
+}
+
+// apply converts a reading. In add mode only the scale applies: the reading is
+// an increment, and the offset belongs to absolute readings. A finite reading
+// that a large scale or offset takes out of the float64 range is clamped to
+// ±math.MaxFloat64, which is reported.
+func (t Transform) apply(value float64, mode MeasurementMode) (float64, bool) {
+	if mode == MeasurementAdd {
+		return clampFinite(value * t.Scale)
+	}
+	return clampFinite(value*t.Scale + t.Offset)
+}
+
+// transformFor returns the transform of the node with the given ID: its own
+// from the graph if it has one, the grid-wide one otherwise.
+func (s *Grid) transformFor(id int) Transform {
+	if t, ok := s.graph.transforms[id]; ok {
+		return t
+	}
+	return s.transform
+}
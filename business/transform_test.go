@@ -0,0 +1,113 @@
+package business
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTransformAppliedBeforeStorage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		global     Transform
+		transforms map[string]Transform
+		updates    []NodeMeasurement
+		want       float64 // total of the single island
+	}{
+		{
+			name:    "identity by default",
+			global:  IdentityTransform,
+			updates: []NodeMeasurement{{Node: "A", Value: 3}, {Node: "B", Value: 4}},
+			want:    7,
+		},
+		{
+			name:    "global scale and offset",
+			global:  Transform{Scale: 10, Offset: 1},
+			updates: []NodeMeasurement{{Node: "A", Value: 3}, {Node: "B", Value: 4}},
+			want:    31 + 41,
+		},
+		{
+			name:       "per-node transform overrides the global one",
+			global:     Transform{Scale: 10},
+			transforms: map[string]Transform{"B": {Scale: 0.5, Offset: 2}},
+			updates:    []NodeMeasurement{{Node: "A", Value: 3}, {Node: "B", Value: 4}},
+			want:       30 + 4,
+		},
+		{
+			name:    "add mode scales the increment only",
+			global:  Transform{Scale: 2, Offset: 1},
+			updates: []NodeMeasurement{{Node: "A", Value: 3}, {Node: "A", Value: 5, Mode: MeasurementAdd}},
+			want:    7 + 10,
+		},
+		{
+			name:    "repeated set is not cumulative",
+			global:  Transform{Scale: 2, Offset: 1},
+			updates: []NodeMeasurement{{Node: "A", Value: 3}, {Node: "A", Value: 3}},
+			want:    7,
+		},
+		{
+			name:       "a scale overflowing a finite reading is clamped",
+			global:     IdentityTransform,
+			transforms: map[string]Transform{"B": {Scale: 1e308}},
+			updates:    []NodeMeasurement{{Node: "B", Value: 10}},
+			want:       math.MaxFloat64,
+		},
+		{
+			name:    "an offset overflowing a finite reading is clamped",
+			global:  Transform{Scale: 1, Offset: -math.MaxFloat64},
+			updates: []NodeMeasurement{{Node: "A", Value: -math.MaxFloat64}},
+			want:    -math.MaxFloat64,
+		},
+		{
+			name:    "an add-mode increment overflowing is clamped",
+			global:  Transform{Scale: 1e300},
+			updates: []NodeMeasurement{{Node: "A", Value: 1e10, Mode: MeasurementAdd}},
+			want:    math.MaxFloat64,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid(WithTransform(tt.global))
+			graph := NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})
+			graph.Transforms = tt.transforms
+			grid.update(GraphUpdate{Graph: graph})
+
+			var res MeasurementResult
+			for _, m := range tt.updates {
+				reply := make(chan MeasurementResult, 1)
+				grid.update(MeasurementUpdate{NodeMeasurement: m, Reply: reply})
+				res = <-reply
+			}
+			if len(res.Totals) != 1 || res.Totals[0].Total != tt.want {
+				t.Fatalf("totals = %v, want %v", res.Totals, tt.want)
+			}
+			for _, n := range []string{"A", "B"} {
+				if d := grid.nodeDetail(n); math.IsInf(d.Value, 0) {
+					t.Fatalf("stored value of %s = %v, want finite", n, d.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestTransformValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, tr := range []Transform{
+		{Scale: math.NaN()},
+		{Scale: math.Inf(1)},
+		{Scale: 1, Offset: math.Inf(-1)},
+		{Scale: 1, Offset: math.NaN()},
+	} {
+		if err := tr.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want an error", tr)
+		}
+	}
+	if err := (Transform{Scale: 1e308, Offset: -1e308}).Validate(); err != nil {
+		t.Errorf("Validate of a finite transform = %v, want nil", err)
+	}
+}
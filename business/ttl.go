@@ -0,0 +1,39 @@
+package business
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// expired reports whether the TTL of m has passed at now.
+func (m measurement) expired(now time.Time) bool {
+	return !m.expires.IsZero() && !now.Before(m.expires)
+}
+
+// reapExpired drops the measurements whose TTL has passed and returns how many
+// it dropped. Their nodes read as never measured afterwards.
+func (s *Grid) reapExpired() int {
+	if s.ttl <= 0 {
+		return 0
+	}
+	now := s.now()
+	reaped, live := 0, 0
+	for id, m := range s.measurements {
+		switch {
+		case m.ok && m.expired(now):
+			s.measurements[id] = measurement{}
+			reaped++
+		case m.ok:
+			live++
+		}
+	}
+
+	level := slog.LevelDebug
+	if reaped > 0 {
+		level = slog.LevelInfo
+		s.totals = nil
+	}
+	s.logger.Log(context.Background(), level, "reaped expired measurements", "reaped", reaped, "remaining", live)
+	return reaped
+}
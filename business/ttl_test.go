@@ -0,0 +1,177 @@
+package business
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeasurementTTL(t *testing.T) {
+	t.Parallel()
+
+	var logs bytes.Buffer
+	now := testTime
+	grid := NewGrid(
+		WithMeasurementTTL(time.Minute),
+		WithClock(func() time.Time { return now }),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+	now = testTime.Add(30 * time.Second)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 2}})
+
+	total := func() float64 {
+		totals := grid.currentTotals()
+		checkTotalsCache(t, grid, now.String())
+		return totals[0].Total
+	}
+	detail := func(node string) NodeDetail {
+		reply := make(chan NodeDetail, 1)
+		grid.update(NodeDetailQuery{Node: node, Reply: reply})
+		return <-reply
+	}
+
+	if got := total(); got != 3 {
+		t.Fatalf("total = %v, want 3", got)
+	}
+
+	// A expires: it stops counting before it is reaped.
+	now = testTime.Add(time.Minute)
+	if got := total(); got != 2 {
+		t.Fatalf("total after A expired = %v, want 2", got)
+	}
+	if !detail("A").Measured {
+		t.Fatal("A reads as unmeasured before being reaped")
+	}
+
+	version := grid.version
+	grid.update(TickEvent{})
+	if d := detail("A"); d.Measured {
+		t.Fatalf("detail of A after reaping = %+v, want unmeasured", d)
+	}
+	if !detail("B").Measured {
+		t.Fatal("B was reaped before its TTL")
+	}
+	if grid.version != version+1 {
+		t.Fatalf("version after reaping = %d, want %d", grid.version, version+1)
+	}
+	if !strings.Contains(logs.String(), "reaped=1 remaining=1") {
+		t.Fatalf("logs = %q, want the reaped count", logs.String())
+	}
+
+	// An expired value is not added to.
+	now = testTime.Add(2 * time.Minute)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 5, Mode: MeasurementAdd}})
+	if got := total(); got != 5 {
+		t.Fatalf("total after adding to the expired B = %v, want 5", got)
+	}
+
+	// Nothing expired: the state is unchanged.
+	version = grid.version
+	grid.update(TickEvent{})
+	if grid.version != version {
+		t.Fatalf("version after an empty reap = %d, want %d", grid.version, version)
+	}
+}
+
+func TestMeasurementTimestampDoesNotDriveExpiry(t *testing.T) {
+	t.Parallel()
+
+	now := testTime
+	grid := NewGrid(
+		WithMeasurementTTL(time.Minute),
+		WithAggregationWindow(time.Minute),
+		WithMeasurementHistory(2),
+		WithClock(func() time.Time { return now }),
+	)
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil)})
+
+	future := time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+	stale := testTime.Add(-24 * time.Hour)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1, Taken: future}})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 2, Taken: stale}})
+
+	totals := func() []float64 {
+		var out []float64
+		for _, m := range grid.currentTotals() {
+			out = append(out, m.Total)
+		}
+		checkTotalsCache(t, grid, now.String())
+		return out
+	}
+
+	// A stale timestamp is neither already expired nor outside the window.
+	if got := totals(); !reflect.DeepEqual(got, []float64{1, 2}) {
+		t.Fatalf("totals = %v, want [1 2]", got)
+	}
+	if got := grid.currentTotals()[1].LastUpdated; !got.Equal(testTime) {
+		t.Fatalf("last updated = %v, want the time of receipt %v", got, testTime)
+	}
+
+	// A timestamp in the future does not keep the value alive.
+	now = testTime.Add(time.Minute + time.Second)
+	if got := totals(); !reflect.DeepEqual(got, []float64{0, 0}) {
+		t.Fatalf("totals after the TTL = %v, want [0 0]", got)
+	}
+	grid.update(TickEvent{})
+	for _, node := range []string{"A", "B"} {
+		reply := make(chan NodeDetail, 1)
+		grid.update(NodeDetailQuery{Node: node, Reply: reply})
+		if d := <-reply; d.Measured {
+			t.Fatalf("detail of %s after reaping = %+v, want unmeasured", node, d)
+		}
+	}
+
+	// The timestamp is kept alongside the time of receipt.
+	reply := make(chan NodeHistory, 1)
+	grid.update(NodeHistoryQuery{Node: "A", Reply: reply})
+	if got, want := (<-reply).Readings, []Reading{{Value: 1, At: testTime, Taken: future}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("readings = %+v, want %+v", got, want)
+	}
+}
+
+func TestMeasurementTTLDisabled(t *testing.T) {
+	t.Parallel()
+
+	now := testTime
+	grid := NewGrid(WithClock(func() time.Time { return now }))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A"}, nil)})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+
+	now = testTime.Add(1000 * time.Hour)
+	grid.update(TickEvent{})
+	if got := grid.currentTotals()[0].Total; got != 1 {
+		t.Fatalf("total = %v, want 1: without a TTL measurements never expire", got)
+	}
+}
+
+func TestLoopReapsExpiredMeasurements(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan Event)
+	go NewGrid(WithMeasurementTTL(10*time.Millisecond)).Loop(ctx, events)
+
+	events <- GraphUpdate{Graph: NewGraph([]string{"A"}, nil)}
+	events <- MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		reply := make(chan NodeDetail, 1)
+		events <- NodeDetailQuery{Node: "A", Reply: reply}
+		if !(<-reply).Measured {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the loop did not reap the expired measurement")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
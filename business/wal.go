@@ -0,0 +1,249 @@
+package business
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// walRecord is a line of the write-ahead log. Exactly one field is set.
+//
+// A log replays to the same state however many times it is replayed: a
+// measurement is logged as the value stored after its transform and add mode,
+// and the other changes as the edit itself, which applies the same way on top
+// of the graph the log posted before it. Only a restore is logged as the full
+// state it restored. Expiry is not logged: the measurements of a replayed log
+// expire from the time they were stored.
+type walRecord struct {
+	Graph       *walGraph            `json:"graph,omitempty"`
+	Measurement *snapshotMeasurement `json:"measurement,omitempty"`
+	Edges       *walEdgeEdit         `json:"edges,omitempty"`
+	RemoveNode  string               `json:"removeNode,omitempty"`
+	Clear       bool                 `json:"clear,omitempty"`
+	Reset       bool                 `json:"reset,omitempty"`
+	State       json.RawMessage      `json:"state,omitempty"`
+}
+
+// walEdgeEdit is the JSON form of an EdgeEdit.
+type walEdgeEdit struct {
+	Add    [][]string `json:"add,omitempty"`
+	Remove [][]string `json:"remove,omitempty"`
+}
+
+// walGraph is the JSON form of a Graph posted with a GraphUpdate.
+type walGraph struct {
+	Directed   bool                         `json:"directed,omitempty"`
+	Nodes      []string                     `json:"nodes"`
+	Edges      map[string][]string          `json:"edges"`
+	Weights    []snapshotEdge               `json:"weights,omitempty"`
+	Roles      map[string]NodeRole          `json:"roles,omitempty"`
+	Transforms map[string]snapshotTransform `json:"transforms,omitempty"`
+	Aliases    map[string]string            `json:"aliases,omitempty"`
+}
+
+// WithWriteAheadLog makes the loop append every change of the graph and the
+// measurements to w as newline-delimited JSON after applying it, before
+// replying. Replay reads such a log back into a new grid. Write errors are
+// logged and do not fail the event.
+func WithWriteAheadLog(w io.Writer) GridOption {
+	return func(s *Grid) {
+		s.wal = w
+	}
+}
+
+// Replay applies the records of a write-ahead log written through
+// WithWriteAheadLog, ignoring the recompute budget, and returns how many it
+// applied along with the length of the log up to the last complete record. A
+// last line without its newline, cut short by an unclean shutdown, is skipped;
+// callers appending to the same log should truncate it to that length first.
+// Records are not logged again while replaying. Like the rest of Grid it must
+// not be called while Loop runs.
+func (s *Grid) Replay(r io.Reader) (records int, valid int64, err error) {
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Every record is written with its newline, so a last line
+			// without one was cut short.
+			if len(bytes.TrimSpace(data)) > 0 {
+				s.logger.Warn("skipping truncated write-ahead log record", "line", line)
+			}
+			break
+		}
+		if err != nil {
+			return records, valid, err
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			var rec walRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return records, valid, fmt.Errorf("write-ahead log line %d: %w", line, err)
+			}
+			if err := s.replayRecord(rec); err != nil {
+				return records, valid, fmt.Errorf("write-ahead log line %d: %w", line, err)
+			}
+			records++
+		}
+		valid += int64(len(data))
+	}
+
+	if records > 0 {
+		// Measurements that expired since they were logged go, as a tick of
+		// the loop would have dropped them.
+		s.reapExpired()
+		s.remapPeaks(nil, nil, nil)
+		s.commit()
+	}
+	return records, valid, nil
+}
+
+// replayRecord applies a single record of the write-ahead log.
+func (s *Grid) replayRecord(rec walRecord) error {
+	switch {
+	case rec.Graph != nil:
+		s.applyGraph(rec.Graph.graph())
+	case rec.Measurement != nil:
+		s.restoreMeasurement(*rec.Measurement)
+	case rec.Edges != nil:
+		if res := s.editEdges(EdgeEdit{Add: rec.Edges.Add, Remove: rec.Edges.Remove}); res.Err != nil {
+			return res.Err
+		}
+	case rec.RemoveNode != "":
+		if res, _ := s.removeNode(rec.RemoveNode); res.Err != nil {
+			return res.Err
+		}
+	case rec.Clear:
+		s.clearMeasurements()
+	case rec.Reset:
+		s.reset()
+	case rec.State != nil:
+		return s.Restore(rec.State)
+	default:
+		return errors.New("empty record")
+	}
+	return nil
+}
+
+// logGraph appends a graph update to the write-ahead log.
+func (s *Grid) logGraph(g Graph) {
+	if s.wal == nil {
+		return
+	}
+	wg := walGraph{
+		Directed: g.Directed,
+		Nodes:    g.Nodes,
+		Edges:    g.Edges,
+		Roles:    g.Roles,
+		Aliases:  g.Aliases,
+	}
+	for e, w := range g.Weights {
+		wg.Weights = append(wg.Weights, snapshotEdge{From: e[0], To: e[1], Weight: &w})
+	}
+	if len(g.Transforms) > 0 {
+		wg.Transforms = make(map[string]snapshotTransform, len(g.Transforms))
+		for n, t := range g.Transforms {
+			wg.Transforms[n] = snapshotTransform{Scale: t.Scale, Offset: t.Offset}
+		}
+	}
+	s.appendWAL(walRecord{Graph: &wg})
+}
+
+// logMeasurement appends the stored measurement of the node with the given ID
+// to the write-ahead log.
+func (s *Grid) logMeasurement(id int) {
+	if s.wal == nil {
+		return
+	}
+	m := s.measurements[id]
+	s.appendWAL(walRecord{Measurement: &snapshotMeasurement{Node: s.nodes.names[id], Value: m.value, Source: m.source, At: m.at, Taken: m.taken}})
+}
+
+// logEdgeEdit appends an edge edit to the write-ahead log.
+func (s *Grid) logEdgeEdit(e EdgeEdit) {
+	if s.wal == nil {
+		return
+	}
+	s.appendWAL(walRecord{Edges: &walEdgeEdit{Add: e.Add, Remove: e.Remove}})
+}
+
+// logNodeRemoval appends the removal of node, named as in the graph rather
+// than by an alias, to the write-ahead log.
+func (s *Grid) logNodeRemoval(node string) {
+	if s.wal == nil {
+		return
+	}
+	s.appendWAL(walRecord{RemoveNode: node})
+}
+
+// logClear appends a clear of the measurements to the write-ahead log.
+func (s *Grid) logClear() {
+	if s.wal == nil {
+		return
+	}
+	s.appendWAL(walRecord{Clear: true})
+}
+
+// logReset appends a reset to the write-ahead log.
+func (s *Grid) logReset() {
+	if s.wal == nil {
+		return
+	}
+	s.appendWAL(walRecord{Reset: true})
+}
+
+// logState appends a snapshot of the whole state to the write-ahead log.
+func (s *Grid) logState() {
+	if s.wal == nil {
+		return
+	}
+	data, err := s.Snapshot()
+	if err != nil {
+		s.logger.Error("write-ahead log snapshot failed", "error", err)
+		return
+	}
+	s.appendWAL(walRecord{State: data})
+}
+
+// appendWAL writes rec as a line of the write-ahead log.
+func (s *Grid) appendWAL(rec walRecord) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		s.logger.Error("write-ahead log encoding failed", "error", err)
+		return
+	}
+	if _, err := s.wal.Write(append(data, '\n')); err != nil {
+		s.logger.Error("write-ahead log write failed", "error", err)
+	}
+}
+
+// graph returns the Graph described by wg.
+func (wg walGraph) graph() Graph {
+	g := Graph{
+		Nodes:    wg.Nodes,
+		Edges:    wg.Edges,
+		Roles:    wg.Roles,
+		Aliases:  wg.Aliases,
+		Directed: wg.Directed,
+	}
+	if g.Edges == nil {
+		g.Edges = map[string][]string{}
+	}
+	for _, e := range wg.Weights {
+		if e.Weight == nil {
+			continue
+		}
+		if g.Weights == nil {
+			g.Weights = make(map[[2]string]float64, len(wg.Weights))
+		}
+		g.Weights[[2]string{e.From, e.To}] = *e.Weight
+	}
+	if len(wg.Transforms) > 0 {
+		g.Transforms = make(map[string]Transform, len(wg.Transforms))
+		for n, t := range wg.Transforms {
+			g.Transforms[n] = Transform{Scale: t.Scale, Offset: t.Offset}
+		}
+	}
+	return g
+}
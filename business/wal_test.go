@@ -0,0 +1,225 @@
+package business
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// walScenarios returns event sequences exercising every kind of WAL record.
+func walScenarios() []struct {
+	name   string
+	events []Event
+} {
+	weighted := NewGraph([]string{"A", "B", "C", "D"}, [][]string{{"A", "B"}, {"C", "D"}})
+	weighted.Weights = map[[2]string]float64{{"A", "B"}: 2.5}
+	weighted.Roles = map[string]NodeRole{"D": RoleSink}
+	weighted.Transforms = map[string]Transform{"C": {Scale: 2, Offset: 1}}
+	weighted.Aliases = map[string]string{"legacy-a": "A"}
+
+	chain := NewGraph([]string{"A", "B", "C", "D"}, [][]string{{"A", "B"}, {"B", "C"}, {"C", "D"}})
+	chain.Aliases = map[string]string{"legacy-d": "D"}
+
+	return []struct {
+		name   string
+		events []Event
+	}{
+		{name: "empty log", events: nil},
+		{name: "graph and measurements", events: []Event{
+			GraphUpdate{Graph: weighted},
+			MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "legacy-a", Value: 1, Source: "agent"}},
+			MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2, Mode: MeasurementAdd}},
+			MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "C", Value: 3}},
+			BatchMeasurementUpdate{Measurements: []NodeMeasurement{{Node: "B", Value: 4}, {Node: "D", Value: 5}}},
+		}},
+		{name: "edits, removals and clears", events: []Event{
+			GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})},
+			MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}},
+			MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "C", Value: 3}},
+			EdgeEdit{Add: [][]string{{"B", "C"}}},
+			NodeRemove{Node: "A"},
+			ClearMeasurements{},
+			MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 6}},
+		}},
+		{name: "edge removals and aliased node removals", events: []Event{
+			GraphUpdate{Graph: chain},
+			MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "D", Value: 4}},
+			MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 1}},
+			EdgeEdit{Remove: [][]string{{"B", "C"}}},
+			EdgeEdit{Add: [][]string{{"A", "C"}}, Remove: [][]string{{"A", "B"}}},
+			NodeRemove{Node: "legacy-d"},
+		}},
+		{name: "reset", events: []Event{
+			GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})},
+			MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}},
+			ResetEvent{},
+			GraphUpdate{Graph: NewDirectedGraph([]string{"X", "Y"}, [][]string{{"X", "Y"}, {"Y", "X"}})},
+			MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "X", Value: 7}},
+		}},
+	}
+}
+
+func TestWriteAheadLogReplay(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range walScenarios() {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var log bytes.Buffer
+			src := NewGrid(WithClock(testClock), WithWriteAheadLog(&log))
+			for _, evt := range tt.events {
+				src.update(evt)
+			}
+			data := log.Bytes()
+
+			dst := NewGrid()
+			records, valid, err := dst.Replay(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Replay() error: %v", err)
+			}
+			if want := bytes.Count(data, []byte("\n")); records != want || valid != int64(len(data)) {
+				t.Fatalf("Replay() = %d records, %d bytes, want %d, %d", records, valid, want, len(data))
+			}
+			checkReplayed(t, dst, src, "after replay")
+
+			// Replaying again, as after a restart that kept the state, changes
+			// nothing.
+			if _, _, err := dst.Replay(bytes.NewReader(data)); err != nil {
+				t.Fatalf("second Replay() error: %v", err)
+			}
+			checkReplayed(t, dst, src, "after a second replay")
+		})
+	}
+}
+
+func TestWriteAheadLogRecordsEdits(t *testing.T) {
+	t.Parallel()
+
+	// Only a restore is logged as a full state: edits, removals, clears and
+	// resets are logged as themselves, so the log grows with the size of the
+	// change rather than of the grid.
+	for _, tt := range walScenarios() {
+		var log bytes.Buffer
+		grid := NewGrid(WithClock(testClock), WithWriteAheadLog(&log))
+		for _, evt := range tt.events {
+			grid.update(evt)
+		}
+		if strings.Contains(log.String(), `"state"`) {
+			t.Fatalf("%s: log = %s, want no full state records", tt.name, log.String())
+		}
+	}
+}
+
+func TestReplayExpiresMeasurements(t *testing.T) {
+	t.Parallel()
+
+	now := testTime
+	clock := func() time.Time { return now }
+
+	var log bytes.Buffer
+	src := NewGrid(WithClock(clock), WithMeasurementTTL(time.Minute), WithWriteAheadLog(&log))
+	src.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, nil)})
+	src.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}})
+	now = testTime.Add(30 * time.Second)
+	src.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 3}})
+
+	// Reaping A is not logged: replay expires it from the time it was stored.
+	now = testTime.Add(time.Minute)
+	logged := log.Len()
+	src.update(TickEvent{})
+	if log.Len() != logged {
+		t.Fatalf("reaping appended %q to the log, want nothing", log.String()[logged:])
+	}
+
+	dst := NewGrid(WithClock(clock), WithMeasurementTTL(time.Minute))
+	if _, _, err := dst.Replay(bytes.NewReader(log.Bytes())); err != nil {
+		t.Fatalf("Replay() error: %v", err)
+	}
+	if d := dst.nodeDetail("A"); d.Measured {
+		t.Fatalf("detail of A after replay = %+v, want it expired", d)
+	}
+	checkReplayed(t, dst, src, "after replay")
+}
+
+// checkReplayed fails unless got holds the same graph and measurements as want.
+func checkReplayed(t *testing.T, got, want *Grid, when string) {
+	t.Helper()
+
+	if !reflect.DeepEqual(partition(got.islands), partition(want.islands)) {
+		t.Fatalf("%s: islands = %v, want %v", when, got.islands, want.islands)
+	}
+	if g, w := got.currentTotals(), want.currentTotals(); !reflect.DeepEqual(g, w) {
+		t.Fatalf("%s: totals = %+v, want %+v", when, g, w)
+	}
+	if g, w := edgeList(got), edgeList(want); !reflect.DeepEqual(g, w) {
+		t.Fatalf("%s: edges = %v, want %v", when, g, w)
+	}
+	for _, n := range []string{"A", "B", "C", "D", "X", "Y"} {
+		if g, w := got.nodeDetail(n), want.nodeDetail(n); g != w {
+			t.Fatalf("%s: detail of %s = %+v, want %+v", when, n, g, w)
+		}
+	}
+}
+
+func TestReplayTruncatedLog(t *testing.T) {
+	t.Parallel()
+
+	var log bytes.Buffer
+	src := NewGrid(WithWriteAheadLog(&log))
+	src.update(GraphUpdate{Graph: NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}})})
+	src.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 2}})
+	complete := log.Len()
+	src.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "B", Value: 3}})
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "cut mid-record", data: log.String()[:log.Len()-10]},
+		{name: "cut before the newline", data: log.String()[:log.Len()-1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grid := NewGrid()
+			records, valid, err := grid.Replay(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("Replay() error: %v", err)
+			}
+			if records != 2 || valid != int64(complete) {
+				t.Fatalf("Replay() = %d records, %d bytes, want 2, %d", records, valid, complete)
+			}
+			if got := grid.currentTotals(); len(got) != 1 || got[0].Total != 2 {
+				t.Fatalf("totals = %+v, want 2 from A alone", got)
+			}
+		})
+	}
+}
+
+func TestReplayRejectsCorruptRecords(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "not JSON", data: "nope\n{}\n"},
+		{name: "empty record", data: "{}\n"},
+		{name: "invalid state", data: `{"state":{"version":99}}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, _, err := NewGrid().Replay(strings.NewReader(tt.data)); err == nil {
+				t.Fatalf("Replay(%q) succeeded, want an error", tt.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package business
+
+import "time"
+
+// With an aggregation window or a TTL, a measurement stops counting toward the
+// totals as the clock advances, without an event. The cached totals therefore
+// carry the time the first of their measurements expires and are rebuilt once
+// it has passed. Loop also wakes up then, so the decayed totals get a state
+// version of their own and reach the subscribers.
+
+// expiryCheck commits and publishes the totals once a measurement stopped
+// counting toward them. The loop processes it when the first one expires.
+type expiryCheck struct{}
+
+// windowStart returns the oldest time a measurement counting toward the totals
+// at now may have been stored at, the zero time when there is no window.
+func (s *Grid) windowStart(now time.Time) time.Time {
+	if s.window <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-s.window)
+}
+
+// counts reports whether m contributes to the totals at now, for a window
+// starting at start.
+func (m measurement) counts(now, start time.Time) bool {
+	return m.ok && !m.at.Before(start) && !m.expired(now)
+}
+
+// expiryOf returns when m stops counting toward the totals, the zero time if
+// it never does.
+func (s *Grid) expiryOf(m measurement) time.Time {
+	expiry := m.expires
+	if s.window > 0 {
+		if end := m.at.Add(s.window); expiry.IsZero() || end.Before(expiry) {
+			expiry = end
+		}
+	}
+	return expiry
+}
+
+// noteExpiry records when m stops counting, so the cached totals are rebuilt
+// by then.
+func (s *Grid) noteExpiry(m measurement) {
+	if expiry := s.expiryOf(m); !expiry.IsZero() && (s.totalsExpiry.IsZero() || expiry.Before(s.totalsExpiry)) {
+		s.totalsExpiry = expiry
+	}
+}
+
+// expireTotals drops the cached totals once one of their measurements has
+// expired, and notes that the totals decayed since the last commit.
+func (s *Grid) expireTotals() {
+	if s.totalsExpiry.IsZero() {
+		return
+	}
+	now := s.now()
+	if now.Before(s.totalsExpiry) {
+		return
+	}
+	s.totals = nil
+	s.decayed = true
+	s.totalsExpiry = time.Time{}
+	start := s.windowStart(now)
+	for _, m := range s.measurements {
+		if m.counts(now, start) {
+			s.noteExpiry(m)
+		}
+	}
+}
+
+// expiryC returns the channel signaling that the first counted measurement
+// stops counting, or nil (blocking forever in a select) when none will.
+func (s *Grid) expiryC() <-chan time.Time {
+	if s.totalsExpiry.IsZero() {
+		if s.expiryTimer != nil {
+			s.expiryTimer.Stop()
+			s.expiryTimer = nil
+		}
+		return nil
+	}
+	if s.expiryTimer == nil || !s.expiryAt.Equal(s.totalsExpiry) {
+		if s.expiryTimer != nil {
+			s.expiryTimer.Stop()
+		}
+		s.expiryTimer = time.NewTimer(s.totalsExpiry.Sub(s.now()))
+		s.expiryAt = s.totalsExpiry
+	}
+	return s.expiryTimer.C
+}
+
+// checkExpiry gives totals that decayed since the last commit a version of
+// their own and publishes them.
+func (s *Grid) checkExpiry() {
+	// The timer fired: expiryC arms a new one, even for the same time.
+	s.expiryTimer = nil
+	s.expireTotals()
+	if s.decayed {
+		s.commit()
+		s.publish(allIslands, false)
+	}
+}
@@ -0,0 +1,146 @@
+package business
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAggregationWindow(t *testing.T) {
+	t.Parallel()
+
+	now := testTime
+	grid := NewGrid(WithAggregationWindow(time.Minute), WithClock(func() time.Time { return now }))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A", "B", "C"}, [][]string{{"A", "B"}})})
+
+	measure := func(at time.Duration, node string, value float64) {
+		now = testTime.Add(at)
+		grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: node, Value: value}})
+	}
+	totals := func(at time.Duration) []float64 {
+		now = testTime.Add(at)
+		var out []float64
+		for _, m := range grid.currentTotals() {
+			out = append(out, m.Total)
+		}
+		// The cache, however it was reached, must agree with a full aggregate.
+		checkTotalsCache(t, grid, at.String())
+		return out
+	}
+
+	measure(0, "A", 1)
+	measure(30*time.Second, "B", 2)
+	measure(40*time.Second, "C", 4)
+
+	steps := []struct {
+		at   time.Duration
+		want []float64
+	}{
+		{at: 45 * time.Second, want: []float64{3, 4}},
+		{at: time.Minute, want: []float64{3, 4}},                  // exactly the window old still counts
+		{at: time.Minute + time.Second, want: []float64{2, 4}},    // A expired
+		{at: 101 * time.Second, want: []float64{0, 0}},            // everything expired
+		{at: 10 * time.Minute, want: []float64{0, 0}},             // and stays so
+		{at: 10*time.Minute + time.Second, want: []float64{0, 0}}, // nothing left to expire
+	}
+	for _, step := range steps {
+		if got := totals(step.at); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("totals at %v = %v, want %v", step.at, got, step.want)
+		}
+	}
+
+	// A fresh measurement counts again, alone in its island.
+	measure(11*time.Minute, "B", 5)
+	if got := totals(11 * time.Minute); !reflect.DeepEqual(got, []float64{5, 0}) {
+		t.Fatalf("totals after B reports again = %v, want [5 0]", got)
+	}
+	if got := grid.currentTotals()[0]; got.MeasuredCount != 1 || got.Min != 5 || got.LastUpdated != testTime.Add(11*time.Minute) {
+		t.Fatalf("island = %+v, want only B counted", got)
+	}
+
+	// Expired values are still stored per node.
+	reply := make(chan NodeDetail, 1)
+	grid.update(NodeDetailQuery{Node: "A", Reply: reply})
+	if got := <-reply; !got.Measured || got.Value != 1 {
+		t.Fatalf("detail of A = %+v, want its stored value 1", got)
+	}
+}
+
+func TestAggregationWindowDisabled(t *testing.T) {
+	t.Parallel()
+
+	now := testTime
+	grid := NewGrid(WithClock(func() time.Time { return now }))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"A"}, nil)})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 1}})
+
+	now = testTime.Add(1000 * time.Hour)
+	if got := grid.currentTotals()[0].Total; got != 1 {
+		t.Fatalf("total = %v, want 1: without a window measurements never expire", got)
+	}
+}
+
+func TestAggregationWindowHotspotAndNamespaces(t *testing.T) {
+	t.Parallel()
+
+	now := testTime
+	grid := NewGrid(WithAggregationWindow(time.Minute), WithClock(func() time.Time { return now }))
+	grid.update(GraphUpdate{Graph: NewGraph([]string{"eu.A", "eu.B", "us.C"}, [][]string{{"eu.A", "eu.B"}})})
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "eu.B", Value: 7}})
+	now = testTime.Add(30 * time.Second)
+	grid.update(MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "eu.A", Value: 2}})
+
+	// eu.B falls out of the window.
+	now = testTime.Add(61 * time.Second)
+	if got := hotspot(grid); got == nil || got.Node != "eu.A" || got.Total != 2 {
+		t.Fatalf("hotspot = %+v, want eu.A with the windowed total 2", got)
+	}
+	ns := islandNamespaces(grid, 1, ".")
+	if total := grid.currentTotals()[0].Total; ns[0].Total != total || ns[0].Namespaces[0].Total != total {
+		t.Fatalf("namespaces = %+v, want the windowed total %v", ns[0], total)
+	}
+
+	now = testTime.Add(91 * time.Second)
+	if got := hotspot(grid); got != nil {
+		t.Fatalf("hotspot = %+v, want none once every measurement left the window", got)
+	}
+}
+
+func TestAggregationWindowExpiryAdvancesVersion(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan Event, 16)
+	go NewGrid(WithAggregationWindow(50*time.Millisecond)).Loop(ctx, events)
+
+	events <- GraphUpdate{Graph: NewGraph([]string{"A"}, nil)}
+	updates := make(chan TotalsUpdate, 4)
+	subscribed := make(chan VersionedTotals, 1)
+	events <- Subscribe{Updates: updates, Done: make(chan struct{}), Reply: subscribed}
+	<-subscribed
+
+	reply := make(chan MeasurementResult, 1)
+	events <- MeasurementUpdate{NodeMeasurement: NodeMeasurement{Node: "A", Value: 3}, Reply: reply}
+	measured := (<-reply).Version
+	if got := <-updates; got.Totals[0].Total != 3 {
+		t.Fatalf("update = %+v, want total 3", got)
+	}
+
+	// Without another event, the decayed total is published as a new version.
+	select {
+	case got := <-updates:
+		if got.Totals[0].Total != 0 || got.Version <= measured {
+			t.Fatalf("update after the window = %+v, want total 0 after version %d", got, measured)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update once the measurement left the window")
+	}
+	version := make(chan uint64, 1)
+	events <- VersionQuery{Reply: version}
+	if got := <-version; got <= measured {
+		t.Fatalf("version = %d, want past %d", got, measured)
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"flag"
 	"fmt"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -19,10 +21,15 @@ var (
 
 	help        = flag.Bool("help", false, "show help message")
 	showVersion = flag.Bool("version", false, "show command version")
-	addr        = flag.String("addr", ":8000", "HTTP network address")
+	addr        = flag.String("addr", ":8000", "HTTP network address (or unix:/path/to/sock)")
 	nodeCount   = flag.Int("nodes", 100, "number of nodes in the topology graph")
 	edgeCount   = flag.Int("edges", 150, "number of random edges in the topology graph")
+	connected   = flag.Bool("connected", false, "spend the first nodes-1 edges on a spanning tree, so the graph is a single island")
 	interval    = flag.Duration("interval", 20*time.Millisecond, "delay between measurement posts")
+	verbose     = flag.Bool("verbose", false, "print the island totals returned for each measurement")
+	maxRetries  = flag.Int("max-retries", 5, "times a post answered 429 Too Many Requests is retried")
+
+	expectIslands = flag.Int("expect-islands", -1, "after posting the graph, exit with an error unless the server reports this many islands (disabled when negative)")
 )
 
 func main() {
@@ -57,16 +64,32 @@ func run(ctx context.Context) error {
 	if *interval <= 0 {
 		return fmt.Errorf("invalid -interval: must be > 0")
 	}
+	if *maxRetries < 0 {
+		return fmt.Errorf("invalid -max-retries: must be >= 0")
+	}
 
 	baseURL := buildBaseURL(*addr)
-	httpClient := &http.Client{Timeout: 5 * time.Second}
+	httpClient := newHTTPClient(*addr)
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-	graph := buildRandomGraph(rng, *nodeCount, *edgeCount)
-	if err := postJSON(ctx, httpClient, baseURL, "/graph", graph); err != nil {
+	graph := buildRandomGraph(rng, *nodeCount, *edgeCount, *connected)
+	if err := postJSON(ctx, httpClient, baseURL, "/graph", *maxRetries, graph, nil); err != nil {
 		return fmt.Errorf("send graph: %w", err)
 	}
 
+	// Smoke-test mode: check the server's view of the topology and stop.
+	if *expectIslands >= 0 {
+		got, err := fetchIslandCount(ctx, httpClient, baseURL)
+		if err != nil {
+			return fmt.Errorf("fetch islands: %w", err)
+		}
+		if got != *expectIslands {
+			return fmt.Errorf("island count mismatch: expected %d, server reports %d", *expectIslands, got)
+		}
+		fmt.Printf("island count ok: %d\n", got)
+		return nil
+	}
+
 	nodes := graph.Nodes
 	t := time.NewTicker(*interval)
 	defer t.Stop()
@@ -83,9 +106,18 @@ func run(ctx context.Context) error {
 			Value: rng.Float64() * 100,
 		}
 
-		if err := postJSON(ctx, httpClient, baseURL, "/measurements", p); err != nil {
+		// The totals are only decoded when they are printed.
+		var totals []IslandMeasurement
+		var out any
+		if *verbose {
+			out = &totals
+		}
+		if err := postJSON(ctx, httpClient, baseURL, "/measurements", *maxRetries, p, out); err != nil {
 			return fmt.Errorf("send measurement: %w", err)
 		}
+		if *verbose {
+			fmt.Printf("%s=%s -> %s\n", p.Node, strconv.FormatFloat(p.Value, 'f', 2, 64), formatTotals(totals))
+		}
 	}
 }
 
@@ -99,29 +131,161 @@ type MeasurementPayload struct {
 	Value float64 `json:"value"`
 }
 
-func postJSON(ctx context.Context, client *http.Client, baseURL, path string, payload any) error {
+// IslandMeasurement mirrors the island entries of a /measurements response,
+// the JSON form of business.IslandMeasurement, with the fields the client prints.
+type IslandMeasurement struct {
+	Island []string
+	Total  float64
+}
+
+// formatTotals returns a one-line summary of totals: the index and total of
+// every island, e.g. "0:12.5 1:3".
+func formatTotals(totals []IslandMeasurement) string {
+	parts := make([]string, len(totals))
+	for i, t := range totals {
+		parts[i] = strconv.Itoa(i) + ":" + strconv.FormatFloat(t.Total, 'g', -1, 64)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Retry delays when the server answers 429 without a usable Retry-After.
+const (
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+)
+
+// postJSON posts payload as JSON to path and, when out is not nil, decodes the
+// response body into it. A 429 Too Many Requests, which the server sends while
+// its event queue is full, is retried up to maxRetries times, after the delay
+// of its Retry-After header or else an exponential backoff.
+func postJSON(ctx context.Context, client *http.Client, baseURL, path string, maxRetries int, payload, out any) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("marshal payload: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+path, bytes.NewReader(body))
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("POST %s: %w", path, err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			delay := retryDelay(resp.Header.Get("Retry-After"), attempt, time.Now())
+			resp.Body.Close()
+			if err := sleep(ctx, delay); err != nil {
+				return fmt.Errorf("POST %s: %w", path, err)
+			}
+			continue
+		}
+
+		err = readResponse(resp, path, out)
+		resp.Body.Close()
+		return err
+	}
+}
+
+// readResponse checks the status of resp and, when out is not nil, decodes its
+// body into it.
+func readResponse(resp *http.Response, path string, out any) error {
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("POST %s: unexpected status %s", path, resp.Status)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("POST %s: decode response: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// retryDelay returns how long to wait before retrying a request answered 429
+// for the attempt-th time, counting from 0. A Retry-After in seconds or as an
+// HTTP date wins; without one the delay doubles from retryBaseDelay up to
+// retryMaxDelay.
+func retryDelay(retryAfter string, attempt int, now time.Time) time.Duration {
+	if retryAfter != "" {
+		if secs, err := strconv.Atoi(retryAfter); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+		if at, err := http.ParseTime(retryAfter); err == nil {
+			return max(at.Sub(now), 0)
+		}
+	}
+
+	delay := retryBaseDelay
+	for range attempt {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
+
+// sleep waits for d, returning the context's error early when ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// fetchIslandCount reads the number of islands of the current graph from the
+// server.
+func fetchIslandCount(ctx context.Context, client *http.Client, baseURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/islands/metrics", nil)
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return 0, fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("POST %s: %w", path, err)
+		return 0, fmt.Errorf("GET /islands/metrics: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		return fmt.Errorf("POST %s: unexpected status %s", path, resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("GET /islands/metrics: unexpected status %s", resp.Status)
 	}
 
-	return nil
+	var islands []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&islands); err != nil {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+	return len(islands), nil
+}
+
+// newHTTPClient returns the client used to talk to the server. For
+// "unix:/path/to/sock" addresses every connection is dialed on the socket,
+// regardless of the host in the request URL.
+func newHTTPClient(addr string) *http.Client {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	path, ok := strings.CutPrefix(strings.TrimSpace(addr), "unix:")
+	if !ok {
+		return client
+	}
+
+	var d net.Dialer
+	client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+	return client
 }
 
 func buildBaseURL(addr string) string {
@@ -130,6 +294,11 @@ func buildBaseURL(addr string) string {
 		return "http://127.0.0.1:8000"
 	}
 
+	// The host is ignored by the unix socket transport, it only needs to be valid.
+	if strings.HasPrefix(addr, "unix:") {
+		return "http://unix"
+	}
+
 	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
 		return strings.TrimRight(addr, "/")
 	}
@@ -142,13 +311,25 @@ func buildBaseURL(addr string) string {
 	return "http://" + addr
 }
 
-func buildRandomGraph(rng *rand.Rand, nodeCount, edgeCount int) GraphPayload {
+// buildRandomGraph returns nodeCount nodes joined by edgeCount random edges.
+// When connected is set, the first nodeCount-1 edges chain the nodes in a
+// random order, a spanning tree that makes the graph a single island, and only
+// the remaining edges are random; the tree is built in full even when
+// edgeCount is smaller.
+func buildRandomGraph(rng *rand.Rand, nodeCount, edgeCount int, connected bool) GraphPayload {
 	nodes := make([]string, 0, nodeCount)
 	for i := range nodeCount {
 		nodes = append(nodes, fmt.Sprintf("N%d", i))
 	}
 
-	var edges [][]string
+	edges := [][]string{}
+	if connected {
+		perm := rng.Perm(len(nodes))
+		for i := 1; i < len(perm); i++ {
+			edges = append(edges, []string{nodes[perm[i-1]], nodes[perm[i]]})
+		}
+		edgeCount = max(edgeCount-len(edges), 0)
+	}
 	for range edgeCount {
 		a := nodes[rng.Intn(len(nodes))]
 		b := nodes[rng.Intn(len(nodes))]
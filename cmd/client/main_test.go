@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"zgrid/api"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+// newTestServer runs a grid behind the full API on an httptest server.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan business.Event, 16)
+	go business.NewGrid().Loop(ctx, events)
+
+	srv := httptest.NewServer(foundation.WrapMiddleware(api.All(), api.GridEventsMiddleware(events)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchIslandCount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		graph GraphPayload
+		want  int
+	}{
+		{
+			name:  "no edges",
+			graph: GraphPayload{Nodes: []string{"A", "B", "C"}, Edges: [][]string{}},
+			want:  3,
+		},
+		{
+			name: "two islands",
+			graph: GraphPayload{
+				Nodes: []string{"A", "B", "C", "D", "E"},
+				Edges: [][]string{{"A", "B"}, {"B", "C"}, {"D", "E"}},
+			},
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newTestServer(t)
+			client := srv.Client()
+
+			if err := postJSON(t.Context(), client, srv.URL, "/graph", 0, tt.graph, nil); err != nil {
+				t.Fatalf("post graph: %v", err)
+			}
+
+			got, err := fetchIslandCount(t.Context(), client, srv.URL)
+			if err != nil {
+				t.Fatalf("fetchIslandCount: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %d islands, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostJSONDecodesTotals(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	client := srv.Client()
+
+	graph := GraphPayload{Nodes: []string{"A", "B", "C"}, Edges: [][]string{{"A", "B"}}}
+	if err := postJSON(t.Context(), client, srv.URL, "/graph", 0, graph, nil); err != nil {
+		t.Fatalf("post graph: %v", err)
+	}
+
+	var totals []IslandMeasurement
+	if err := postJSON(t.Context(), client, srv.URL, "/measurements", 0, MeasurementPayload{Node: "B", Value: 2.5}, &totals); err != nil {
+		t.Fatalf("post measurement: %v", err)
+	}
+	if got, want := formatTotals(totals), "0:2.5 1:0"; got != want {
+		t.Fatalf("totals = %q, want %q", got, want)
+	}
+	if len(totals[0].Island) != 2 {
+		t.Errorf("first island = %v, want A and B", totals[0].Island)
+	}
+}
+
+func TestPostJSONRetriesTooManyRequests(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		busy       int // 429 answers before the server accepts the post
+		maxRetries int
+		wantErr    bool
+		wantCalls  int32
+	}{
+		{name: "no 429", busy: 0, maxRetries: 2, wantCalls: 1},
+		{name: "retried", busy: 2, maxRetries: 2, wantCalls: 3},
+		{name: "retries exhausted", busy: 3, maxRetries: 2, wantErr: true, wantCalls: 3},
+		{name: "retries disabled", busy: 1, maxRetries: 0, wantErr: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if int(calls.Add(1)) <= tt.busy {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.Write([]byte(`[{"Island":["A"],"Total":1}]`))
+			}))
+			t.Cleanup(srv.Close)
+
+			var totals []IslandMeasurement
+			err := postJSON(t.Context(), srv.Client(), srv.URL, "/measurements", tt.maxRetries, MeasurementPayload{Node: "A", Value: 1}, &totals)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("postJSON() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("server saw %d posts, want %d", got, tt.wantCalls)
+			}
+			if !tt.wantErr && formatTotals(totals) != "0:1" {
+				t.Errorf("totals = %+v, want the accepted answer", totals)
+			}
+		})
+	}
+}
+
+func TestPostJSONRetryCanceled(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := postJSON(ctx, srv.Client(), srv.URL, "/graph", 5, GraphPayload{}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("postJSON() error = %v, want the context's deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("postJSON() returned after %v, want it to stop waiting when canceled", elapsed)
+	}
+}
+
+func TestBuildRandomGraphConnected(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	client := srv.Client()
+
+	tests := []struct {
+		name      string
+		nodes     int
+		edges     int
+		wantEdges int
+	}{
+		{name: "single node", nodes: 1, edges: 0, wantEdges: 0},
+		{name: "tree only", nodes: 50, edges: 0, wantEdges: 49},
+		{name: "tree within the edge budget", nodes: 50, edges: 49, wantEdges: 49},
+		{name: "tree and random edges", nodes: 50, edges: 80},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph := buildRandomGraph(rand.New(rand.NewSource(1)), tt.nodes, tt.edges, true)
+			if tt.wantEdges > 0 && len(graph.Edges) != tt.wantEdges {
+				t.Fatalf("got %d edges, want %d", len(graph.Edges), tt.wantEdges)
+			}
+			if len(graph.Edges) > max(tt.edges, tt.nodes-1) {
+				t.Fatalf("got %d edges, want at most %d", len(graph.Edges), max(tt.edges, tt.nodes-1))
+			}
+
+			if err := postJSON(t.Context(), client, srv.URL, "/graph", 0, graph, nil); err != nil {
+				t.Fatalf("post graph: %v", err)
+			}
+			got, err := fetchIslandCount(t.Context(), client, srv.URL)
+			if err != nil {
+				t.Fatalf("fetch islands: %v", err)
+			}
+			if got != 1 {
+				t.Fatalf("got %d islands, want 1", got)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{name: "seconds", retryAfter: "3", attempt: 4, want: 3 * time.Second},
+		{name: "zero seconds", retryAfter: "0", want: 0},
+		{name: "HTTP date", retryAfter: now.Add(7 * time.Second).Format(http.TimeFormat), want: 7 * time.Second},
+		{name: "past HTTP date", retryAfter: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "first backoff", attempt: 0, want: retryBaseDelay},
+		{name: "doubled backoff", attempt: 2, want: 4 * retryBaseDelay},
+		{name: "capped backoff", attempt: 30, want: retryMaxDelay},
+		{name: "invalid header", retryAfter: "soon", attempt: 1, want: 2 * retryBaseDelay},
+		{name: "negative seconds", retryAfter: "-1", attempt: 0, want: retryBaseDelay},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.retryAfter, tt.attempt, now); got != tt.want {
+			t.Errorf("%s: retryDelay(%q, %d) = %v, want %v", tt.name, tt.retryAfter, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTotals(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		totals []IslandMeasurement
+		want   string
+	}{
+		{totals: nil, want: ""},
+		{totals: []IslandMeasurement{{Total: 12.5}}, want: "0:12.5"},
+		{totals: []IslandMeasurement{{Total: 12.5}, {Total: -3}, {Total: 1e21}}, want: "0:12.5 1:-3 2:1e+21"},
+	}
+
+	for _, tt := range tests {
+		if got := formatTotals(tt.totals); got != tt.want {
+			t.Errorf("formatTotals(%v) = %q, want %q", tt.totals, got, tt.want)
+		}
+	}
+}
+
+// TestRunExpectIslands drives run through its flags, so it cannot be parallel.
+func TestRunExpectIslands(t *testing.T) {
+	srv := newTestServer(t)
+
+	prevAddr, prevNodes, prevEdges, prevExpect := *addr, *nodeCount, *edgeCount, *expectIslands
+	t.Cleanup(func() {
+		*addr, *nodeCount, *edgeCount, *expectIslands = prevAddr, prevNodes, prevEdges, prevExpect
+	})
+
+	// Without edges every node is its own island.
+	*addr, *nodeCount, *edgeCount = srv.URL, 4, 0
+
+	tests := []struct {
+		name    string
+		expect  int
+		wantErr string
+	}{
+		{name: "match", expect: 4},
+		{name: "mismatch", expect: 3, wantErr: "expected 3, server reports 4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*expectIslands = tt.expect
+
+			err := run(t.Context())
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("run: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("run error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
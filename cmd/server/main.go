@@ -2,13 +2,21 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 	"zgrid/api"
 	"zgrid/business"
@@ -16,23 +24,53 @@ import (
 )
 
 const (
-	shutdownTimeout = 30 * time.Second
-	bufferSize      = 4096
+	shutdownTimeout   = 30 * time.Second
+	drainTimeout      = 10 * time.Second
+	closeConnsTimeout = 10 * time.Second
+	defaultBufferSize = 4096
 )
 
 var (
 	version = "--- set from makefile ---"
 
-	help        = flag.Bool("help", false, "show help message")
-	showVersion = flag.Bool("version", false, "show command version")
-	addr        = flag.String("addr", ":8000", "HTTP network address")
+	help         = flag.Bool("help", false, "show help message")
+	showVersion  = flag.Bool("version", false, "show command version")
+	addr         = flag.String("addr", ":8000", "HTTP network address (or unix:/path/to/sock)")
+	clfLog       = flag.String("clf-log", "", "also write access logs in Common Log Format to this file (- for stdout, disabled when empty)")
+	apiKeysFile  = flag.String("api-keys-file", "", "file of \"<principal> <key>\" lines; topology changes then require one of the keys (open when empty)")
+	adminToken   = flag.String("admin-token", "", "bearer token for the /admin routes (disabled when empty)")
+	buffer       = flag.Int("buffer", defaultBufferSize, "events queued for the grid loop; a larger queue absorbs longer bursts before 429s, at the cost of memory and latency")
+	backpressure = flag.Duration("backpressure-timeout", api.DefaultBackpressureTimeout, "how long a request waits for a full event queue before 429 (0 waits until the request ends)")
+	corsOrigins  = flag.String("cors-origins", "", "comma-separated origins allowed to call the API from a browser, * for any (CORS disabled when empty)")
+	corsCreds    = flag.Bool("cors-credentials", false, "allow credentialed CORS requests from the listed -cors-origins")
+	coalesce     = flag.Duration("coalesce", 0, "hold measurements this long so only the last one per node is applied (0 applies every one)")
+	gzipOn       = flag.Bool("gzip", true, "gzip responses for clients that accept it")
+	gzipMinSize  = flag.Int("gzip-min-size", foundation.DefaultGzipMinSize, "smallest response body in bytes that is gzipped")
+	logFormat    = flag.String("log-format", "text", "log output format: text or json")
+	logLevel     = flag.String("log-level", "info", "lowest level logged: debug, info, warn or error")
+	historyDepth = flag.Int("history-depth", 0, "state versions whose totals are kept for GET /measurements?version=, each copied on every change (0 keeps only the current one)")
+	maxBody      = flag.Int64("max-body-size", foundation.DefaultMaxBodySize, "largest JSON request body in bytes, e.g. raise it for graphs with many edges")
+	nodeHistory  = flag.Int("measurement-history", 1, "measurements kept per node for GET /nodes/{node}/history (1 keeps the latest only)")
+	maxSubs      = flag.Int("max-subscribers", api.DefaultMaxSubscribers, "concurrent measurement streams, beyond it new ones get 503")
+	pauseBuffer  = flag.Int("pause-buffer", 0, "measurements queued while paused (0 rejects them with 503)")
+	pprofOn      = flag.Bool("pprof", false, "serve net/http/pprof profiles under /debug/pprof/")
+	recompute    = flag.Duration("recompute-budget", 0, "max time to compute islands before falling back to the previous ones (0 is unbounded)")
+	strictGraph  = flag.Bool("strict-graph", false, "reject graph updates with 409 while measurements are queued")
+	scale        = flag.Float64("scale", 1, "factor applied to every measurement before it is stored")
+	offset       = flag.Float64("offset", 0, "added to every scaled measurement before it is stored (not to add-mode increments)")
+	root         = flag.String("root", "", "reject graphs with nodes unreachable from this node (disabled when empty)")
+	ttl          = flag.Duration("ttl", 0, "expire each measurement this long after it is stored, reaping expired ones as often (0 never expires)")
+	window       = flag.Duration("window", 0, "count only measurements stored within this long toward totals (0 counts the latest of each node forever)")
+	walPath      = flag.String("wal", "", "append every graph and measurement change to this write-ahead log and replay it on startup (disabled when empty)")
+	tlsCert      = flag.String("tls-cert", "", "PEM certificate file; with -tls-key the server speaks HTTPS (plain HTTP when empty)")
+	tlsKey       = flag.String("tls-key", "", "PEM private key file of -tls-cert")
+	tlsClientCA  = flag.String("tls-client-ca", "", "PEM CA bundle; HTTPS clients must present a certificate signed by one of its CAs (mutual TLS disabled when empty)")
+	streamFlush  = flag.Duration("stream-flush", 250*time.Millisecond, "minimum interval between streamed totals (0 sends every change)")
 )
 
-func init() {
+func main() {
 	flag.Parse()
-}
 
-func main() {
 	if *help {
 		flag.Usage()
 		return
@@ -43,9 +81,11 @@ func main() {
 		return
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	logger, err := newLogger(os.Stdout, *logFormat, *logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
@@ -56,6 +96,34 @@ func main() {
 	}
 }
 
+// newTransform returns the transform of the -scale and -offset flags, which
+// must be finite: flag.Float64 accepts NaN and Inf.
+func newTransform(scale, offset float64) (business.Transform, error) {
+	t := business.Transform{Scale: scale, Offset: offset}
+	if err := t.Validate(); err != nil {
+		return business.Transform{}, fmt.Errorf("invalid -scale/-offset: %w", err)
+	}
+	return t, nil
+}
+
+// newLogger returns a logger writing to w in the given format, text or json,
+// from the given level up.
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid -log-level %q: want debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid -log-format %q: want text or json", format)
+}
+
 func run(ctx context.Context, logger *slog.Logger) error {
 	wg := sync.WaitGroup{}
 
@@ -64,36 +132,159 @@ func run(ctx context.Context, logger *slog.Logger) error {
 
 	// Buffer events so measurement updates can queue while a graph recomputation
 	// is in progress, matching docs/golang_exercise.md.
-	events := make(chan business.Event, bufferSize)
-	defer close(events)
+	if *buffer <= 0 {
+		return fmt.Errorf("-buffer must be greater than 0, got %d", *buffer)
+	}
+	events := make(chan business.Event, *buffer)
 
-	grid := business.NewGrid()
-	wg.Go(func() {
-		grid.Loop(ctx, events)
-	})
+	transform, err := newTransform(*scale, *offset)
+	if err != nil {
+		return err
+	}
+
+	graphPolicy := business.AcceptGraphUpdates
+	if *strictGraph {
+		graphPolicy = business.RejectGraphWhilePending
+	}
+	// Measurement events queued for the loop, counted by the handlers.
+	backlog := &business.MeasurementBacklog{}
+	walFile, err := openWAL(*walPath)
+	if err != nil {
+		return err
+	}
+	var walOpt business.GridOption
+	if walFile != nil {
+		defer walFile.Close()
+		walOpt = business.WithWriteAheadLog(walFile)
+	}
+
+	latency := api.NewLatencyStats()
+	// The island gauge is only read by scrapes, once the grid below is set.
+	var grid *business.Grid
+	metrics := api.NewMetrics(func() int { return grid.IslandCount() })
+	grid = business.NewGrid(
+		business.WithPauseBuffer(*pauseBuffer),
+		business.WithGraphUpdatePolicy(graphPolicy),
+		business.WithMeasurementBacklog(backlog),
+		business.WithRecomputeBudget(*recompute),
+		business.WithMeasurementCoalescing(*coalesce),
+		business.WithHistoryDepth(*historyDepth),
+		business.WithMeasurementHistory(*nodeHistory),
+		business.WithAggregationWindow(*window),
+		business.WithMeasurementTTL(*ttl),
+		business.WithTransform(transform),
+		business.WithLogger(logger),
+		walOpt,
+		business.WithEventTimer(func(evt business.Event, d time.Duration) {
+			latency.Observe(evt, d)
+			metrics.ObserveEvent(evt, d)
+		}),
+		business.WithPanicHandler(func(evt business.Event, v any, stack []byte) {
+			logger.Error("panic in grid loop", "event", fmt.Sprintf("%T", evt), "panic", fmt.Sprint(v), "stack", string(stack))
+		}),
+	)
+	// The log is replayed before the loop starts, and so before any request
+	// is served.
+	if walFile != nil {
+		if err := replayWAL(grid, walFile, logger); err != nil {
+			return err
+		}
+	}
+	// The loop outlives the signal: on shutdown it drains the events still
+	// queued once the server stops sending them, see drainEvents. It is only
+	// cancelled when that takes too long, or when run fails.
+	loopCtx, stopLoop := context.WithCancel(context.Background())
+	defer stopLoop()
+	loopDone := make(chan struct{})
+	go func() {
+		defer close(loopDone)
+		grid.Loop(loopCtx, events)
+	}()
 
 	// ----------------------------------------------------------------------------
 	// Server Setup
 
-	handler := foundation.WrapMiddleware(api.All(),
+	clfFile, err := openCLFLog(*clfLog)
+	if err != nil {
+		return err
+	}
+	var clf io.Writer
+	if clfFile != nil {
+		clf = clfFile
+		if clfFile != os.Stdout {
+			defer clfFile.Close()
+		}
+	}
+
+	apiKeys, err := loadAPIKeys(*apiKeysFile)
+	if err != nil {
+		return err
+	}
+
+	websockets := api.NewWebSockets()
+	handler := foundation.WrapMiddleware(api.All(
+		api.WithAdminToken(*adminToken),
+		api.WithAPIKeys(apiKeys),
+		api.WithRequiredRoot(*root),
+		api.WithBackpressureTimeout(*backpressure),
+		api.WithStreamFlushInterval(*streamFlush),
+		api.WithMaxSubscribers(*maxSubs),
+		api.WithPprof(*pprofOn),
+		api.WithLatencyStats(latency),
+		api.WithMetrics(metrics),
+		api.WithMeasurementBacklog(backlog),
+		api.WithWebSockets(websockets),
+	),
 		foundation.WithRequestID,
+		foundation.PrettyJSON,
+		foundation.NegotiateEncoding,
 		foundation.WithLogger(logger),
 		foundation.Recover(logger),
-		foundation.AccessLog(logger),
+		// Scrapes would drown the requests worth reading.
+		foundation.SkipPaths(foundation.AccessLog(logger, func(*http.Request) []slog.Attr {
+			return []slog.Attr{slog.Int("islands", grid.IslandCount())}
+		}), "/metrics"),
+		foundation.SkipPaths(foundation.AccessLogCLF(clf), "/metrics"),
+		corsMiddleware(*corsOrigins, *corsCreds),
+		// Inside the access logs, which thus record the compressed sizes.
+		gzipMiddleware(*gzipOn, *gzipMinSize),
+		foundation.MaxBodySize(*maxBody),
+		api.ReadinessGate(grid.Ready()),
 		api.GridEventsMiddleware(events),
 	)
 
+	tlsConfig, err := loadTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+	if err != nil {
+		return err
+	}
+
 	server := &http.Server{
-		Addr:    *addr,
-		Handler: handler,
+		Addr:      *addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	// Streaming handlers never finish on their own, and Shutdown does not track
+	// WebSockets at all: end both. Shutdown does not wait for the hook itself,
+	// which must be done before events is closed.
+	var shutdownHooks sync.WaitGroup
+	var connsClosed bool
+	shutdownHooks.Add(1)
+	server.RegisterOnShutdown(func() {
+		defer shutdownHooks.Done()
+		connsClosed = closeConnections(events, websockets, closeConnsTimeout, logger)
+	})
+
+	ln, err := listen(*addr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
 	}
 
 	serverErrs := make(chan error, 1)
 	wg.Go(func() {
 		defer close(serverErrs)
 
-		logger.Info("starting http server", "addr", *addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Info("starting http server", "addr", *addr, "tls", tlsConfig != nil, "mutual_tls", *tlsClientCA != "")
+		if err := serve(server, ln); err != nil && err != http.ErrServerClosed {
 			serverErrs <- fmt.Errorf("server error: %w", err)
 		}
 	})
@@ -114,7 +305,286 @@ func run(ctx context.Context, logger *slog.Logger) error {
 		}
 	}
 
+	// No handler is left to send events: let the loop apply the queued ones.
+	shutdownHooks.Wait()
+	if !connsClosed {
+		// A WebSocket handler may still send, so events must stay open.
+		stopLoop()
+		logger.Warn("WebSocket connections did not close in time, dropping the queued events", "queued", len(events), "timeout", closeConnsTimeout)
+	} else if n, drained := drainEvents(events, loopDone, drainTimeout); !drained {
+		stopLoop()
+		logger.Warn("grid loop did not drain the event queue in time, dropping the rest", "queued", n, "timeout", drainTimeout)
+	} else {
+		logger.Info("drained event queue", "events", n)
+	}
+
 	logger.Info("waiting for background tasks to complete")
 	wg.Wait()
 	return nil
 }
+
+// closeConnections ends the connections Shutdown does not wait for: the
+// measurement streams, and the WebSockets, whose handlers would otherwise keep
+// sending events after Shutdown returns. It reports whether every WebSocket
+// handler returned within timeout, after which none sends on events.
+func closeConnections(events chan<- business.Event, websockets *api.WebSockets, timeout time.Duration, logger *slog.Logger) bool {
+	if n, ok := closeSubscribers(events, time.Second); ok {
+		logger.Info("closed measurement streams", "subscribers", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	n, err := websockets.Close(ctx)
+	if err != nil {
+		return false
+	}
+	logger.Info("closed WebSocket connections", "connections", n)
+	return true
+}
+
+// drainEvents closes events, so the grid loop applies the events still queued
+// and then returns, closing done. It waits for that at most timeout and returns
+// how many events were queued and whether the loop finished in time. Nothing
+// may send on events any more.
+func drainEvents(events chan business.Event, done <-chan struct{}, timeout time.Duration) (int, bool) {
+	n := len(events)
+	close(events)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return n, true
+	case <-timer.C:
+		return n, false
+	}
+}
+
+// serve accepts connections on ln, speaking HTTPS when the server has a TLS
+// configuration and plain HTTP otherwise. Either way Shutdown stops it.
+func serve(server *http.Server, ln net.Listener) error {
+	if server.TLSConfig != nil {
+		// The certificate is already in the configuration.
+		return server.ServeTLS(ln, "", "")
+	}
+	return server.Serve(ln)
+}
+
+// loadTLSConfig returns the TLS configuration for the given PEM files, or nil
+// to serve plain HTTP when no certificate is set. The certificate and its key
+// go together. With a client CA bundle, clients must present a certificate
+// signed by one of its CAs.
+func loadTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, errors.New("-tls-client-ca requires -tls-cert and -tls-key")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		data, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading TLS client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("TLS client CA %s holds no PEM certificate", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// closeSubscribers asks the grid loop to end every measurement stream, waiting
+// at most timeout. It reports false when the loop did not answer in time, e.g.
+// because it has already stopped (which closes the streams as well).
+func closeSubscribers(events chan<- business.Event, timeout time.Duration) (int, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	reply := make(chan int, 1)
+	select {
+	case events <- business.CloseSubscribers{Reply: reply}:
+	case <-timer.C:
+		return 0, false
+	}
+	select {
+	case n := <-reply:
+		return n, true
+	case <-timer.C:
+		return 0, false
+	}
+}
+
+// loadAPIKeys reads the API keys file at path: one "<principal> <key>" pair per
+// line, blank lines and lines starting with # ignored. An empty path configures
+// no keys.
+func loadAPIKeys(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading API keys: %w", err)
+	}
+
+	keys := map[string]string{}
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("API keys line %d: want \"<principal> <key>\"", i+1)
+		}
+		if _, dup := keys[fields[1]]; dup {
+			return nil, fmt.Errorf("API keys line %d: key of %s already used", i+1, fields[0])
+		}
+		keys[fields[1]] = fields[0]
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("API keys file %s has no keys", path)
+	}
+	return keys, nil
+}
+
+// corsMiddleware returns the CORS middleware for the comma-separated origins,
+// or nil, which WrapMiddleware skips, when there are none.
+func corsMiddleware(origins string, credentials bool) foundation.Middleware {
+	var allowed []string
+	for o := range strings.SplitSeq(origins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			allowed = append(allowed, o)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	return foundation.CORS(foundation.CORSOptions{
+		AllowedOrigins:   allowed,
+		AllowCredentials: credentials,
+		// Response headers the API documents, so browser clients can read them.
+		ExposedHeaders: []string{foundation.RequestIDHeader, "X-State-Version", "X-Totals-Changed", "X-Measurements-Applied", "Retry-After"},
+		MaxAge:         10 * time.Minute,
+	})
+}
+
+// gzipMiddleware returns the response compression middleware, or nil, which
+// WrapMiddleware skips, when it is disabled.
+func gzipMiddleware(enabled bool, minSize int) foundation.Middleware {
+	if !enabled {
+		return nil
+	}
+	return foundation.Gzip(minSize)
+}
+
+// openCLFLog opens the destination of the Common Log Format access log: none
+// for an empty path, stdout for "-", otherwise the file, appended to.
+func openCLFLog(path string) (*os.File, error) {
+	switch path {
+	case "":
+		return nil, nil
+	case "-":
+		return os.Stdout, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening CLF log: %w", err)
+	}
+	return f, nil
+}
+
+// openWAL opens the write-ahead log at path for replay and appending, creating
+// it if needed, or returns nil for an empty path.
+func openWAL(path string) (*os.File, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening write-ahead log: %w", err)
+	}
+	return f, nil
+}
+
+// replayWAL replays the write-ahead log f into grid. A last record cut short by
+// an unclean shutdown is truncated away, so that new records start on a line of
+// their own.
+func replayWAL(grid *business.Grid, f *os.File, logger *slog.Logger) error {
+	records, valid, err := grid.Replay(f)
+	if err != nil {
+		return fmt.Errorf("replaying write-ahead log: %w", err)
+	}
+	if err := f.Truncate(valid); err != nil {
+		return fmt.Errorf("truncating write-ahead log: %w", err)
+	}
+	logger.Info("replayed write-ahead log", "path", f.Name(), "records", records)
+	return nil
+}
+
+// listen opens the network listener for addr. An address of the form
+// "unix:/path/to/sock" binds a Unix domain socket, removing a stale socket file
+// left behind by a previous run; any other address is treated as TCP.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the socket file once the listener is closed (server shutdown).
+	ln.(*net.UnixListener).SetUnlinkOnClose(true)
+	return ln, nil
+}
+
+// removeStaleSocket removes the socket file a previous run left at path. Any
+// other kind of file is left alone and reported, so a mistyped -addr cannot
+// delete it, and so is a socket something still listens on: only a socket
+// refusing connections is stale.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat stale socket: %w", err)
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket, refusing to remove it", path)
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s: address in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("probe stale socket: %w", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove stale socket: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/coder/websocket"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"zgrid/api"
+	"zgrid/business"
+	"zgrid/foundation"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	t.Parallel()
+
+	// Keep the path short: unix socket paths are limited to ~100 bytes.
+	dir, err := os.MkdirTemp("", "zgrid")
+	if err != nil {
+		t.Fatalf("mkdir temp: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	sock := filepath.Join(dir, "zgrid.sock")
+
+	// A stale socket file from a previous run must not prevent binding.
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	if info, err := os.Lstat(sock); err != nil || info.Mode()&fs.ModeSocket == 0 {
+		t.Fatalf("stale socket = %v, %v, want a socket file left behind", info, err)
+	}
+
+	ln, err := listen("unix:" + sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "ok")
+		}),
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(ln) }()
+
+	var d net.Dialer
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+
+	resp, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatalf("GET over unix socket: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("response = %d %q, want %d %q", resp.StatusCode, body, http.StatusOK, "ok")
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := <-serveErr; err != http.ErrServerClosed {
+		t.Fatalf("serve error = %v, want %v", err, http.ErrServerClosed)
+	}
+
+	if _, err := os.Stat(sock); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("socket file still present after shutdown: %v", err)
+	}
+}
+
+func TestListenUnixKeepsOtherFiles(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "zgrid")
+	if err != nil {
+		t.Fatalf("mkdir temp: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	// A mistyped -addr naming a regular file must not delete it.
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("keep me"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	ln, err := listen("unix:" + path)
+	if err == nil {
+		ln.Close()
+		t.Fatal("listen on a regular file succeeded, want an error")
+	}
+	if !strings.Contains(err.Error(), "not a socket") {
+		t.Errorf("listen error = %v, want it to say the file is not a socket", err)
+	}
+	if b, err := os.ReadFile(path); err != nil || string(b) != "keep me" {
+		t.Fatalf("file after listen = %q, %v, want it untouched", b, err)
+	}
+}
+
+func TestListenUnixKeepsLiveSocket(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "zgrid")
+	if err != nil {
+		t.Fatalf("mkdir temp: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	// Another server still listens on the socket: it must keep it.
+	sock := filepath.Join(dir, "zgrid.sock")
+	live, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen live socket: %v", err)
+	}
+	t.Cleanup(func() { live.Close() })
+
+	ln, err := listen("unix:" + sock)
+	if err == nil {
+		ln.Close()
+		t.Fatal("listen on a live socket succeeded, want an error")
+	}
+	if !strings.Contains(err.Error(), "address in use") {
+		t.Errorf("listen error = %v, want it to say the address is in use", err)
+	}
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := live.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		accepted <- err
+	}()
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatalf("dial live socket after listen: %v", err)
+	}
+	conn.Close()
+	if err := <-accepted; err != nil {
+		t.Fatalf("accept on live socket: %v", err)
+	}
+}
+
+func TestCORSMiddlewareFlag(t *testing.T) {
+	t.Parallel()
+
+	for _, origins := range []string{"", " , "} {
+		if mw := corsMiddleware(origins, false); mw != nil {
+			t.Errorf("corsMiddleware(%q) is enabled, want nil", origins)
+		}
+	}
+
+	h := corsMiddleware("https://a.example, https://b.example", true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/islands", nil)
+	req.Header.Set("Origin", "https://b.example")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://b.example" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the listed origin", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "pairs with comments and blank lines",
+			content: "# ops team\nops  k-ops\n\n  ingest\tk-ingest  \n",
+			want:    map[string]string{"k-ops": "ops", "k-ingest": "ingest"},
+		},
+		{name: "line without a key", content: "ops\n", wantErr: true},
+		{name: "key reused", content: "ops k\ningest k\n", wantErr: true},
+		{name: "no keys", content: "# nothing yet\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "keys")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("write keys: %v", err)
+			}
+			got, err := loadAPIKeys(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadAPIKeys error = %v, want error: %v", err, tt.wantErr)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("keys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if keys, err := loadAPIKeys(""); keys != nil || err != nil {
+		t.Errorf("loadAPIKeys(\"\") = %v, %v, want no keys", keys, err)
+	}
+}
+
+func TestReplayWAL(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "grid.wal")
+	if f, err := openWAL(""); f != nil || err != nil {
+		t.Fatalf("openWAL(\"\") = %v, %v, want no log", f, err)
+	}
+
+	// A grid writes a log whose last record is then cut short.
+	f, err := openWAL(path)
+	if err != nil {
+		t.Fatalf("openWAL: %v", err)
+	}
+	src := business.NewGrid(business.WithWriteAheadLog(f))
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan business.Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		src.Loop(ctx, events)
+	}()
+	graph := make(chan business.GraphResult, 1)
+	events <- business.GraphUpdate{Graph: business.NewGraph([]string{"A", "B"}, [][]string{{"A", "B"}}), Reply: graph}
+	<-graph
+	for _, m := range []business.NodeMeasurement{{Node: "A", Value: 2}, {Node: "B", Value: 3}} {
+		reply := make(chan business.MeasurementResult, 1)
+		events <- business.MeasurementUpdate{NodeMeasurement: m, Reply: reply}
+		<-reply
+	}
+	cancel()
+	<-done
+	f.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat log: %v", err)
+	}
+	if err := os.Truncate(path, info.Size()-5); err != nil {
+		t.Fatalf("truncate log: %v", err)
+	}
+
+	f, err = openWAL(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	grid := business.NewGrid(business.WithWriteAheadLog(f))
+	if err := replayWAL(grid, f, slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("replayWAL: %v", err)
+	}
+
+	// Only the measurement of B was lost, and the log now ends on a complete
+	// record, ready for appending.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		t.Fatalf("log after replay = %q, want complete lines", data)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 2 {
+		t.Fatalf("log after replay has %d records, want 2", n)
+	}
+	if grid.IslandCount() != 1 {
+		t.Fatalf("islands after replay = %d, want 1", grid.IslandCount())
+	}
+}
+
+func TestDrainEvents(t *testing.T) {
+	t.Parallel()
+
+	t.Run("queued events are applied", func(t *testing.T) {
+		t.Parallel()
+
+		grid := business.NewGrid()
+		events := make(chan business.Event, 8)
+		events <- business.GraphUpdate{Graph: business.NewGraph([]string{"A", "B"}, nil)}
+		for _, m := range []business.NodeMeasurement{{Node: "A", Value: 2}, {Node: "B", Value: 3}} {
+			events <- business.MeasurementUpdate{NodeMeasurement: m}
+		}
+
+		// The loop starts on a full queue, as one that fell behind.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			grid.Loop(context.Background(), events)
+		}()
+
+		n, ok := drainEvents(events, done, 5*time.Second)
+		if !ok || n > 3 {
+			t.Fatalf("drainEvents() = %d, %t, want at most 3 events drained in time", n, ok)
+		}
+
+		// Every queued measurement counts, as read by a new loop.
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		after := make(chan business.Event)
+		go grid.Loop(ctx, after)
+		reply := make(chan business.VersionedTotals, 1)
+		after <- business.TotalsAtQuery{Latest: true, Reply: reply}
+		if got := <-reply; len(got.Totals) != 2 || got.Totals[0].Total != 2 || got.Totals[1].Total != 3 {
+			t.Fatalf("totals after draining = %+v, want A at 2 and B at 3", got.Totals)
+		}
+	})
+
+	t.Run("a stuck loop times out", func(t *testing.T) {
+		t.Parallel()
+
+		events := make(chan business.Event, 1)
+		events <- business.Ping{}
+		start := time.Now()
+		n, ok := drainEvents(events, make(chan struct{}), 50*time.Millisecond)
+		if ok || n != 1 {
+			t.Fatalf("drainEvents() = %d, %t, want 1 event left undrained", n, ok)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("drainEvents() took %v, want it bounded by the timeout", elapsed)
+		}
+	})
+}
+
+func TestShutdownWithOpenWebSocket(t *testing.T) {
+	t.Parallel()
+
+	grid := business.NewGrid()
+	events := make(chan business.Event, 8)
+	loopDone := make(chan struct{})
+	go func() {
+		defer close(loopDone)
+		grid.Loop(context.Background(), events)
+	}()
+	events <- business.GraphUpdate{Graph: business.NewGraph([]string{"A"}, nil)}
+
+	websockets := api.NewWebSockets()
+	server := &http.Server{Handler: foundation.WrapMiddleware(api.All(api.WithWebSockets(websockets)), api.GridEventsMiddleware(events))}
+	var hooks sync.WaitGroup
+	var closed bool
+	hooks.Add(1)
+	server.RegisterOnShutdown(func() {
+		defer hooks.Done()
+		closed = closeConnections(events, websockets, 5*time.Second, slog.New(slog.DiscardHandler))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go server.Serve(ln)
+
+	ctx := t.Context()
+	conn, _, err := websocket.Dial(ctx, "ws://"+ln.Addr().String()+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.CloseNow()
+
+	// The client keeps sending measurements through the shutdown.
+	sent := make(chan error, 1)
+	go func() {
+		for {
+			if err := conn.Write(ctx, websocket.MessageText, []byte(`{"node":"A","value":1}`)); err != nil {
+				sent <- err
+				return
+			}
+			if _, _, err := conn.Read(ctx); err != nil {
+				sent <- err
+				return
+			}
+		}
+	}()
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+	hooks.Wait()
+	if !closed {
+		t.Fatal("WebSocket handlers did not return on shutdown")
+	}
+	// Closing events would panic a handler still sending on it.
+	if _, ok := drainEvents(events, loopDone, 5*time.Second); !ok {
+		t.Fatal("the loop did not drain the event queue")
+	}
+
+	if err := <-sent; websocket.CloseStatus(err) != websocket.StatusGoingAway {
+		t.Fatalf("client error = %v, want a close with status %d", err, websocket.StatusGoingAway)
+	}
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca, caKey := newTestCert(t, dir, "ca", nil, nil)
+	newTestCert(t, dir, "server", ca, caKey)
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cert, key, caFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem")
+
+	tests := []struct {
+		name       string
+		cert, key  string
+		clientCA   string
+		wantTLS    bool
+		wantMutual bool
+		wantErr    bool
+	}{
+		{name: "plain HTTP"},
+		{name: "TLS", cert: cert, key: key, wantTLS: true},
+		{name: "mutual TLS", cert: cert, key: key, clientCA: caFile, wantTLS: true, wantMutual: true},
+		{name: "certificate without key", cert: cert, wantErr: true},
+		{name: "key without certificate", key: key, wantErr: true},
+		{name: "client CA without certificate", clientCA: caFile, wantErr: true},
+		{name: "missing certificate file", cert: filepath.Join(dir, "missing.pem"), key: key, wantErr: true},
+		{name: "client CA without certificates", cert: cert, key: key, clientCA: garbage, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg, err := loadTLSConfig(tt.cert, tt.key, tt.clientCA)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (cfg != nil) != tt.wantTLS {
+				t.Fatalf("loadTLSConfig() = %v, want TLS %v", cfg, tt.wantTLS)
+			}
+			if cfg != nil && (cfg.ClientAuth == tls.RequireAndVerifyClientCert) != tt.wantMutual {
+				t.Errorf("ClientAuth = %v, want mutual TLS %v", cfg.ClientAuth, tt.wantMutual)
+			}
+		})
+	}
+}
+
+func TestServeMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca, caKey := newTestCert(t, dir, "ca", nil, nil)
+	newTestCert(t, dir, "server", ca, caKey)
+	newTestCert(t, dir, "client", ca, caKey)
+
+	cfg, err := loadTLSConfig(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatalf("loadTLSConfig: %v", err)
+	}
+	ln, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+		}),
+		TLSConfig: cfg,
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- serve(server, ln) }()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key"))
+	if err != nil {
+		t.Fatalf("load client certificate: %v", err)
+	}
+	get := func(certs []tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get("https://" + ln.Addr().String() + "/")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if body, err := get([]tls.Certificate{clientCert}); err != nil || body != "client" {
+		t.Fatalf("GET with a client certificate = %q, %v, want client", body, err)
+	}
+	if _, err := get(nil); err == nil {
+		t.Fatalf("GET without a client certificate succeeded, want a handshake failure")
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := <-serveErr; err != http.ErrServerClosed {
+		t.Fatalf("serve error = %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+// newTestCert writes name.pem and name.key to dir: a certificate for
+// 127.0.0.1 with name as its common name, signed by parent, or a self-signed
+// CA when parent is nil.
+func newTestCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	files := map[string]*pem.Block{
+		name + ".pem": {Type: "CERTIFICATE", Bytes: der},
+		name + ".key": {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+	for file, block := range files {
+		if err := os.WriteFile(filepath.Join(dir, file), pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("write %s: %v", file, err)
+		}
+	}
+	return cert, key
+}
+
+func TestNewTransform(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct{ scale, offset float64 }{
+		{math.NaN(), 0},
+		{math.Inf(1), 0},
+		{1, math.Inf(-1)},
+	} {
+		if _, err := newTransform(tt.scale, tt.offset); err == nil {
+			t.Errorf("newTransform(%v, %v) succeeded, want an error", tt.scale, tt.offset)
+		}
+	}
+	if got, err := newTransform(2, -1); err != nil || got != (business.Transform{Scale: 2, Offset: -1}) {
+		t.Errorf("newTransform(2, -1) = %+v, %v, want scale 2 and offset -1", got, err)
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct{ format, level string }{{"xml", "info"}, {"json", "loud"}} {
+		if _, err := newLogger(io.Discard, tt.format, tt.level); err == nil {
+			t.Errorf("newLogger(%q, %q) succeeded, want an error", tt.format, tt.level)
+		}
+	}
+
+	var text bytes.Buffer
+	logger, err := newLogger(&text, "text", "warn")
+	if err != nil {
+		t.Fatalf("newLogger: %v", err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if got := text.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "level=WARN msg=shown") {
+		t.Errorf("text log at warn = %q, want only the warning", got)
+	}
+
+	// In JSON, every access log line carries the request attributes, the
+	// request ID coming from the logger of WithLogger as in the server chain.
+	var out bytes.Buffer
+	logger, err = newLogger(&out, "json", "info")
+	if err != nil {
+		t.Fatalf("newLogger: %v", err)
+	}
+	h := foundation.WrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), foundation.WithRequestID, foundation.WithLogger(logger), foundation.AccessLog(logger))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.test/islands", nil))
+
+	var line map[string]any
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("access log %q is not a JSON line: %v", out.String(), err)
+	}
+	for _, attr := range []string{"time", "level", "msg", "method", "path", "status", "duration_ms", "remote_ip", "request_id"} {
+		if _, ok := line[attr]; !ok {
+			t.Errorf("access log %s has no %q", out.String(), attr)
+		}
+	}
+	if line["method"] != "GET" || line["path"] != "/islands" || line["status"] != float64(http.StatusTeapot) {
+		t.Errorf("access log = %v, want GET /islands with status 418", line)
+	}
+}
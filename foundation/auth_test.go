@@ -0,0 +1,105 @@
+package foundation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKey(t *testing.T) {
+	t.Parallel()
+
+	keys := map[string]string{"k-ops": "ops", "k-ingest": "ingest"}
+
+	tests := []struct {
+		name          string
+		headers       map[string]string
+		wantStatus    int
+		wantPrincipal string
+		wantError     string
+	}{
+		{
+			name:          "bearer token",
+			headers:       map[string]string{"Authorization": "Bearer k-ops"},
+			wantStatus:    http.StatusNoContent,
+			wantPrincipal: "ops",
+		},
+		{
+			name:          "X-API-Key header",
+			headers:       map[string]string{"X-API-Key": "k-ingest"},
+			wantStatus:    http.StatusNoContent,
+			wantPrincipal: "ingest",
+		},
+		{
+			name:       "missing key",
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "API key required",
+		},
+		{
+			name:       "unknown key",
+			headers:    map[string]string{"Authorization": "Bearer k-opsx"},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "invalid API key",
+		},
+		{
+			name:       "other authorization scheme",
+			headers:    map[string]string{"Authorization": "Basic k-ops"},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "API key required",
+		},
+		{
+			name:       "empty bearer token",
+			headers:    map[string]string{"Authorization": "Bearer "},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "API key required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var principal string
+			h := APIKey(keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = PrincipalFromContext(r.Context())
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if principal != tt.wantPrincipal {
+				t.Errorf("principal = %q, want %q", principal, tt.wantPrincipal)
+			}
+			if tt.wantError == "" {
+				return
+			}
+			if got := rr.Header().Get("WWW-Authenticate"); got != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", got)
+			}
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body.Error != tt.wantError {
+				t.Errorf("body error = %q (%v), want %q", body.Error, err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestPrincipalFromContextWithoutAPIKey(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/", nil)
+	if p, ok := PrincipalFromContext(req.Context()); ok {
+		t.Errorf("principal = %q on an unauthenticated request, want none", p)
+	}
+}
@@ -0,0 +1,190 @@
+package foundation
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Encoder writes response bodies in one media type.
+type Encoder interface {
+	// ContentType is the media type of the encoded bodies.
+	ContentType() string
+	// Encode writes v to w. Values are encoded as they marshal to JSON, so
+	// struct tags and json.Marshaler implementations apply to every encoder.
+	Encode(w io.Writer, v any) error
+}
+
+var (
+	// JSONEncoder writes a JSON document. It is the default encoder.
+	JSONEncoder Encoder = jsonEncoder{}
+	// NDJSONEncoder writes newline-delimited JSON: every element of an array
+	// on its own line, any other value on a single line.
+	NDJSONEncoder Encoder = ndjsonEncoder{}
+	// MsgpackEncoder writes MessagePack. Go integers are encoded as integers
+	// and floats as floats of their own size, whatever their value; objects
+	// keep their JSON key order.
+	MsgpackEncoder Encoder = msgpackEncoder{}
+)
+
+// encoders are the encoders NegotiateEncoding selects from, by media type.
+var encoders = map[string]Encoder{
+	"application/json":      JSONEncoder,
+	"application/x-ndjson":  NDJSONEncoder,
+	"application/msgpack":   MsgpackEncoder,
+	"application/x-msgpack": MsgpackEncoder,
+}
+
+// NegotiateEncoding makes Respond encode bodies in the media type the
+// request's Accept header prefers among application/json,
+// application/x-ndjson and application/msgpack. Without an Accept header, or
+// when it lists none of them, bodies stay JSON.
+func NegotiateEncoding(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if enc := negotiateEncoder(r.Header.Get("Accept")); enc != JSONEncoder {
+			w = &encodingWriter{ResponseWriter: w, enc: enc}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// negotiateEncoder returns the encoder accept prefers. Each encoder takes the
+// quality of the most specific media range matching it, so
+// "*/*, application/msgpack" picks MessagePack and "application/msgpack;q=0"
+// refuses it whatever the wildcards say. Among encoders of equal quality the
+// one matched by the more specific range wins, then the one listed first.
+// Wildcards alone select JSON.
+func negotiateEncoder(accept string) Encoder {
+	type match struct {
+		q           float64
+		specificity int // 2 for type/subtype, 1 for type/*, 0 for */*
+		position    int
+	}
+	matches := make(map[string]match)
+
+	for i, part := range slices.Collect(strings.SplitSeq(accept, ",")) {
+		mediaType, params, _ := strings.Cut(part, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+		q := 1.0
+		for param := range strings.SplitSeq(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) != "q" {
+				continue
+			}
+			if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = f
+			}
+		}
+
+		for offered := range encoders {
+			specificity := -1
+			switch {
+			case mediaType == offered:
+				specificity = 2
+			case mediaType == "application/*":
+				specificity = 1
+			case mediaType == "*/*":
+				specificity = 0
+			}
+			if m, ok := matches[offered]; specificity < 0 || ok && m.specificity >= specificity {
+				continue
+			}
+			matches[offered] = match{q: q, specificity: specificity, position: i}
+		}
+	}
+
+	// Sorted, so the outcome does not depend on map order; JSON first, so it
+	// wins the ties of wildcards.
+	offered := slices.Sorted(maps.Keys(encoders))
+	best, bestMatch := JSONEncoder, match{}
+	for _, mediaType := range offered {
+		m, ok := matches[mediaType]
+		if !ok || m.q <= 0 {
+			continue
+		}
+		if m.q > bestMatch.q ||
+			m.q == bestMatch.q && m.specificity > bestMatch.specificity ||
+			m.q == bestMatch.q && m.specificity == bestMatch.specificity && m.position < bestMatch.position {
+			best, bestMatch = encoders[mediaType], m
+		}
+	}
+	return best
+}
+
+// encodingWriter carries the encoder negotiated for a response.
+type encodingWriter struct {
+	http.ResponseWriter
+	enc Encoder
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (e *encodingWriter) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+// EncoderFor returns the encoder negotiated for w by NegotiateEncoding, or
+// JSONEncoder when there is none.
+func EncoderFor(w http.ResponseWriter) Encoder {
+	for w != nil {
+		if e, ok := w.(*encodingWriter); ok {
+			return e.enc
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	return JSONEncoder
+}
+
+// jsonEncoder writes JSON, indented for PrettyJSON requests.
+type jsonEncoder struct {
+	indent bool
+}
+
+func (jsonEncoder) ContentType() string { return "application/json" }
+
+func (j jsonEncoder) Encode(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	if j.indent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+// ndjsonEncoder writes newline-delimited JSON.
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) ContentType() string { return "application/x-ndjson" }
+
+func (ndjsonEncoder) Encode(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var lines []json.RawMessage
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &lines); err != nil {
+			return err
+		}
+	} else {
+		lines = []json.RawMessage{data}
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,256 @@
+package foundation
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	t.Parallel()
+
+	type entry struct {
+		Island []string `json:"island"`
+		Total  float64  `json:"total"`
+	}
+	list := []entry{{Island: []string{"A", "B"}, Total: 4}, {Island: []string{"C"}, Total: -1.5}}
+
+	tests := []struct {
+		name       string
+		accept     string
+		body       any
+		wantType   string
+		wantBody   []byte
+		wantPretty bool
+	}{
+		{
+			name:     "no Accept header",
+			body:     list,
+			wantType: "application/json",
+			wantBody: []byte(`[{"island":["A","B"],"total":4},{"island":["C"],"total":-1.5}]` + "\n"),
+		},
+		{
+			name:     "wildcard",
+			accept:   "*/*",
+			body:     list,
+			wantType: "application/json",
+			wantBody: []byte(`[{"island":["A","B"],"total":4},{"island":["C"],"total":-1.5}]` + "\n"),
+		},
+		{
+			name:     "unsupported types fall back to JSON",
+			accept:   "text/html, application/xml",
+			body:     ErrorResponse{Error: "nope"},
+			wantType: "application/json",
+			wantBody: []byte(`{"error":"nope"}` + "\n"),
+		},
+		{
+			name:     "ndjson array",
+			accept:   "application/x-ndjson",
+			body:     list,
+			wantType: "application/x-ndjson",
+			wantBody: []byte(`{"island":["A","B"],"total":4}` + "\n" + `{"island":["C"],"total":-1.5}` + "\n"),
+		},
+		{
+			name:     "ndjson object",
+			accept:   "application/x-ndjson",
+			body:     ErrorResponse{Error: "nope"},
+			wantType: "application/x-ndjson",
+			wantBody: []byte(`{"error":"nope"}` + "\n"),
+		},
+		{
+			name:     "ndjson empty array",
+			accept:   "application/x-ndjson",
+			body:     []entry{},
+			wantType: "application/x-ndjson",
+			wantBody: []byte{},
+		},
+		{
+			name:     "msgpack",
+			accept:   "application/msgpack",
+			body:     list,
+			wantType: "application/msgpack",
+			wantBody: []byte{
+				0x92,
+				// A whole float64 is still a float.
+				0x82, 0xa6, 'i', 's', 'l', 'a', 'n', 'd', 0x92, 0xa1, 'A', 0xa1, 'B', 0xa5, 't', 'o', 't', 'a', 'l',
+				0xcb, 0x40, 0x10, 0, 0, 0, 0, 0, 0,
+				0x82, 0xa6, 'i', 's', 'l', 'a', 'n', 'd', 0x91, 0xa1, 'C', 0xa5, 't', 'o', 't', 'a', 'l',
+				0xcb, 0xbf, 0xf8, 0, 0, 0, 0, 0, 0,
+			},
+		},
+		{
+			name:     "msgpack scalars",
+			accept:   "application/x-msgpack",
+			body:     []any{nil, true, false, -5, 200, -200, 70000, "é"},
+			wantType: "application/msgpack",
+			wantBody: []byte{0x98, 0xc0, 0xc3, 0xc2, 0xfb, 0xcc, 0xc8, 0xd1, 0xff, 0x38, 0xce, 0x00, 0x01, 0x11, 0x70, 0xa2, 0xc3, 0xa9},
+		},
+		{
+			name:     "specific type beats a wildcard",
+			accept:   "*/*, application/msgpack",
+			body:     []int{1},
+			wantType: "application/msgpack",
+			wantBody: []byte{0x91, 0x01},
+		},
+		{
+			name:     "refused type despite a wildcard",
+			accept:   "application/msgpack;q=0, application/*",
+			body:     []int{1},
+			wantType: "application/json",
+			wantBody: []byte("[1]\n"),
+		},
+		{
+			name:     "earliest of equal types",
+			accept:   "application/x-ndjson, application/json",
+			body:     []int{1},
+			wantType: "application/x-ndjson",
+			wantBody: []byte("1\n"),
+		},
+		{
+			name:     "highest quality wins",
+			accept:   "application/json;q=0.5, application/x-ndjson;q=0.9, application/msgpack;q=0.1",
+			body:     []int{1, 2},
+			wantType: "application/x-ndjson",
+			wantBody: []byte("1\n2\n"),
+		},
+		{
+			name:     "zero quality is refused",
+			accept:   "application/msgpack;q=0",
+			body:     []int{1},
+			wantType: "application/json",
+			wantBody: []byte("[1]\n"),
+		},
+		{
+			name:       "pretty applies to JSON only",
+			accept:     "application/x-ndjson",
+			body:       list,
+			wantType:   "application/x-ndjson",
+			wantBody:   []byte(`{"island":["A","B"],"total":4}` + "\n" + `{"island":["C"],"total":-1.5}` + "\n"),
+			wantPretty: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// AccessLog wraps the encoding writer, as in the server middleware
+			// chain.
+			h := WrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Respond(w, http.StatusOK, tt.body)
+			}), PrettyJSON, NegotiateEncoding, AccessLog(nil))
+
+			target := "http://example.test/"
+			if tt.wantPretty {
+				target += "?pretty=true"
+			}
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := rr.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("Vary = %q, want Accept", got)
+			}
+			if !bytes.Equal(rr.Body.Bytes(), tt.wantBody) {
+				t.Errorf("body = %q, want %q", rr.Body.Bytes(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMsgpackEncoderFollowsGoTypes(t *testing.T) {
+	t.Parallel()
+
+	type Inner struct {
+		Count int     `json:"count"`
+		Ratio float32 `json:"ratio"`
+	}
+	type outer struct {
+		Inner
+		Name    string            `json:"name,omitempty"`
+		Skipped string            `json:"-"`
+		Count   uint8             `json:"count"` // shadows Inner.Count
+		Labels  map[string]string `json:"labels"`
+		When    *time.Time        `json:",omitempty"`
+		Raw     json.RawMessage   `json:"raw"`
+		hidden  int
+	}
+	when := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		in   any
+		want []byte
+	}{
+		{name: "whole float", in: 2.0, want: []byte{0xcb, 0x40, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "float32", in: float32(0.5), want: []byte{0xca, 0x3f, 0, 0, 0}},
+		{name: "integers", in: []any{0, -1, -33, 128, uint64(math.MaxUint64), int64(math.MinInt64)}, want: []byte{
+			0x96, 0x00, 0xff, 0xd0, 0xdf, 0xcc, 0x80,
+			0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0,
+		}},
+		{name: "nil slice and map", in: []any{[]int(nil), map[string]int(nil)}, want: []byte{0x92, 0xc0, 0xc0}},
+		{name: "map keys sorted", in: map[int]bool{10: true, 2: false}, want: []byte{0x82, 0xa2, '1', '0', 0xc3, 0xa1, '2', 0xc2}},
+		{name: "bytes as base64", in: []byte{1, 2}, want: []byte{0xa4, 'A', 'Q', 'I', '='}},
+		{
+			name: "struct as JSON writes it",
+			in:   outer{Inner: Inner{Count: 1, Ratio: 1}, Skipped: "x", Count: 2, When: &when, Raw: json.RawMessage(`{"n":3}`), hidden: 4},
+			want: slices.Concat(
+				[]byte{0x85},
+				[]byte{0xa5, 'r', 'a', 't', 'i', 'o', 0xca, 0x3f, 0x80, 0, 0},
+				[]byte{0xa5, 'c', 'o', 'u', 'n', 't', 0x02},
+				[]byte{0xa6, 'l', 'a', 'b', 'e', 'l', 's', 0xc0},
+				// time.Time marshals itself to JSON.
+				[]byte{0xa4, 'W', 'h', 'e', 'n', 0xb4}, []byte("2024-03-01T12:00:00Z"),
+				// Numbers of a json.Marshaler have no Go type: they are floats.
+				[]byte{0xa3, 'r', 'a', 'w', 0x81, 0xa1, 'n', 0xcb, 0x40, 0x08, 0, 0, 0, 0, 0, 0},
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			if err := MsgpackEncoder.Encode(&buf, tt.in); err != nil {
+				t.Fatalf("Encode(%v) error: %v", tt.in, err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Fatalf("Encode(%v) = % x, want % x", tt.in, buf.Bytes(), tt.want)
+			}
+		})
+	}
+
+	if err := MsgpackEncoder.Encode(io.Discard, make(chan int)); err == nil {
+		t.Fatal("Encode(chan) succeeded, want an error")
+	}
+}
+
+func TestRespondNoResponseIgnoresEncoding(t *testing.T) {
+	t.Parallel()
+
+	h := NegotiateEncoding(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Respond(w, http.StatusNoContent, NoResponse{})
+	}))
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/", nil)
+	req.Header.Set("Accept", "application/msgpack")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent || rr.Body.Len() != 0 || rr.Header().Get("Content-Type") != "" {
+		t.Fatalf("response = %d %q with Content-Type %q, want an empty 204", rr.Code, rr.Body, rr.Header().Get("Content-Type"))
+	}
+}
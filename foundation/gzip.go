@@ -0,0 +1,157 @@
+package foundation
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultGzipMinSize is the response size below which Gzip sends the body
+// as is: compressing a few hundred bytes saves less than the gzip framing and
+// CPU cost.
+const DefaultGzipMinSize = 1024
+
+// Gzip compresses response bodies of at least minSize bytes for clients that
+// accept gzip. Smaller bodies, bodies already encoded by the handler, HEAD
+// requests and connection upgrades are sent unchanged. The body is buffered
+// until minSize bytes are written, the handler flushes, or it returns.
+//
+// A middleware that wraps Gzip, like AccessLog, sees the compressed body: the
+// byte counts it records are what went on the wire.
+func Gzip(minSize int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" || !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipWriter{ResponseWriter: w, minSize: minSize}
+			next.ServeHTTP(gw, r)
+			gw.close()
+		})
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding of r lists gzip with a
+// non-zero quality.
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for coding := range strings.SplitSeq(v, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+				continue
+			}
+			q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+			if !ok {
+				return true
+			}
+			if f, err := strconv.ParseFloat(q, 64); err == nil && f > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gzipWriter holds the start of a response until it knows whether to compress
+// it: once minSize bytes are buffered it compresses, if the handler flushes or
+// returns first the body goes out as is.
+type gzipWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	status      int    // pending status, 0 until the handler sets one
+	buf         []byte // body written before the decision
+	gz          *gzip.Writer
+	passthrough bool // decided against compressing
+}
+
+func (g *gzipWriter) WriteHeader(code int) {
+	// Informational responses go out at once; the final status is held.
+	if code < http.StatusOK {
+		g.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if g.status == 0 {
+		g.status = code
+	}
+}
+
+func (g *gzipWriter) Write(p []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	switch {
+	case g.gz != nil:
+		return g.gz.Write(p)
+	case g.passthrough:
+		return g.ResponseWriter.Write(p)
+	}
+
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= g.minSize {
+		if err := g.commit(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// commit sends the held status and body, compressed if compress allows it.
+func (g *gzipWriter) commit(compress bool) error {
+	h := g.Header()
+	if compress && h.Get("Content-Encoding") == "" {
+		// A length set by the handler is the uncompressed one.
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		g.ResponseWriter.WriteHeader(g.status)
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+		_, err := g.gz.Write(g.buf)
+		g.buf = nil
+		return err
+	}
+
+	g.passthrough = true
+	g.ResponseWriter.WriteHeader(g.status)
+	_, err := g.ResponseWriter.Write(g.buf)
+	g.buf = nil
+	return err
+}
+
+// decided reports whether the status and start of the body have been sent.
+func (g *gzipWriter) decided() bool {
+	return g.gz != nil || g.passthrough
+}
+
+// Flush sends what is buffered. A response flushed before reaching minSize,
+// like a stream, is not compressed.
+func (g *gzipWriter) Flush() {
+	if !g.decided() {
+		if g.status == 0 {
+			g.status = http.StatusOK
+		}
+		_ = g.commit(false)
+	}
+	if g.gz != nil {
+		_ = g.gz.Flush()
+	}
+	_ = http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// close ends the response once the handler returns.
+func (g *gzipWriter) close() {
+	switch {
+	case g.gz != nil:
+		_ = g.gz.Close()
+	case !g.decided() && g.status != 0:
+		_ = g.commit(false)
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (g *gzipWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
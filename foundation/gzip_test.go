@@ -0,0 +1,197 @@
+package foundation
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGzip(t *testing.T) {
+	t.Parallel()
+
+	large := strings.Repeat(`{"island":["A","B"],"total":1}`, 100)
+
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		handler        http.HandlerFunc
+		wantStatus     int
+		wantGzip       bool
+		wantBody       string
+	}{
+		{
+			name:           "large body is compressed",
+			acceptEncoding: "gzip, deflate, br",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", strconv.Itoa(len(large)))
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusCreated,
+			wantGzip:   true,
+			wantBody:   large,
+		},
+		{
+			name:           "large body in small writes",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				for i := 0; i < len(large); i += 7 {
+					io.WriteString(w, large[i:min(i+7, len(large))])
+				}
+			},
+			wantStatus: http.StatusOK,
+			wantGzip:   true,
+			wantBody:   large,
+		},
+		{
+			name:           "small body is sent as is",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `{"error":"node not found"}`)
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"error":"node not found"}`,
+		},
+		{
+			name: "client without gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   large,
+		},
+		{
+			name:           "gzip refused with q=0",
+			acceptEncoding: "br, gzip;q=0",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   large,
+		},
+		{
+			name:           "gzip with a quality",
+			acceptEncoding: "br;q=1.0, GZIP;q=0.5",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusOK,
+			wantGzip:   true,
+			wantBody:   large,
+		},
+		{
+			name:           "body already encoded by the handler",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "identity")
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   large,
+		},
+		{
+			name:           "status without a body",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:           "flushed body is streamed as is",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "data: 1\n\n")
+				http.NewResponseController(w).Flush()
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "data: 1\n\n" + large,
+		},
+		{
+			name:           "HEAD is not compressed",
+			method:         http.MethodHead,
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "http://example.test/islands", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+			Gzip(DefaultGzipMinSize)(tt.handler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+
+			body := rr.Body.Bytes()
+			if gzipped := rr.Header().Get("Content-Encoding") == "gzip"; gzipped != tt.wantGzip {
+				t.Fatalf("Content-Encoding = %q, want gzip: %v", rr.Header().Get("Content-Encoding"), tt.wantGzip)
+			}
+			if tt.wantGzip {
+				if cl := rr.Header().Get("Content-Length"); cl != "" {
+					t.Errorf("Content-Length = %q on a compressed body, want none", cl)
+				}
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatalf("gzip reader: %v", err)
+				}
+				if body, err = io.ReadAll(zr); err != nil {
+					t.Fatalf("decompress: %v", err)
+				}
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %.60q..., want %.60q...", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestGzipAccessLogCountsCompressedBytes(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	large := strings.Repeat("a", 10*DefaultGzipMinSize)
+
+	h := WrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, large)
+	}), AccessLog(logger), Gzip(DefaultGzipMinSize))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/islands", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if want := `"bytes":` + strconv.Itoa(rr.Body.Len()); !strings.Contains(buf.String(), want) {
+		t.Errorf("access log = %s, want %s (the compressed size)", buf.String(), want)
+	}
+	if rr.Body.Len() >= len(large) {
+		t.Errorf("sent %d bytes, want fewer than the %d uncompressed", rr.Body.Len(), len(large))
+	}
+}
@@ -5,18 +5,29 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type contextKey int
 
+// RequestIDHeader carries the request ID, in both directions: a client can
+// send its own, and every response reports the one used.
+const RequestIDHeader = "X-Request-Id"
+
 const (
 	requestIDKey contextKey = iota
 	loggerKey
+	principalKey
+	maxBodySizeKey
 )
 
 // Middleware represents a standard HTTP middleware.
@@ -60,12 +71,12 @@ func LoggerFromContext(ctx context.Context, base *slog.Logger) *slog.Logger {
 // and the X-Request-Id response header.
 func WithRequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id := r.Header.Get("X-Request-Id")
+		id := r.Header.Get(RequestIDHeader)
 		if id == "" {
 			id = newRequestID()
 		}
 
-		w.Header().Set("X-Request-Id", id)
+		w.Header().Set(RequestIDHeader, id)
 		ctx := context.WithValue(r.Context(), requestIDKey, id)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -90,7 +101,9 @@ func WithLogger(base *slog.Logger) Middleware {
 	}
 }
 
-// Recover recovers from panics, logs a stack trace, and returns a 500.
+// Recover recovers from panics, logs a stack trace, and returns a 500 with a
+// JSON error body like every other error. The X-Request-Id header is set, so
+// the client can quote the ID that appears on the logged panic.
 func Recover(base *slog.Logger) Middleware {
 	if base == nil {
 		base = slog.Default()
@@ -102,7 +115,10 @@ func Recover(base *slog.Logger) Middleware {
 				if v := recover(); v != nil {
 					l := LoggerFromContext(r.Context(), base)
 					l.Error("panic in handler", "panic", fmt.Sprint(v), "stack", string(debug.Stack()))
-					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					if id, ok := RequestIDFromContext(r.Context()); ok {
+						w.Header().Set(RequestIDHeader, id)
+					}
+					RespondError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 				}
 			}()
 			next.ServeHTTP(w, r)
@@ -110,8 +126,125 @@ func Recover(base *slog.Logger) Middleware {
 	}
 }
 
+// SkipPaths returns mw applied to every request except those for one of paths,
+// which go straight to the next handler. It keeps e.g. scrape or probe
+// endpoints out of the access logs.
+func SkipPaths(mw Middleware, paths ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(paths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CORSOptions configures the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to call the service, e.g.
+	// "https://app.example.com". "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedMethods answers preflight requests; empty allows the methods the
+	// service uses.
+	AllowedMethods []string
+	// AllowedHeaders answers preflight requests; empty allows whatever request
+	// headers the preflight asks for.
+	AllowedHeaders []string
+	// ExposedHeaders are response headers the browser lets scripts read, beyond
+	// the CORS-safelisted ones.
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and credentials to origins
+	// that are listed explicitly; it is never granted through "*".
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight answer, 0 leaves it to
+	// the browser.
+	MaxAge time.Duration
+}
+
+// defaultCORSMethods are allowed when CORSOptions.AllowedMethods is empty.
+var defaultCORSMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// CORS lets browsers call the service from the allowed origins. A request from
+// an allowed origin gets that origin echoed back in Access-Control-Allow-Origin,
+// or "*" when any origin is allowed and credentials are not. Preflight requests
+// (OPTIONS with Access-Control-Request-Method) are answered 204 here and never
+// reach next; from an origin that is not allowed they get no CORS headers, so
+// the browser blocks the actual request.
+func CORS(opts CORSOptions) Middleware {
+	anyOrigin := slices.Contains(opts.AllowedOrigins, "*")
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+
+	allowed := func(origin string) (allowOrigin string, credentials bool) {
+		if slices.Contains(opts.AllowedOrigins, origin) {
+			return origin, opts.AllowCredentials
+		}
+		if anyOrigin {
+			return "*", false
+		}
+		return "", false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			h := w.Header()
+			// The answer depends on the origin unless every origin gets "*".
+			if !anyOrigin || opts.AllowCredentials {
+				h.Add("Vary", "Origin")
+			}
+			allowOrigin, credentials := allowed(origin)
+			if origin != "" && allowOrigin != "" {
+				h.Set("Access-Control-Allow-Origin", allowOrigin)
+				if credentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if !preflight {
+				if origin != "" && allowOrigin != "" && len(opts.ExposedHeaders) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			if origin != "" && allowOrigin != "" {
+				h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				headers := r.Header.Get("Access-Control-Request-Headers")
+				if len(opts.AllowedHeaders) > 0 {
+					headers = strings.Join(opts.AllowedHeaders, ", ")
+				}
+				if headers != "" {
+					h.Set("Access-Control-Allow-Headers", headers)
+				}
+				if opts.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// LogAttrs returns extra attributes to add to the access log line of r.
+type LogAttrs func(r *http.Request) []slog.Attr
+
 // AccessLog emits a single log line per request with method/path/status/duration.
-func AccessLog(base *slog.Logger) Middleware {
+// Optional attrs callbacks run once per request, after the handler, and append
+// their attributes to the line.
+func AccessLog(base *slog.Logger, attrs ...LogAttrs) Middleware {
 	if base == nil {
 		base = slog.Default()
 	}
@@ -125,15 +258,63 @@ func AccessLog(base *slog.Logger) Middleware {
 
 			l := LoggerFromContext(r.Context(), base)
 
-			l.Info(
-				"http request",
+			args := []any{
 				"method", r.Method,
 				"path", r.URL.Path,
 				"status", rec.status,
 				"bytes", rec.bytes,
 				"duration_ms", time.Since(start).Milliseconds(),
 				"remote_ip", remoteIP(r),
-			)
+			}
+			for _, fn := range attrs {
+				if fn == nil {
+					continue
+				}
+				for _, a := range fn(r) {
+					args = append(args, a)
+				}
+			}
+
+			l.Info("http request", args...)
+		})
+	}
+}
+
+// clfTimeLayout is the timestamp layout of the Common Log Format.
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogCLF writes one Common Log Format line per request to w, for log
+// pipelines that expect it rather than structured output:
+//
+//	host - - [10/Oct/2000:13:55:36 -0700] "GET /graph HTTP/1.1" 200 2326
+//
+// It can be used alongside AccessLog. A nil w disables it.
+func AccessLogCLF(w io.Writer) Middleware {
+	if w == nil {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	// Lines are written whole under the lock, so concurrent requests never
+	// interleave.
+	var mu sync.Mutex
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+
+			next.ServeHTTP(rec, r)
+
+			size := "-"
+			if rec.bytes > 0 {
+				size = fmt.Sprint(rec.bytes)
+			}
+			line := fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s\n",
+				remoteIP(r), start.Format(clfTimeLayout), r.Method, r.URL.RequestURI(), r.Proto, rec.status, size)
+
+			mu.Lock()
+			defer mu.Unlock()
+			_, _ = io.WriteString(w, line)
 		})
 	}
 }
@@ -155,6 +336,12 @@ func (r *statusRecorder) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController, so handlers
+// can still flush or set deadlines through the recorder.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func newRequestID() string {
 	var b [16]byte
 	if _, err := rand.Read(b[:]); err != nil {
@@ -2,10 +2,14 @@ package foundation
 
 import (
 	"bytes"
+	"encoding/json"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestWithRequestID(t *testing.T) {
@@ -28,6 +32,43 @@ func TestWithRequestID(t *testing.T) {
 	}
 }
 
+func TestRecoverRespondsJSON(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	h := WrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), WithRequestID, WithLogger(logger), Recover(logger))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/graph", nil)
+	req.Header.Set("X-Request-Id", "req-42")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if got := rr.Header().Get("X-Request-Id"); got != "req-42" {
+		t.Errorf("X-Request-Id = %q, want req-42", got)
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body.Error != "Internal Server Error" {
+		t.Errorf("body error = %q (%v), want Internal Server Error", body.Error, err)
+	}
+
+	log := buf.String()
+	if !strings.Contains(log, `"request_id":"req-42"`) || !strings.Contains(log, `"panic":"boom"`) || !strings.Contains(log, `"stack":"goroutine`) {
+		t.Errorf("log = %s, want the panic and its stack under the request id", log)
+	}
+}
+
 func TestAccessLogEmitsStatus(t *testing.T) {
 	t.Parallel()
 
@@ -60,3 +101,250 @@ func TestAccessLogEmitsStatus(t *testing.T) {
 		t.Fatalf("expected access log line to contain status, got %s", string(last))
 	}
 }
+
+func TestAccessLogCLF(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string // expected line, after the timestamp
+	}{
+		{
+			name: "body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte("hello"))
+			},
+			want: `"POST /graph?pretty=true HTTP/1.1" 201 5`,
+		},
+		{
+			name: "no body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			want: `"POST /graph?pretty=true HTTP/1.1" 204 -`,
+		},
+	}
+
+	line := regexp.MustCompile(`^192\.0\.2\.1 - - \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] (.*)\n$`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			h := AccessLogCLF(&buf)(tt.handler)
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/graph?pretty=true", nil)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			m := line.FindStringSubmatch(buf.String())
+			if m == nil {
+				t.Fatalf("line = %q, want a Common Log Format line", buf.String())
+			}
+			if m[1] != tt.want {
+				t.Fatalf("request and status = %q, want %q", m[1], tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessLogExtraAttrs(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h = AccessLog(logger, nil, func(r *http.Request) []slog.Attr {
+		return []slog.Attr{slog.Int("islands", 7)}
+	})(h)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/graph", nil)
+	h.ServeHTTP(rr, req)
+
+	line := bytes.TrimSpace(buf.Bytes())
+	if !bytes.Contains(line, []byte(`"islands":7`)) {
+		t.Fatalf("expected access log line to contain injected attribute, got %s", string(line))
+	}
+	if !bytes.Contains(line, []byte(`"status":204`)) {
+		t.Fatalf("expected access log line to keep the default attributes, got %s", string(line))
+	}
+}
+
+func TestSkipPaths(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	h := SkipPaths(AccessLog(logger), "/metrics")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, path := range []string{"/metrics", "/graph", "/metrics/extra"} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.test"+path, nil))
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("%s: status = %d, want %d", path, rr.Code, http.StatusNoContent)
+		}
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 || bytes.Contains(buf.Bytes(), []byte(`"path":"/metrics"`)) {
+		t.Fatalf("access log = %s, want only /graph and /metrics/extra", buf.String())
+	}
+}
+
+func TestCORS(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		opts        CORSOptions
+		method      string
+		headers     map[string]string
+		wantStatus  int
+		wantHeaders map[string]string // "" means absent
+	}{
+		{
+			name:       "listed origin is echoed",
+			opts:       CORSOptions{AllowedOrigins: []string{"https://app.example"}, ExposedHeaders: []string{"X-State-Version"}},
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://app.example"},
+			wantStatus: http.StatusTeapot,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Expose-Headers":    "X-State-Version",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:        "unlisted origin gets no CORS headers",
+			opts:        CORSOptions{AllowedOrigins: []string{"https://app.example"}},
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://evil.example"},
+			wantStatus:  http.StatusTeapot,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "wildcard answers any origin with a star",
+			opts:        CORSOptions{AllowedOrigins: []string{"*"}},
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://any.example"},
+			wantStatus:  http.StatusTeapot,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "*", "Vary": ""},
+		},
+		{
+			name:       "credentials only for listed origins",
+			opts:       CORSOptions{AllowedOrigins: []string{"*", "https://app.example"}, AllowCredentials: true},
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://app.example"},
+			wantStatus: http.StatusTeapot,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name:       "credentials not granted through the wildcard",
+			opts:       CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://any.example"},
+			wantStatus: http.StatusTeapot,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name:   "preflight is answered without the handler",
+			opts:   CORSOptions{AllowedOrigins: []string{"https://app.example"}, MaxAge: 10 * time.Minute},
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example",
+				"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers": "content-type",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:   "preflight with configured methods and headers",
+			opts:   CORSOptions{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, AllowedHeaders: []string{"Content-Type", "Authorization"}},
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://any.example",
+				"Access-Control-Request-Method": "GET",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "GET",
+				"Access-Control-Allow-Headers": "Content-Type, Authorization",
+				"Access-Control-Max-Age":       "",
+			},
+		},
+		{
+			name:   "preflight from an unlisted origin",
+			opts:   CORSOptions{AllowedOrigins: []string{"https://app.example"}},
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://evil.example",
+				"Access-Control-Request-Method": "POST",
+			},
+			wantStatus:  http.StatusNoContent,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:        "plain OPTIONS reaches the handler",
+			opts:        CORSOptions{AllowedOrigins: []string{"*"}},
+			method:      http.MethodOptions,
+			headers:     map[string]string{"Origin": "https://any.example"},
+			wantStatus:  http.StatusTeapot,
+			wantHeaders: map[string]string{"Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:        "same-origin request is left alone",
+			opts:        CORSOptions{AllowedOrigins: []string{"*"}},
+			method:      http.MethodGet,
+			wantStatus:  http.StatusTeapot,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := WrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}), CORS(tt.opts))
+
+			req := httptest.NewRequest(tt.method, "http://example.test/graph", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			for k, want := range tt.wantHeaders {
+				if got := rr.Header().Get(k); got != want {
+					t.Errorf("%s = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package foundation
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// msgpackEncoder writes MessagePack. It walks the Go value rather than its
+// JSON, so the wire type of a field follows its Go type: a float64 holding 4
+// is still a float. The JSON rules for the shape of the document are kept:
+// struct tags name and omit fields, embedded structs are inlined, map keys
+// are sorted, []byte is a base64 string, and json.Marshaler and
+// encoding.TextMarshaler implementations apply. The JSON written by a
+// json.Marshaler carries no Go types: its numbers are encoded as 64-bit
+// floats.
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) ContentType() string { return "application/msgpack" }
+
+func (msgpackEncoder) Encode(w io.Writer, v any) error {
+	var buf bytes.Buffer
+	if err := writeMsgpack(&buf, reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// writeMsgpack appends the MessagePack encoding of v to buf.
+func writeMsgpack(buf *bytes.Buffer, v reflect.Value) error {
+	if v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() == reflect.Pointer && v.IsNil() {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+	// Like encoding/json, a method with a pointer receiver applies to
+	// addressable values.
+	if v.Kind() != reflect.Pointer && v.CanAddr() && reflect.PointerTo(v.Type()).Implements(jsonMarshalerType) {
+		v = v.Addr()
+	}
+	if v.Type().Implements(jsonMarshalerType) {
+		return writeMsgpackMarshaler(buf, v.Interface().(json.Marshaler))
+	}
+	if v.Kind() != reflect.Pointer && v.CanAddr() && reflect.PointerTo(v.Type()).Implements(textMarshalerType) {
+		v = v.Addr()
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		writeMsgpackString(buf, string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeMsgpackInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeMsgpackUint(buf, v.Uint())
+	case reflect.Float32:
+		buf.WriteByte(0xca)
+		buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(float32(v.Float()))))
+	case reflect.Float64:
+		writeMsgpackFloat(buf, v.Float())
+	case reflect.String:
+		writeMsgpackString(buf, v.String())
+	case reflect.Pointer:
+		return writeMsgpack(buf, v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			writeMsgpackString(buf, base64.StdEncoding.EncodeToString(v.Bytes()))
+			return nil
+		}
+		return writeMsgpackArray(buf, v)
+	case reflect.Array:
+		return writeMsgpackArray(buf, v)
+	case reflect.Map:
+		return writeMsgpackMap(buf, v)
+	case reflect.Struct:
+		return writeMsgpackStruct(buf, v)
+	default:
+		return &json.UnsupportedTypeError{Type: v.Type()}
+	}
+	return nil
+}
+
+// writeMsgpackMarshaler appends the JSON document m marshals to.
+func writeMsgpackMarshaler(buf *bytes.Buffer, m json.Marshaler) error {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return writeMsgpack(buf, reflect.ValueOf(doc))
+}
+
+// writeMsgpackArray appends the elements of the slice or array v.
+func writeMsgpackArray(buf *bytes.Buffer, v reflect.Value) error {
+	writeMsgpackHeader(buf, v.Len(), 0x90, 0xdc, 0xdd)
+	for i := range v.Len() {
+		if err := writeMsgpack(buf, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMsgpackMap appends the map v with its keys sorted, named as
+// encoding/json names them.
+func writeMsgpackMap(buf *bytes.Buffer, v reflect.Value) error {
+	if v.IsNil() {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	for iter := v.MapRange(); iter.Next(); {
+		key, err := msgpackMapKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{key: key, value: iter.Value()})
+	}
+	slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.key, b.key) })
+
+	writeMsgpackHeader(buf, len(entries), 0x80, 0xde, 0xdf)
+	for _, e := range entries {
+		writeMsgpackString(buf, e.key)
+		if err := writeMsgpack(buf, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msgpackMapKey returns the object key of the map key k.
+func msgpackMapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", &json.UnsupportedTypeError{Type: k.Type()}
+}
+
+// writeMsgpackStruct appends the fields of the struct v that JSON would write.
+func writeMsgpackStruct(buf *bytes.Buffer, v reflect.Value) error {
+	var (
+		fields bytes.Buffer
+		n      int
+	)
+	for _, f := range msgpackFields(v.Type()) {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || f.omitEmpty && isEmptyValue(fv) || f.omitZero && fv.IsZero() {
+			continue
+		}
+		writeMsgpackString(&fields, f.name)
+		if err := writeMsgpack(&fields, fv); err != nil {
+			return err
+		}
+		n++
+	}
+	writeMsgpackHeader(buf, n, 0x80, 0xde, 0xdf)
+	buf.Write(fields.Bytes())
+	return nil
+}
+
+// msgpackField is a struct field as encoding/json writes it.
+type msgpackField struct {
+	name      string
+	index     []int
+	tagged    bool
+	omitEmpty bool
+	omitZero  bool
+}
+
+// msgpackFieldCache maps a struct type to its []msgpackField.
+var msgpackFieldCache sync.Map
+
+// msgpackFields returns the fields of the struct type t in JSON order, with
+// the fields of embedded structs inlined. As in encoding/json, of the fields
+// sharing a name the shallowest wins, a tagged one among equals, and a tie
+// drops them all.
+func msgpackFields(t reflect.Type) []msgpackField {
+	if f, ok := msgpackFieldCache.Load(t); ok {
+		return f.([]msgpackField)
+	}
+
+	var all []msgpackField
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := range t.NumField() {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			idx := append(slices.Clip(index), i)
+
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft, idx)
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+			f := msgpackField{name: name, index: idx, tagged: name != ""}
+			if f.name == "" {
+				f.name = sf.Name
+			}
+			for opt := range strings.SplitSeq(opts, ",") {
+				f.omitEmpty = f.omitEmpty || opt == "omitempty"
+				f.omitZero = f.omitZero || opt == "omitzero"
+			}
+			all = append(all, f)
+		}
+	}
+	walk(t, nil)
+
+	fields := make([]msgpackField, 0, len(all))
+	for _, f := range all {
+		if dominantField(all, f) {
+			fields = append(fields, f)
+		}
+	}
+	msgpackFieldCache.Store(t, fields)
+	return fields
+}
+
+// dominantField reports whether f is the field JSON writes for its name.
+func dominantField(all []msgpackField, f msgpackField) bool {
+	for _, other := range all {
+		if other.name != f.name || slices.Equal(other.index, f.index) {
+			continue
+		}
+		switch {
+		case len(other.index) < len(f.index):
+			return false
+		case len(other.index) == len(f.index) && other.tagged == f.tagged:
+			return false
+		case len(other.index) == len(f.index) && other.tagged:
+			return false
+		}
+	}
+	return true
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, reporting false where a nil
+// embedded pointer leaves the field out.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyValue reports whether v is empty as the omitempty option means it.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// writeMsgpackInt appends i as the smallest MessagePack integer holding it.
+func writeMsgpackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		writeMsgpackUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		buf.Write([]byte{0xd0, byte(i)})
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	default:
+		buf.WriteByte(0xd3)
+		buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
+
+// writeMsgpackUint appends u as the smallest MessagePack integer holding it.
+func writeMsgpackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= math.MaxInt8:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.Write([]byte{0xcc, byte(u)})
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(u)))
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(u)))
+	default:
+		buf.WriteByte(0xcf)
+		buf.Write(binary.BigEndian.AppendUint64(nil, u))
+	}
+}
+
+// writeMsgpackFloat appends f as a 64-bit float. JSON has no encoding for
+// NaN or the infinities, MessagePack does.
+func writeMsgpackFloat(buf *bytes.Buffer, f float64) {
+	buf.WriteByte(0xcb)
+	buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+// writeMsgpackString appends s as a MessagePack str.
+func writeMsgpackString(buf *bytes.Buffer, s string) {
+	switch n := len(s); {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{0xd9, byte(n)})
+	default:
+		writeMsgpackHeader(buf, n, 0, 0xda, 0xdb)
+	}
+	buf.WriteString(s)
+}
+
+// writeMsgpackHeader appends the header of a MessagePack value of length n:
+// the fix byte for up to 15 elements, or the 16- or 32-bit form. A fix byte of
+// 0 skips the fix form.
+func writeMsgpackHeader(buf *bytes.Buffer, n int, fix, b16, b32 byte) {
+	switch {
+	case fix != 0 && n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(b16)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		buf.WriteByte(b32)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
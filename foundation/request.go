@@ -1,39 +1,235 @@
 package foundation
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
-const maxBodySize = 1 << 20 // 1 MB
+// DefaultMaxBodySize is the request body size limit of Decode, unless
+// MaxBodySize sets another one.
+const DefaultMaxBodySize = 1 << 20 // 1 MB
+
+// ErrBodyTooLarge is returned, wrapped, by Decode when the request body exceeds
+// the size limit. The *http.MaxBytesError that tripped is wrapped as well.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// ErrEmptyBody is returned by Decode when the request has no body, or one of
+// whitespace only, as when a client retries without resending it.
+var ErrEmptyBody = errors.New("request: empty body")
+
+// MaxBodySize sets the request body size limit Decode applies to the requests
+// it wraps, in bytes.
+func MaxBodySize(limit int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), maxBodySizeKey, limit)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// maxBodySizeOf returns the body size limit set by MaxBodySize, or the default.
+func maxBodySizeOf(ctx context.Context) int64 {
+	if limit, ok := ctx.Value(maxBodySizeKey).(int64); ok {
+		return limit
+	}
+	return DefaultMaxBodySize
+}
+
+// DecodeErrorKind tells why a request body is not a valid JSON payload.
+type DecodeErrorKind int
+
+const (
+	// DecodeSyntax is malformed or truncated JSON.
+	DecodeSyntax DecodeErrorKind = iota + 1
+	// DecodeUnknownField is a field the payload does not have.
+	DecodeUnknownField
+	// DecodeTypeMismatch is a value of the wrong JSON type for its field.
+	DecodeTypeMismatch
+	// DecodeMultipleValues is a body with more than one JSON value.
+	DecodeMultipleValues
+)
+
+// DecodeError is returned, wrapped, by Decode when the request body is not a
+// valid JSON payload. Its message is meant to be shown to clients.
+type DecodeError struct {
+	Kind   DecodeErrorKind
+	Field  string // offending field as a dotted path from the top level, array indices included; empty for the whole body or other kinds
+	Offset int64  // byte offset in the body where decoding failed, -1 when unknown
+	Err    error  // error of the JSON decoder, nil for multiple values
+}
+
+func (e *DecodeError) Error() string {
+	switch e.Kind {
+	case DecodeSyntax:
+		var syntax *json.SyntaxError
+		if errors.As(e.Err, &syntax) {
+			return fmt.Sprintf("invalid JSON at byte %d: %s", e.Offset, syntax)
+		}
+		return "invalid JSON: unexpected end of input"
+	case DecodeUnknownField:
+		return fmt.Sprintf("unknown field %q", e.Field)
+	case DecodeTypeMismatch:
+		var typeErr *json.UnmarshalTypeError
+		errors.As(e.Err, &typeErr)
+		want, got := jsonTypeName(typeErr.Type), typeErr.Value
+		// Numbers out of range are reported as "number 300".
+		got, _, _ = strings.Cut(got, " ")
+		switch got {
+		case "bool":
+			got = "a boolean"
+		case "array", "object":
+			got = "an " + got
+		default:
+			got = "a " + got
+		}
+		if e.Field == "" {
+			return fmt.Sprintf("body must be %s, not %s", want, got)
+		}
+		return fmt.Sprintf("field %q must be %s, not %s", e.Field, want, got)
+	case DecodeMultipleValues:
+		return "body must contain a single JSON value"
+	}
+	return "invalid JSON payload"
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// jsonTypeName returns the JSON type, with its article, that decodes into t.
+func jsonTypeName(t reflect.Type) string {
+	if t == nil {
+		return "a valid value"
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Pointer:
+		return jsonTypeName(t.Elem())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return "a valid value"
+}
 
 // Decode reads and decodes the JSON body of an HTTP request into a value of T.
 // It limits the request body size, disallows unknown JSON fields, and rejects
-// bodies containing more than a single JSON value.
+// bodies containing more than a single JSON value. An empty body yields
+// ErrEmptyBody, and any other body that is not a valid payload a *DecodeError
+// telling which field or position broke.
 func Decode[T any](w http.ResponseWriter, r *http.Request) (T, error) {
-	body := http.MaxBytesReader(w, r.Body, maxBodySize)
+	var data T
+	if r.Body == nil || r.Body == http.NoBody {
+		return data, ErrEmptyBody
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxBodySizeOf(r.Context()))
 	defer body.Close()
 
 	dec := json.NewDecoder(body)
 	dec.DisallowUnknownFields()
 
-	var data T
 	if err := dec.Decode(&data); err != nil {
-		return data, fmt.Errorf("request: decode: %w", err)
+		return data, decodeError(err)
 	}
 
 	// Ensure there is exactly one JSON value in the request body.
 	// json.Decoder permits multiple values by default (e.g. "{}{}"), which we treat
-	// as invalid input.
+	// as invalid input. Trailing whitespace is skipped and still yields io.EOF.
 	var trailing struct{}
 	if err := dec.Decode(&trailing); err != io.EOF {
 		if err == nil {
-			return data, fmt.Errorf("request: decode: body must contain a single JSON value")
+			return data, fmt.Errorf("request: decode: %w", &DecodeError{Kind: DecodeMultipleValues, Offset: -1})
 		}
-		return data, fmt.Errorf("request: decode: %w", err)
+		return data, decodeError(err)
 	}
 
 	return data, nil
 }
+
+// DecodeCSV reads the CSV body of an HTTP request, limiting its size like
+// Decode. Records may have any number of fields, and leading spaces of fields
+// are trimmed. Lines that are not valid CSV, such as ones with a stray quote,
+// are skipped rather than failing the request; only a read error, like a body
+// over the size limit, is returned.
+func DecodeCSV(w http.ResponseWriter, r *http.Request) ([][]string, error) {
+	body := http.MaxBytesReader(w, r.Body, maxBodySizeOf(r.Context()))
+	defer body.Close()
+
+	cr := csv.NewReader(body)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	records := [][]string{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			continue
+		}
+		if err != nil {
+			return records, decodeError(err)
+		}
+		records = append(records, record)
+	}
+}
+
+// decodeError wraps an error of the JSON decoder, telling a body cut off by the
+// size limit apart from malformed JSON, and classifying the latter in a
+// *DecodeError.
+func decodeError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return fmt.Errorf("request: decode: %w: %w", ErrBodyTooLarge, err)
+	}
+
+	var (
+		syntax  *json.SyntaxError
+		typeErr *json.UnmarshalTypeError
+		decErr  *DecodeError
+	)
+	switch {
+	case errors.As(err, &syntax):
+		decErr = &DecodeError{Kind: DecodeSyntax, Offset: syntax.Offset, Err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		decErr = &DecodeError{Kind: DecodeSyntax, Offset: -1, Err: err}
+	case errors.Is(err, io.EOF):
+		// Nothing but whitespace before the end of the body.
+		return ErrEmptyBody
+	case errors.As(err, &typeErr):
+		decErr = &DecodeError{Kind: DecodeTypeMismatch, Field: typeErr.Field, Offset: typeErr.Offset, Err: err}
+	default:
+		// DisallowUnknownFields reports unknown fields with an untyped error.
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			if name, err := strconv.Unquote(field); err == nil {
+				field = name
+			}
+			decErr = &DecodeError{Kind: DecodeUnknownField, Field: field, Offset: -1, Err: err}
+		}
+	}
+	if decErr != nil {
+		return fmt.Errorf("request: decode: %w", decErr)
+	}
+	return fmt.Errorf("request: decode: %w", err)
+}
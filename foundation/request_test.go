@@ -0,0 +1,182 @@
+package foundation
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSingleValue(t *testing.T) {
+	t.Parallel()
+
+	type payload struct {
+		Node string `json:"node"`
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{name: "single value", body: `{}`},
+		{name: "trailing whitespace", body: "{}  \n"},
+		{name: "leading and trailing whitespace", body: "\r\n\t{\"node\":\"A\"}\n\n"},
+		{name: "second object", body: `{}{}`, wantErr: true},
+		{name: "second object after whitespace", body: "{}\n{}", wantErr: true},
+		{name: "trailing garbage", body: `{} garbage`, wantErr: true},
+		{name: "trailing scalar", body: `{} 5`, wantErr: true},
+		{name: "trailing array", body: `{} []`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("POST", "http://example.test/", strings.NewReader(tt.body))
+			_, err := Decode[payload](httptest.NewRecorder(), req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode(%q) error = %v, wantErr %v", tt.body, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	t.Parallel()
+
+	type payload struct {
+		Nodes []string   `json:"nodes"`
+		Edges [][]string `json:"edges"`
+		Sub   struct {
+			Count int `json:"count"`
+		} `json:"sub"`
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantKind   DecodeErrorKind
+		wantField  string
+		wantOffset int64
+		wantMsg    string
+	}{
+		{name: "syntax error", body: `{"nodes": x}`, wantKind: DecodeSyntax, wantOffset: 11, wantMsg: "invalid JSON at byte 11: invalid character 'x' looking for beginning of value"},
+		{name: "truncated", body: `{"nodes":`, wantKind: DecodeSyntax, wantOffset: -1, wantMsg: "invalid JSON: unexpected end of input"},
+		{name: "trailing garbage", body: `{} garbage`, wantKind: DecodeSyntax, wantOffset: 4, wantMsg: "invalid JSON at byte 4: invalid character 'g' looking for beginning of value"},
+		{name: "unknown field", body: `{"edgess":[]}`, wantKind: DecodeUnknownField, wantField: "edgess", wantOffset: -1, wantMsg: `unknown field "edgess"`},
+		{name: "type mismatch", body: `{"nodes":"A"}`, wantKind: DecodeTypeMismatch, wantField: "nodes", wantOffset: 12, wantMsg: `field "nodes" must be an array, not a string`},
+		{name: "nested type mismatch", body: `{"sub":{"count":1.5}}`, wantKind: DecodeTypeMismatch, wantField: "sub.count", wantOffset: 19, wantMsg: `field "sub.count" must be an integer, not a number`},
+		{name: "wrong body type", body: `[]`, wantKind: DecodeTypeMismatch, wantOffset: 1, wantMsg: "body must be an object, not an array"},
+		{name: "two values", body: `{}{}`, wantKind: DecodeMultipleValues, wantOffset: -1, wantMsg: "body must contain a single JSON value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("POST", "http://example.test/", strings.NewReader(tt.body))
+			_, err := Decode[payload](httptest.NewRecorder(), req)
+
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("Decode(%q) error = %v, want a *DecodeError", tt.body, err)
+			}
+			if decodeErr.Kind != tt.wantKind || decodeErr.Field != tt.wantField || decodeErr.Offset != tt.wantOffset {
+				t.Errorf("DecodeError = {Kind: %d, Field: %q, Offset: %d}, want {Kind: %d, Field: %q, Offset: %d}",
+					decodeErr.Kind, decodeErr.Field, decodeErr.Offset, tt.wantKind, tt.wantField, tt.wantOffset)
+			}
+			if got := decodeErr.Error(); got != tt.wantMsg {
+				t.Errorf("message = %q, want %q", got, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestDecodeEmptyBody(t *testing.T) {
+	t.Parallel()
+
+	type payload struct {
+		Node string `json:"node"`
+	}
+
+	tests := []struct {
+		name string
+		body io.Reader
+	}{
+		{name: "no body", body: nil},
+		{name: "empty body", body: strings.NewReader("")},
+		{name: "whitespace only", body: strings.NewReader(" \r\n\t\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("POST", "http://example.test/", tt.body)
+			_, err := Decode[payload](httptest.NewRecorder(), req)
+			if !errors.Is(err, ErrEmptyBody) {
+				t.Fatalf("Decode error = %v, want %v", err, ErrEmptyBody)
+			}
+			var decodeErr *DecodeError
+			if errors.As(err, &decodeErr) {
+				t.Errorf("Decode error = %v, want no *DecodeError for an empty body", err)
+			}
+		})
+	}
+}
+
+func TestDecodeBodySizeLimit(t *testing.T) {
+	t.Parallel()
+
+	type payload struct {
+		Nodes []string `json:"nodes"`
+	}
+	// A valid payload of about size bytes.
+	body := func(size int) string {
+		return `{"nodes":["` + strings.Repeat("A", size-14) + `"]}`
+	}
+
+	tests := []struct {
+		name      string
+		limit     int64 // 0 keeps the default
+		body      string
+		wantErr   bool
+		wantLarge bool
+	}{
+		{name: "default limit", body: body(DefaultMaxBodySize)},
+		{name: "over the default limit", body: body(DefaultMaxBodySize + 1), wantErr: true, wantLarge: true},
+		{name: "raised limit", limit: 4 << 20, body: body(DefaultMaxBodySize + 1)},
+		{name: "lowered limit", limit: 16, body: `{"nodes":["A","B","C"]}`, wantErr: true, wantLarge: true},
+		{name: "trailing value over the limit", limit: 16, body: `{"nodes":[]}    {}`, wantErr: true, wantLarge: true},
+		{name: "malformed within the limit", body: `{"nodes":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var err error
+			var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, err = Decode[payload](w, r)
+			})
+			if tt.limit > 0 {
+				h = MaxBodySize(tt.limit)(h)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "http://example.test/graph", strings.NewReader(tt.body)))
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, ErrBodyTooLarge); got != tt.wantLarge {
+				t.Errorf("errors.Is(%v, ErrBodyTooLarge) = %v, want %v", err, got, tt.wantLarge)
+			}
+			var maxBytes *http.MaxBytesError
+			if got := errors.As(err, &maxBytes); got != tt.wantLarge {
+				t.Errorf("errors.As(%v, *http.MaxBytesError) = %v, want %v", err, got, tt.wantLarge)
+			}
+		})
+	}
+}
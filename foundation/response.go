@@ -1,25 +1,118 @@
 package foundation
 
 import (
-	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 // NoResponse tells the Respond function to not respond to the request. In these
 // cases the app layer code has already done so.
 type NoResponse struct{}
 
-// Respond sends a response to the client.
+// Respond sends a response to the client, encoded as negotiated by
+// NegotiateEncoding.
 func Respond(w http.ResponseWriter, code int, v any) {
 	if _, ok := v.(NoResponse); ok {
 		w.WriteHeader(code)
 		return
 	}
+	if e, ok := v.(ErrorResponse); ok && e.RequestID == "" {
+		e.RequestID = w.Header().Get(RequestIDHeader)
+		v = e
+	}
+
+	enc := EncoderFor(w)
+	if enc == JSONEncoder && isPretty(w) {
+		enc = jsonEncoder{indent: true}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", enc.ContentType())
 	w.WriteHeader(code)
-	if err := json.NewEncoder(w).Encode(v); err != nil {
+	if err := enc.Encode(w, v); err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 }
+
+// ErrorResponse is the JSON body of error responses. Respond fills RequestID
+// in from the RequestIDHeader of the response, set by WithRequestID, so clients
+// can quote it; it is omitted when the response has no ID.
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// NewErrorResponse returns the error body for msg with the request ID of w
+// filled in, for bodies that embed it, which Respond cannot fill in itself.
+func NewErrorResponse(w http.ResponseWriter, msg string) ErrorResponse {
+	return ErrorResponse{Error: msg, RequestID: w.Header().Get(RequestIDHeader)}
+}
+
+// RespondError sends an error response with msg in the ErrorResponse shape.
+func RespondError(w http.ResponseWriter, code int, msg string) {
+	Respond(w, code, ErrorResponse{Error: msg})
+}
+
+// PrettyJSON makes Respond indent the JSON body of requests sent with
+// ?pretty=true, for reading responses by hand. Any other value keeps the
+// default compact output.
+func PrettyJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+			w = &prettyWriter{ResponseWriter: w}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// prettyWriter marks a response whose JSON body should be indented.
+type prettyWriter struct {
+	http.ResponseWriter
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (p *prettyWriter) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}
+
+// isPretty reports whether w, or a writer it wraps, is a prettyWriter.
+func isPretty(w http.ResponseWriter) bool {
+	for w != nil {
+		if _, ok := w.(*prettyWriter); ok {
+			return true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+	return false
+}
+
+// NotModified sets the ETag header of the response to etag, a quoted strong
+// entity tag, and reports whether the request's If-None-Match header matches
+// it. When it does, the 304 Not Modified response has been sent and the caller
+// must not write a body.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether the If-None-Match header value matches etag. As
+// RFC 9110 requires for If-None-Match, weak tags compare equal to their strong
+// counterparts.
+func etagMatches(header, etag string) bool {
+	for tag := range strings.SplitSeq(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package foundation
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRespondPretty(t *testing.T) {
+	t.Parallel()
+
+	body := map[string]any{"islands": []any{[]any{"A", "B"}, []any{"C"}}, "total": 4.5}
+
+	// AccessLog wraps the pretty writer, as in the server middleware chain.
+	h := WrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Respond(w, http.StatusCreated, body)
+	}), PrettyJSON, AccessLog(nil))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.test"+path, nil))
+		return rr
+	}
+
+	compact := get("/")
+	pretty := get("/?pretty=true")
+
+	for name, rr := range map[string]*httptest.ResponseRecorder{"compact": compact, "pretty": pretty} {
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("%s status = %d, want %d", name, rr.Code, http.StatusCreated)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("%s Content-Type = %q, want application/json", name, ct)
+		}
+	}
+
+	if bytes.Contains(compact.Body.Bytes(), []byte("\n  ")) {
+		t.Fatalf("default output is indented: %s", compact.Body)
+	}
+	if !bytes.Contains(pretty.Body.Bytes(), []byte("\n  ")) {
+		t.Fatalf("pretty output is not indented: %s", pretty.Body)
+	}
+
+	var fromCompact, fromPretty any
+	if err := json.Unmarshal(compact.Body.Bytes(), &fromCompact); err != nil {
+		t.Fatalf("decode compact: %v", err)
+	}
+	if err := json.Unmarshal(pretty.Body.Bytes(), &fromPretty); err != nil {
+		t.Fatalf("decode pretty: %v", err)
+	}
+	if !reflect.DeepEqual(fromCompact, fromPretty) {
+		t.Fatalf("pretty = %v, want %v", fromPretty, fromCompact)
+	}
+
+	if rr := get("/?pretty=nope"); bytes.Contains(rr.Body.Bytes(), []byte("\n  ")) {
+		t.Fatalf("invalid pretty value indented the output: %s", rr.Body)
+	}
+}
+
+func TestRespondErrorCarriesRequestID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		requestID string // sent by the client, empty lets WithRequestID pick one
+		withID    bool   // whether WithRequestID runs
+		body      func(w http.ResponseWriter) any
+		want      string // with {id} for the request ID
+	}{
+		{
+			name:      "error body",
+			requestID: "req-1",
+			withID:    true,
+			body:      func(http.ResponseWriter) any { return ErrorResponse{Error: "nodes is required"} },
+			want:      `{"error":"nodes is required","request_id":"req-1"}`,
+		},
+		{
+			name:      "embedded error body",
+			requestID: "req-2",
+			withID:    true,
+			body: func(w http.ResponseWriter) any {
+				return struct {
+					ErrorResponse
+					Current float64 `json:"current"`
+				}{NewErrorResponse(w, "mismatch"), 3}
+			},
+			want: `{"error":"mismatch","request_id":"req-2","current":3}`,
+		},
+		{
+			name:   "generated request ID",
+			withID: true,
+			body:   func(http.ResponseWriter) any { return ErrorResponse{Error: "nope"} },
+			want:   `{"error":"nope","request_id":"{id}"}`,
+		},
+		{
+			name: "no request ID is omitted",
+			body: func(http.ResponseWriter) any { return ErrorResponse{Error: "nope"} },
+			want: `{"error":"nope"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Respond(w, http.StatusBadRequest, tt.body(w))
+			})
+			if tt.withID {
+				h = WithRequestID(h)
+			}
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", nil)
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			want := strings.ReplaceAll(tt.want, "{id}", rr.Header().Get(RequestIDHeader))
+			if got := strings.TrimSpace(rr.Body.String()); got != want {
+				t.Errorf("body = %s, want %s", got, want)
+			}
+		})
+	}
+}
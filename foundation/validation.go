@@ -1,16 +1,59 @@
 package foundation
 
 import (
+	"fmt"
 	"mime"
 	"net/http"
+	"slices"
+	"strings"
 )
 
 // RequireMethod enforces an HTTP method.
 func RequireMethod(method string) Middleware {
+	return RequireMethods(method)
+}
+
+// RequireMethods only lets requests with one of methods through. Others are
+// answered 405 with a JSON error and an Allow header listing methods, as RFC
+// 9110 requires.
+func RequireMethods(methods ...string) Middleware {
+	allow := strings.Join(methods, ", ")
+	return requireMethods(methods, func() string { return allow })
+}
+
+// AllowedMethods records the methods each path is served with, for the Allow
+// header of 405 responses: a path served by several routes, like a plain
+// pattern next to method-qualified ones, lists the methods of all of them.
+// Routes are recorded while they are registered, before serving.
+type AllowedMethods map[string][]string
+
+// Add records that path is served with methods.
+func (a AllowedMethods) Add(path string, methods ...string) {
+	for _, m := range methods {
+		if !slices.Contains(a[path], m) {
+			a[path] = append(a[path], m)
+		}
+	}
+}
+
+// RequireMethods is RequireMethods for a route serving path: it records
+// methods for path, and its Allow header lists every method recorded for path
+// by the time of the request.
+func (a AllowedMethods) RequireMethods(path string, methods ...string) Middleware {
+	a.Add(path, methods...)
+	return requireMethods(methods, func() string {
+		return strings.Join(slices.Sorted(slices.Values(a[path])), ", ")
+	})
+}
+
+// requireMethods answers requests whose method is not one of methods 405,
+// with allow() as the Allow header.
+func requireMethods(methods []string, allow func() string) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Method != method {
-				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			if !slices.Contains(methods, r.Method) {
+				w.Header().Set("Allow", allow())
+				RespondError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -18,16 +61,54 @@ func RequireMethod(method string) Middleware {
 	}
 }
 
-// RequireJSONContentType enforces an application/json Content-Type. It accepts
-// common parameters like charset=utf-8.
-func RequireJSONContentType(next http.Handler) http.Handler {
+// DiscardHeadBody answers HEAD requests with the headers and status next sets
+// for GET, dropping the body it writes. Content-Type is still set, so clients
+// can tell the format without fetching it.
+func DiscardHeadBody(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ct := r.Header.Get("Content-Type")
-		mediaType, _, err := mime.ParseMediaType(ct)
-		if err != nil || mediaType != "application/json" {
-			http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
-			return
+		if r.Method == http.MethodHead {
+			w = &headWriter{ResponseWriter: w}
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// headWriter drops the body written in reply to a HEAD request.
+type headWriter struct {
+	http.ResponseWriter
+}
+
+// Write reports p as written without sending it.
+func (h *headWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (h *headWriter) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
+
+// RequireJSONContentType enforces an application/json Content-Type, answering
+// 415 with a JSON error otherwise. It accepts common parameters like
+// charset=utf-8.
+func RequireJSONContentType(next http.Handler) http.Handler {
+	return RequireContentType("application/json")(next)
+}
+
+// RequireContentType only lets requests through whose Content-Type is one of
+// mediaTypes, answering 415 with a JSON error otherwise. Parameters like
+// charset=utf-8 are ignored.
+func RequireContentType(mediaTypes ...string) Middleware {
+	msg := "Content-Type must be " + strings.Join(mediaTypes, " or ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || !slices.Contains(mediaTypes, mediaType) {
+				RespondError(w, http.StatusUnsupportedMediaType, msg)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
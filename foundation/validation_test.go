@@ -0,0 +1,165 @@
+package foundation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireMethods(t *testing.T) {
+	t.Parallel()
+
+	// A path served by a POST route and a PATCH route registered after it.
+	allowed := AllowedMethods{}
+	graphPost := allowed.RequireMethods("/graph", http.MethodPost)
+	allowed.Add("/graph", http.MethodPatch)
+
+	tests := []struct {
+		name       string
+		mw         Middleware
+		method     string
+		wantStatus int
+		wantAllow  string
+	}{
+		{name: "single method allowed", mw: RequireMethod(http.MethodPost), method: http.MethodPost, wantStatus: http.StatusNoContent},
+		{name: "single method rejected", mw: RequireMethod(http.MethodPost), method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed, wantAllow: "POST"},
+		{name: "first of several", mw: RequireMethods(http.MethodGet, http.MethodHead), method: http.MethodGet, wantStatus: http.StatusNoContent},
+		{name: "second of several", mw: RequireMethods(http.MethodGet, http.MethodHead), method: http.MethodHead, wantStatus: http.StatusNoContent},
+		{name: "none of several", mw: RequireMethods(http.MethodGet, http.MethodPost), method: http.MethodDelete, wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, POST"},
+		{name: "route of a path", mw: graphPost, method: http.MethodPost, wantStatus: http.StatusNoContent},
+		{name: "every route of a path in Allow", mw: graphPost, method: http.MethodPut, wantStatus: http.StatusMethodNotAllowed, wantAllow: "PATCH, POST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := tt.mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(tt.method, "http://example.test/islands", nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed {
+				checkJSONError(t, rr, "method "+tt.method+" not allowed")
+			}
+		})
+	}
+}
+
+func TestRequireJSONContentType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		contentType string
+		wantStatus  int
+	}{
+		{contentType: "application/json", wantStatus: http.StatusNoContent},
+		{contentType: "application/json; charset=utf-8", wantStatus: http.StatusNoContent},
+		{contentType: "text/plain", wantStatus: http.StatusUnsupportedMediaType},
+		{contentType: "", wantStatus: http.StatusUnsupportedMediaType},
+		{contentType: "application/json;;", wantStatus: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			t.Parallel()
+
+			h := RequireJSONContentType(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", nil)
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnsupportedMediaType {
+				checkJSONError(t, rr, "Content-Type must be application/json")
+			}
+		})
+	}
+}
+
+func TestDiscardHeadBody(t *testing.T) {
+	t.Parallel()
+
+	h := DiscardHeadBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Respond(w, http.StatusOK, map[string]string{"status": "ok"})
+	}))
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, "http://example.test/healthz", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s status = %d, want %d", method, rr.Code, http.StatusOK)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s Content-Type = %q, want application/json", method, ct)
+		}
+		if empty := rr.Body.Len() == 0; empty != (method == http.MethodHead) {
+			t.Errorf("%s body = %q, want one only for GET", method, rr.Body)
+		}
+	}
+}
+
+func TestRequireContentType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		contentType string
+		wantStatus  int
+	}{
+		{contentType: "application/json", wantStatus: http.StatusNoContent},
+		{contentType: "text/csv; charset=utf-8", wantStatus: http.StatusNoContent},
+		{contentType: "text/plain", wantStatus: http.StatusUnsupportedMediaType},
+		{contentType: "", wantStatus: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			t.Parallel()
+
+			h := RequireContentType("application/json", "text/csv")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "http://example.test/graph", nil)
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnsupportedMediaType {
+				checkJSONError(t, rr, "Content-Type must be application/json or text/csv")
+			}
+		})
+	}
+}
+
+// checkJSONError fails unless rr holds a JSON {"error": want} body.
+func checkJSONError(t *testing.T, rr *httptest.ResponseRecorder, want string) {
+	t.Helper()
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not JSON: %v", rr.Body.String(), err)
+	}
+	if len(body) != 1 || body["error"] != want {
+		t.Errorf("body = %v, want only error %q", body, want)
+	}
+}